@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remote-agent-terminal/backend/internal/auth"
+)
+
+// AuthOptions configures AuthMiddleware.
+type AuthOptions struct {
+	// AllowQueryToken also accepts the token as a ?token= query parameter,
+	// for WebSocket and EventSource requests on which browsers cannot set
+	// an Authorization header.
+	AllowQueryToken bool
+}
+
+// AuthMiddleware returns a middleware that requires a bearer token verified by
+// verifier and sets the token's subject as the request's userID. Requests
+// without a valid token are rejected with 401 Unauthorized.
+func AuthMiddleware(verifier *auth.TokenVerifier, opts AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c.GetHeader("Authorization"))
+		if token == "" && opts.AllowQueryToken {
+			token = c.Query("token")
+		}
+
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			message := "Invalid token"
+			switch {
+			case errors.Is(err, auth.ErrTokenMissing):
+				message = "Bearer token is required"
+			case errors.Is(err, auth.ErrTokenExpired):
+				message = "Token has expired"
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			sendError(c, http.StatusUnauthorized, "UNAUTHORIZED", message)
+			c.Abort()
+			return
+		}
+
+		c.Set("userID", claims.Subject)
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header
+// value, or "" if it is not a bearer token.
+func bearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authHandlers returns the middleware that authenticates routes, or none if
+// verifier is nil and the routes are unauthenticated.
+func authHandlers(verifier *auth.TokenVerifier, opts AuthOptions) []gin.HandlerFunc {
+	if verifier == nil {
+		return nil
+	}
+	return []gin.HandlerFunc{AuthMiddleware(verifier, opts)}
+}
+
+// AccessLogger returns gin's request logger with the value of ?token= query
+// parameters replaced, so tokens sent by WebSocket and EventSource clients
+// do not end up in the access log. Lines are otherwise in gin's default
+// format.
+func AccessLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		var statusColor, methodColor, resetColor string
+		if param.IsOutputColor() {
+			statusColor = param.StatusCodeColor()
+			methodColor = param.MethodColor()
+			resetColor = param.ResetColor()
+		}
+		if param.Latency > time.Minute {
+			param.Latency = param.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, param.StatusCode, resetColor,
+			param.Latency,
+			param.ClientIP,
+			methodColor, param.Method, resetColor,
+			redactToken(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// redactToken replaces the values of token parameters in the query of a
+// logged request path.
+func redactToken(path string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		if key, _, _ := strings.Cut(param, "="); key == "token" {
+			params[i] = "token=REDACTED"
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
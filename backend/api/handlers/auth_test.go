@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remote-agent-terminal/backend/internal/auth"
+	"github.com/remote-agent-terminal/backend/internal/db"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+	"github.com/remote-agent-terminal/backend/internal/repository"
+	"github.com/remote-agent-terminal/backend/internal/session"
+)
+
+// TestRedactToken checks that query tokens are hidden from logged paths.
+func TestRedactToken(t *testing.T) {
+	tests := map[string]string{
+		"/api/sessions":                                  "/api/sessions",
+		"/api/sessions/x/attach?token=abc":               "/api/sessions/x/attach?token=REDACTED",
+		"/api/sessions/x/attach?since_seq=1&token=a.b.c": "/api/sessions/x/attach?since_seq=1&token=REDACTED",
+		"/api/sessions/x/attach?token=abc&mode=observer": "/api/sessions/x/attach?token=REDACTED&mode=observer",
+	}
+	for path, want := range tests {
+		if got := redactToken(path); got != want {
+			t.Errorf("redactToken(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// TestStatusQueryToken checks that the status stream accepts the token as a
+// query parameter, since EventSource cannot set headers.
+func TestStatusQueryToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tempDir := t.TempDir()
+
+	database, err := db.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer database.Close()
+
+	ptyManager := pty.NewManager(tempDir)
+	sessionManager := session.NewManager(ptyManager, repository.NewSessionRepository(database), session.Config{LogDir: tempDir})
+	defer sessionManager.Close()
+
+	sess, err := sessionManager.Create(context.Background(), &model.CreateSessionRequest{Command: "cat", UserID: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	secret := []byte("test-secret")
+	token, err := auth.SignToken(secret, auth.Claims{Subject: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	r := gin.New()
+	handler := NewSessionHandler(sessionManager)
+	handler.SetTokenVerifier(auth.NewTokenVerifier(secret))
+	handler.RegisterRoutes(r.Group("/api"))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	statusURL := server.URL + "/api/sessions/" + sess.ID + "/status"
+
+	resp, err := http.Get(statusURL)
+	if err != nil {
+		t.Fatalf("Failed to request status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a token, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL+"?token="+token, nil)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 with a query token, got %d", resp.StatusCode)
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read status event: %v", err)
+	}
+	if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, `"status":"running"`) {
+		t.Errorf("Expected the running status as the first event, got %q", line)
+	}
+}
@@ -2,12 +2,20 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/remote-agent-terminal/backend/internal/auth"
+	"github.com/remote-agent-terminal/backend/internal/logger"
 	"github.com/remote-agent-terminal/backend/internal/model"
 	"github.com/remote-agent-terminal/backend/internal/session"
 )
@@ -15,6 +23,7 @@ import (
 // SessionHandler handles HTTP requests for session management.
 type SessionHandler struct {
 	sessionManager *session.Manager
+	verifier       *auth.TokenVerifier // Optional; when set, routes require a bearer token
 }
 
 // NewSessionHandler creates a new SessionHandler.
@@ -26,10 +35,18 @@ func NewSessionHandler(sessionManager *session.Manager) *SessionHandler {
 
 // CreateSessionRequest represents the request body for creating a session.
 type CreateSessionRequest struct {
-	Command string            `json:"command" binding:"required"`
-	Name    string            `json:"name"`
-	Workdir string            `json:"workdir"`
-	Env     map[string]string `json:"env"`
+	Command     string            `json:"command" binding:"required"`
+	Name        string            `json:"name"`
+	Workdir     string            `json:"workdir"`
+	Env         map[string]string `json:"env"`
+	MaxDuration time.Duration     `json:"maxDuration,omitempty"` // Nanoseconds; zero is unlimited
+}
+
+// UpdateSessionRequest represents the request body for updating a session.
+// Omitted fields are left unchanged.
+type UpdateSessionRequest struct {
+	Name *string   `json:"name"`
+	Tags *[]string `json:"tags"`
 }
 
 // SessionResponse represents a session in API responses.
@@ -44,11 +61,22 @@ type SessionResponse struct {
 	PID         *int              `json:"pid,omitempty"`
 	LogFilePath string            `json:"logFilePath"`
 	PreviewLine string            `json:"previewLine,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
 	Duration    string            `json:"duration"`
 	CreatedAt   string            `json:"createdAt"`
 	UpdatedAt   string            `json:"updatedAt"`
 }
 
+// SessionListResponse is a page of sessions returned by List.
+// NextCursor is empty on the last page. NextOffset is only set when paging
+// by offset, and is nil on the last page.
+type SessionListResponse struct {
+	Sessions   []*SessionResponse `json:"sessions"`
+	Total      int                `json:"total"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+	NextOffset *int               `json:"nextOffset,omitempty"`
+}
+
 // ErrorResponse represents an error response.
 type ErrorResponse struct {
 	Error ErrorDetail `json:"error"`
@@ -75,6 +103,7 @@ func toSessionResponse(s *model.Session) *SessionResponse {
 		PID:         s.PID,
 		LogFilePath: s.LogFilePath,
 		PreviewLine: s.PreviewLine,
+		Tags:        s.Tags,
 		Duration:    formatDuration(s.Duration()),
 		CreatedAt:   s.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:   s.UpdatedAt.Format(time.RFC3339),
@@ -100,7 +129,7 @@ func formatDuration(d time.Duration) string {
 }
 
 // getUserID extracts the user ID from the request context.
-// In a real implementation, this would come from authentication middleware.
+// It is set by AuthMiddleware when authentication is enabled.
 func getUserID(c *gin.Context) string {
 	// Try to get from context (set by auth middleware)
 	if userID, exists := c.Get("userID"); exists {
@@ -135,17 +164,18 @@ func (h *SessionHandler) Create(c *gin.Context) {
 
 	// Create session request
 	createReq := &model.CreateSessionRequest{
-		Command: req.Command,
-		Name:    req.Name,
-		Workdir: req.Workdir,
-		Env:     req.Env,
-		UserID:  userID,
+		Command:     req.Command,
+		Name:        req.Name,
+		Workdir:     req.Workdir,
+		Env:         req.Env,
+		MaxDuration: req.MaxDuration,
+		UserID:      userID,
 	}
 
 	// Create session
 	sess, err := h.sessionManager.Create(c.Request.Context(), createReq)
 	if err != nil {
-		if errors.Is(err, model.ErrCommandRequired) {
+		if errors.Is(err, model.ErrCommandRequired) || errors.Is(err, model.ErrInvalidMaxDuration) {
 			sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
 			return
 		}
@@ -178,19 +208,58 @@ func findSubstr(s, substr string) bool {
 
 
 // List handles GET /api/sessions - lists all sessions for the user.
+// Optional query parameters narrow the list: status, q (name or command
+// substring), tag, created_after and created_before (RFC 3339). Results are paged with limit
+// (default DefaultPageLimit, at most MaxPageLimit) and either cursor, the
+// nextCursor of the previous page, or offset.
 // Requirements: 2.1
 func (h *SessionHandler) List(c *gin.Context) {
 	userID := getUserID(c)
 
-	sessions, err := h.sessionManager.List(c.Request.Context(), userID)
+	filter, err := parseSessionFilter(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	total, err := h.sessionManager.CountByUser(ctx, userID, filter)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list sessions: "+err.Error())
+		return
+	}
+
+	var sessions []*model.Session
+	var nextCursor string
+	cursor := c.Query("cursor")
+	if cursor != "" {
+		sessions, nextCursor, err = h.sessionManager.ListPage(ctx, model.ListOptions{
+			UserID: userID,
+			Limit:  limit,
+			Cursor: cursor,
+			Filter: filter,
+		})
+	} else {
+		sessions, err = h.sessionManager.ListFiltered(ctx, userID, filter, limit, offset)
+	}
+	if errors.Is(err, model.ErrInvalidCursor) {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list sessions: "+err.Error())
 		return
 	}
 
 	// Convert to response format and verify status based on actual process state
-	response := make([]*SessionResponse, len(sessions))
-	for i, sess := range sessions {
+	response := make([]*SessionResponse, 0, len(sessions))
+	for _, sess := range sessions {
 		// Verify if the session is actually running
 		// If the database says it's running but the process is not, correct the status
 		if sess.Status == model.SessionStatusRunning {
@@ -203,10 +272,79 @@ func (h *SessionHandler) List(c *gin.Context) {
 				// The handleProcessExit callback should handle database updates
 			}
 		}
-		response[i] = toSessionResponse(sess)
+		// Drop sessions whose corrected status no longer matches the filter
+		if filter.Status != "" && sess.Status != filter.Status {
+			continue
+		}
+		response = append(response, toSessionResponse(sess))
+	}
+
+	// Offset pages can also be continued with a cursor
+	var nextOffset *int
+	if next := offset + len(sessions); cursor == "" && len(sessions) > 0 && next < total {
+		nextOffset = &next
+		nextCursor = model.CursorAfter(sessions[len(sessions)-1]).Encode()
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, SessionListResponse{
+		Sessions:   response,
+		Total:      total,
+		NextCursor: nextCursor,
+		NextOffset: nextOffset,
+	})
+}
+
+const (
+	// DefaultPageLimit is the number of sessions listed when no limit is given.
+	DefaultPageLimit = 50
+
+	// MaxPageLimit is the largest accepted limit.
+	MaxPageLimit = 500
+)
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(c *gin.Context) (limit, offset int, err error) {
+	limit = DefaultPageLimit
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return 0, 0, fmt.Errorf("invalid limit: must be between 1 and %d", MaxPageLimit)
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if c.Query("cursor") != "" {
+			return 0, 0, errors.New("invalid offset: cannot be combined with cursor")
+		}
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset: must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// parseSessionFilter reads the session list filter from the query string.
+func parseSessionFilter(c *gin.Context) (model.SessionFilter, error) {
+	filter := model.SessionFilter{
+		Status: model.SessionStatus(c.Query("status")),
+		Query:  c.Query("q"),
+		Tag:    c.Query("tag"),
+	}
+
+	for param, dst := range map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: must be an RFC 3339 time", param)
+			}
+			*dst = t
+		}
+	}
+
+	return filter, filter.Validate()
 }
 
 // Get handles GET /api/sessions/:id - gets a specific session.
@@ -253,6 +391,145 @@ func (h *SessionHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, toSessionResponse(sess))
 }
 
+// Update handles PATCH /api/sessions/:id - changes a session's name and tags.
+func (h *SessionHandler) Update(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Session ID is required")
+		return
+	}
+
+	var req UpdateSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Check the session exists and belongs to the user
+	sess, err := h.sessionManager.Get(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, model.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "SESSION_NOT_FOUND", "Session "+sessionID+" not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get session: "+err.Error())
+		return
+	}
+
+	userID := getUserID(c)
+	if sess.UserID != userID {
+		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to session denied")
+		return
+	}
+
+	updated, err := h.sessionManager.UpdateMetadata(c.Request.Context(), sessionID, &model.UpdateSessionRequest{
+		Name: req.Name,
+		Tags: req.Tags,
+	})
+	if err != nil {
+		if errors.Is(err, model.ErrNameRequired) || errors.Is(err, model.ErrInvalidTag) {
+			sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+			return
+		}
+		if errors.Is(err, model.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "SESSION_NOT_FOUND", "Session "+sessionID+" not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update session: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, toSessionResponse(updated))
+}
+
+// statusKeepalive is how often an idle status stream sends a comment so
+// proxies do not close it.
+const statusKeepalive = 30 * time.Second
+
+// Status handles GET /api/sessions/:id/status - streams the session's status
+// as Server-Sent Events, starting with the current status. The stream ends
+// after the session is deleted.
+func (h *SessionHandler) Status(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Session ID is required")
+		return
+	}
+
+	sess, err := h.sessionManager.Get(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, model.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "SESSION_NOT_FOUND", "Session "+sessionID+" not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get session: "+err.Error())
+		return
+	}
+
+	// Check ownership
+	userID := getUserID(c)
+	if sess.UserID != userID {
+		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to session denied")
+		return
+	}
+
+	// Subscribe before reading the current status so no change is missed
+	events, unsubscribe := h.sessionManager.StatusBus().Subscribe(sessionID)
+	defer unsubscribe()
+
+	current := session.StatusEvent{
+		SessionID: sessionID,
+		Status:    sess.Status,
+		PID:       sess.PID,
+		ExitCode:  sess.ExitCode,
+	}
+	if current.Status == model.SessionStatusRunning && !h.sessionManager.IsSessionRunning(sessionID) {
+		// Process has exited but database wasn't updated yet
+		current.Status = model.SessionStatusExited
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	if err := writeStatusEvent(c, current); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(statusKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-events:
+			if err := writeStatusEvent(c, event); err != nil || event.Status == session.StatusDeleted {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeStatusEvent writes a status event as an SSE data line and flushes it.
+func writeStatusEvent(c *gin.Context, event session.StatusEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
 // Delete handles DELETE /api/sessions/:id - deletes a session.
 // Requirements: 2.3
 func (h *SessionHandler) Delete(c *gin.Context) {
@@ -293,6 +570,40 @@ func (h *SessionHandler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// DeleteByStatusResponse is returned by DeleteByStatus.
+type DeleteByStatusResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// DeleteByStatus handles DELETE /api/sessions?status=exited - deletes all of
+// the user's sessions in a status. The optional userId parameter must match
+// the authenticated user.
+func (h *SessionHandler) DeleteByStatus(c *gin.Context) {
+	userID := getUserID(c)
+	if requested := c.Query("userId"); requested != "" && requested != userID {
+		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to sessions denied")
+		return
+	}
+
+	status := model.SessionStatus(c.Query("status"))
+	if status == "" {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "status is required")
+		return
+	}
+
+	deleted, err := h.sessionManager.DeleteByStatus(c.Request.Context(), userID, status)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidStatus) {
+			sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete sessions: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteByStatusResponse{Deleted: deleted})
+}
+
 // Restart handles POST /api/sessions/:id/restart - restarts an exited session.
 func (h *SessionHandler) Restart(c *gin.Context) {
 	sessionID := c.Param("id")
@@ -336,13 +647,26 @@ func (h *SessionHandler) Restart(c *gin.Context) {
 	c.JSON(http.StatusOK, toSessionResponse(restartedSess))
 }
 
+// SetTokenVerifier requires a bearer token verified by verifier on the routes
+// registered afterwards. Without one, routes are unauthenticated and requests
+// act as a default user, which is meant for local development.
+func (h *SessionHandler) SetTokenVerifier(verifier *auth.TokenVerifier) {
+	h.verifier = verifier
+}
+
 // RegisterRoutes registers the session handler routes on a Gin router group.
+// The status stream also accepts the token as a ?token= query parameter,
+// since browsers cannot set headers on EventSource requests.
 func (h *SessionHandler) RegisterRoutes(rg *gin.RouterGroup) {
-	sessions := rg.Group("/sessions")
+	rg.GET("/sessions/:id/status", append(authHandlers(h.verifier, AuthOptions{AllowQueryToken: true}), h.Status)...)
+
+	sessions := rg.Group("/sessions", authHandlers(h.verifier, AuthOptions{})...)
 	{
 		sessions.POST("", h.Create)
 		sessions.GET("", h.List)
+		sessions.DELETE("", h.DeleteByStatus)
 		sessions.GET("/:id", h.Get)
+		sessions.PATCH("/:id", h.Update)
 		sessions.DELETE("/:id", h.Delete)
 		sessions.POST("/:id/restart", h.Restart)
 	}
@@ -382,15 +706,129 @@ func (h *SessionHandler) GetLogs(c *gin.Context) {
 		return
 	}
 
-	// Set headers for file download
+	parts, err := logger.Parts(sess.LogFilePath)
+	if err != nil {
+		sendError(c, http.StatusNotFound, "LOG_NOT_FOUND", "Log file not found for session "+sessionID)
+		return
+	}
+
+	// List the parts of a rotated recording
+	if c.Query("parts") == "list" {
+		response := LogPartsResponse{Parts: make([]LogPart, 0, len(parts))}
+		for i, path := range parts {
+			info, err := os.Stat(path)
+			if err != nil {
+				sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to read log file: "+err.Error())
+				return
+			}
+			response.Parts = append(response.Parts, LogPart{Part: i, Size: info.Size()})
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Download a single part
+	if value := c.Query("part"); value != "" {
+		part, err := strconv.Atoi(value)
+		if err != nil || part < 0 {
+			sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "invalid part: must be a non-negative integer")
+			return
+		}
+		if part >= len(parts) {
+			sendError(c, http.StatusNotFound, "LOG_NOT_FOUND", fmt.Sprintf("Log part %d not found for session %s", part, sessionID))
+			return
+		}
+		sendLogFile(c, sessionID, parts[part], logger.PartPath(sessionID+".cast", part))
+		return
+	}
+
+	if len(parts) == 1 {
+		sendLogFile(c, sessionID, parts[0], sessionID+".cast")
+		return
+	}
+
+	// Join the parts of a rotated recording into one
+	reader, err := logger.OpenCast(sess.LogFilePath)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to read log file: "+err.Error())
+		return
+	}
+	defer reader.Close()
+
 	c.Header("Content-Type", "application/x-asciicast")
 	c.Header("Content-Disposition", "attachment; filename="+sessionID+".cast")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		log.Printf("Failed to send logs for session %s: %v", sessionID, err)
+	}
+}
+
+// LogPart describes one part of a session recording.
+type LogPart struct {
+	Part int   `json:"part"`
+	Size int64 `json:"size"` // Bytes on disk, compressed if the recording is
+}
 
-	// Stream the file
-	c.File(sess.LogFilePath)
+// LogPartsResponse lists the parts of a session recording, returned by
+// GetLogs with ?parts=list.
+type LogPartsResponse struct {
+	Parts []LogPart `json:"parts"`
+}
+
+// sendLogFile sends one recording file as a download named filename.
+func sendLogFile(c *gin.Context, sessionID, path, filename string) {
+	// Set headers for file download
+	c.Header("Content-Type", "application/x-asciicast")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	compressed, err := logger.IsCompressed(path)
+	if err != nil {
+		sendError(c, http.StatusNotFound, "LOG_NOT_FOUND", "Log file not found for session "+sessionID)
+		return
+	}
+	if !compressed {
+		// Stream the file
+		c.File(path)
+		return
+	}
+
+	// Send a compressed log as is to clients that accept gzip
+	c.Header("Vary", "Accept-Encoding")
+	if acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Header("Content-Encoding", "gzip")
+		c.File(path)
+		return
+	}
+
+	// Otherwise decompress it on the fly
+	reader, err := logger.OpenDecompressed(path)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to read log file: "+err.Error())
+		return
+	}
+	defer reader.Close()
+
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		log.Printf("Failed to send logs for session %s: %v", sessionID, err)
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// gzip;q=0 explicitly refuses it
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
 }
 
 // RegisterLogsRoute registers the logs download route.
 func (h *SessionHandler) RegisterLogsRoute(rg *gin.RouterGroup) {
-	rg.GET("/sessions/:id/logs", h.GetLogs)
+	rg.GET("/sessions/:id/logs", append(authHandlers(h.verifier, AuthOptions{}), h.GetLogs)...)
 }
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remote-agent-terminal/backend/internal/auth"
+	"github.com/remote-agent-terminal/backend/internal/session"
+	"github.com/remote-agent-terminal/backend/internal/ws"
+)
+
+// SessionEventsHandler streams changes to a user's sessions over a
+// WebSocket, so dashboards need not poll the session list.
+type SessionEventsHandler struct {
+	wsService *ws.Service
+	verifier  *auth.TokenVerifier // Optional; when set, routes require a bearer token
+}
+
+// NewSessionEventsHandler creates a new SessionEventsHandler. Pass its
+// Publish method to the session manager's event bus with Subscribe.
+func NewSessionEventsHandler(wsService *ws.Service) *SessionEventsHandler {
+	return &SessionEventsHandler{wsService: wsService}
+}
+
+// SessionEventResponse is the payload of a session feed message.
+// Session is set for session_created and session_status messages.
+type SessionEventResponse struct {
+	SessionID string           `json:"sessionId"`
+	Session   *SessionResponse `json:"session,omitempty"`
+	Status    string           `json:"status,omitempty"`
+	ExitCode  *int             `json:"exitCode,omitempty"`
+}
+
+// Publish sends a session event to the session feed of its user.
+func (h *SessionEventsHandler) Publish(event session.Event) {
+	payload := SessionEventResponse{
+		SessionID: event.SessionID,
+		Status:    string(event.Status),
+		ExitCode:  event.ExitCode,
+	}
+	if event.Session != nil {
+		payload.Session = toSessionResponse(event.Session)
+	}
+
+	if err := h.wsService.PublishSessionEvent(event.UserID, ws.MessageType(event.Type), payload); err != nil {
+		log.Printf("Failed to publish %s event for session %s: %v", event.Type, event.SessionID, err)
+	}
+}
+
+// Stream handles WS /api/ws/sessions - pushes session_created,
+// session_status and session_deleted messages for the requesting user's
+// sessions.
+func (h *SessionEventsHandler) Stream(c *gin.Context) {
+	if err := h.wsService.HandleSessionFeed(c.Writer, c.Request, getUserID(c)); err != nil {
+		// Error already handled by WebSocket handler
+		return
+	}
+}
+
+// SetTokenVerifier requires a bearer token verified by verifier on the routes
+// registered afterwards. The token is also accepted as a ?token= query
+// parameter, since browsers cannot set headers on WebSocket requests.
+func (h *SessionEventsHandler) SetTokenVerifier(verifier *auth.TokenVerifier) {
+	h.verifier = verifier
+}
+
+// RegisterRoutes registers the session feed route on a Gin router group.
+func (h *SessionEventsHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/ws/sessions", append(authHandlers(h.verifier, AuthOptions{AllowQueryToken: true}), h.Stream)...)
+}
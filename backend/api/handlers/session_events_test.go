@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/db"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+	"github.com/remote-agent-terminal/backend/internal/repository"
+	"github.com/remote-agent-terminal/backend/internal/session"
+	"github.com/remote-agent-terminal/backend/internal/ws"
+)
+
+// TestSessionEventsStream creates and deletes a session over REST and checks
+// that the user's session feed reports both.
+func TestSessionEventsStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tempDir := t.TempDir()
+
+	database, err := db.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer database.Close()
+
+	ptyManager := pty.NewManager(tempDir)
+	sessionManager := session.NewManager(ptyManager, repository.NewSessionRepository(database), session.Config{LogDir: tempDir})
+	defer sessionManager.Close()
+	wsService := ws.NewService(ptyManager, nil)
+	defer wsService.Close()
+
+	eventsHandler := NewSessionEventsHandler(wsService)
+	sessionManager.Events().Subscribe(eventsHandler.Publish)
+
+	r := gin.New()
+	api := r.Group("/api")
+	NewSessionHandler(sessionManager).RegisterRoutes(api)
+	eventsHandler.RegisterRoutes(api)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws/sessions", nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to the session feed: %v", err)
+	}
+	defer conn.Close()
+
+	// The client is registered after the upgrade response
+	deadline := time.Now().Add(2 * time.Second)
+	for wsService.SessionFeedClientCount("default-user") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the feed client to register")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// next returns the payload of the next feed message of type msgType,
+	// skipping others such as status changes
+	next := func(msgType ws.MessageType) SessionEventResponse {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg ws.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("Failed to read %s message: %v", msgType, err)
+			}
+			if msg.Type != msgType {
+				continue
+			}
+			var payload SessionEventResponse
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+				t.Fatalf("Failed to decode %s payload: %v", msgType, err)
+			}
+			return payload
+		}
+	}
+
+	resp, err := http.Post(server.URL+"/api/sessions", "application/json", strings.NewReader(`{"command": "/usr/bin/sleep 10"}`))
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	var created SessionResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	event := next(ws.MessageTypeSessionCreated)
+	if event.SessionID != created.ID {
+		t.Errorf("Expected session_created for %s, got %s", created.ID, event.SessionID)
+	}
+	if event.Session == nil || event.Session.Status != "running" {
+		t.Errorf("Expected the running session in the payload, got %+v", event.Session)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/sessions/"+created.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	resp.Body.Close()
+
+	event = next(ws.MessageTypeSessionDeleted)
+	if event.SessionID != created.ID {
+		t.Errorf("Expected session_deleted for %s, got %s", created.ID, event.SessionID)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remote-agent-terminal/backend/internal/db"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+	"github.com/remote-agent-terminal/backend/internal/repository"
+	"github.com/remote-agent-terminal/backend/internal/session"
+)
+
+// TestSessionStatusStream opens a session's status stream and checks that it
+// starts with the current status and ends once the session is deleted.
+func TestSessionStatusStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tempDir := t.TempDir()
+
+	database, err := db.NewTestDB()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer database.Close()
+
+	ptyManager := pty.NewManager(tempDir)
+	sessionManager := session.NewManager(ptyManager, repository.NewSessionRepository(database), session.Config{LogDir: tempDir})
+	defer sessionManager.Close()
+
+	r := gin.New()
+	NewSessionHandler(sessionManager).RegisterRoutes(r.Group("/api"))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	sess, err := sessionManager.Create(context.Background(), &model.CreateSessionRequest{Command: "cat", UserID: "default-user"})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	resp, err := http.Get(server.URL + "/api/sessions/missing/status")
+	if err != nil {
+		t.Fatalf("Failed to request status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/sessions/"+sess.ID+"/status", nil)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %q", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	// next returns the next status event, skipping blank lines and comments
+	next := func() (session.StatusEvent, error) {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return session.StatusEvent{}, err
+			}
+			data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+			if !ok {
+				continue
+			}
+			var event session.StatusEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("Failed to decode status event %q: %v", data, err)
+			}
+			return event, nil
+		}
+	}
+
+	event, err := next()
+	if err != nil {
+		t.Fatalf("Failed to read the current status: %v", err)
+	}
+	if event.Status != model.SessionStatusRunning || event.PID == nil {
+		t.Errorf("Expected the running status with a PID first, got %+v", event)
+	}
+
+	deleteReq, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/sessions/"+sess.ID, nil)
+	deleteResp, err := http.DefaultClient.Do(deleteReq)
+	if err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	deleteResp.Body.Close()
+
+	// Closing the process may report its exit before the deletion
+	for {
+		event, err := next()
+		if err != nil {
+			t.Fatalf("Expected a deleted status event, got %v", err)
+		}
+		if event.Status == session.StatusDeleted {
+			break
+		}
+	}
+	if _, err := next(); err != io.EOF {
+		t.Errorf("Expected the stream to end after the deletion, got %v", err)
+	}
+}
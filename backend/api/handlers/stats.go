@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remote-agent-terminal/backend/internal/auth"
+	"github.com/remote-agent-terminal/backend/internal/ws"
+)
+
+// StatsHandler reports server-wide session and client counts for operators.
+type StatsHandler struct {
+	wsService *ws.Service
+	verifier  *auth.TokenVerifier // Optional; when set, routes require a bearer token
+}
+
+// NewStatsHandler creates a new StatsHandler.
+func NewStatsHandler(wsService *ws.Service) *StatsHandler {
+	return &StatsHandler{wsService: wsService}
+}
+
+// Stats handles GET /api/stats - returns the number of active PTY processes,
+// connected clients in total and per session of the user, ring buffer usage
+// and uptime. It only takes read locks, so it can be polled frequently.
+func (h *StatsHandler) Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.wsService.UserSessionStats(getUserID(c)))
+}
+
+// SetTokenVerifier requires a bearer token verified by verifier on the routes
+// registered afterwards.
+func (h *StatsHandler) SetTokenVerifier(verifier *auth.TokenVerifier) {
+	h.verifier = verifier
+}
+
+// RegisterRoutes registers the stats route on a Gin router group.
+func (h *StatsHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/stats", append(authHandlers(h.verifier, AuthOptions{}), h.Stats)...)
+}
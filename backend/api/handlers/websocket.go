@@ -2,10 +2,18 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/auth"
+	"github.com/remote-agent-terminal/backend/internal/logger"
 	"github.com/remote-agent-terminal/backend/internal/model"
 	"github.com/remote-agent-terminal/backend/internal/session"
 	"github.com/remote-agent-terminal/backend/internal/ws"
@@ -15,6 +23,7 @@ import (
 type WebSocketHandler struct {
 	sessionManager *session.Manager
 	wsHandler      *ws.Handler
+	verifier       *auth.TokenVerifier // Optional; when set, routes require a bearer token
 }
 
 // NewWebSocketHandler creates a new WebSocketHandler.
@@ -45,7 +54,7 @@ func (h *WebSocketHandler) Attach(c *gin.Context) {
 		return
 	}
 
-	// Check ownership
+	// Check ownership; the WebSocket handler checks it again before registering the client
 	userID := getUserID(c)
 	if sess.UserID != userID {
 		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to session denied")
@@ -65,14 +74,299 @@ func (h *WebSocketHandler) Attach(c *gin.Context) {
 		h.wsHandler.SetSessionDriver(sessionID, sessionCtx.Driver)
 	}
 
-	// Handle WebSocket connection
-	if err := h.wsHandler.HandleConnection(c.Writer, c.Request, sessionID); err != nil {
+	// Handle WebSocket connection; ?mode=observer, ?mode=readonly or ?mode=viewer attaches a viewer
+	opts := ws.ConnectOptions{UserID: userID, ReadOnly: ws.IsReadOnlyMode(c.Query("mode"))}
+	if err := h.wsHandler.HandleConnectionWithOptions(c.Writer, c.Request, sessionID, opts); err != nil {
+		// Error already handled by WebSocket handler
+		return
+	}
+}
+
+// TicketResponse represents a WebSocket attach ticket in API responses.
+type TicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// IssueTicket handles POST /api/sessions/:id/ws-ticket - issues a short-lived,
+// single-use ticket for attaching to the session via WebSocket.
+func (h *WebSocketHandler) IssueTicket(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Session ID is required")
+		return
+	}
+
+	store := h.wsHandler.TicketStore()
+	if store == nil {
+		sendError(c, http.StatusNotFound, "TICKETS_DISABLED", "WebSocket ticket authentication is not enabled")
+		return
+	}
+
+	// Get session to verify existence and ownership
+	sess, err := h.sessionManager.Get(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, model.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "SESSION_NOT_FOUND", "Session "+sessionID+" not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get session: "+err.Error())
+		return
+	}
+
+	// Check ownership
+	userID := getUserID(c)
+	if sess.UserID != userID {
+		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to session denied")
+		return
+	}
+
+	ticket, err := store.Issue(sessionID, userID)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to issue ticket: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, TicketResponse{
+		Ticket:    ticket.Token,
+		ExpiresAt: ticket.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// ConnectionResponse represents a connected WebSocket client in API responses.
+type ConnectionResponse struct {
+	ID           string `json:"id"`
+	RemoteAddr   string `json:"remoteAddr"`
+	ReadOnly     bool   `json:"readOnly"`
+	Controller   bool   `json:"controller"`
+	ConnectedAt  string `json:"connectedAt"`
+	Duration     string `json:"duration"`
+	MessagesSent uint64 `json:"messagesSent"`
+	BytesSent    uint64 `json:"bytesSent"`
+	Dropped      uint64 `json:"dropped"`
+}
+
+// Connections handles GET /api/sessions/:id/connections - lists the WebSocket
+// clients attached to a session.
+func (h *WebSocketHandler) Connections(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Session ID is required")
+		return
+	}
+
+	// Get session to verify existence and ownership
+	sess, err := h.sessionManager.Get(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, model.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "SESSION_NOT_FOUND", "Session "+sessionID+" not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get session: "+err.Error())
+		return
+	}
+
+	// Check ownership
+	if sess.UserID != getUserID(c) {
+		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to session denied")
+		return
+	}
+
+	connections := make([]ConnectionResponse, 0)
+	if hub := h.wsHandler.HubManager().Get(sessionID); hub != nil {
+		for _, info := range hub.Snapshot() {
+			connections = append(connections, ConnectionResponse{
+				ID:           info.ID,
+				RemoteAddr:   info.RemoteAddr,
+				ReadOnly:     info.ReadOnly,
+				Controller:   info.Controller,
+				ConnectedAt:  info.ConnectedAt.Format(time.RFC3339),
+				Duration:     formatDuration(time.Since(info.ConnectedAt)),
+				MessagesSent: info.MessagesSent,
+				BytesSent:    info.BytesSent,
+				Dropped:      info.Dropped,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, connections)
+}
+
+// Messages handles GET /api/sessions/:id/messages - lists the conversation
+// messages the session's driver has parsed, oldest first. Only the latest
+// messages are kept, and none once the session is deleted.
+func (h *WebSocketHandler) Messages(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Session ID is required")
+		return
+	}
+
+	// Get session to verify existence and ownership
+	sess, err := h.sessionManager.Get(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, model.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "SESSION_NOT_FOUND", "Session "+sessionID+" not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get session: "+err.Error())
+		return
+	}
+
+	// Check ownership
+	if sess.UserID != getUserID(c) {
+		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to session denied")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.wsHandler.ConversationHistory(sessionID))
+}
+
+// MaxReplaySpeed is the largest accepted replay speed multiplier.
+const MaxReplaySpeed = 100
+
+// Replay handles WS /api/sessions/:id/replay - streams the session's recording
+// with its original timing. ?speed=2 plays it twice as fast and ?from=12.5
+// starts 12.5 seconds in. Unlike Attach, it works for sessions that have
+// exited, since it only reads the log file. Requests that are not WebSocket
+// upgrades get the recording as Server-Sent Events; see replayEvents.
+func (h *WebSocketHandler) Replay(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Session ID is required")
+		return
+	}
+
+	speed := 1.0
+	if value := c.Query("speed"); value != "" {
+		var err error
+		speed, err = strconv.ParseFloat(value, 64)
+		if err != nil || speed <= 0 || speed > MaxReplaySpeed {
+			sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("Invalid speed: must be greater than 0 and at most %d", MaxReplaySpeed))
+			return
+		}
+	}
+
+	from := 0.0
+	if value := c.Query("from"); value != "" {
+		var err error
+		from, err = strconv.ParseFloat(value, 64)
+		if err != nil || from < 0 {
+			sendError(c, http.StatusBadRequest, "VALIDATION_ERROR", "Invalid from: must be a non-negative number of seconds")
+			return
+		}
+	}
+
+	// Get session to verify existence and ownership
+	sess, err := h.sessionManager.Get(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, model.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "SESSION_NOT_FOUND", "Session "+sessionID+" not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get session: "+err.Error())
+		return
+	}
+
+	// Check ownership
+	userID := getUserID(c)
+	if sess.UserID != userID {
+		sendError(c, http.StatusForbidden, "FORBIDDEN", "Access to session denied")
+		return
+	}
+
+	if sess.LogFilePath == "" {
+		sendError(c, http.StatusNotFound, "LOG_NOT_FOUND", "Log file not found for session "+sessionID)
+		return
+	}
+
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		replayEvents(c, sessionID, sess.LogFilePath, logger.PlayerOptions{Speed: speed, From: from})
+		return
+	}
+
+	opts := ws.ReplayOptions{Speed: speed, From: from, OwnerID: sess.UserID}
+	if err := h.wsHandler.HandleReplay(c.Writer, c.Request, sessionID, sess.LogFilePath, opts); err != nil {
 		// Error already handled by WebSocket handler
 		return
 	}
 }
 
+// replayEvents streams the recording at logPath as Server-Sent Events with
+// its original timing. The first event, named header, carries the recording's
+// header. Each recorded event follows as an unnamed event whose data is the
+// event in asciinema's [time, type, data] form, except markers, which are
+// named marker. A final event named end marks the end of the recording.
+func replayEvents(c *gin.Context, sessionID, logPath string, opts logger.PlayerOptions) {
+	reader, err := logger.Open(logPath)
+	if err != nil {
+		sendError(c, http.StatusNotFound, "LOG_NOT_FOUND", "Log file not found for session "+sessionID)
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	player := logger.NewPlayer(reader, opts)
+	if err := writeReplayEvent(c, "header", player.Header()); err != nil {
+		return
+	}
+
+	err = player.Play(c.Request.Context(), func(event logger.AsciinemaEvent) error {
+		name := ""
+		if event.EventType == "m" {
+			name = "marker"
+		}
+		return writeReplayEvent(c, name, event)
+	})
+	if err != nil {
+		if reader.Err() != nil {
+			log.Printf("Failed to read recording for session %s: %v", sessionID, err)
+		}
+		// Otherwise the client went away
+		return
+	}
+	writeReplayEvent(c, "end", struct{}{})
+}
+
+// writeReplayEvent writes v as an SSE event with the given name, or an
+// unnamed event if name is empty, and flushes it.
+func writeReplayEvent(c *gin.Context, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\n", name); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// SetTokenVerifier requires a bearer token verified by verifier on the routes
+// registered afterwards. The attach and replay routes also accept the token
+// as a ?token= query parameter, since browsers cannot set headers on
+// WebSocket or EventSource requests.
+func (h *WebSocketHandler) SetTokenVerifier(verifier *auth.TokenVerifier) {
+	h.verifier = verifier
+}
+
 // RegisterRoutes registers the WebSocket handler routes on a Gin router group.
 func (h *WebSocketHandler) RegisterRoutes(rg *gin.RouterGroup) {
-	rg.GET("/sessions/:id/attach", h.Attach)
+	headerAuth := authHandlers(h.verifier, AuthOptions{})
+	queryAuth := authHandlers(h.verifier, AuthOptions{AllowQueryToken: true})
+
+	rg.GET("/sessions/:id/attach", append(queryAuth, h.Attach)...)
+	rg.POST("/sessions/:id/ws-ticket", append(headerAuth, h.IssueTicket)...)
+	rg.GET("/sessions/:id/connections", append(headerAuth, h.Connections)...)
+	rg.GET("/sessions/:id/messages", append(headerAuth, h.Messages)...)
+	rg.GET("/sessions/:id/replay", append(queryAuth, h.Replay)...)
 }
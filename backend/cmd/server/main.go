@@ -1,15 +1,22 @@
 package main
 
 import (
+	"compress/flate"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/remote-agent-terminal/backend/api/handlers"
+	"github.com/remote-agent-terminal/backend/internal/auth"
 	"github.com/remote-agent-terminal/backend/internal/db"
+	"github.com/remote-agent-terminal/backend/internal/logging"
+	"github.com/remote-agent-terminal/backend/internal/metrics"
 	"github.com/remote-agent-terminal/backend/internal/pty"
 	"github.com/remote-agent-terminal/backend/internal/repository"
 	"github.com/remote-agent-terminal/backend/internal/session"
@@ -23,6 +30,14 @@ func main() {
 	dbPath := getEnv("DB_PATH", "data/sessions.db")
 	logDir := getEnv("LOG_DIR", "data/logs")
 	maxSessions := 10
+	ringBufferSize := getEnvInt("RING_BUFFER_SIZE", pty.DefaultRingBufferSize)
+
+	// The session and WebSocket layers log JSON lines of at least LOG_LEVEL
+	logLevel, err := logging.ParseLevel(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	appLogger := logging.New(os.Stderr, logLevel)
 
 	// Ensure data directories exist
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
@@ -44,12 +59,40 @@ func main() {
 
 	// Initialize PTY manager
 	ptyManager := pty.NewManager(logDir)
+	ptyManager.SetRingBufferSize(ringBufferSize)
+	// Rotate recordings into parts of about this many bytes; 0 disables rotation
+	ptyManager.SetLogMaxBytes(int64(getEnvInt("LOG_MAX_BYTES", 0)))
 	defer ptyManager.Close()
 
+	// Export Prometheus metrics unless METRICS_ENABLED=false
+	var serverMetrics *metrics.ServerMetrics
+	if getEnv("METRICS_ENABLED", "true") == "true" {
+		serverMetrics = metrics.New()
+		ptyManager.SetMetrics(serverMetrics)
+	}
+
+	// Drivers configured by pattern files, e.g.
+	// DRIVER_PATTERN_CONFIGS="config/deploy-bot.yaml,config/review.json"
+	if paths := getEnv("DRIVER_PATTERN_CONFIGS", ""); paths != "" {
+		for _, path := range strings.Split(paths, ",") {
+			cfg, err := driver.LoadPatternConfig(strings.TrimSpace(path))
+			if err == nil {
+				err = driver.RegisterPattern(cfg)
+			}
+			if err != nil {
+				log.Fatalf("Invalid pattern driver %s: %v", path, err)
+			}
+		}
+	}
+
 	// Initialize session manager
 	sessionManager := session.NewManager(ptyManager, sessionRepo, session.Config{
 		LogDir:             logDir,
 		MaxSessionsPerUser: maxSessions,
+		IdleTimeout:        time.Duration(getEnvInt("SESSION_IDLE_TIMEOUT_SEC", 0)) * time.Second,
+		WatchdogTimeout:    time.Duration(getEnvInt("SESSION_WATCHDOG_TIMEOUT_SEC", 0)) * time.Second,
+		CompressLogs:       getEnv("LOG_COMPRESS", "false") == "true",
+		Logger:             appLogger,
 	})
 	defer sessionManager.Close()
 
@@ -57,14 +100,134 @@ func main() {
 	// Initialize WebSocket service
 	agentDriver := driver.NewGenericDriver()
 	wsService := ws.NewService(ptyManager, agentDriver)
+	wsService.SetLogger(appLogger)
 	defer wsService.Close()
 
+	// Broadcast each session's output from the moment it is spawned
+	sessionManager.SetOnSpawn(wsService.AttachProcess)
+
+	// Alert clients when a session stops producing output
+	sessionManager.SetOnWatchdog(wsService.HandleWatchdog)
+
+	// Tell clients when a session is terminated for exceeding its max duration
+	sessionManager.SetOnExpire(wsService.HandleExpired)
+
+	// Allow WebSocket origins besides the server's own, e.g.
+	// ALLOWED_ORIGINS="https://app.example.com,*.example.com"
+	if origins := getEnv("ALLOWED_ORIGINS", getEnv("WS_ALLOWED_ORIGINS", "")); origins != "" {
+		ws.SetAllowedOrigins(strings.Split(origins, ","))
+	}
+
+	// Require short-lived tickets for WebSocket attach when enabled
+	if getEnv("WS_TICKET_AUTH", "false") == "true" {
+		ticketStore := auth.NewTicketStore(auth.DefaultTicketTTL)
+		defer ticketStore.Close()
+		wsService.Handler().SetTicketStore(ticketStore)
+	}
+
+	// Choose how slow clients are handled when their send queue fills up
+	if name := getEnv("WS_BACKPRESSURE", ""); name != "" {
+		policy, err := ws.ParseBackpressurePolicy(name)
+		if err != nil {
+			log.Fatalf("Invalid WS_BACKPRESSURE: %v", err)
+		}
+		wsService.HubManager().SetBackpressure(policy, 0)
+	}
+
+	// Compress large output frames for clients that negotiate permessage-deflate
+	if getEnv("WS_COMPRESS_OUTPUT", "false") == "true" {
+		wsService.Handler().CompressOutput = true
+		wsService.Handler().CompressThreshold = getEnvInt("WS_COMPRESS_THRESHOLD", ws.DefaultCompressThreshold)
+		level := getEnvInt("WS_COMPRESS_LEVEL", flate.BestSpeed)
+		// Level 0 (flate.NoCompression) is not accepted: it would mean the
+		// handler's default, and compressing at it saves nothing anyway
+		if level < flate.HuffmanOnly || level > flate.BestCompression || level == flate.NoCompression {
+			log.Fatalf("Invalid WS_COMPRESS_LEVEL: %d (use -2 to 9 except 0, or disable WS_COMPRESS_OUTPUT)", level)
+		}
+		wsService.Handler().CompressionLevel = level
+	}
+
+	// Batch rapid stdout chunks into fewer frames, e.g. WS_COALESCE_MS=16
+	if ms := getEnvInt("WS_COALESCE_MS", 0); ms > 0 {
+		wsService.Handler().CoalesceWindow = time.Duration(ms) * time.Millisecond
+		wsService.Handler().CoalesceMaxBytes = ws.DefaultCoalesceMaxBytes
+	}
+
+	// Drop input beyond a rate per client, e.g. WS_STDIN_RATE_LIMIT=65536
+	// bytes per second with bursts of WS_STDIN_BURST bytes
+	if rate := getEnvInt("WS_STDIN_RATE_LIMIT", 0); rate > 0 {
+		wsService.Handler().StdinRateLimit = rate
+		wsService.Handler().StdinBurst = getEnvInt("WS_STDIN_BURST", 0)
+	}
+
+	// Limit the size of client messages in bytes, e.g. WS_MAX_MESSAGE_SIZE=65536
+	if n := getEnvInt("WS_MAX_MESSAGE_SIZE", 0); n > 0 {
+		wsService.Handler().MaxMessageSize = int64(n)
+	}
+
+	// Limit clients per session besides the owner, e.g. WS_MAX_CLIENTS=8
+	if n := getEnvInt("WS_MAX_CLIENTS", 0); n > 0 {
+		wsService.HubManager().SetMaxClients(n)
+	}
+
+	// Limit connections per user across sessions, e.g. WS_MAX_CONNS_PER_USER=20;
+	// a negative value disables the limit
+	if n := getEnvInt("WS_MAX_CONNS_PER_USER", 0); n != 0 {
+		wsService.Handler().MaxConnsPerUser = n
+	}
+
+	// Close clients without activity for a while, e.g. WS_CLIENT_IDLE_TIMEOUT_SEC=600;
+	// a negative value keeps them open
+	if sec := getEnvInt("WS_CLIENT_IDLE_TIMEOUT_SEC", 0); sec != 0 {
+		wsService.Handler().IdleTimeout = time.Duration(sec) * time.Second
+	}
+
+	// Drop hubs that have had no clients for a while, e.g. WS_HUB_IDLE_TIMEOUT_SEC=600
+	if sec := getEnvInt("WS_HUB_IDLE_TIMEOUT_SEC", 0); sec > 0 {
+		wsService.HubManager().SetIdleTimeout(time.Duration(sec) * time.Second)
+	}
+
+	// Keep hubs of exited sessions without clients this long, e.g.
+	// WS_HUB_EXITED_GRACE_SEC=60; 0 keeps them until the session is deleted
+	if sec := getEnvInt("WS_HUB_EXITED_GRACE_SEC", -1); sec >= 0 {
+		wsService.HubManager().SetExitedGracePeriod(time.Duration(sec) * time.Second)
+	}
+
+	// Count broadcasts, and report active sessions and clients at scrape time
+	if serverMetrics != nil {
+		wsService.HubManager().SetMetrics(serverMetrics)
+		serverMetrics.Registry.NewGaugeFunc(metrics.Namespace+"_active_sessions",
+			"Running PTY processes.", func() float64 {
+				return float64(len(ptyManager.List()))
+			})
+		serverMetrics.Registry.NewGaugeFunc(metrics.Namespace+"_connected_clients",
+			"Connected WebSocket clients.", func() float64 {
+				return float64(wsService.SessionStats().Clients)
+			})
+	}
+
 	// Initialize handlers
 	sessionHandler := handlers.NewSessionHandler(sessionManager)
 	wsHandler := handlers.NewWebSocketHandler(sessionManager, wsService.Handler())
+	statsHandler := handlers.NewStatsHandler(wsService)
+	sessionEventsHandler := handlers.NewSessionEventsHandler(wsService)
+
+	// Push session list changes to the users' session feeds
+	sessionManager.Events().Subscribe(sessionEventsHandler.Publish)
 
-	// Initialize Gin router
-	r := gin.Default()
+	// Require HS256 bearer tokens whose subject is the user ID when a secret
+	// is configured; without one the API is unauthenticated for local development
+	if secret := getEnv("AUTH_JWT_SECRET", ""); secret != "" {
+		verifier := auth.NewTokenVerifier([]byte(secret))
+		sessionHandler.SetTokenVerifier(verifier)
+		wsHandler.SetTokenVerifier(verifier)
+		statsHandler.SetTokenVerifier(verifier)
+		sessionEventsHandler.SetTokenVerifier(verifier)
+	}
+
+	// Initialize Gin router, logging requests without their ?token= values
+	r := gin.New()
+	r.Use(handlers.AccessLogger(), gin.Recovery())
 
 	// Enable CORS for development
 	r.Use(corsMiddleware())
@@ -76,6 +239,11 @@ func main() {
 		})
 	})
 
+	// Prometheus scrape endpoint; like /health it needs no token
+	if serverMetrics != nil {
+		r.GET("/metrics", gin.WrapH(serverMetrics.Registry))
+	}
+
 	// API routes
 	api := r.Group("/api")
 	{
@@ -85,6 +253,10 @@ func main() {
 
 		// WebSocket routes
 		wsHandler.RegisterRoutes(api)
+		sessionEventsHandler.RegisterRoutes(api)
+
+		// Server statistics
+		statsHandler.RegisterRoutes(api)
 	}
 
 	// Graceful shutdown
@@ -93,9 +265,11 @@ func main() {
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		<-sigCh
 		log.Println("Shutting down server...")
+		// Tell WebSocket clients first, so they see a shutdown rather than
+		// their sessions exiting
+		wsService.Close()
 		sessionManager.Close()
 		ptyManager.Close()
-		wsService.Close()
 		db.CloseDB()
 		os.Exit(0)
 	}()
@@ -115,13 +289,24 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvInt returns the integer value of an environment variable or a default value.
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+		log.Printf("Invalid value for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
 // corsMiddleware returns a CORS middleware for development.
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
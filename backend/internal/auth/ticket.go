@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTicketTTL is how long a WebSocket ticket remains valid after issue.
+	DefaultTicketTTL = 30 * time.Second
+
+	// ticketTokenBytes is the number of random bytes in a ticket token.
+	ticketTokenBytes = 32
+)
+
+var (
+	// ErrTicketMissing is returned when no ticket was supplied.
+	ErrTicketMissing = errors.New("ticket is required")
+
+	// ErrTicketInvalid is returned when a ticket is unknown or has already been used.
+	ErrTicketInvalid = errors.New("ticket is invalid")
+
+	// ErrTicketExpired is returned when a ticket is redeemed after its expiry.
+	ErrTicketExpired = errors.New("ticket has expired")
+
+	// ErrTicketSessionMismatch is returned when a ticket is redeemed for a different session.
+	ErrTicketSessionMismatch = errors.New("ticket does not match session")
+)
+
+// Ticket is a short-lived, single-use credential for a WebSocket upgrade.
+// Browsers cannot set Authorization headers on WebSocket requests, so the
+// client obtains a ticket over an authenticated HTTP call and passes it as
+// a query parameter instead.
+type Ticket struct {
+	Token     string    `json:"ticket"`
+	SessionID string    `json:"-"`
+	UserID    string    `json:"-"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// TicketStore is an in-memory store of outstanding WebSocket tickets.
+// Expired tickets are swept periodically in the background.
+type TicketStore struct {
+	ttl     time.Duration
+	tickets map[string]*Ticket
+	mu      sync.Mutex
+
+	// now is overridable for testing.
+	now func() time.Time
+
+	stopCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTicketStore creates a new TicketStore with the given ticket lifetime.
+// If ttl is zero or negative, DefaultTicketTTL is used.
+func NewTicketStore(ttl time.Duration) *TicketStore {
+	if ttl <= 0 {
+		ttl = DefaultTicketTTL
+	}
+
+	s := &TicketStore{
+		ttl:     ttl,
+		tickets: make(map[string]*Ticket),
+		now:     time.Now,
+		stopCh:  make(chan struct{}),
+	}
+
+	go s.sweepLoop()
+
+	return s
+}
+
+// TTL returns the lifetime of issued tickets.
+func (s *TicketStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue creates a new ticket bound to the session and user.
+func (s *TicketStore) Issue(sessionID, userID string) (*Ticket, error) {
+	b := make([]byte, ticketTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate ticket: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ticket := &Ticket{
+		Token:     hex.EncodeToString(b),
+		SessionID: sessionID,
+		UserID:    userID,
+		ExpiresAt: s.now().Add(s.ttl),
+	}
+	s.tickets[ticket.Token] = ticket
+
+	return ticket, nil
+}
+
+// Redeem validates a ticket for the given session and consumes it.
+// A ticket can only be redeemed once, regardless of whether validation succeeds.
+func (s *TicketStore) Redeem(token, sessionID string) (*Ticket, error) {
+	if token == "" {
+		return nil, ErrTicketMissing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ticket, ok := s.tickets[token]
+	if !ok {
+		return nil, ErrTicketInvalid
+	}
+	delete(s.tickets, token)
+
+	if !s.now().Before(ticket.ExpiresAt) {
+		return nil, ErrTicketExpired
+	}
+	if ticket.SessionID != sessionID {
+		return nil, ErrTicketSessionMismatch
+	}
+
+	return ticket, nil
+}
+
+// Sweep removes all expired tickets.
+func (s *TicketStore) Sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for token, ticket := range s.tickets {
+		if !now.Before(ticket.ExpiresAt) {
+			delete(s.tickets, token)
+		}
+	}
+}
+
+// Len returns the number of outstanding tickets.
+func (s *TicketStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tickets)
+}
+
+// Close stops the background sweeper.
+func (s *TicketStore) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
+
+// sweepLoop periodically removes expired tickets until the store is closed.
+func (s *TicketStore) sweepLoop() {
+	ticker := time.NewTicker(s.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Sweep()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
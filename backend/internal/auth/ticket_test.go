@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a controllable time source for ticket expiry tests.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestStore(t *testing.T) (*TicketStore, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	store := NewTicketStore(DefaultTicketTTL)
+	store.mu.Lock()
+	store.now = clock.Now
+	store.mu.Unlock()
+	t.Cleanup(store.Close)
+	return store, clock
+}
+
+func TestTicketStore_IssueAndRedeem(t *testing.T) {
+	store, clock := newTestStore(t)
+
+	ticket, err := store.Issue("session-1", "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ticket.Token) != ticketTokenBytes*2 {
+		t.Errorf("expected %d hex chars, got %d", ticketTokenBytes*2, len(ticket.Token))
+	}
+	if !ticket.ExpiresAt.Equal(clock.Now().Add(DefaultTicketTTL)) {
+		t.Errorf("unexpected expiry: %v", ticket.ExpiresAt)
+	}
+
+	redeemed, err := store.Redeem(ticket.Token, "session-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if redeemed.UserID != "user-1" || redeemed.SessionID != "session-1" {
+		t.Errorf("ticket bound to wrong identity: user=%s session=%s", redeemed.UserID, redeemed.SessionID)
+	}
+}
+
+func TestTicketStore_RedeemErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(store *TicketStore, clock *fakeClock) string
+		sessionID string
+		expected  error
+	}{
+		{
+			name: "missing ticket",
+			setup: func(store *TicketStore, clock *fakeClock) string {
+				return ""
+			},
+			sessionID: "session-1",
+			expected:  ErrTicketMissing,
+		},
+		{
+			name: "unknown ticket",
+			setup: func(store *TicketStore, clock *fakeClock) string {
+				return "not-a-ticket"
+			},
+			sessionID: "session-1",
+			expected:  ErrTicketInvalid,
+		},
+		{
+			name: "expired ticket",
+			setup: func(store *TicketStore, clock *fakeClock) string {
+				ticket, _ := store.Issue("session-1", "user-1")
+				clock.Advance(DefaultTicketTTL + time.Second)
+				return ticket.Token
+			},
+			sessionID: "session-1",
+			expected:  ErrTicketExpired,
+		},
+		{
+			name: "reused ticket",
+			setup: func(store *TicketStore, clock *fakeClock) string {
+				ticket, _ := store.Issue("session-1", "user-1")
+				if _, err := store.Redeem(ticket.Token, "session-1"); err != nil {
+					t.Fatalf("first redeem failed: %v", err)
+				}
+				return ticket.Token
+			},
+			sessionID: "session-1",
+			expected:  ErrTicketInvalid,
+		},
+		{
+			name: "wrong session",
+			setup: func(store *TicketStore, clock *fakeClock) string {
+				ticket, _ := store.Issue("session-1", "user-1")
+				return ticket.Token
+			},
+			sessionID: "session-2",
+			expected:  ErrTicketSessionMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, clock := newTestStore(t)
+			token := tt.setup(store, clock)
+
+			_, err := store.Redeem(token, tt.sessionID)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected error %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestTicketStore_WrongSessionConsumesTicket(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	ticket, _ := store.Issue("session-1", "user-1")
+	store.Redeem(ticket.Token, "session-2")
+
+	if _, err := store.Redeem(ticket.Token, "session-1"); !errors.Is(err, ErrTicketInvalid) {
+		t.Errorf("expected ticket to be consumed after failed redeem, got %v", err)
+	}
+}
+
+func TestTicketStore_Sweep(t *testing.T) {
+	store, clock := newTestStore(t)
+
+	store.Issue("session-1", "user-1")
+	clock.Advance(DefaultTicketTTL / 2)
+	store.Issue("session-2", "user-1")
+
+	if store.Len() != 2 {
+		t.Fatalf("expected 2 tickets, got %d", store.Len())
+	}
+
+	clock.Advance(DefaultTicketTTL / 2)
+	store.Sweep()
+
+	if store.Len() != 1 {
+		t.Errorf("expected 1 ticket after sweep, got %d", store.Len())
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test-secret")
+
+func newTestVerifier() *TokenVerifier {
+	v := NewTokenVerifier(testSecret)
+	v.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return v
+}
+
+func mustSign(t *testing.T, secret []byte, claims Claims) string {
+	t.Helper()
+	token, err := SignToken(secret, claims)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return token
+}
+
+func TestTokenVerifier_Verify(t *testing.T) {
+	v := newTestVerifier()
+
+	token := mustSign(t, testSecret, Claims{Subject: "user-1", ExpiresAt: 1700000060, IssuedAt: 1700000000})
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "user-1" {
+		t.Errorf("expected subject user-1, got %q", claims.Subject)
+	}
+
+	// Tokens without an expiry stay valid
+	if _, err := v.Verify(mustSign(t, testSecret, Claims{Subject: "user-1"})); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTokenVerifier_VerifyErrors(t *testing.T) {
+	valid := mustSign(t, testSecret, Claims{Subject: "user-1"})
+	parts := strings.Split(valid, ".")
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	tests := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"missing token", "", ErrTokenMissing},
+		{"malformed token", "not-a-token", ErrTokenInvalid},
+		{"wrong secret", mustSign(t, []byte("other-secret"), Claims{Subject: "user-1"}), ErrTokenInvalid},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2], ErrTokenInvalid},
+		{"alg none", noneHeader + "." + parts[1] + ".", ErrTokenInvalid},
+		{"missing subject", mustSign(t, testSecret, Claims{}), ErrTokenInvalid},
+		{"expired", mustSign(t, testSecret, Claims{Subject: "user-1", ExpiresAt: 1700000000}), ErrTokenExpired},
+		{"not yet valid", mustSign(t, testSecret, Claims{Subject: "user-1", NotBefore: 1700000060}), ErrTokenExpired},
+	}
+
+	v := newTestVerifier()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Verify(tt.token); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
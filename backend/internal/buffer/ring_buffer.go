@@ -15,6 +15,17 @@ type RingBuffer struct {
 	data     []byte
 	capacity int
 	mu       sync.RWMutex
+
+	// totalWritten counts every byte ever written. It is the cursor
+	// position of the end of the buffer and never decreases.
+	totalWritten int64
+
+	// origin is the cursor the buffer started at. See StartAt.
+	origin int64
+
+	// ansiSafe moves the eviction point to a boundary where terminal
+	// output can be replayed cleanly. See NewANSISafeRingBuffer.
+	ansiSafe bool
 }
 
 // NewRingBuffer creates a new RingBuffer with the specified capacity.
@@ -29,6 +40,17 @@ func NewRingBuffer(capacity int) *RingBuffer {
 	}
 }
 
+// NewANSISafeRingBuffer creates a RingBuffer that never starts in the middle
+// of a line, escape sequence, or UTF-8 character. When evicting, the discard
+// point advances to the start of the next line or the next escape sequence,
+// whichever comes first, so replaying the buffer into a terminal emulator
+// renders cleanly. The buffer may hold slightly less than capacity bytes.
+func NewANSISafeRingBuffer(capacity int) *RingBuffer {
+	rb := NewRingBuffer(capacity)
+	rb.ansiSafe = true
+	return rb
+}
+
 // Write appends data to the buffer. If the total data exceeds capacity,
 // the oldest data is discarded to make room for new data.
 // This method implements io.Writer interface.
@@ -40,10 +62,13 @@ func (rb *RingBuffer) Write(p []byte) (n int, err error) {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
 
+	rb.totalWritten += int64(len(p))
+
 	// If incoming data is larger than capacity, only keep the last 'capacity' bytes
 	if len(p) >= rb.capacity {
 		rb.data = make([]byte, rb.capacity)
 		copy(rb.data, p[len(p)-rb.capacity:])
+		rb.trimUnsafeStartLocked()
 		return len(p), nil
 	}
 
@@ -63,11 +88,48 @@ func (rb *RingBuffer) Write(p []byte) (n int, err error) {
 		copy(newData, rb.data[discard:])
 		copy(newData[len(rb.data)-discard:], p)
 		rb.data = newData
+		rb.trimUnsafeStartLocked()
 	}
 
 	return len(p), nil
 }
 
+// trimUnsafeStartLocked drops leading bytes left over from a cut line or
+// escape sequence after an eviction. It does nothing unless ansiSafe is set.
+// The caller must hold rb.mu.
+func (rb *RingBuffer) trimUnsafeStartLocked() {
+	if !rb.ansiSafe {
+		return
+	}
+	start := safeStart(rb.data)
+	if start == 0 {
+		return
+	}
+	n := copy(rb.data, rb.data[start:])
+	rb.data = rb.data[:n]
+}
+
+// safeStart returns the offset of the first position in data where replay
+// can begin cleanly: just after a newline or at an ESC that starts a new
+// escape sequence, whichever comes first. If neither exists, it only skips
+// UTF-8 continuation bytes so the data does not start mid-character.
+func safeStart(data []byte) int {
+	for i, b := range data {
+		switch {
+		case b == '\x1b':
+			return i
+		case b == '\n':
+			return i + 1
+		}
+	}
+
+	i := 0
+	for i < len(data) && data[i]&0xC0 == 0x80 {
+		i++
+	}
+	return i
+}
+
 // ReadAll returns a copy of all data currently in the buffer.
 // The returned slice is safe to use without holding the lock.
 func (rb *RingBuffer) ReadAll() []byte {
@@ -84,6 +146,68 @@ func (rb *RingBuffer) ReadAll() []byte {
 	return result
 }
 
+// ReadFrom returns the data written after the given cursor, along with the
+// cursor for the end of the buffer. A cursor is the total number of bytes
+// written when it was obtained, so a client that stores the cursor it last
+// received can fetch only what it missed.
+//
+// If the cursor is older than the oldest retained byte, or ahead of the
+// buffer, all buffered data is returned. Callers can detect this case by
+// checking newCursor-cursor != len(data).
+func (rb *RingBuffer) ReadFrom(cursor int) (data []byte, newCursor int) {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+
+	total := rb.totalWritten
+	oldest := total - int64(len(rb.data))
+	start := 0
+	if c := int64(cursor); c >= oldest && c <= total {
+		start = int(c - oldest)
+	}
+
+	if start == len(rb.data) {
+		return nil, int(total)
+	}
+
+	result := make([]byte, len(rb.data)-start)
+	copy(result, rb.data[start:])
+	return result, int(total)
+}
+
+// StartAt numbers the buffer's bytes from cursor instead of 0, as if cursor
+// bytes had been written and discarded, e.g. so the cursors of a restarted
+// process's output follow those of the process it replaces. It must be
+// called before the first Write.
+func (rb *RingBuffer) StartAt(cursor int) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.totalWritten = int64(cursor)
+	rb.origin = int64(cursor)
+}
+
+// Origin returns the cursor the buffer started at. Cursors up to it refer
+// to output the buffer never held.
+func (rb *RingBuffer) Origin() int {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return int(rb.origin)
+}
+
+// Cursor returns the total number of bytes written to the buffer.
+func (rb *RingBuffer) Cursor() int {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return int(rb.totalWritten)
+}
+
+// Start returns the cursor of the oldest byte in the buffer: the number of
+// bytes written before it.
+func (rb *RingBuffer) Start() int {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return int(rb.totalWritten) - len(rb.data)
+}
+
 // Clear removes all data from the buffer.
 func (rb *RingBuffer) Clear() {
 	rb.mu.Lock()
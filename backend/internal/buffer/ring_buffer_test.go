@@ -168,3 +168,177 @@ func TestRingBuffer_Clear(t *testing.T) {
 		t.Errorf("expected 'world', got '%s'", string(data))
 	}
 }
+
+func TestRingBuffer_ReadFrom(t *testing.T) {
+	rb := NewRingBuffer(10)
+
+	// Empty buffer
+	data, cursor := rb.ReadFrom(0)
+	if data != nil || cursor != 0 {
+		t.Errorf("expected nil data and cursor 0, got '%s' and %d", string(data), cursor)
+	}
+
+	rb.Write([]byte("hello"))
+	data, cursor = rb.ReadFrom(0)
+	if !bytes.Equal(data, []byte("hello")) || cursor != 5 {
+		t.Errorf("expected 'hello' at cursor 5, got '%s' at %d", string(data), cursor)
+	}
+
+	// Only the delta since the last cursor is returned
+	rb.Write([]byte("abc"))
+	data, cursor = rb.ReadFrom(cursor)
+	if !bytes.Equal(data, []byte("abc")) || cursor != 8 {
+		t.Errorf("expected 'abc' at cursor 8, got '%s' at %d", string(data), cursor)
+	}
+
+	// Up to date
+	data, cursor = rb.ReadFrom(cursor)
+	if data != nil || cursor != 8 {
+		t.Errorf("expected no data at cursor 8, got '%s' at %d", string(data), cursor)
+	}
+
+	// Cursor keeps counting after overflow
+	rb.Write([]byte("0123456789"))
+	data, cursor = rb.ReadFrom(13)
+	if !bytes.Equal(data, []byte("56789")) || cursor != 18 {
+		t.Errorf("expected '56789' at cursor 18, got '%s' at %d", string(data), cursor)
+	}
+	if start := rb.Start(); start != 8 {
+		t.Errorf("expected the oldest byte at cursor 8, got %d", start)
+	}
+}
+
+func TestRingBuffer_StartAt(t *testing.T) {
+	rb := NewRingBuffer(16)
+	rb.StartAt(100)
+	rb.Write([]byte("hello"))
+
+	if rb.Cursor() != 105 || rb.Start() != 100 || rb.Origin() != 100 {
+		t.Errorf("expected cursors 100..105 from origin 100, got %d..%d from %d", rb.Start(), rb.Cursor(), rb.Origin())
+	}
+	if data, cursor := rb.ReadFrom(102); string(data) != "llo" || cursor != 105 {
+		t.Errorf("expected 'llo' up to 105, got '%s' up to %d", data, cursor)
+	}
+	if data, _ := rb.ReadFrom(50); string(data) != "hello" {
+		t.Errorf("expected a cursor before the origin to read everything, got '%s'", data)
+	}
+}
+
+func TestRingBuffer_ReadFromStaleCursor(t *testing.T) {
+	rb := NewRingBuffer(5)
+	rb.Write([]byte("0123456789"))
+
+	tests := []struct {
+		name   string
+		cursor int
+	}{
+		{"cursor older than retained data", 2},
+		{"cursor ahead of buffer", 42},
+		{"negative cursor", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, cursor := rb.ReadFrom(tt.cursor)
+			if !bytes.Equal(data, []byte("56789")) {
+				t.Errorf("expected full buffer '56789', got '%s'", string(data))
+			}
+			if cursor != 10 {
+				t.Errorf("expected cursor 10, got %d", cursor)
+			}
+			if cursor-tt.cursor == len(data) {
+				t.Error("stale cursor should not look like a contiguous delta")
+			}
+		})
+	}
+
+	// Clear drops data but keeps the cursor monotonic
+	rb.Clear()
+	if rb.Cursor() != 10 {
+		t.Errorf("expected cursor 10 after clear, got %d", rb.Cursor())
+	}
+}
+
+func TestANSISafeRingBuffer_Eviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "no eviction keeps everything",
+			capacity: 32,
+			writes:   []string{"\x1b[31mred\x1b[0m"},
+			expected: "\x1b[31mred\x1b[0m",
+		},
+		{
+			name:     "cut escape sequence skips to next sequence",
+			capacity: 12,
+			writes:   []string{"ab\x1b[31mred", "\x1b[0mxy"},
+			expected: "\x1b[0mxy",
+		},
+		{
+			name:     "cut line skips to next line",
+			capacity: 10,
+			writes:   []string{"line one\nline two\n"},
+			expected: "line two\n",
+		},
+		{
+			name:     "newline before escape",
+			capacity: 14,
+			writes:   []string{"xxxx[1mbold\n", "\x1b[0mz"},
+			expected: "\x1b[0mz",
+		},
+		{
+			name:     "cut utf-8 character without boundary",
+			capacity: 4,
+			writes:   []string{"a界bc"},
+			expected: "bc",
+		},
+		{
+			name:     "plain text without boundary is kept",
+			capacity: 4,
+			writes:   []string{"abcdef"},
+			expected: "cdef",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := NewANSISafeRingBuffer(tt.capacity)
+			total := 0
+			for _, w := range tt.writes {
+				rb.Write([]byte(w))
+				total += len(w)
+			}
+
+			if got := string(rb.ReadAll()); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+
+			// Cursors still count every byte written
+			if rb.Cursor() != total {
+				t.Errorf("expected cursor %d, got %d", total, rb.Cursor())
+			}
+			data, cursor := rb.ReadFrom(0)
+			if string(data) != tt.expected || cursor != total {
+				t.Errorf("ReadFrom returned %q at %d", string(data), cursor)
+			}
+		})
+	}
+}
+
+func TestANSISafeRingBuffer_NeverStartsMidSequence(t *testing.T) {
+	rb := NewANSISafeRingBuffer(64)
+	for i := 0; i < 200; i++ {
+		rb.Write([]byte("\x1b[38;5;196mcolored output\x1b[0m "))
+		data := rb.ReadAll()
+		if len(data) > 0 && data[0] != 0x1b {
+			t.Fatalf("buffer starts mid-sequence after write %d: %q", i, data)
+		}
+		if len(data) > rb.Cap() {
+			t.Fatalf("buffer exceeds capacity: %d", len(data))
+		}
+	}
+}
@@ -69,18 +69,73 @@ func runMigrations(db *sql.DB) error {
 		pid INTEGER,
 		log_file_path TEXT NOT NULL,
 		preview_line TEXT,
+		tags TEXT,
+		max_duration INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 	CREATE INDEX IF NOT EXISTS idx_sessions_status ON sessions(status);
+
+	-- One row per tag in sessions.tags, so sessions can be looked up by tag
+	-- through an index rather than by scanning the JSON arrays
+	CREATE TABLE IF NOT EXISTS session_tags (
+		session_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (session_id, tag)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_session_tags_tag ON session_tags(tag, session_id);
 	`
 
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
+	// Columns added after the initial schema
+	if err := addColumnIfMissing(db, "sessions", "tags", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "sessions", "max_duration", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table created by an older schema.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
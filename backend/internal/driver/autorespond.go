@@ -0,0 +1,34 @@
+package driver
+
+import "regexp"
+
+// AutoRespondRule answers claude_confirm prompts matching Pattern with
+// Response, as if a user had sent it in an event_response message.
+type AutoRespondRule struct {
+	Pattern  *regexp.Regexp
+	Response string
+}
+
+// NewSafeAutoResponder returns rules that accept, once, prompts to create
+// or edit a file given by a plain relative path. Prompts to delete, remove
+// or overwrite files, and paths that are absolute, start with "~" or ".",
+// or contain "..", are left for a user to answer.
+func NewSafeAutoResponder() []AutoRespondRule {
+	return []AutoRespondRule{
+		{
+			Pattern:  regexp.MustCompile(`^Do you want to (?:create|edit|modify|update|write) (?:[\w-]+/)*[\w-]+(?:\.[\w-]+)*\?$`),
+			Response: "yes",
+		},
+	}
+}
+
+// autoResponse returns the input answering event by the first matching
+// rule, if any.
+func (d *ClaudeDriver) autoResponse(event SmartEvent) ([]byte, bool) {
+	for _, rule := range d.AutoRespondRules {
+		if rule.Pattern != nil && rule.Pattern.MatchString(event.Prompt) {
+			return d.RespondToEvent(event, rule.Response), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,183 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+)
+
+// BashDriver is a driver for interactive shells such as bash, sh, zsh and fish.
+//
+// It reports a "shell_prompt" event when the shell is waiting for a command,
+// a "sudo_password" event when sudo asks for a password, and a "question"
+// event for (y/n) confirmations. Shell output carries no conversation, so
+// it produces no messages.
+type BashDriver struct {
+	// StrictPromptDetection only accepts user@host style prompts, such as
+	// "alice@box:~/src$ ". By default any line ending in $, # or % counts,
+	// which also matches custom prompts but may match ordinary output.
+	StrictPromptDetection bool
+
+	// questionPattern matches patterns like "(y/n)", "(yes/no)", etc.
+	questionPattern *regexp.Regexp
+
+	// sudoPattern matches sudo's password prompt
+	sudoPattern *regexp.Regexp
+
+	// promptPattern matches any line ending in a prompt character
+	promptPattern *regexp.Regexp
+
+	// strictPromptPattern matches user@host style prompts
+	strictPromptPattern *regexp.Regexp
+
+	// buffer accumulates recent output so prompts split across chunks are seen.
+	buffer *bytes.Buffer
+
+	// maxBufferSize limits the buffer size to prevent unbounded growth.
+	maxBufferSize int
+}
+
+// NewBashDriver creates a new BashDriver instance with wide prompt detection.
+func NewBashDriver() *BashDriver {
+	return &BashDriver{
+		// Match patterns like (y/n), (yes/no), (Y/N), etc.
+		questionPattern: regexp.MustCompile(`\(([yY])/([nN])\)|\(([yY]es)/([nN]o)\)`),
+
+		// Match "[sudo] password for alice: "
+		sudoPattern: regexp.MustCompile(`\[sudo\] password for [^:]+:\s*$`),
+
+		// Match "$ ", "# " or "% " at the end of the line
+		promptPattern: regexp.MustCompile(`[$#%]\s*$`),
+
+		// Match "alice@box:~$ ", "[alice@box src]# " and "(venv) alice@box ~ % "
+		strictPromptPattern: regexp.MustCompile(`^(\([^)]*\)\s*)?(\[[\w.-]+@[\w.-]+[^\]]*\]|[\w.-]+@[\w.-]+[^$#%]*)[$#%]\s*$`),
+
+		buffer:        &bytes.Buffer{},
+		maxBufferSize: 4096, // Keep last 4KB for pattern matching
+	}
+}
+
+// Name returns the name of the driver.
+func (d *BashDriver) Name() string {
+	return "bash"
+}
+
+// Capabilities reports the features supported by the shell driver.
+func (d *BashDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		SupportsSmartEvents: true,
+		SupportsAutoRespond: true,
+	}
+}
+
+// Parse processes a chunk of PTY output and detects shell prompts and questions.
+// Only the line the cursor is on is considered, so each prompt is reported
+// once, when the output that completes it arrives.
+func (d *BashDriver) Parse(ctx context.Context, chunk []byte) (*ParseResult, error) {
+	result := &ParseResult{
+		RawData:     chunk,
+		SmartEvents: []SmartEvent{},
+		Messages:    []Message{},
+	}
+
+	// Append to buffer for pattern matching
+	d.buffer.Write(chunk)
+
+	// Trim buffer if it exceeds max size
+	if d.buffer.Len() > d.maxBufferSize {
+		data := d.buffer.Bytes()
+		d.buffer.Reset()
+		d.buffer.Write(data[len(data)-d.maxBufferSize:])
+	}
+
+	// Chunks that only move the cursor or change modes leave the line as it was
+	if len(bytes.TrimSpace(ansiPattern.ReplaceAll(chunk, nil))) == 0 {
+		return result, nil
+	}
+
+	line := currentLine(ansiPattern.ReplaceAll(d.buffer.Bytes(), nil))
+	if strings.TrimSpace(line) == "" {
+		return result, nil
+	}
+	prompt := strings.TrimSpace(line)
+
+	switch {
+	case d.sudoPattern.MatchString(line):
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+			Kind:   "sudo_password",
+			Prompt: prompt,
+		})
+	case d.questionPattern.MatchString(line):
+		matches := d.questionPattern.FindStringSubmatch(line)
+		options := []string{"y", "n"}
+		if matches[3] != "" {
+			options = []string{"yes", "no"}
+		}
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+			Kind:    "question",
+			Options: options,
+			Prompt:  prompt,
+		})
+	case d.isPrompt(line):
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+			Kind:   "shell_prompt",
+			Prompt: prompt,
+		})
+	}
+
+	return result, nil
+}
+
+// isPrompt reports whether line looks like a shell prompt.
+func (d *BashDriver) isPrompt(line string) bool {
+	if d.StrictPromptDetection {
+		return d.strictPromptPattern.MatchString(strings.TrimSpace(line))
+	}
+	return d.promptPattern.MatchString(line)
+}
+
+// currentLine returns the text of the line the cursor is on: the text after
+// the last newline, from its last carriage return if the line was redrawn.
+func currentLine(data []byte) string {
+	line := string(data[bytes.LastIndexByte(data, '\n')+1:])
+	line = strings.TrimRight(line, "\r")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return line
+}
+
+// FormatInput formats an input action into bytes for PTY.
+func (d *BashDriver) FormatInput(action InputAction) []byte {
+	switch action.Type {
+	case "text":
+		return []byte(action.Content)
+	case "command":
+		return []byte(action.Content + KeyEnter)
+	case "key":
+		return formatKey(action.Content)
+	case "confirm":
+		return []byte(action.Content + KeyEnter)
+	case "cancel", "interrupt":
+		return []byte(KeyCtrlC)
+	default:
+		return []byte(action.Content)
+	}
+}
+
+// RespondToEvent generates the appropriate input for a SmartEvent response.
+// Passwords and commands are sent as typed, followed by Enter.
+func (d *BashDriver) RespondToEvent(event SmartEvent, response string) []byte {
+	if event.Kind == "question" {
+		if input, ok := yesNoResponse(event, response); ok {
+			return input
+		}
+	}
+	return []byte(response + KeyEnter)
+}
+
+// Reset clears the internal buffer.
+func (d *BashDriver) Reset() {
+	d.buffer.Reset()
+}
@@ -0,0 +1,223 @@
+package driver
+
+import (
+	"context"
+	"testing"
+)
+
+// TestBashDriver_Name tests the Name method
+func TestBashDriver_Name(t *testing.T) {
+	driver := NewBashDriver()
+	if driver.Name() != "bash" {
+		t.Errorf("Expected name 'bash', got '%s'", driver.Name())
+	}
+}
+
+// TestBashDriver_Parse tests prompt, sudo and question detection
+func TestBashDriver_Parse(t *testing.T) {
+	tests := []struct {
+		name           string
+		inputs         []string
+		strict         bool
+		expectedKind   string
+		expectedPrompt string
+	}{
+		{
+			name:           "user prompt",
+			inputs:         []string{"alice@box:~/src$ "},
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "alice@box:~/src$",
+		},
+		{
+			name:           "root prompt",
+			inputs:         []string{"root@box:/# "},
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "root@box:/#",
+		},
+		{
+			name:           "zsh prompt",
+			inputs:         []string{"box% "},
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "box%",
+		},
+		{
+			name:           "colored prompt",
+			inputs:         []string{"\x1b[01;32malice@box\x1b[00m:\x1b[01;34m~\x1b[00m$ "},
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "alice@box:~$",
+		},
+		{
+			name:           "prompt after output",
+			inputs:         []string{"total 0\r\n", "alice@box:~$ "},
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "alice@box:~$",
+		},
+		{
+			name:           "prompt split across chunks",
+			inputs:         []string{"alice@bo", "x:~$ "},
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "alice@box:~$",
+		},
+		{
+			name:         "typing after prompt",
+			inputs:       []string{"alice@box:~$ ", "ls"},
+			expectedKind: "",
+		},
+		{
+			name:         "output line",
+			inputs:       []string{"compiling main.go\r\n"},
+			expectedKind: "",
+		},
+		{
+			name:           "sudo password",
+			inputs:         []string{"[sudo] password for alice: "},
+			expectedKind:   "sudo_password",
+			expectedPrompt: "[sudo] password for alice:",
+		},
+		{
+			name:           "y/n question",
+			inputs:         []string{"Remove all files? (y/n) "},
+			expectedKind:   "question",
+			expectedPrompt: "Remove all files? (y/n)",
+		},
+		{
+			name:           "strict user prompt",
+			inputs:         []string{"alice@box:~/src$ "},
+			strict:         true,
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "alice@box:~/src$",
+		},
+		{
+			name:           "strict bracketed prompt",
+			inputs:         []string{"[alice@box src]# "},
+			strict:         true,
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "[alice@box src]#",
+		},
+		{
+			name:           "strict virtualenv prompt",
+			inputs:         []string{"(venv) alice@box ~ % "},
+			strict:         true,
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "(venv) alice@box ~ %",
+		},
+		{
+			name:         "strict ignores bare prompt characters",
+			inputs:       []string{"Progress: 100%"},
+			strict:       true,
+			expectedKind: "",
+		},
+		{
+			name:           "wide matches bare prompt characters",
+			inputs:         []string{"Progress: 100%"},
+			expectedKind:   "shell_prompt",
+			expectedPrompt: "Progress: 100%",
+		},
+		{
+			name:           "strict still detects sudo",
+			inputs:         []string{"[sudo] password for alice: "},
+			strict:         true,
+			expectedKind:   "sudo_password",
+			expectedPrompt: "[sudo] password for alice:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewBashDriver()
+			driver.StrictPromptDetection = tt.strict
+
+			var result *ParseResult
+			for _, input := range tt.inputs {
+				var err error
+				result, err = driver.Parse(context.Background(), []byte(input))
+				if err != nil {
+					t.Fatalf("Parse error: %v", err)
+				}
+			}
+
+			if tt.expectedKind == "" {
+				if len(result.SmartEvents) != 0 {
+					t.Errorf("Expected no events, got %+v", result.SmartEvents)
+				}
+				return
+			}
+			if len(result.SmartEvents) != 1 {
+				t.Fatalf("Expected 1 event, got %+v", result.SmartEvents)
+			}
+			event := result.SmartEvents[0]
+			if event.Kind != tt.expectedKind {
+				t.Errorf("Expected kind '%s', got '%s'", tt.expectedKind, event.Kind)
+			}
+			if event.Prompt != tt.expectedPrompt {
+				t.Errorf("Expected prompt '%s', got '%s'", tt.expectedPrompt, event.Prompt)
+			}
+		})
+	}
+}
+
+// TestBashDriver_PromptNotRepeated tests that mode changes after a prompt do not repeat the event
+func TestBashDriver_PromptNotRepeated(t *testing.T) {
+	driver := NewBashDriver()
+
+	result, _ := driver.Parse(context.Background(), []byte("alice@box:~$ "))
+	if len(result.SmartEvents) != 1 {
+		t.Fatalf("Expected prompt event, got %+v", result.SmartEvents)
+	}
+
+	// Bracketed paste mode is enabled after the prompt is drawn
+	result, _ = driver.Parse(context.Background(), []byte("\x1b[?2004h"))
+	if len(result.SmartEvents) != 0 {
+		t.Errorf("Expected no repeated event, got %+v", result.SmartEvents)
+	}
+}
+
+// TestBashDriver_RespondToEvent tests response formatting for each event kind
+func TestBashDriver_RespondToEvent(t *testing.T) {
+	driver := NewBashDriver()
+
+	tests := []struct {
+		name     string
+		event    SmartEvent
+		response string
+		expected string
+	}{
+		{"sudo password", SmartEvent{Kind: "sudo_password"}, "hunter2", "hunter2\r"},
+		{"shell command", SmartEvent{Kind: "shell_prompt"}, "ls -la", "ls -la\r"},
+		{"y/n yes", SmartEvent{Kind: "question", Options: []string{"y", "n"}}, "yes", "y\r"},
+		{"yes/no no", SmartEvent{Kind: "question", Options: []string{"yes", "no"}}, "N", "no\r"},
+		{"question other", SmartEvent{Kind: "question", Options: []string{"y", "n"}}, "maybe", "maybe\r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(driver.RespondToEvent(tt.event, tt.response)); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestBashDriver_Registered tests that shells resolve to the bash driver
+func TestBashDriver_Registered(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"bash", "bash"},
+		{"/bin/bash -l", "bash"},
+		{"sh", "bash"},
+		{"/usr/bin/zsh", "bash"},
+		{"fish --private", "bash"},
+		{"shellcheck script.sh", "generic"},
+		{"bash -c claude", "claude"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if name := ResolveDriver(tt.command).Name(); name != tt.expected {
+				t.Errorf("Expected driver '%s', got '%s'", tt.expected, name)
+			}
+		})
+	}
+}
@@ -2,11 +2,79 @@ package driver
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// DefaultClaudeActionVerbs are the tool names recognized as Claude actions,
+// e.g. "● Write(file.txt)". They cover the Claude Code 1.x tool set.
+var DefaultClaudeActionVerbs = []string{
+	"Write", "Read", "Edit", "MultiEdit", "Delete",
+	"Bash", "Search", "Grep", "Glob", "LS",
+	"NotebookRead", "NotebookEdit", "TodoWrite",
+	"Task", "WebFetch", "WebSearch",
+}
+
+// DefaultClaudeErrorBanners are the phrases that mark a line of Claude
+// output as an error, such as "API Error: 529 Overloaded". They are matched
+// case-insensitively.
+var DefaultClaudeErrorBanners = []string{
+	"API Error", "rate limit", "permission denied", "usage limit reached",
+}
+
+// ClaudeConfig configures how a ClaudeDriver recognizes conversation messages.
+type ClaudeConfig struct {
+	// ActionVerbs are the tool names recognized as actions.
+	// If empty, DefaultClaudeActionVerbs is used.
+	ActionVerbs []string
+
+	// ActionPattern optionally replaces the pattern built from ActionVerbs.
+	// It must have two capture groups: the tool name and its argument.
+	ActionPattern *regexp.Regexp
+
+	// ErrorBanners are the phrases whose lines are reported as "error"
+	// events. If empty, DefaultClaudeErrorBanners is used.
+	ErrorBanners []string
+}
+
+// buildActionPattern compiles the action pattern for the given verbs.
+func buildActionPattern(verbs []string) *regexp.Regexp {
+	quoted := make([]string, len(verbs))
+	for i, v := range verbs {
+		quoted[i] = regexp.QuoteMeta(v)
+	}
+	return regexp.MustCompile(`●\s*(` + strings.Join(quoted, "|") + `)\(([^)]+)\)`)
+}
+
+// buildErrorPattern compiles the error pattern for the given banners.
+func buildErrorPattern(banners []string) *regexp.Regexp {
+	quoted := make([]string, len(banners))
+	for i, b := range banners {
+		quoted[i] = regexp.QuoteMeta(b)
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+}
+
+// DriverState is the phase a Claude session is in, as inferred from its output.
+type DriverState string
+
+const (
+	// StateIdle means Claude is waiting at its prompt for a new command.
+	StateIdle DriverState = "idle"
+	// StateThinking means Claude is showing its "Thinking…" indicator.
+	StateThinking DriverState = "thinking"
+	// StateActing means Claude is running a tool such as Write or Bash.
+	StateActing DriverState = "acting"
+	// StateWaitingInput means Claude is asking the user to confirm an action.
+	StateWaitingInput DriverState = "waiting_input"
+)
+
 // ClaudeDriver is a driver for parsing Claude CLI output.
 // It detects question patterns, waiting-for-input states, and conversation messages.
 type ClaudeDriver struct {
@@ -19,6 +87,23 @@ type ClaudeDriver struct {
 	// idlePattern matches patterns that indicate waiting for input.
 	idlePattern *regexp.Regexp
 
+	// costPattern matches cost reports like "Total cost: $0.0123" and
+	// inline amounts like "$0.42"
+	costPattern *regexp.Regexp
+
+	// tokenPattern matches token counts like "1.2k input, 345 output" or
+	// "1,234 tokens input, 567 tokens output"
+	tokenPattern *regexp.Regexp
+
+	// spinnerPattern matches Claude's progress spinner, e.g. "✻ Thinking…"
+	spinnerPattern *regexp.Regexp
+
+	// readyPattern matches the empty input prompt shown when Claude is ready
+	readyPattern *regexp.Regexp
+
+	// errorPattern matches the error banners, e.g. "API Error"
+	errorPattern *regexp.Regexp
+
 	// Message parsing patterns
 	userCommandPattern  *regexp.Regexp // "> command"
 	claudeResponseStart *regexp.Regexp // "● response"
@@ -40,6 +125,12 @@ type ClaudeDriver struct {
 	lastResponse     string
 	lastActionResult string
 	lastActionTime   time.Time
+	lastUsage        string
+	lastError        string
+	lastErrorTime    time.Time
+
+	// busy is set by a "busy" event and cleared by the next "idle" event
+	busy bool
 
 	// Output block collector for multi-line outputs
 	inOutputBlock     bool
@@ -57,10 +148,52 @@ type ClaudeDriver struct {
 	lastResumeSelection     string
 	resumeSelectionComplete bool
 	lastSessionResumed      string
+
+	// state is the current phase, guarded by stateMu so State can be
+	// called from outside the parsing goroutine.
+	stateMu sync.RWMutex
+	state   DriverState
+
+	// OnStateChange, if set, is called after each state transition.
+	OnStateChange func(old, new DriverState)
+
+	// AutoRespondRules, if set, answer matching claude_confirm prompts:
+	// Parse returns the answer as the result's AutoResponse and forgets the
+	// prompt, so it is answered once. See NewSafeAutoResponder.
+	AutoRespondRules []AutoRespondRule
 }
 
 // NewClaudeDriver creates a new ClaudeDriver instance.
 func NewClaudeDriver() *ClaudeDriver {
+	return newClaudeDriver(buildActionPattern(DefaultClaudeActionVerbs), buildErrorPattern(DefaultClaudeErrorBanners))
+}
+
+// NewClaudeDriverWithConfig creates a new ClaudeDriver with custom action
+// and error recognition.
+func NewClaudeDriverWithConfig(cfg ClaudeConfig) (*ClaudeDriver, error) {
+	banners := cfg.ErrorBanners
+	if len(banners) == 0 {
+		banners = DefaultClaudeErrorBanners
+	}
+	errorPattern := buildErrorPattern(banners)
+
+	if cfg.ActionPattern != nil {
+		if cfg.ActionPattern.NumSubexp() < 2 {
+			return nil, fmt.Errorf("action pattern must have 2 capture groups, got %d", cfg.ActionPattern.NumSubexp())
+		}
+		return newClaudeDriver(cfg.ActionPattern, errorPattern), nil
+	}
+
+	verbs := cfg.ActionVerbs
+	if len(verbs) == 0 {
+		verbs = DefaultClaudeActionVerbs
+	}
+	return newClaudeDriver(buildActionPattern(verbs), errorPattern), nil
+}
+
+// newClaudeDriver creates a ClaudeDriver using the given action and error
+// patterns.
+func newClaudeDriver(actionPattern, errorPattern *regexp.Regexp) *ClaudeDriver {
 	return &ClaudeDriver{
 		// Match patterns like (y/n), (yes/no), (Y/N), etc.
 		questionPattern: regexp.MustCompile(`\(([yY])/([nN])\)|\(([yY]es)/([nN]o)\)`),
@@ -73,14 +206,31 @@ func NewClaudeDriver() *ClaudeDriver {
 		// Common patterns: "? ", "> ", "$ ", "Continue? ", etc.
 		idlePattern: regexp.MustCompile(`(\?\s*$|>\s*$|\$\s*$|Continue\?\s*$|Proceed\?\s*$)`),
 
+		// Match "Total cost: $0.0123" from /cost and "Session cost: $1.20",
+		// or any other "$x.xx" amount such as a status line's "$0.42"
+		costPattern: regexp.MustCompile(`(?i)\bcost\b[^$\n]*\$(\d+(?:\.\d+)?)|\$(\d+\.\d+)\b`),
+
+		// Match "1.2k input, 345 output" from /cost's per-model usage lines
+		// and "1,234 tokens input, 567 tokens output" from cost summaries
+		tokenPattern: regexp.MustCompile(`([\d.,]+[kKmM]?)\s+(?:tokens\s+)?input,\s*([\d.,]+[kKmM]?)\s+(?:tokens\s+)?output`),
+
+		// Match "✻ Thinking…", "· Running… (esc to interrupt)" and similar
+		spinnerPattern: regexp.MustCompile(`[·✢✳✶✻✽]\s*[A-Z][a-z]+(?:…|\.\.\.)|Thinking(?:…|\.\.\.)|esc to interrupt`),
+
+		// Match the empty "│ > │" input box, its "? for shortcuts" hint, or a bare "> "
+		readyPattern: regexp.MustCompile(`(?m)│\s*>\s+│|\? for shortcuts|^>\s*$`),
+
+		errorPattern: errorPattern,
+
 		// Message parsing patterns
 		userCommandPattern:  regexp.MustCompile(`^>\s+(.+)$`),
 		claudeResponseStart: regexp.MustCompile(`●\s*(.+)`),
-		claudeActionPattern: regexp.MustCompile(`●\s*(Write|Read|Edit|Delete|Bash|Search)\(([^)]+)\)`),
+		claudeActionPattern: actionPattern,
 		claudeResultPattern: regexp.MustCompile(`⎿\s*(.+)`),
 
 		buffer:        &bytes.Buffer{},
 		maxBufferSize: 4096, // Keep last 4KB for pattern matching
+		state:         StateIdle,
 	}
 }
 
@@ -89,8 +239,22 @@ func (d *ClaudeDriver) Name() string {
 	return "claude"
 }
 
+// Capabilities reports the features supported by the Claude driver.
+func (d *ClaudeDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		SupportsSmartEvents:          true,
+		SupportsConversationMessages: true,
+		SupportsMenuNavigation:       true,
+		SupportsAutoRespond:          true,
+	}
+}
+
 // Parse processes a chunk of PTY output and detects smart events and messages.
-func (d *ClaudeDriver) Parse(chunk []byte) (*ParseResult, error) {
+// The chunk is always appended to the driver's buffer, so it counts towards
+// later matches; ctx is checked after that and between the detection stages.
+// Once ctx is done, the events and messages detected so far are returned
+// with ctx's error, and State is not updated for the chunk.
+func (d *ClaudeDriver) Parse(ctx context.Context, chunk []byte) (*ParseResult, error) {
 	result := &ParseResult{
 		RawData:     chunk,
 		SmartEvents: []SmartEvent{},
@@ -113,6 +277,9 @@ func (d *ClaudeDriver) Parse(chunk []byte) (*ParseResult, error) {
 
 	// Strip ANSI escape sequences for pattern matching
 	cleanContent := d.stripANSI(bufferContent)
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
 
 	// Check for standard question patterns (y/n), (yes/no)
 	if matches := d.questionPattern.FindSubmatch(cleanContent); matches != nil {
@@ -135,24 +302,251 @@ func (d *ClaudeDriver) Parse(chunk []byte) (*ParseResult, error) {
 			})
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
 
 	// Check for Claude Code's specific menu pattern
 	if matches := d.claudeMenuPattern.FindSubmatch(cleanContent); matches != nil {
 		prompt := string(matches[0])
 		// Claude Code's menu options: 1=Yes, 2=Yes allow all, Esc=Cancel
-		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+		event := SmartEvent{
 			Kind:    "claude_confirm",
 			Options: []string{"1", "2", "esc"},
 			Prompt:  prompt,
-		})
+		}
+		if input, ok := d.autoResponse(event); ok {
+			result.AutoResponse = &input
+			// Forget the answered prompt so later chunks do not detect it
+			d.buffer.Reset()
+		}
+		result.SmartEvents = append(result.SmartEvents, event)
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	// Check for cost and token usage reports
+	d.detectUsage(cleanContent, result)
+
+	// Check for spinners and the returning prompt
+	d.detectActivity(chunk, result)
+
+	// Check for API errors, rate limits and refused permissions
+	d.detectErrors(chunk, result)
+	if err := ctx.Err(); err != nil {
+		return result, err
 	}
 
 	// Parse conversation messages from the chunk
 	d.parseMessages(chunk, result)
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	d.updateState(chunk, result)
 
 	return result, nil
 }
 
+// State returns the current phase of the Claude session.
+func (d *ClaudeDriver) State() DriverState {
+	d.stateMu.RLock()
+	defer d.stateMu.RUnlock()
+	return d.state
+}
+
+// updateState moves to the phase indicated by the parsed chunk. When a chunk
+// carries several indicators, a pending confirmation wins over a tool call,
+// which wins over the thinking indicator, which wins over an idle prompt.
+func (d *ClaudeDriver) updateState(chunk []byte, result *ParseResult) {
+	for _, event := range result.SmartEvents {
+		if event.Kind == "claude_confirm" {
+			d.setState(StateWaitingInput)
+			return
+		}
+	}
+	for _, msg := range result.Messages {
+		if msg.Type == "claude_action" {
+			d.setState(StateActing)
+			return
+		}
+	}
+
+	clean := d.stripANSI(chunk)
+	if bytes.Contains(clean, []byte("Thinking…")) || bytes.Contains(clean, []byte("Thinking...")) {
+		d.setState(StateThinking)
+		return
+	}
+	if d.idlePattern.Match(clean) {
+		d.setState(StateIdle)
+	}
+}
+
+// setState records a new state and notifies OnStateChange if it changed.
+func (d *ClaudeDriver) setState(state DriverState) {
+	d.stateMu.Lock()
+	old := d.state
+	d.state = state
+	d.stateMu.Unlock()
+
+	if old != state && d.OnStateChange != nil {
+		d.OnStateChange(old, state)
+	}
+}
+
+// detectActivity reports a "busy" event when a spinner first appears in
+// the output and an "idle" event when the empty prompt returns after it.
+// Only the chunk is examined, so spinner frames left in the buffer are not
+// counted again, and each event is sent once per busy period. A chunk with
+// a spinner is busy even if it also redraws the prompt.
+func (d *ClaudeDriver) detectActivity(chunk []byte, result *ParseResult) {
+	clean := d.stripANSI(chunk)
+
+	if loc := d.spinnerPattern.FindIndex(clean); loc != nil {
+		if !d.busy {
+			d.busy = true
+			result.SmartEvents = append(result.SmartEvents, SmartEvent{
+				Kind:   "busy",
+				Prompt: strings.TrimSpace(lineAt(clean, loc[0])),
+			})
+		}
+		return
+	}
+
+	if d.busy && d.readyPattern.Match(clean) {
+		d.busy = false
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{Kind: "idle"})
+	}
+}
+
+// detectErrors reports each line of the chunk containing an error banner
+// as an "error" event, with the line as its prompt and the matched banner
+// as its "banner" data. Only the chunk is examined, so banners left in the
+// buffer are not reported again, and a line redrawn within two seconds is
+// reported once.
+func (d *ClaudeDriver) detectErrors(chunk []byte, result *ParseResult) {
+	clean := d.stripANSI(chunk)
+	now := time.Now()
+	for _, loc := range d.errorPattern.FindAllIndex(clean, -1) {
+		line := strings.TrimSpace(lineAt(clean, loc[0]))
+		if line == d.lastError && now.Sub(d.lastErrorTime) <= 2*time.Second {
+			continue
+		}
+		d.lastError = line
+		d.lastErrorTime = now
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+			Kind:   "error",
+			Prompt: line,
+			Data:   map[string]string{"banner": string(clean[loc[0]:loc[1]])},
+		})
+	}
+}
+
+// lineAt returns the line of data containing the byte at index i.
+func lineAt(data []byte, i int) string {
+	start := bytes.LastIndexAny(data[:i], "\r\n") + 1
+	end := len(data)
+	if n := bytes.IndexAny(data[i:], "\r\n"); n >= 0 {
+		end = i + n
+	}
+	return string(data[start:end])
+}
+
+// lastCostMatch returns the submatch indices of the last cost in content,
+// skipping amounts in Claude's responses ("● ..." lines), such as prices it
+// is discussing. It returns nil if there is none.
+func (d *ClaudeDriver) lastCostMatch(content []byte) []int {
+	matches := d.costPattern.FindAllSubmatchIndex(content, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(strings.TrimSpace(lineAt(content, matches[i][0])), "●") {
+			return matches[i]
+		}
+	}
+	return nil
+}
+
+// detectUsage reports the most recent cost report in content as a "usage"
+// event and a "usage_summary" message. Data holds "cost_usd" and, when
+// /cost lists them, the summed "input_tokens" and "output_tokens"; the
+// message's Metadata holds the same values as float64. Claude prints
+// session totals, so both are only emitted when the reported values change.
+func (d *ClaudeDriver) detectUsage(content []byte, result *ParseResult) {
+	match := d.lastCostMatch(content)
+	if match == nil {
+		return
+	}
+	// Amounts after "cost" are in the first group, bare ones in the second
+	amount := match[2:4]
+	if amount[0] < 0 {
+		amount = match[4:6]
+	}
+	data := map[string]string{"cost_usd": string(content[amount[0]:amount[1]])}
+
+	// /cost lists token counts after the cost, one line per model
+	var input, output int
+	tokens := d.tokenPattern.FindAllSubmatch(content[match[1]:], -1)
+	for _, m := range tokens {
+		input += parseTokenCount(string(m[1]))
+		output += parseTokenCount(string(m[2]))
+	}
+	if len(tokens) > 0 {
+		data["input_tokens"] = strconv.Itoa(input)
+		data["output_tokens"] = strconv.Itoa(output)
+	}
+
+	key := data["cost_usd"] + "/" + data["input_tokens"] + "/" + data["output_tokens"]
+	if key == d.lastUsage {
+		return
+	}
+	d.lastUsage = key
+
+	start := bytes.LastIndexByte(content[:match[0]], '\n') + 1
+	end := match[1] + bytes.IndexByte(content[match[1]:], '\n')
+	if end < match[1] {
+		end = len(content)
+	}
+	line := strings.TrimSpace(string(content[start:end]))
+	result.SmartEvents = append(result.SmartEvents, SmartEvent{
+		Kind:   "usage",
+		Prompt: line,
+		Data:   data,
+	})
+
+	metadata := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			metadata[key] = n
+		}
+	}
+	result.Messages = append(result.Messages, Message{
+		Timestamp: time.Now(),
+		Type:      "usage_summary",
+		Content:   line,
+		Metadata:  metadata,
+	})
+}
+
+// parseTokenCount parses token counts like "345", "12,345" or "1.2k".
+// Unparseable counts are treated as zero.
+func parseTokenCount(s string) int {
+	s = strings.ReplaceAll(s, ",", "")
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		multiplier = 1e3
+		s = s[:len(s)-1]
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "M"):
+		multiplier = 1e6
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int(math.Round(n * multiplier))
+}
+
 // parseMessages extracts conversation messages from the output chunk.
 func (d *ClaudeDriver) parseMessages(chunk []byte, result *ParseResult) {
 	content := string(d.stripANSI(chunk))
@@ -421,6 +815,11 @@ func (d *ClaudeDriver) isUINoiseOrLoading(line string) bool {
 		return false
 	}
 
+	// Error banners are shown in boxes and menus too, but are never noise
+	if d.errorPattern.MatchString(line) {
+		return false
+	}
+
 	// Loading indicators
 	if strings.HasPrefix(line, "·") && strings.Contains(line, "…") {
 		return true
@@ -514,6 +913,9 @@ func (d *ClaudeDriver) Reset() {
 	d.inResumeMenu = false
 	d.lastResumeSelection = ""
 	d.resumeSelectionComplete = false
+	d.busy = false
+	d.lastError = ""
+	d.setState(StateIdle)
 }
 
 // Flush returns any pending output block as messages.
@@ -567,7 +969,7 @@ func (d *ClaudeDriver) FormatInput(action InputAction) []byte {
 		// Command input - add Enter at the end
 		return []byte(action.Content + KeyEnter)
 	case "key":
-		return d.formatKey(action.Content)
+		return formatKey(action.Content)
 	case "confirm":
 		// Confirmation - could be "y", "yes", "1", "2", etc.
 		return d.formatConfirmation(action.Content)
@@ -598,34 +1000,6 @@ func (d *ClaudeDriver) RespondToEvent(event SmartEvent, response string) []byte
 	}
 }
 
-// formatKey converts a key name to its escape sequence
-func (d *ClaudeDriver) formatKey(keyName string) []byte {
-	switch strings.ToLower(keyName) {
-	case "enter", "return":
-		return []byte(KeyEnter)
-	case "escape", "esc":
-		return []byte(KeyEscape)
-	case "ctrl+c", "ctrlc":
-		return []byte(KeyCtrlC)
-	case "ctrl+d", "ctrld":
-		return []byte(KeyCtrlD)
-	case "backspace", "bs":
-		return []byte(KeyBackspace)
-	case "tab":
-		return []byte(KeyTab)
-	case "up", "arrowup":
-		return []byte(KeyUp)
-	case "down", "arrowdown":
-		return []byte(KeyDown)
-	case "left", "arrowleft":
-		return []byte(KeyLeft)
-	case "right", "arrowright":
-		return []byte(KeyRight)
-	default:
-		return []byte(keyName)
-	}
-}
-
 // formatConfirmation formats a confirmation response
 func (d *ClaudeDriver) formatConfirmation(response string) []byte {
 	switch strings.ToLower(response) {
@@ -1,6 +1,9 @@
 package driver
 
 import (
+	"context"
+	"errors"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -53,7 +56,7 @@ func TestClaudeDriver_Parse_QuestionPattern(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			driver := NewClaudeDriver()
-			result, err := driver.Parse([]byte(tt.input))
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
 			
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -121,7 +124,7 @@ func TestClaudeDriver_Parse_ClaudeMenuPattern(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			driver := NewClaudeDriver()
-			result, err := driver.Parse([]byte(tt.input))
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
 			
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -188,7 +191,7 @@ func TestClaudeDriver_Parse_UserInput(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			driver := NewClaudeDriver()
-			result, err := driver.Parse([]byte(tt.input))
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
 			
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -258,12 +261,72 @@ func TestClaudeDriver_Parse_ClaudeAction(t *testing.T) {
 			expectMessage:   true,
 			expectedContent: "Search(TODO)",
 		},
+		{
+			name:            "multiedit action",
+			input:           "● MultiEdit(src/app.ts)",
+			expectMessage:   true,
+			expectedContent: "MultiEdit(src/app.ts)",
+		},
+		{
+			name:            "glob action",
+			input:           "● Glob(**/*.go)",
+			expectMessage:   true,
+			expectedContent: "Glob(**/*.go)",
+		},
+		{
+			name:            "ls action",
+			input:           "● LS(internal/driver)",
+			expectMessage:   true,
+			expectedContent: "LS(internal/driver)",
+		},
+		{
+			name:            "grep action",
+			input:           "● Grep(claudeActionPattern)",
+			expectMessage:   true,
+			expectedContent: "Grep(claudeActionPattern)",
+		},
+		{
+			name:            "notebook read action",
+			input:           "● NotebookRead(analysis.ipynb)",
+			expectMessage:   true,
+			expectedContent: "NotebookRead(analysis.ipynb)",
+		},
+		{
+			name:            "notebook edit action",
+			input:           "● NotebookEdit(analysis.ipynb)",
+			expectMessage:   true,
+			expectedContent: "NotebookEdit(analysis.ipynb)",
+		},
+		{
+			name:            "todo write action",
+			input:           "● TodoWrite(Update todo list)",
+			expectMessage:   true,
+			expectedContent: "TodoWrite(Update todo list)",
+		},
+		{
+			name:            "task action",
+			input:           "● Task(Find driver tests)",
+			expectMessage:   true,
+			expectedContent: "Task(Find driver tests)",
+		},
+		{
+			name:            "web fetch action",
+			input:           "● WebFetch(https://example.com/docs)",
+			expectMessage:   true,
+			expectedContent: "WebFetch(https://example.com/docs)",
+		},
+		{
+			name:            "web search action",
+			input:           "● WebSearch(gorilla websocket close codes)",
+			expectMessage:   true,
+			expectedContent: "WebSearch(gorilla websocket close codes)",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			driver := NewClaudeDriver()
-			result, err := driver.Parse([]byte(tt.input))
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
 			
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -285,6 +348,95 @@ func TestClaudeDriver_Parse_ClaudeAction(t *testing.T) {
 	}
 }
 
+// TestClaudeDriver_CustomActionVerbs tests action detection with a configured verb list
+func TestClaudeDriver_CustomActionVerbs(t *testing.T) {
+	driver, err := NewClaudeDriverWithConfig(ClaudeConfig{
+		ActionVerbs: []string{"Write", "MultiEdit", "WebFetch", "Grep"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create driver: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		input        string
+		expectedType string
+		expected     string
+	}{
+		{
+			name:         "multiedit action",
+			input:        "● MultiEdit(src/app.ts)",
+			expectedType: "claude_action",
+			expected:     "MultiEdit(src/app.ts)",
+		},
+		{
+			name:         "webfetch action",
+			input:        "● WebFetch(https://example.com/docs)",
+			expectedType: "claude_action",
+			expected:     "WebFetch(https://example.com/docs)",
+		},
+		{
+			name:         "default verb still configured",
+			input:        "● Write(notes.md)",
+			expectedType: "claude_action",
+			expected:     "Write(notes.md)",
+		},
+		{
+			name:         "plain response is not an action",
+			input:        "● I fetched the documentation and summarized it",
+			expectedType: "claude_response",
+			expected:     "I fetched the documentation and summarized it",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			if len(result.Messages) != 1 {
+				t.Fatalf("Expected 1 message, got %d", len(result.Messages))
+			}
+			msg := result.Messages[0]
+			if msg.Type != tt.expectedType {
+				t.Errorf("Expected type '%s', got '%s'", tt.expectedType, msg.Type)
+			}
+			if msg.Content != tt.expected {
+				t.Errorf("Expected content '%s', got '%s'", tt.expected, msg.Content)
+			}
+		})
+	}
+
+	// Verbs outside the configured list are not reported as actions
+	result, _ := driver.Parse(context.Background(), []byte("● Bash(ls -la)"))
+	if len(result.Messages) != 0 {
+		t.Errorf("Expected unconfigured verb to be ignored, got %v", result.Messages)
+	}
+}
+
+// TestClaudeDriver_CustomActionPattern tests a fully custom action regexp
+func TestClaudeDriver_CustomActionPattern(t *testing.T) {
+	driver, err := NewClaudeDriverWithConfig(ClaudeConfig{
+		ActionPattern: regexp.MustCompile(`●\s*(\w+)\(([^)]+)\)`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create driver: %v", err)
+	}
+
+	result, _ := driver.Parse(context.Background(), []byte("● NotebookEdit(analysis.ipynb)"))
+	if len(result.Messages) != 1 || result.Messages[0].Content != "NotebookEdit(analysis.ipynb)" {
+		t.Errorf("Expected NotebookEdit action, got %v", result.Messages)
+	}
+
+	_, err = NewClaudeDriverWithConfig(ClaudeConfig{
+		ActionPattern: regexp.MustCompile(`●\s*\w+\(.+\)`),
+	})
+	if err == nil {
+		t.Error("Expected error for pattern without capture groups")
+	}
+}
+
 // TestClaudeDriver_Parse_ActionResult tests action result detection
 func TestClaudeDriver_Parse_ActionResult(t *testing.T) {
 	tests := []struct {
@@ -322,7 +474,7 @@ func TestClaudeDriver_Parse_ActionResult(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			driver := NewClaudeDriver()
-			_, err := driver.Parse([]byte(tt.input))
+			_, err := driver.Parse(context.Background(), []byte(tt.input))
 			
 			if err != nil {
 				t.Fatalf("Parse error: %v", err)
@@ -343,6 +495,85 @@ func TestClaudeDriver_Parse_ActionResult(t *testing.T) {
 	}
 }
 
+// TestClaudeDriver_State tests state transitions driven by parsed output
+func TestClaudeDriver_State(t *testing.T) {
+	tests := []struct {
+		name          string
+		inputs        []string
+		expectedState DriverState
+	}{
+		{
+			name:          "initial state",
+			inputs:        nil,
+			expectedState: StateIdle,
+		},
+		{
+			name:          "thinking indicator",
+			inputs:        []string{"✻ Thinking… (3s · esc to interrupt)"},
+			expectedState: StateThinking,
+		},
+		{
+			name:          "tool call",
+			inputs:        []string{"✻ Thinking…", "● Write(hello.txt)\n"},
+			expectedState: StateActing,
+		},
+		{
+			name:          "confirmation menu",
+			inputs:        []string{"● Bash(rm -rf build)\n", "Do you want to delete build?"},
+			expectedState: StateWaitingInput,
+		},
+		{
+			name:          "idle prompt",
+			inputs:        []string{"✻ Thinking…", "Done.\n> "},
+			expectedState: StateIdle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewClaudeDriver()
+			for _, input := range tt.inputs {
+				if _, err := driver.Parse(context.Background(), []byte(input)); err != nil {
+					t.Fatalf("Parse error: %v", err)
+				}
+			}
+			if state := driver.State(); state != tt.expectedState {
+				t.Errorf("Expected state '%s', got '%s'", tt.expectedState, state)
+			}
+		})
+	}
+}
+
+// TestClaudeDriver_OnStateChange tests that the callback fires once per transition
+func TestClaudeDriver_OnStateChange(t *testing.T) {
+	driver := NewClaudeDriver()
+	var transitions []string
+	driver.OnStateChange = func(old, new DriverState) {
+		transitions = append(transitions, string(old)+"->"+string(new))
+	}
+
+	inputs := []string{
+		"✻ Thinking…",
+		"✻ Thinking… (2s)",
+		"● Edit(main.go)\n",
+		"Do you want to modify main.go?",
+	}
+	for _, input := range inputs {
+		driver.Parse(context.Background(), []byte(input))
+	}
+	driver.Reset()
+
+	expected := []string{
+		"idle->thinking",
+		"thinking->acting",
+		"acting->waiting_input",
+		"waiting_input->idle",
+	}
+	if strings.Join(transitions, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected transitions %v, got %v", expected, transitions)
+	}
+}
+
 // TestClaudeDriver_FormatInput tests input formatting
 func TestClaudeDriver_FormatInput(t *testing.T) {
 	tests := []struct {
@@ -615,7 +846,7 @@ func TestClaudeDriver_Reset(t *testing.T) {
 	driver := NewClaudeDriver()
 	
 	// Add some data
-	driver.Parse([]byte("test data"))
+	driver.Parse(context.Background(), []byte("test data"))
 	
 	if driver.buffer.Len() == 0 {
 		t.Fatal("Buffer should have data before reset")
@@ -634,7 +865,7 @@ func TestClaudeDriver_Flush(t *testing.T) {
 	driver := NewClaudeDriver()
 	
 	// Parse some output that creates a pending block
-	driver.Parse([]byte("⎿ Wrote file"))
+	driver.Parse(context.Background(), []byte("⎿ Wrote file"))
 	
 	// Flush should return the pending message
 	messages := driver.Flush()
@@ -665,7 +896,7 @@ func TestClaudeDriver_BufferSizeLimit(t *testing.T) {
 		largeData[i] = 'A'
 	}
 	
-	driver.Parse(largeData)
+	driver.Parse(context.Background(), largeData)
 	
 	if driver.buffer.Len() > driver.maxBufferSize {
 		t.Errorf("Buffer size %d exceeds max %d", driver.buffer.Len(), driver.maxBufferSize)
@@ -677,7 +908,7 @@ func TestClaudeDriver_MultiLineOutput(t *testing.T) {
 	driver := NewClaudeDriver()
 	
 	// Parse diagnostic header
-	driver.Parse([]byte("Diagnostics\n"))
+	driver.Parse(context.Background(), []byte("Diagnostics\n"))
 	
 	// Should start collecting output
 	if !driver.inOutputBlock {
@@ -685,8 +916,8 @@ func TestClaudeDriver_MultiLineOutput(t *testing.T) {
 	}
 	
 	// Parse more lines
-	driver.Parse([]byte("└ Currently running: npm-global (2.0.60)\n"))
-	driver.Parse([]byte("└ Path: /usr/local/bin/node\n"))
+	driver.Parse(context.Background(), []byte("└ Currently running: npm-global (2.0.60)\n"))
+	driver.Parse(context.Background(), []byte("└ Path: /usr/local/bin/node\n"))
 	
 	// Should still be collecting
 	if !driver.inOutputBlock {
@@ -710,8 +941,8 @@ func TestClaudeDriver_Deduplication(t *testing.T) {
 	driver := NewClaudeDriver()
 	
 	// Send same user input twice quickly
-	result1, _ := driver.Parse([]byte("> hello"))
-	result2, _ := driver.Parse([]byte("> hello"))
+	result1, _ := driver.Parse(context.Background(), []byte("> hello"))
+	result2, _ := driver.Parse(context.Background(), []byte("> hello"))
 	
 	// First should have message
 	if len(result1.Messages) == 0 {
@@ -723,3 +954,512 @@ func TestClaudeDriver_Deduplication(t *testing.T) {
 		t.Error("Expected no message in second parse (should be deduplicated)")
 	}
 }
+
+// TestClaudeDriver_Usage tests usage event extraction from /cost output and inline costs
+func TestClaudeDriver_Usage(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   []string
+		expected map[string]string
+	}{
+		{
+			name: "cost command",
+			inputs: []string{"  ⎿  Total cost:            $0.0123\r\n" +
+				"     Total duration (API):  6.2s\r\n" +
+				"     Usage by model:\r\n" +
+				"         claude-3-5-haiku:  1.2k input, 100 output, 0 cache read, 0 cache write\r\n" +
+				"            claude-sonnet:  12 input, 345 output, 10.5k cache read, 2.1k cache write\r\n"},
+			expected: map[string]string{"cost_usd": "0.0123", "input_tokens": "1212", "output_tokens": "445"},
+		},
+		{
+			name:     "older cost format",
+			inputs:   []string{"Total cost: $1.50\nTotal tokens: 12,345 input, 678 output\n"},
+			expected: map[string]string{"cost_usd": "1.50", "input_tokens": "12345", "output_tokens": "678"},
+		},
+		{
+			name:     "inline cost",
+			inputs:   []string{"\x1b[2mSession cost: $0.42\x1b[0m\r\n"},
+			expected: map[string]string{"cost_usd": "0.42"},
+		},
+		{
+			name:     "status line amount",
+			inputs:   []string{"  claude-sonnet-4 │ $0.42 │ 12% context\r\n"},
+			expected: map[string]string{"cost_usd": "0.42"},
+		},
+		{
+			name:     "spent amount",
+			inputs:   []string{"Spent $1.25 this session\r\n"},
+			expected: map[string]string{"cost_usd": "1.25"},
+		},
+		{
+			name:     "price in prose",
+			inputs:   []string{"● The hosting plan costs $5.00 per month\r\n"},
+			expected: nil,
+		},
+		{
+			name:     "amount in prose",
+			inputs:   []string{"● That instance is $0.10 an hour\r\n"},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewClaudeDriver()
+
+			var usage []SmartEvent
+			for _, input := range tt.inputs {
+				result, err := driver.Parse(context.Background(), []byte(input))
+				if err != nil {
+					t.Fatalf("Parse error: %v", err)
+				}
+				for _, e := range result.SmartEvents {
+					if e.Kind == "usage" {
+						usage = append(usage, e)
+					}
+				}
+			}
+
+			if tt.expected == nil {
+				if len(usage) != 0 {
+					t.Errorf("Expected no usage events, got %+v", usage)
+				}
+				return
+			}
+			if len(usage) != 1 {
+				t.Fatalf("Expected 1 usage event, got %+v", usage)
+			}
+			if len(usage[0].Data) != len(tt.expected) {
+				t.Errorf("Expected data %v, got %v", tt.expected, usage[0].Data)
+			}
+			for k, v := range tt.expected {
+				if usage[0].Data[k] != v {
+					t.Errorf("Expected %s=%s, got %s", k, v, usage[0].Data[k])
+				}
+			}
+			if !strings.Contains(usage[0].Prompt, "$"+tt.expected["cost_usd"]) {
+				t.Errorf("Expected prompt to contain the cost line, got %q", usage[0].Prompt)
+			}
+		})
+	}
+}
+
+// TestClaudeDriver_UsageSummary tests usage_summary messages and their metadata
+func TestClaudeDriver_UsageSummary(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedContent string
+		expected        map[string]float64
+	}{
+		{
+			name:            "cost summary",
+			input:           "Cost: $0.0234 (1,234 tokens input, 567 tokens output)\r\n",
+			expectedContent: "Cost: $0.0234 (1,234 tokens input, 567 tokens output)",
+			expected:        map[string]float64{"cost_usd": 0.0234, "input_tokens": 1234, "output_tokens": 567},
+		},
+		{
+			name: "cost command",
+			input: "  ⎿  Total cost:            $0.0123\r\n" +
+				"         claude-sonnet:  1.2k input, 345 output, 0 cache read, 0 cache write\r\n",
+			expectedContent: "⎿  Total cost:            $0.0123",
+			expected:        map[string]float64{"cost_usd": 0.0123, "input_tokens": 1200, "output_tokens": 345},
+		},
+		{
+			name:            "cost only",
+			input:           "Session cost: $0.42\r\n",
+			expectedContent: "Session cost: $0.42",
+			expected:        map[string]float64{"cost_usd": 0.42},
+		},
+		{
+			name:  "price in prose",
+			input: "● The hosting plan costs $5.00 per month\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewClaudeDriver()
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+
+			var summaries []Message
+			for _, msg := range result.Messages {
+				if msg.Type == "usage_summary" {
+					summaries = append(summaries, msg)
+				}
+			}
+			if tt.expected == nil {
+				if len(summaries) != 0 {
+					t.Errorf("Expected no usage_summary messages, got %+v", summaries)
+				}
+				return
+			}
+			if len(summaries) != 1 {
+				t.Fatalf("Expected 1 usage_summary message, got %+v", result.Messages)
+			}
+
+			msg := summaries[0]
+			if msg.Content != tt.expectedContent {
+				t.Errorf("Expected content %q, got %q", tt.expectedContent, msg.Content)
+			}
+			if len(msg.Metadata) != len(tt.expected) {
+				t.Errorf("Expected metadata %v, got %v", tt.expected, msg.Metadata)
+			}
+			for k, v := range tt.expected {
+				if got, ok := msg.Metadata[k].(float64); !ok || got != v {
+					t.Errorf("Expected %s=%v, got %v", k, v, msg.Metadata[k])
+				}
+			}
+		})
+	}
+}
+
+// TestClaudeDriver_AutoRespond tests answering confirm prompts with auto-respond rules
+func TestClaudeDriver_AutoRespond(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []AutoRespondRule
+		input    string
+		expected string // Empty for no automatic response
+	}{
+		{"create file", NewSafeAutoResponder(), "Do you want to create hello.txt?\n❯ 1. Yes\n", "1"},
+		{"edit nested file", NewSafeAutoResponder(), "Do you want to edit src/app/main.go?\n", "1"},
+		{"delete file", NewSafeAutoResponder(), "Do you want to delete hello.txt?\n", ""},
+		{"overwrite file", NewSafeAutoResponder(), "Do you want to overwrite hello.txt?\n", ""},
+		{"parent directory", NewSafeAutoResponder(), "Do you want to create ../hello.txt?\n", ""},
+		{"absolute path", NewSafeAutoResponder(), "Do you want to write /etc/hosts?\n", ""},
+		{"hidden file", NewSafeAutoResponder(), "Do you want to create .env?\n", ""},
+		{"no rules", nil, "Do you want to create hello.txt?\n", ""},
+		{
+			"custom rule",
+			[]AutoRespondRule{{Pattern: regexp.MustCompile(`\.md\?$`), Response: "all"}},
+			"Do you want to modify README.md?\n",
+			"2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewClaudeDriver()
+			driver.AutoRespondRules = tt.rules
+
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			if tt.expected == "" {
+				if result.AutoResponse != nil {
+					t.Errorf("Expected no automatic response, got %q", *result.AutoResponse)
+				}
+				return
+			}
+			if result.AutoResponse == nil || string(*result.AutoResponse) != tt.expected {
+				t.Fatalf("Expected automatic response %q, got %v", tt.expected, result.AutoResponse)
+			}
+			if len(result.SmartEvents) == 0 || result.SmartEvents[0].Kind != "claude_confirm" {
+				t.Errorf("Expected the claude_confirm event alongside the response, got %+v", result.SmartEvents)
+			}
+
+			// The answered prompt is not answered again
+			result, _ = driver.Parse(context.Background(), []byte("● Write(hello.txt)\n"))
+			if result.AutoResponse != nil {
+				t.Errorf("Expected the prompt to be answered once, got %q", *result.AutoResponse)
+			}
+		})
+	}
+}
+
+// TestClaudeDriver_UsageDeduplication tests that a cost report is only reported once
+func TestClaudeDriver_UsageDeduplication(t *testing.T) {
+	driver := NewClaudeDriver()
+
+	countUsage := func(input string) int {
+		result, _ := driver.Parse(context.Background(), []byte(input))
+		n := 0
+		for _, e := range result.SmartEvents {
+			if e.Kind == "usage" {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := countUsage("Total cost: $0.10\r\n"); n != 1 {
+		t.Fatalf("Expected 1 usage event, got %d", n)
+	}
+	// The report stays in the buffer while later output arrives
+	if n := countUsage("● Done.\r\n"); n != 0 {
+		t.Errorf("Expected no repeated usage event, got %d", n)
+	}
+	if n := countUsage("Total cost: $0.10\r\n"); n != 0 {
+		t.Errorf("Expected unchanged totals to be deduplicated, got %d", n)
+	}
+	if n := countUsage("Total cost: $0.25\r\n"); n != 1 {
+		t.Errorf("Expected a usage event for the new total, got %d", n)
+	}
+}
+
+// TestParseTokenCount tests parsing abbreviated token counts
+func TestParseTokenCount(t *testing.T) {
+	tests := map[string]int{"345": 345, "12,345": 12345, "1.2k": 1200, "10.5K": 10500, "2M": 2000000, "n/a": 0}
+	for input, expected := range tests {
+		if got := parseTokenCount(input); got != expected {
+			t.Errorf("parseTokenCount(%q): expected %d, got %d", input, expected, got)
+		}
+	}
+}
+
+// TestClaudeDriver_BusyIdle tests busy and idle events around spinners and the returning prompt
+func TestClaudeDriver_BusyIdle(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   []string
+		expected []string // event kind per input, "" for none
+	}{
+		{
+			name: "thinking then prompt",
+			inputs: []string{
+				"\x1b[38;5;174m✻\x1b[0m Thinking… (3s · esc to interrupt)",
+				"\r\x1b[2K✶ Thinking… (4s · esc to interrupt)",
+				"\r\x1b[2K✳ Thinking… (5s · esc to interrupt)",
+				"╭──────────╮\r\n│ >        │\r\n╰──────────╯\r\n  ? for shortcuts",
+				"│ >        │",
+			},
+			expected: []string{"busy", "", "", "idle", ""},
+		},
+		{
+			name:     "prompt without busy period",
+			inputs:   []string{"│ >        │\r\n  ? for shortcuts"},
+			expected: []string{""},
+		},
+		{
+			name: "prompt redrawn below spinner",
+			inputs: []string{
+				"· Running… (esc to interrupt)\r\n│ >        │",
+				"│ >        │\r\n  ? for shortcuts",
+			},
+			expected: []string{"busy", "idle"},
+		},
+		{
+			name:     "ellipsis in a response",
+			inputs:   []string{"● Working on it... the tests pass now.\r\n"},
+			expected: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewClaudeDriver()
+			for i, input := range tt.inputs {
+				result, err := driver.Parse(context.Background(), []byte(input))
+				if err != nil {
+					t.Fatalf("Parse error: %v", err)
+				}
+				var kinds []string
+				for _, e := range result.SmartEvents {
+					if e.Kind == "busy" || e.Kind == "idle" {
+						kinds = append(kinds, e.Kind)
+					}
+				}
+				got := strings.Join(kinds, ",")
+				if got != tt.expected[i] {
+					t.Errorf("Input %d: expected events %q, got %q", i, tt.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+// TestClaudeDriver_BusyKeepsParsing tests that busy detection leaves action parsing intact
+func TestClaudeDriver_BusyKeepsParsing(t *testing.T) {
+	driver := NewClaudeDriver()
+
+	result, _ := driver.Parse(context.Background(), []byte("● Bash(npm test)\r\n· Running… (esc to interrupt)\r\n"))
+
+	var busy *SmartEvent
+	for i, e := range result.SmartEvents {
+		if e.Kind == "busy" {
+			busy = &result.SmartEvents[i]
+		}
+	}
+	if busy == nil {
+		t.Fatal("Expected a busy event")
+	}
+	if busy.Prompt != "· Running… (esc to interrupt)" {
+		t.Errorf("Expected the spinner line as prompt, got %q", busy.Prompt)
+	}
+
+	actions := 0
+	for _, msg := range result.Messages {
+		if msg.Type == "claude_action" {
+			actions++
+		}
+		if strings.Contains(msg.Content, "Running…") {
+			t.Errorf("Expected the spinner to stay out of messages, got %+v", msg)
+		}
+	}
+	if actions != 1 {
+		t.Errorf("Expected 1 claude_action message, got %+v", result.Messages)
+	}
+
+	driver.Reset()
+	result, _ = driver.Parse(context.Background(), []byte("│ >        │"))
+	for _, e := range result.SmartEvents {
+		if e.Kind == "idle" {
+			t.Error("Expected Reset to end the busy period without an idle event")
+		}
+	}
+}
+
+// TestClaudeDriver_ParseCancelled tests that Parse stops between stages once ctx is done
+func TestClaudeDriver_ParseCancelled(t *testing.T) {
+	driver := NewClaudeDriver()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := driver.Parse(ctx, []byte("Thinking…\nContinue? (y/n)"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if result == nil || string(result.RawData) != "Thinking…\nContinue? (y/n)" {
+		t.Fatalf("Expected the partial result with the raw data, got %+v", result)
+	}
+	if len(result.SmartEvents) != 0 {
+		t.Errorf("Expected no events once cancelled, got %+v", result.SmartEvents)
+	}
+	if state := driver.State(); state != StateIdle {
+		t.Errorf("Expected the state to stay idle, got %s", state)
+	}
+
+	// The chunk stays buffered, so the next parse still sees the question
+	result, err = driver.Parse(context.Background(), []byte("\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.SmartEvents) == 0 || result.SmartEvents[0].Kind != "question" {
+		t.Errorf("Expected the buffered question to be detected, got %+v", result.SmartEvents)
+	}
+}
+
+// errorEvents returns the "error" events of a parse result.
+func errorEvents(result *ParseResult) []SmartEvent {
+	var events []SmartEvent
+	for _, e := range result.SmartEvents {
+		if e.Kind == "error" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// TestClaudeDriver_ErrorBanners tests that each default error banner is reported as an error event
+func TestClaudeDriver_ErrorBanners(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		prompt string
+		banner string
+	}{
+		{
+			name:   "api error",
+			input:  "  ⎿  API Error: 529 {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\"}}\r\n",
+			prompt: "⎿  API Error: 529 {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\"}}",
+			banner: "API Error",
+		},
+		{
+			name:   "rate limit",
+			input:  "\x1b[31mRate limit exceeded. Retrying in 12 seconds…\x1b[0m\r\n",
+			prompt: "Rate limit exceeded. Retrying in 12 seconds…",
+			banner: "Rate limit",
+		},
+		{
+			name:   "permission denied",
+			input:  "● Bash(rm -rf /var/log)\r\n  ⎿  Error: Permission denied\r\n",
+			prompt: "⎿  Error: Permission denied",
+			banner: "Permission denied",
+		},
+		{
+			name:   "usage limit",
+			input:  "│ Claude usage limit reached. Your limit will reset at 5pm. │\r\n",
+			prompt: "│ Claude usage limit reached. Your limit will reset at 5pm. │",
+			banner: "usage limit reached",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewClaudeDriver()
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			events := errorEvents(result)
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 error event, got %+v", result.SmartEvents)
+			}
+			if events[0].Prompt != tt.prompt {
+				t.Errorf("Expected prompt %q, got %q", tt.prompt, events[0].Prompt)
+			}
+			if events[0].Data["banner"] != tt.banner {
+				t.Errorf("Expected banner %q, got %q", tt.banner, events[0].Data["banner"])
+			}
+		})
+	}
+
+	// Redrawing the same banner is reported once
+	driver := NewClaudeDriver()
+	driver.Parse(context.Background(), []byte("API Error: Connection error.\r\n"))
+	result, _ := driver.Parse(context.Background(), []byte("\r\x1b[2KAPI Error: Connection error.\r\n"))
+	if events := errorEvents(result); len(events) != 0 {
+		t.Errorf("Expected a redrawn banner to be ignored, got %+v", events)
+	}
+
+	// Ordinary output is not an error
+	result, _ = driver.Parse(context.Background(), []byte("● I added error handling to the API client\r\n"))
+	if events := errorEvents(result); len(events) != 0 {
+		t.Errorf("Expected no error event, got %+v", events)
+	}
+}
+
+// TestClaudeDriver_ErrorBannersNotNoise tests that boxed error banners are not filtered as UI noise
+func TestClaudeDriver_ErrorBannersNotNoise(t *testing.T) {
+	driver := NewClaudeDriver()
+	for _, line := range []string{
+		"│ API Error: 500 Internal server error │",
+		"│ Claude usage limit reached │",
+		"╭─ Rate limit reached ─╮",
+		"· Rate limited, retrying…",
+	} {
+		if driver.isUINoiseOrLoading(line) {
+			t.Errorf("Expected %q not to be UI noise", line)
+		}
+	}
+	if !driver.isUINoiseOrLoading("│ >        │") {
+		t.Error("Expected the input box to still be UI noise")
+	}
+}
+
+// TestClaudeDriver_CustomErrorBanners tests error detection with a configured banner list
+func TestClaudeDriver_CustomErrorBanners(t *testing.T) {
+	driver, err := NewClaudeDriverWithConfig(ClaudeConfig{
+		ErrorBanners: []string{"Overloaded", "quota exceeded"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create driver: %v", err)
+	}
+
+	result, _ := driver.Parse(context.Background(), []byte("Monthly Quota Exceeded (resets in 3 days)\r\n"))
+	events := errorEvents(result)
+	if len(events) != 1 || events[0].Data["banner"] != "Quota Exceeded" {
+		t.Errorf("Expected a configured banner to be reported, got %+v", events)
+	}
+
+	// Default banners are replaced, not extended
+	result, _ = driver.Parse(context.Background(), []byte("API Error: Connection error.\r\n"))
+	if events := errorEvents(result); len(events) != 0 {
+		t.Errorf("Expected default banners to be ignored, got %+v", events)
+	}
+}
@@ -1,19 +1,28 @@
 package driver
 
-import "time"
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
 
 // SmartEvent represents a structured event generated by parsing CLI output.
 type SmartEvent struct {
-	Kind    string   `json:"kind"`    // "question", "idle", "progress", "claude_confirm"
-	Options []string `json:"options"` // ["yes", "no"] or ["1", "2", "esc"]
-	Prompt  string   `json:"prompt"`  // Original prompt text
+	ID      string            `json:"id,omitempty"`   // Unique ID assigned when the event is broadcast
+	Kind    string            `json:"kind"`           // "question", "password", "press_any_key", "idle", "busy", "progress", "claude_confirm", "usage", "error"
+	Options []string          `json:"options"`        // ["yes", "no"] or ["1", "2", "esc"]
+	Prompt  string            `json:"prompt"`         // Original prompt text
+	Data    map[string]string `json:"data,omitempty"` // Structured values, e.g. {"cost_usd": "0.0123"} for "usage"
 }
 
 // Message represents a parsed message from the conversation.
 type Message struct {
-	Timestamp time.Time `json:"timestamp"`
-	Type      string    `json:"type"`    // "user_input", "claude_response", "claude_action", "action_result", "command_output", "agent_interrupted"
-	Content   string    `json:"content"` // The message content
+	Timestamp time.Time              `json:"timestamp"`
+	Type      string                 `json:"type"`               // "user_input", "claude_response", "claude_action", "action_result", "command_output", "agent_interrupted", "usage_summary"
+	Content   string                 `json:"content"`            // The message content
+	Metadata  map[string]interface{} `json:"metadata,omitempty"` // Parsed values, e.g. {"cost_usd": 0.0234} for "usage_summary"
 }
 
 // ParseResult contains the result of parsing PTY output.
@@ -21,11 +30,16 @@ type ParseResult struct {
 	RawData     []byte
 	SmartEvents []SmartEvent
 	Messages    []Message // Parsed conversation messages
+
+	// AutoResponse, if set, is input the driver answered a prompt with on
+	// the user's behalf; it should be written to the PTY instead of
+	// asking clients. See ClaudeDriver.AutoRespondRules.
+	AutoResponse *[]byte
 }
 
 // InputAction represents an action to send to the PTY
 type InputAction struct {
-	Type    string `json:"type"`    // "text", "key", "confirm", "cancel"
+	Type    string `json:"type"`    // "text", "command", "key", "confirm", "cancel", "interrupt"
 	Content string `json:"content"` // Text content or key name
 }
 
@@ -43,6 +57,22 @@ const (
 	KeyLeft      = "\x1b[D"
 )
 
+// DriverCapabilities describes the optional features a driver supports.
+type DriverCapabilities struct {
+	// SupportsSmartEvents reports whether Parse can produce SmartEvents.
+	SupportsSmartEvents bool `json:"supportsSmartEvents"`
+
+	// SupportsConversationMessages reports whether Parse can produce Messages.
+	SupportsConversationMessages bool `json:"supportsConversationMessages"`
+
+	// SupportsMenuNavigation reports whether the driver can select menu items.
+	SupportsMenuNavigation bool `json:"supportsMenuNavigation"`
+
+	// SupportsAutoRespond reports whether RespondToEvent maps responses to
+	// the CLI's own input, rather than sending them verbatim.
+	SupportsAutoRespond bool `json:"supportsAutoRespond"`
+}
+
 // AgentDriver is an interface for parsing CLI output and generating smart events.
 type AgentDriver interface {
 	// Name returns the name of the driver.
@@ -50,7 +80,9 @@ type AgentDriver interface {
 
 	// Parse processes a chunk of PTY output and returns parsed results.
 	// It returns the raw data along with any detected smart events.
-	Parse(chunk []byte) (*ParseResult, error)
+	// Drivers may stop early once ctx is done, returning ctx's error with
+	// the results found so far.
+	Parse(ctx context.Context, chunk []byte) (*ParseResult, error)
 
 	// FormatInput formats an input action into bytes to send to PTY.
 	// This handles special keys, confirmations, and text input.
@@ -59,11 +91,40 @@ type AgentDriver interface {
 	// RespondToEvent generates the appropriate input for a SmartEvent response.
 	// For example, responding "yes" to a (y/n) question or selecting option 1.
 	RespondToEvent(event SmartEvent, response string) []byte
+
+	// Capabilities reports which optional features the driver supports.
+	Capabilities() DriverCapabilities
+
+	// Reset discards any buffered output and parsing state, e.g. when the
+	// session's process is restarted.
+	Reset()
 }
 
-// GenericDriver is a pass-through driver that doesn't perform any parsing.
-// It simply returns the raw data without generating any smart events.
-type GenericDriver struct{}
+// GenericDriver is the fallback driver for commands without a dedicated
+// driver. It passes output through unchanged and detects prompts that most
+// interactive CLIs share: a "question" event for (y/n) and (yes/no)
+// confirmations, a "password" event for password and passphrase prompts,
+// and a "press_any_key" event for "Press any key to continue". It produces
+// no conversation messages.
+type GenericDriver struct {
+	// buffer holds recent output so prompts split across chunks are seen.
+	buffer bytes.Buffer
+}
+
+// genericBufferSize limits the output GenericDriver keeps for matching.
+const genericBufferSize = 4096
+
+var (
+	// genericQuestionPattern matches patterns like "(y/n)", "(yes/no)", etc.
+	genericQuestionPattern = regexp.MustCompile(`\(([yY])/([nN])\)|\(([yY]es)/([nN]o)\)`)
+
+	// genericPasswordPattern matches "Password:", "[sudo] password for
+	// alice:" and "Enter passphrase for key '/home/alice/.ssh/id_rsa':"
+	genericPasswordPattern = regexp.MustCompile(`(?i)(password|passphrase)[^:]*:\s*$`)
+
+	// genericPressKeyPattern matches "Press any key to continue"
+	genericPressKeyPattern = regexp.MustCompile(`(?i)press any key`)
+)
 
 // NewGenericDriver creates a new GenericDriver instance.
 func NewGenericDriver() *GenericDriver {
@@ -75,13 +136,60 @@ func (d *GenericDriver) Name() string {
 	return "generic"
 }
 
-// Parse returns the raw data without any parsing or smart event generation.
-func (d *GenericDriver) Parse(chunk []byte) (*ParseResult, error) {
-	return &ParseResult{
+// Parse returns the raw data unchanged, with an event for a prompt on the
+// line the cursor is on. Each prompt is reported once, when the output that
+// completes it arrives.
+func (d *GenericDriver) Parse(ctx context.Context, chunk []byte) (*ParseResult, error) {
+	result := &ParseResult{
 		RawData:     chunk,
 		SmartEvents: []SmartEvent{},
 		Messages:    []Message{},
-	}, nil
+	}
+
+	// Append to buffer for pattern matching, keeping only the tail
+	d.buffer.Write(chunk)
+	if d.buffer.Len() > genericBufferSize {
+		data := d.buffer.Bytes()
+		d.buffer.Reset()
+		d.buffer.Write(data[len(data)-genericBufferSize:])
+	}
+
+	// Chunks that only move the cursor or change modes leave the line as it was
+	if len(bytes.TrimSpace(ansiPattern.ReplaceAll(chunk, nil))) == 0 {
+		return result, nil
+	}
+
+	line := currentLine(ansiPattern.ReplaceAll(d.buffer.Bytes(), nil))
+	prompt := strings.TrimSpace(line)
+	if prompt == "" {
+		return result, nil
+	}
+
+	switch {
+	case genericQuestionPattern.MatchString(line):
+		matches := genericQuestionPattern.FindStringSubmatch(line)
+		options := []string{"y", "n"}
+		if matches[3] != "" {
+			options = []string{"yes", "no"}
+		}
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+			Kind:    "question",
+			Options: options,
+			Prompt:  prompt,
+		})
+	case genericPasswordPattern.MatchString(line):
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+			Kind:   "password",
+			Prompt: prompt,
+		})
+	case genericPressKeyPattern.MatchString(line):
+		result.SmartEvents = append(result.SmartEvents, SmartEvent{
+			Kind:   "press_any_key",
+			Prompt: prompt,
+		})
+	}
+
+	return result, nil
 }
 
 // FormatInput formats an input action into bytes for PTY.
@@ -91,43 +199,93 @@ func (d *GenericDriver) FormatInput(action InputAction) []byte {
 		return []byte(action.Content)
 	case "key":
 		return formatKey(action.Content)
+	case "command":
+		return []byte(action.Content + KeyEnter)
 	case "confirm":
 		return []byte(action.Content + KeyEnter)
 	case "cancel":
 		return []byte(KeyEscape)
+	case "interrupt":
+		return []byte(KeyCtrlC)
 	default:
 		return []byte(action.Content)
 	}
 }
 
-// RespondToEvent generates input for a SmartEvent response.
+// RespondToEvent generates input for a SmartEvent response. Questions are
+// answered in the form their options use, e.g. "yes" becomes "y" for a
+// (y/n) question, and a press_any_key prompt is answered with Enter. Other
+// responses, such as passwords, are sent as typed, followed by Enter.
 func (d *GenericDriver) RespondToEvent(event SmartEvent, response string) []byte {
-	// Generic driver just sends the response as-is with Enter
+	switch event.Kind {
+	case "question":
+		if input, ok := yesNoResponse(event, response); ok {
+			return input
+		}
+	case "press_any_key":
+		return []byte(KeyEnter)
+	}
 	return []byte(response + KeyEnter)
 }
 
-// formatKey converts a key name to its escape sequence
+// Capabilities reports that the generic driver detects prompts and answers
+// them.
+func (d *GenericDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		SupportsSmartEvents: true,
+		SupportsAutoRespond: true,
+	}
+}
+
+// Reset clears the internal buffer.
+func (d *GenericDriver) Reset() {
+	d.buffer.Reset()
+}
+
+// yesNoResponse formats a yes or no response to a question event as the
+// short (y/n) or long (yes/no) answer its options ask for; other options,
+// such as "always" in (y/n/always), do not make the answer long. It returns
+// false for other responses.
+func yesNoResponse(event SmartEvent, response string) ([]byte, bool) {
+	yes, no := "y", "n"
+	for _, opt := range event.Options {
+		if opt := strings.ToLower(opt); opt == "yes" || opt == "no" {
+			yes, no = "yes", "no"
+			break
+		}
+	}
+	switch strings.ToLower(response) {
+	case "y", "yes":
+		return []byte(yes + KeyEnter), true
+	case "n", "no":
+		return []byte(no + KeyEnter), true
+	}
+	return nil, false
+}
+
+// formatKey converts a key name to its escape sequence.
+// Key names are case-insensitive; unknown names are sent as-is.
 func formatKey(keyName string) []byte {
-	switch keyName {
-	case "enter":
+	switch strings.ToLower(keyName) {
+	case "enter", "return":
 		return []byte(KeyEnter)
 	case "escape", "esc":
 		return []byte(KeyEscape)
-	case "ctrl+c":
+	case "ctrl+c", "ctrlc":
 		return []byte(KeyCtrlC)
-	case "ctrl+d":
+	case "ctrl+d", "ctrld":
 		return []byte(KeyCtrlD)
-	case "backspace":
+	case "backspace", "bs":
 		return []byte(KeyBackspace)
 	case "tab":
 		return []byte(KeyTab)
-	case "up":
+	case "up", "arrowup":
 		return []byte(KeyUp)
-	case "down":
+	case "down", "arrowdown":
 		return []byte(KeyDown)
-	case "left":
+	case "left", "arrowleft":
 		return []byte(KeyLeft)
-	case "right":
+	case "right", "arrowright":
 		return []byte(KeyRight)
 	default:
 		return []byte(keyName)
@@ -1,6 +1,9 @@
 package driver
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -30,15 +33,11 @@ func TestGenericDriver_Parse(t *testing.T) {
 			name:  "empty input",
 			input: []byte{},
 		},
-		{
-			name:  "with question pattern",
-			input: []byte("Continue? (y/n)"),
-		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result, err := driver.Parse(tc.input)
+			result, err := driver.Parse(context.Background(), tc.input)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -52,10 +51,180 @@ func TestGenericDriver_Parse(t *testing.T) {
 				t.Errorf("expected raw data '%s', got '%s'", string(tc.input), string(result.RawData))
 			}
 
-			// GenericDriver should not generate any smart events
+			// Output without a prompt generates no smart events
 			if len(result.SmartEvents) != 0 {
 				t.Errorf("expected no smart events, got %d", len(result.SmartEvents))
 			}
 		})
 	}
 }
+
+func TestGenericDriver_Prompts(t *testing.T) {
+	testCases := []struct {
+		name    string
+		chunks  []string
+		kind    string
+		options []string
+		prompt  string
+	}{
+		{
+			name:    "y/n question",
+			chunks:  []string{"Continue? (y/n) "},
+			kind:    "question",
+			options: []string{"y", "n"},
+			prompt:  "Continue? (y/n)",
+		},
+		{
+			name:    "yes/no question split across chunks",
+			chunks:  []string{"Overwrite existing file? (Ye", "s/No) "},
+			kind:    "question",
+			options: []string{"yes", "no"},
+			prompt:  "Overwrite existing file? (Yes/No)",
+		},
+		{
+			name:   "password prompt",
+			chunks: []string{"Connecting...\r\nPassword: "},
+			kind:   "password",
+			prompt: "Password:",
+		},
+		{
+			name:   "passphrase prompt",
+			chunks: []string{"\x1b[1mEnter passphrase for key '/home/alice/.ssh/id_rsa':\x1b[0m "},
+			kind:   "password",
+			prompt: "Enter passphrase for key '/home/alice/.ssh/id_rsa':",
+		},
+		{
+			name:   "press any key",
+			chunks: []string{"Installation complete.\r\nPress any key to continue..."},
+			kind:   "press_any_key",
+			prompt: "Press any key to continue...",
+		},
+		{
+			name:   "answered prompt",
+			chunks: []string{"Password: ", "\r\n", "Welcome\r\n"},
+		},
+		{
+			name:   "password in ordinary output",
+			chunks: []string{"Your password: was changed yesterday\r\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := NewGenericDriver()
+			var events []SmartEvent
+			for _, chunk := range tc.chunks {
+				result, err := driver.Parse(context.Background(), []byte(chunk))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				events = result.SmartEvents
+			}
+
+			if tc.kind == "" {
+				if len(events) != 0 {
+					t.Errorf("expected no smart events, got %+v", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 smart event, got %+v", events)
+			}
+			event := events[0]
+			if event.Kind != tc.kind || event.Prompt != tc.prompt {
+				t.Errorf("expected %s event %q, got %s event %q", tc.kind, tc.prompt, event.Kind, event.Prompt)
+			}
+			if strings.Join(event.Options, ",") != strings.Join(tc.options, ",") {
+				t.Errorf("expected options %v, got %v", tc.options, event.Options)
+			}
+		})
+	}
+}
+
+func TestGenericDriver_RespondToEvent(t *testing.T) {
+	driver := NewGenericDriver()
+
+	testCases := []struct {
+		event    SmartEvent
+		response string
+		expected string
+	}{
+		{SmartEvent{Kind: "question", Options: []string{"y", "n"}}, "yes", "y\r"},
+		{SmartEvent{Kind: "question", Options: []string{"yes", "no"}}, "n", "no\r"},
+		{SmartEvent{Kind: "question", Options: []string{"y", "n"}}, "maybe", "maybe\r"},
+		{SmartEvent{Kind: "question", Options: []string{"y", "n", "always"}}, "yes", "y\r"},
+		{SmartEvent{Kind: "question", Options: []string{"Yes", "No", "always"}}, "y", "yes\r"},
+		{SmartEvent{Kind: "password"}, "hunter2", "hunter2\r"},
+		{SmartEvent{Kind: "press_any_key"}, "ok", "\r"},
+	}
+
+	for _, tc := range testCases {
+		if got := string(driver.RespondToEvent(tc.event, tc.response)); got != tc.expected {
+			t.Errorf("%s %q: expected %q, got %q", tc.event.Kind, tc.response, tc.expected, got)
+		}
+	}
+}
+
+func TestDriver_Capabilities(t *testing.T) {
+	testCases := []struct {
+		driver   AgentDriver
+		expected DriverCapabilities
+	}{
+		{
+			driver: NewGenericDriver(),
+			expected: DriverCapabilities{
+				SupportsSmartEvents: true,
+				SupportsAutoRespond: true,
+			},
+		},
+		{
+			driver: NewClaudeDriver(),
+			expected: DriverCapabilities{
+				SupportsSmartEvents:          true,
+				SupportsConversationMessages: true,
+				SupportsMenuNavigation:       true,
+				SupportsAutoRespond:          true,
+			},
+		},
+		{
+			driver: NewGeminiDriver(),
+			expected: DriverCapabilities{
+				SupportsSmartEvents:          true,
+				SupportsConversationMessages: true,
+				SupportsAutoRespond:          true,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.driver.Name(), func(t *testing.T) {
+			if caps := tc.driver.Capabilities(); caps != tc.expected {
+				t.Errorf("expected capabilities %+v, got %+v", tc.expected, caps)
+			}
+		})
+	}
+}
+
+// TestSmartEvent_JSON tests that Data is only present in the JSON when set
+func TestSmartEvent_JSON(t *testing.T) {
+	plain, err := json.Marshal(SmartEvent{Kind: "question", Options: []string{"y", "n"}, Prompt: "Continue? (y/n)"})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `{"kind":"question","options":["y","n"],"prompt":"Continue? (y/n)"}`
+	if string(plain) != expected {
+		t.Errorf("Expected %s, got %s", expected, plain)
+	}
+
+	withData, err := json.Marshal(SmartEvent{Kind: "usage", Data: map[string]string{"cost_usd": "0.50"}})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var decoded SmartEvent
+	if err := json.Unmarshal(withData, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Kind != "usage" || decoded.Data["cost_usd"] != "0.50" {
+		t.Errorf("Expected usage event with cost_usd 0.50, got %+v", decoded)
+	}
+}
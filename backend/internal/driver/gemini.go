@@ -0,0 +1,319 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// GeminiDriver is a driver for parsing Google's gemini CLI output.
+//
+// Gemini's tool confirmation menu is reported with the "gemini_confirm" kind
+// and the options "1" (allow once), "2" (allow always) and "esc" (no).
+// Responses and tool calls reuse the existing conversation message types, so
+// the chat view renders them unchanged.
+type GeminiDriver struct {
+	// questionPattern matches patterns like "(y/n)", "(yes/no)", etc.
+	questionPattern *regexp.Regexp
+
+	// confirmPattern matches Gemini's tool confirmation questions
+	confirmPattern *regexp.Regexp
+
+	// Message parsing patterns
+	userInputPattern     *regexp.Regexp // "> command"
+	responseStartPattern *regexp.Regexp // "✦ response"
+	toolCallPattern      *regexp.Regexp // "✔  ReadFile src/main.go"
+
+	// buffer accumulates recent output for pattern matching.
+	buffer *bytes.Buffer
+
+	// maxBufferSize limits the buffer size to prevent unbounded growth.
+	maxBufferSize int
+
+	// lastConfirmPrompt avoids re-emitting the same confirmation while it stays on screen
+	lastConfirmPrompt string
+
+	// Deduplication state
+	lastUserInput string
+	lastToolCall  string
+	lastResponse  string
+
+	// Response block collector for multi-line responses
+	inResponseBlock   bool
+	responseLines     []string
+	responseStartTime time.Time
+}
+
+// geminiTools lists the tool display names used by the gemini CLI.
+var geminiTools = []string{
+	"ReadFile", "WriteFile", "Edit", "Shell", "FindFiles", "SearchText",
+	"ReadFolder", "ReadManyFiles", "WebFetch", "GoogleSearch", "SaveMemory",
+}
+
+// NewGeminiDriver creates a new GeminiDriver instance.
+func NewGeminiDriver() *GeminiDriver {
+	return &GeminiDriver{
+		// Match patterns like (y/n), (yes/no), (Y/N), etc.
+		questionPattern: regexp.MustCompile(`\(([yY])/([nN])\)|\(([yY]es)/([nN]o)\)`),
+
+		// Match Gemini's tool confirmation questions, e.g. "Allow execution?"
+		confirmPattern: regexp.MustCompile(`(Apply this change|Allow execution|Do you want to proceed)\?`),
+
+		// Message parsing patterns
+		userInputPattern:     regexp.MustCompile(`^>\s+(.+)$`),
+		responseStartPattern: regexp.MustCompile(`^✦\s*(.+)`),
+		toolCallPattern:      regexp.MustCompile(`^[✔✓⊷✖?]\s+(` + strings.Join(geminiTools, "|") + `)\b\s*(.*)$`),
+
+		buffer:        &bytes.Buffer{},
+		maxBufferSize: 4096, // Keep last 4KB for pattern matching
+	}
+}
+
+// Name returns the name of the driver.
+func (d *GeminiDriver) Name() string {
+	return "gemini"
+}
+
+// Capabilities reports the features supported by the Gemini driver.
+// Menu items are selected through RespondToEvent rather than navigation.
+func (d *GeminiDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		SupportsSmartEvents:          true,
+		SupportsConversationMessages: true,
+		SupportsAutoRespond:          true,
+	}
+}
+
+// Parse processes a chunk of PTY output and detects smart events and messages.
+func (d *GeminiDriver) Parse(ctx context.Context, chunk []byte) (*ParseResult, error) {
+	result := &ParseResult{
+		RawData:     chunk,
+		SmartEvents: []SmartEvent{},
+		Messages:    []Message{},
+	}
+
+	// Append to buffer for pattern matching
+	d.buffer.Write(chunk)
+
+	// Trim buffer if it exceeds max size
+	if d.buffer.Len() > d.maxBufferSize {
+		data := d.buffer.Bytes()
+		d.buffer.Reset()
+		d.buffer.Write(data[len(data)-d.maxBufferSize:])
+	}
+
+	cleanContent := ansiPattern.ReplaceAll(d.buffer.Bytes(), []byte{})
+
+	// Check for standard question patterns (y/n), (yes/no)
+	if matches := d.questionPattern.FindSubmatch(cleanContent); matches != nil {
+		var options []string
+		if len(matches[1]) > 0 && len(matches[2]) > 0 {
+			options = []string{"y", "n"}
+		} else if len(matches[3]) > 0 && len(matches[4]) > 0 {
+			options = []string{"yes", "no"}
+		}
+
+		if len(options) > 0 {
+			result.SmartEvents = append(result.SmartEvents, SmartEvent{
+				Kind:    "question",
+				Options: options,
+				Prompt:  lastNonEmptyLine(cleanContent),
+			})
+		}
+	}
+
+	// Check for Gemini's tool confirmation menu.
+	// Only the newest match counts; it is emitted when it first appears or
+	// when the current chunk redraws it, not for every later chunk.
+	if locs := d.confirmPattern.FindAllIndex(cleanContent, -1); locs != nil {
+		loc := locs[len(locs)-1]
+		prompt := string(cleanContent[loc[0]:loc[1]])
+		newInChunk := bytes.Contains(ansiPattern.ReplaceAll(chunk, []byte{}), []byte(prompt))
+		if prompt != d.lastConfirmPrompt || newInChunk {
+			d.lastConfirmPrompt = prompt
+			result.SmartEvents = append(result.SmartEvents, SmartEvent{
+				Kind:    "gemini_confirm",
+				Options: []string{"1", "2", "esc"},
+				Prompt:  prompt,
+			})
+		}
+	}
+
+	// Parse conversation messages from the chunk
+	d.parseMessages(chunk, result)
+
+	return result, nil
+}
+
+// parseMessages extracts conversation messages from the output chunk.
+func (d *GeminiDriver) parseMessages(chunk []byte, result *ParseResult) {
+	content := string(ansiPattern.ReplaceAll(chunk, []byte{}))
+	now := time.Now()
+
+	for _, line := range strings.Split(content, "\n") {
+		line = trimBoxBorders(line)
+		if len(line) < 3 {
+			continue
+		}
+
+		if d.isNoise(line) {
+			continue
+		}
+
+		// Tool invocation: "✔  ReadFile src/main.go"
+		if matches := d.toolCallPattern.FindStringSubmatch(line); matches != nil {
+			d.flushResponseBlock(result)
+			action := matches[1] + "(" + strings.TrimSpace(matches[2]) + ")"
+			if action != d.lastToolCall {
+				d.lastToolCall = action
+				result.Messages = append(result.Messages, Message{
+					Timestamp: now,
+					Type:      "claude_action",
+					Content:   action,
+				})
+			}
+			continue
+		}
+
+		// User input echo: "> command"
+		if matches := d.userInputPattern.FindStringSubmatch(line); matches != nil {
+			d.flushResponseBlock(result)
+			cmd := strings.TrimSpace(matches[1])
+			if cmd != "" && cmd != d.lastUserInput {
+				d.lastUserInput = cmd
+				result.Messages = append(result.Messages, Message{
+					Timestamp: now,
+					Type:      "user_input",
+					Content:   cmd,
+				})
+			}
+			continue
+		}
+
+		// Streaming response marker: "✦ response text"
+		if matches := d.responseStartPattern.FindStringSubmatch(line); matches != nil {
+			d.flushResponseBlock(result)
+			d.inResponseBlock = true
+			d.responseStartTime = now
+			d.responseLines = []string{strings.TrimSpace(matches[1])}
+			continue
+		}
+
+		// Any other line continues the current response
+		if d.inResponseBlock {
+			d.responseLines = append(d.responseLines, line)
+		}
+	}
+
+	// Flush any pending response block at the end of the chunk
+	d.flushResponseBlock(result)
+}
+
+// flushResponseBlock saves the collected response block as a single message.
+func (d *GeminiDriver) flushResponseBlock(result *ParseResult) {
+	if !d.inResponseBlock || len(d.responseLines) == 0 {
+		return
+	}
+
+	fullResponse := strings.Join(d.responseLines, " ")
+	if fullResponse != d.lastResponse {
+		d.lastResponse = fullResponse
+		result.Messages = append(result.Messages, Message{
+			Timestamp: d.responseStartTime,
+			Type:      "claude_response",
+			Content:   fullResponse,
+		})
+	}
+
+	d.inResponseBlock = false
+	d.responseLines = nil
+}
+
+// isNoise reports whether a line is UI chrome rather than conversation content.
+func (d *GeminiDriver) isNoise(line string) bool {
+	// Box borders
+	if strings.HasPrefix(line, "╭") || strings.HasPrefix(line, "╰") || strings.HasPrefix(line, "─") {
+		return true
+	}
+	// Spinners, footer, and input placeholder
+	return strings.Contains(line, "esc to cancel") ||
+		strings.Contains(line, "context left)") ||
+		strings.Contains(line, "Type your message") ||
+		strings.HasPrefix(line, "Using ") && strings.Contains(line, "GEMINI.md")
+}
+
+// trimBoxBorders strips surrounding whitespace and "│" box borders from a line.
+func trimBoxBorders(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "│")
+	line = strings.TrimSuffix(line, "│")
+	return strings.TrimSpace(line)
+}
+
+// lastNonEmptyLine returns the last non-blank line of data.
+func lastNonEmptyLine(data []byte) string {
+	lines := bytes.Split(data, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := bytes.TrimSpace(lines[i]); len(line) > 0 {
+			return string(line)
+		}
+	}
+	return ""
+}
+
+// Reset clears the internal buffer and block state.
+func (d *GeminiDriver) Reset() {
+	d.buffer.Reset()
+	d.lastConfirmPrompt = ""
+	d.inResponseBlock = false
+	d.responseLines = nil
+}
+
+// FormatInput formats an input action into bytes for PTY.
+func (d *GeminiDriver) FormatInput(action InputAction) []byte {
+	switch action.Type {
+	case "text":
+		return []byte(action.Content)
+	case "command":
+		return []byte(action.Content + KeyEnter)
+	case "key":
+		return formatKey(action.Content)
+	case "confirm":
+		return d.formatConfirmResponse(action.Content)
+	case "cancel":
+		return []byte(KeyEscape)
+	case "interrupt":
+		return []byte(KeyCtrlC)
+	default:
+		return []byte(action.Content)
+	}
+}
+
+// RespondToEvent generates the appropriate input for a SmartEvent response.
+func (d *GeminiDriver) RespondToEvent(event SmartEvent, response string) []byte {
+	switch event.Kind {
+	case "question":
+		return []byte(strings.ToLower(response) + KeyEnter)
+	case "gemini_confirm":
+		return d.formatConfirmResponse(response)
+	default:
+		return []byte(response + KeyEnter)
+	}
+}
+
+// formatConfirmResponse maps a response to a Gemini confirmation menu selection.
+func (d *GeminiDriver) formatConfirmResponse(response string) []byte {
+	switch strings.ToLower(response) {
+	case "1", "y", "yes":
+		// Yes, allow once
+		return []byte("1")
+	case "2", "all", "yes_all", "always":
+		// Yes, allow always
+		return []byte("2")
+	default:
+		// No / cancel
+		return []byte(KeyEscape)
+	}
+}
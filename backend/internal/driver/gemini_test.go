@@ -0,0 +1,223 @@
+package driver
+
+import (
+	"context"
+	"testing"
+)
+
+// TestGeminiDriver_Name tests the Name method
+func TestGeminiDriver_Name(t *testing.T) {
+	driver := NewGeminiDriver()
+	if driver.Name() != "gemini" {
+		t.Errorf("Expected name 'gemini', got '%s'", driver.Name())
+	}
+}
+
+// TestGeminiDriver_Parse_PromptDetection tests detection of confirmation and question prompts
+func TestGeminiDriver_Parse_PromptDetection(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectEvent     bool
+		expectedKind    string
+		expectedOptions []string
+		expectedPrompt  string
+	}{
+		{
+			name: "shell confirmation",
+			input: "╭──────────────────────────────╮\n" +
+				"│ ?  Shell ls -la              │\n" +
+				"│ Allow execution?             │\n" +
+				"│ ● 1. Yes, allow once         │\n" +
+				"│   2. Yes, allow always       │\n" +
+				"│   3. No (esc)                │\n" +
+				"╰──────────────────────────────╯\n",
+			expectEvent:     true,
+			expectedKind:    "gemini_confirm",
+			expectedOptions: []string{"1", "2", "esc"},
+			expectedPrompt:  "Allow execution?",
+		},
+		{
+			name:            "edit confirmation",
+			input:           "│ Apply this change? │",
+			expectEvent:     true,
+			expectedKind:    "gemini_confirm",
+			expectedOptions: []string{"1", "2", "esc"},
+			expectedPrompt:  "Apply this change?",
+		},
+		{
+			name:            "proceed confirmation with ANSI",
+			input:           "\x1b[1mDo you want to proceed?\x1b[0m",
+			expectEvent:     true,
+			expectedKind:    "gemini_confirm",
+			expectedOptions: []string{"1", "2", "esc"},
+			expectedPrompt:  "Do you want to proceed?",
+		},
+		{
+			name:            "y/n question",
+			input:           "Overwrite existing file? (y/n)",
+			expectEvent:     true,
+			expectedKind:    "question",
+			expectedOptions: []string{"y", "n"},
+			expectedPrompt:  "Overwrite existing file? (y/n)",
+		},
+		{
+			name:        "plain response",
+			input:       "✦ Here is the summary you asked for.",
+			expectEvent: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewGeminiDriver()
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+
+			if !tt.expectEvent {
+				if len(result.SmartEvents) != 0 {
+					t.Errorf("Expected no events, got %v", result.SmartEvents)
+				}
+				return
+			}
+
+			if len(result.SmartEvents) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(result.SmartEvents))
+			}
+			event := result.SmartEvents[0]
+			if event.Kind != tt.expectedKind {
+				t.Errorf("Expected kind '%s', got '%s'", tt.expectedKind, event.Kind)
+			}
+			if len(event.Options) != len(tt.expectedOptions) {
+				t.Fatalf("Expected options %v, got %v", tt.expectedOptions, event.Options)
+			}
+			for i, opt := range tt.expectedOptions {
+				if event.Options[i] != opt {
+					t.Errorf("Expected option %d '%s', got '%s'", i, opt, event.Options[i])
+				}
+			}
+			if event.Prompt != tt.expectedPrompt {
+				t.Errorf("Expected prompt '%s', got '%s'", tt.expectedPrompt, event.Prompt)
+			}
+		})
+	}
+}
+
+// TestGeminiDriver_Parse_ConfirmNotRepeated tests that a confirmation is not re-emitted for unrelated output
+func TestGeminiDriver_Parse_ConfirmNotRepeated(t *testing.T) {
+	driver := NewGeminiDriver()
+
+	result, _ := driver.Parse(context.Background(), []byte("│ Allow execution? │\n"))
+	if len(result.SmartEvents) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(result.SmartEvents))
+	}
+
+	result, _ = driver.Parse(context.Background(), []byte("⠋ Waiting for user confirmation...\n"))
+	if len(result.SmartEvents) != 0 {
+		t.Errorf("Expected confirmation not to repeat, got %v", result.SmartEvents)
+	}
+}
+
+// TestGeminiDriver_Parse_Messages tests conversation message extraction
+func TestGeminiDriver_Parse_Messages(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedType    string
+		expectedContent string
+	}{
+		{
+			name:            "user input",
+			input:           "│ > explain this repo │",
+			expectedType:    "user_input",
+			expectedContent: "explain this repo",
+		},
+		{
+			name:            "streaming response",
+			input:           "✦ This repository is a web terminal\nfor remote agent CLIs.",
+			expectedType:    "claude_response",
+			expectedContent: "This repository is a web terminal for remote agent CLIs.",
+		},
+		{
+			name:            "successful tool call",
+			input:           "│ ✔  ReadFile src/main.go │",
+			expectedType:    "claude_action",
+			expectedContent: "ReadFile(src/main.go)",
+		},
+		{
+			name:            "pending shell tool call",
+			input:           "│ ?  Shell npm test │",
+			expectedType:    "claude_action",
+			expectedContent: "Shell(npm test)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := NewGeminiDriver()
+			result, err := driver.Parse(context.Background(), []byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			if len(result.Messages) != 1 {
+				t.Fatalf("Expected 1 message, got %v", result.Messages)
+			}
+			msg := result.Messages[0]
+			if msg.Type != tt.expectedType {
+				t.Errorf("Expected type '%s', got '%s'", tt.expectedType, msg.Type)
+			}
+			if msg.Content != tt.expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", tt.expectedContent, msg.Content)
+			}
+		})
+	}
+}
+
+// TestGeminiDriver_Parse_IgnoresChrome tests that spinners and footers are not reported
+func TestGeminiDriver_Parse_IgnoresChrome(t *testing.T) {
+	driver := NewGeminiDriver()
+	input := "⠋ Thinking... (esc to cancel, 3s)\n" +
+		"Using 1 GEMINI.md file\n" +
+		"~/project   gemini-2.5-pro (99% context left)\n" +
+		"│ > Type your message or @path/to/file │\n"
+
+	result, _ := driver.Parse(context.Background(), []byte(input))
+	if len(result.Messages) != 0 {
+		t.Errorf("Expected no messages, got %v", result.Messages)
+	}
+}
+
+// TestGeminiDriver_RespondToEvent tests responses to confirmation menus
+func TestGeminiDriver_RespondToEvent(t *testing.T) {
+	driver := NewGeminiDriver()
+	event := SmartEvent{Kind: "gemini_confirm", Options: []string{"1", "2", "esc"}}
+
+	tests := []struct {
+		response string
+		expected string
+	}{
+		{"yes", "1"},
+		{"1", "1"},
+		{"always", "2"},
+		{"no", KeyEscape},
+		{"esc", KeyEscape},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.response, func(t *testing.T) {
+			got := string(driver.RespondToEvent(event, tt.response))
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestGeminiDriver_Registered tests that the default registry resolves gemini commands
+func TestGeminiDriver_Registered(t *testing.T) {
+	if name := ResolveDriver("gemini --yolo").Name(); name != "gemini" {
+		t.Errorf("Expected gemini driver, got '%s'", name)
+	}
+}
@@ -0,0 +1,352 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PatternConfig declares a PatternDriver: a name and the rules that turn
+// lines of output into SmartEvents and conversation messages. It can be
+// written as JSON or YAML; see LoadPatternConfig.
+//
+//	name: deploy-bot
+//	commands: [deploy-bot]
+//	rules:
+//	  - name: approval
+//	    pattern: '^\[approve\] (\w+): (.+)\? \[(\w+(?:/\w+)+)\]$'
+//	    event: question
+//	    fields: {tool: "1", prompt: "2", options: "3"}
+//	  - name: reply
+//	    pattern: '^bot> (.+)$'
+//	    message: claude_response
+type PatternConfig struct {
+	Name  string        `json:"name" yaml:"name"`
+	Rules []PatternRule `json:"rules" yaml:"rules"`
+
+	// Commands are the programs RegisterPattern uses the driver for,
+	// matched as by CommandName. It defaults to Name.
+	Commands []string `json:"commands,omitempty" yaml:"commands,omitempty"`
+}
+
+// PatternRule reports lines of output matching Pattern as a SmartEvent of
+// kind Event, a Message of type Message, or both.
+//
+// The event's prompt is the line and the message's content is the
+// pattern's first capture group, or the line if it has none. Fields maps
+// event and message fields to capture groups, given by number or name:
+// "prompt" sets the event's prompt, "content" the message's content, and
+// "options" the event's options, split at slashes, e.g. "y/n/always". Any
+// other field is added to the event's Data and the message's Metadata.
+type PatternRule struct {
+	Name    string            `json:"name" yaml:"name"`
+	Pattern string            `json:"pattern" yaml:"pattern"`
+	Event   string            `json:"event,omitempty" yaml:"event,omitempty"`
+	Message string            `json:"message,omitempty" yaml:"message,omitempty"`
+	Options []string          `json:"options,omitempty" yaml:"options,omitempty"` // Event options unless mapped by Fields
+	Fields  map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// LoadPatternConfig reads a PatternConfig from a .json, .yaml or .yml file.
+func LoadPatternConfig(path string) (PatternConfig, error) {
+	var cfg PatternConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read pattern config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		return cfg, fmt.Errorf("unsupported pattern config format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to parse pattern config: %w", err)
+	}
+	return cfg, nil
+}
+
+// RegisterPattern registers a PatternDriver for cfg under its name, for
+// commands whose program is one of its Commands. Each session gets its own
+// driver. It returns NewPatternDriver's error for an invalid config.
+func (r *Registry) RegisterPattern(cfg PatternConfig) error {
+	if _, err := NewPatternDriver(cfg); err != nil {
+		return err
+	}
+	commands := cfg.Commands
+	if len(commands) == 0 {
+		commands = []string{cfg.Name}
+	}
+	r.Register(cfg.Name, CommandName(commands...), func() AgentDriver {
+		d, _ := NewPatternDriver(cfg) // Validated above
+		return d
+	})
+	return nil
+}
+
+// RegisterPattern registers a PatternDriver for cfg in the default registry.
+func RegisterPattern(cfg PatternConfig) error {
+	return defaultRegistry.RegisterPattern(cfg)
+}
+
+// patternLineSize limits the unfinished line PatternDriver keeps.
+const patternLineSize = 4096
+
+// patternRule is a PatternRule with its pattern compiled and its fields
+// resolved to capture group indexes.
+type patternRule struct {
+	PatternRule
+	re     *regexp.Regexp
+	groups map[string]int
+}
+
+// PatternDriver is a driver configured by a PatternConfig rather than
+// written in Go, for CLIs with a simple prompt format.
+//
+// Output is matched a line at a time, with ANSI escape sequences removed
+// and redrawn lines reduced to their last version. Each completed line is
+// matched once. Event rules are also matched against the line the cursor
+// is on when output changes it, so prompts waiting for input are reported
+// before their line ends, and not again when it ends. Messages are only
+// produced for completed lines.
+type PatternDriver struct {
+	name  string
+	rules []patternRule
+
+	// pending holds the output after the last newline.
+	pending []byte
+
+	// lastPartial is the unfinished line last reported.
+	lastPartial string
+}
+
+// NewPatternDriver creates a driver from cfg. It returns an error if the
+// config has no name, or a rule has an invalid pattern, neither an event
+// nor a message, or a field mapped to a capture group its pattern lacks.
+func NewPatternDriver(cfg PatternConfig) (*PatternDriver, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("pattern driver needs a name")
+	}
+
+	d := &PatternDriver{name: cfg.Name}
+	for i, rule := range cfg.Rules {
+		name := rule.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		if rule.Event == "" && rule.Message == "" {
+			return nil, fmt.Errorf("rule %s: needs an event or a message", name)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid pattern: %w", name, err)
+		}
+
+		groups := make(map[string]int, len(rule.Fields))
+		for field, group := range rule.Fields {
+			index, err := strconv.Atoi(group)
+			if err != nil {
+				index = re.SubexpIndex(group)
+			}
+			if index < 0 || index > re.NumSubexp() {
+				return nil, fmt.Errorf("rule %s: field %s: no capture group %q", name, field, group)
+			}
+			groups[field] = index
+		}
+		d.rules = append(d.rules, patternRule{PatternRule: rule, re: re, groups: groups})
+	}
+	return d, nil
+}
+
+// Name returns the configured name of the driver.
+func (d *PatternDriver) Name() string {
+	return d.name
+}
+
+// Capabilities reports SmartEvents and auto-respond support if a rule
+// produces events, and conversation messages if a rule produces messages.
+func (d *PatternDriver) Capabilities() DriverCapabilities {
+	var caps DriverCapabilities
+	for _, rule := range d.rules {
+		if rule.Event != "" {
+			caps.SupportsSmartEvents = true
+			caps.SupportsAutoRespond = true
+		}
+		if rule.Message != "" {
+			caps.SupportsConversationMessages = true
+		}
+	}
+	return caps
+}
+
+// Parse matches the lines completed by the chunk, and the line the cursor
+// is on, against the driver's rules.
+func (d *PatternDriver) Parse(ctx context.Context, chunk []byte) (*ParseResult, error) {
+	result := &ParseResult{
+		RawData:     chunk,
+		SmartEvents: []SmartEvent{},
+		Messages:    []Message{},
+	}
+
+	lines := bytes.Split(append(d.pending, chunk...), []byte{'\n'})
+	last := lines[len(lines)-1]
+	if len(last) > patternLineSize {
+		last = last[len(last)-patternLineSize:]
+	}
+	d.pending = append([]byte(nil), last...)
+
+	for _, line := range lines[:len(lines)-1] {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		text := patternLineText(line)
+		if text == "" {
+			continue
+		}
+		// Events of a line reported while unfinished were already sent
+		events := text != d.lastPartial
+		d.lastPartial = ""
+		d.match(text, result, events, true)
+	}
+
+	// Chunks that only move the cursor or change modes leave the line as it was
+	if len(bytes.TrimSpace(ansiPattern.ReplaceAll(chunk, nil))) == 0 {
+		return result, nil
+	}
+	if text := patternLineText(d.pending); text != "" && text != d.lastPartial {
+		if d.match(text, result, true, false) {
+			d.lastPartial = text
+		}
+	}
+	return result, nil
+}
+
+// patternLineText returns a line of output without ANSI escape sequences,
+// from its last carriage return, and without surrounding whitespace.
+func patternLineText(line []byte) string {
+	return strings.TrimSpace(currentLine(ansiPattern.ReplaceAll(line, nil)))
+}
+
+// match adds the events, the messages, or both, of the rules matching a
+// line to result, and reports whether any of them matched.
+func (d *PatternDriver) match(line string, result *ParseResult, events, messages bool) bool {
+	matched := false
+	for _, rule := range d.rules {
+		emitEvent := events && rule.Event != ""
+		emitMessage := messages && rule.Message != ""
+		if !emitEvent && !emitMessage {
+			continue
+		}
+		loc := rule.re.FindStringSubmatchIndex(line)
+		if loc == nil {
+			continue
+		}
+		matched = true
+
+		group := func(i int) (string, bool) {
+			if loc[2*i] < 0 {
+				return "", false
+			}
+			return line[loc[2*i]:loc[2*i+1]], true
+		}
+
+		prompt, content, options := line, line, rule.Options
+		if rule.re.NumSubexp() > 0 {
+			if s, ok := group(1); ok {
+				content = s
+			}
+		}
+		var data map[string]string
+		for field, i := range rule.groups {
+			value, ok := group(i)
+			if !ok {
+				continue
+			}
+			switch field {
+			case "prompt":
+				prompt = value
+			case "content":
+				content = value
+			case "options":
+				options = strings.Split(value, "/")
+			default:
+				if data == nil {
+					data = make(map[string]string)
+				}
+				data[field] = value
+			}
+		}
+
+		if emitEvent {
+			result.SmartEvents = append(result.SmartEvents, SmartEvent{
+				Kind:    rule.Event,
+				Options: options,
+				Prompt:  prompt,
+				Data:    data,
+			})
+		}
+		if emitMessage {
+			msg := Message{
+				Timestamp: time.Now(),
+				Type:      rule.Message,
+				Content:   content,
+			}
+			if len(data) > 0 {
+				msg.Metadata = make(map[string]interface{}, len(data))
+				for key, value := range data {
+					msg.Metadata[key] = value
+				}
+			}
+			result.Messages = append(result.Messages, msg)
+		}
+	}
+	return matched
+}
+
+// FormatInput formats an input action into bytes for PTY.
+func (d *PatternDriver) FormatInput(action InputAction) []byte {
+	switch action.Type {
+	case "text":
+		return []byte(action.Content)
+	case "key":
+		return formatKey(action.Content)
+	case "command", "confirm":
+		return []byte(action.Content + KeyEnter)
+	case "cancel":
+		return []byte(KeyEscape)
+	case "interrupt":
+		return []byte(KeyCtrlC)
+	default:
+		return []byte(action.Content)
+	}
+}
+
+// RespondToEvent generates input for a SmartEvent response. A "question"
+// with yes and no options is answered in the form they use; other
+// responses are sent as typed, followed by Enter.
+func (d *PatternDriver) RespondToEvent(event SmartEvent, response string) []byte {
+	if event.Kind == "question" {
+		if input, ok := yesNoResponse(event, response); ok {
+			return input
+		}
+	}
+	return []byte(response + KeyEnter)
+}
+
+// Reset discards the unfinished line.
+func (d *PatternDriver) Reset() {
+	d.pending = nil
+	d.lastPartial = ""
+}
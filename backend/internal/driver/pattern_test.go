@@ -0,0 +1,210 @@
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// deployBotYAML configures a driver for a CLI whose approval prompts look
+// like "[approve] Shell: run the migration? [y/n/always]".
+const deployBotYAML = `
+name: deploy-bot
+rules:
+  - name: approval
+    pattern: '^\[approve\] (?P<tool>\w+): (.+)\? \[(\w+(?:/\w+)+)\]$'
+    event: question
+    fields:
+      tool: tool
+      prompt: "2"
+      options: "3"
+  - name: reply
+    pattern: '^bot> (.+)$'
+    message: claude_response
+  - name: step
+    pattern: '^step (\d+)/(\d+): (.+)$'
+    event: progress
+    message: command_output
+    fields:
+      content: "3"
+      step: "1"
+      total: "2"
+`
+
+// deployBotJSON is deployBotYAML's approval rule as JSON.
+const deployBotJSON = `{
+  "name": "deploy-bot",
+  "rules": [{
+    "name": "approval",
+    "pattern": "^\\[approve\\] (?P<tool>\\w+): (.+)\\? \\[(\\w+(?:/\\w+)+)\\]$",
+    "event": "question",
+    "fields": {"tool": "tool", "prompt": "2", "options": "3"}
+  }]
+}`
+
+// loadPatternDriver writes a config file with the given name and creates a
+// driver from it.
+func loadPatternDriver(t *testing.T, name, config string) *PatternDriver {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := LoadPatternConfig(path)
+	if err != nil {
+		t.Fatalf("LoadPatternConfig failed: %v", err)
+	}
+	d, err := NewPatternDriver(cfg)
+	if err != nil {
+		t.Fatalf("NewPatternDriver failed: %v", err)
+	}
+	return d
+}
+
+// TestPatternDriver_CustomPrompt tests a configured prompt pattern loaded from YAML and JSON
+func TestPatternDriver_CustomPrompt(t *testing.T) {
+	for _, file := range []struct{ name, config string }{
+		{"deploy-bot.yaml", deployBotYAML},
+		{"deploy-bot.json", deployBotJSON},
+	} {
+		t.Run(file.name, func(t *testing.T) {
+			d := loadPatternDriver(t, file.name, file.config)
+			if d.Name() != "deploy-bot" {
+				t.Errorf("Expected name deploy-bot, got %q", d.Name())
+			}
+
+			// The prompt waits for input, so it is reported before its line ends
+			result, err := d.Parse(context.Background(), []byte("\x1b[1m[approve]\x1b[0m Shell: run the migration? [y/n/always]"))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			if len(result.SmartEvents) != 1 {
+				t.Fatalf("Expected 1 event, got %+v", result.SmartEvents)
+			}
+			event := result.SmartEvents[0]
+			if event.Kind != "question" || event.Prompt != "run the migration" {
+				t.Errorf("Expected question 'run the migration', got %+v", event)
+			}
+			if strings.Join(event.Options, ",") != "y,n,always" || event.Data["tool"] != "Shell" {
+				t.Errorf("Expected options y,n,always for tool Shell, got %+v", event)
+			}
+
+			// Ending the line does not report it again
+			result, _ = d.Parse(context.Background(), []byte("\r\n"))
+			if len(result.SmartEvents) != 0 {
+				t.Errorf("Expected the finished prompt not to be reported again, got %+v", result.SmartEvents)
+			}
+
+			if input := d.RespondToEvent(event, "yes"); string(input) != "y\r" {
+				t.Errorf("Expected 'y\\r' for yes, got %q", input)
+			}
+			if input := d.RespondToEvent(event, "always"); string(input) != "always\r" {
+				t.Errorf("Expected 'always\\r', got %q", input)
+			}
+		})
+	}
+}
+
+// TestPatternDriver_Messages tests messages and field mapping for completed lines
+func TestPatternDriver_Messages(t *testing.T) {
+	d := loadPatternDriver(t, "deploy-bot.yml", deployBotYAML)
+
+	// Lines split across chunks are matched once complete
+	result, _ := d.Parse(context.Background(), []byte("bot> Deploying to sta"))
+	result2, _ := d.Parse(context.Background(), []byte("ging now\r\nstep 2/5: building image\r\nunrelated output\r\n"))
+
+	if len(result.Messages) != 0 {
+		t.Errorf("Expected no message for an unfinished reply, got %+v", result.Messages)
+	}
+	if len(result2.Messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %+v", result2.Messages)
+	}
+	reply, step := result2.Messages[0], result2.Messages[1]
+	if reply.Type != "claude_response" || reply.Content != "Deploying to staging now" {
+		t.Errorf("Expected reply message, got %+v", reply)
+	}
+	if step.Type != "command_output" || step.Content != "building image" ||
+		step.Metadata["step"] != "2" || step.Metadata["total"] != "5" {
+		t.Errorf("Expected step message with metadata, got %+v", step)
+	}
+	if len(result2.SmartEvents) != 1 || result2.SmartEvents[0].Kind != "progress" || result2.SmartEvents[0].Data["step"] != "2" {
+		t.Errorf("Expected progress event, got %+v", result2.SmartEvents)
+	}
+
+	caps := d.Capabilities()
+	if !caps.SupportsSmartEvents || !caps.SupportsConversationMessages || !caps.SupportsAutoRespond || caps.SupportsMenuNavigation {
+		t.Errorf("Unexpected capabilities %+v", caps)
+	}
+
+	d.Reset()
+	result, _ = d.Parse(context.Background(), []byte("ging now\r\n"))
+	if len(result.Messages) != 0 {
+		t.Errorf("Expected Reset to discard the unfinished line, got %+v", result.Messages)
+	}
+}
+
+// TestNewPatternDriver_InvalidConfig tests that invalid configs are rejected
+func TestNewPatternDriver_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  PatternConfig
+	}{
+		{"no name", PatternConfig{Rules: []PatternRule{{Pattern: "x", Event: "question"}}}},
+		{"invalid pattern", PatternConfig{Name: "bad", Rules: []PatternRule{{Pattern: "(", Event: "question"}}}},
+		{"no event or message", PatternConfig{Name: "bad", Rules: []PatternRule{{Pattern: "x"}}}},
+		{"missing group number", PatternConfig{Name: "bad", Rules: []PatternRule{
+			{Pattern: "(x)", Event: "question", Fields: map[string]string{"prompt": "2"}},
+		}}},
+		{"missing group name", PatternConfig{Name: "bad", Rules: []PatternRule{
+			{Pattern: "(?P<tool>x)", Event: "question", Fields: map[string]string{"tool": "tol"}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPatternDriver(tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "driver.toml")
+	os.WriteFile(path, []byte("name = 'x'"), 0644)
+	if _, err := LoadPatternConfig(path); err == nil {
+		t.Error("Expected error for an unsupported format, got nil")
+	}
+}
+
+// TestRegistry_RegisterPattern tests that a pattern driver is resolved for
+// its commands, each session getting its own driver
+func TestRegistry_RegisterPattern(t *testing.T) {
+	registry := NewRegistry()
+	cfg := PatternConfig{
+		Name:     "deploy-bot",
+		Commands: []string{"deploy-bot", "db"},
+		Rules:    []PatternRule{{Pattern: `^bot> (.+)$`, Message: "claude_response"}},
+	}
+	if err := registry.RegisterPattern(cfg); err != nil {
+		t.Fatalf("RegisterPattern failed: %v", err)
+	}
+
+	first := registry.ResolveDriver("/usr/local/bin/deploy-bot --env prod")
+	if first.Name() != "deploy-bot" {
+		t.Errorf("Expected the pattern driver, got %s", first.Name())
+	}
+	if second := registry.ResolveDriver("db"); second == first || second.Name() != "deploy-bot" {
+		t.Error("Expected a new pattern driver for each session")
+	}
+	if other := registry.ResolveDriver("deploy"); other.Name() == "deploy-bot" {
+		t.Error("Expected other commands not to use the pattern driver")
+	}
+
+	if err := registry.RegisterPattern(PatternConfig{Name: "empty"}); err != nil {
+		t.Fatalf("Expected a config without rules to be accepted, got %v", err)
+	}
+	if err := registry.RegisterPattern(PatternConfig{Rules: cfg.Rules}); err == nil {
+		t.Error("Expected an error for a config without a name")
+	}
+}
@@ -0,0 +1,114 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Pipeline is an AgentDriver that passes PTY output through several drivers
+// in order, e.g. a driver that strips a container's framing followed by the
+// driver of the agent running inside it.
+//
+// Input is formatted by the last driver, which parses the agent's own
+// output and so knows its input conventions.
+type Pipeline struct {
+	drivers []AgentDriver
+}
+
+// NewPipeline creates a driver that runs drivers in order. Nil drivers are
+// skipped; with no drivers it behaves like GenericDriver.
+func NewPipeline(drivers ...AgentDriver) AgentDriver {
+	p := &Pipeline{}
+	for _, d := range drivers {
+		if d != nil {
+			p.drivers = append(p.drivers, d)
+		}
+	}
+	if len(p.drivers) == 0 {
+		p.drivers = []AgentDriver{NewGenericDriver()}
+	}
+	return p
+}
+
+// Drivers returns the pipeline's drivers in order.
+func (p *Pipeline) Drivers() []AgentDriver {
+	return append([]AgentDriver(nil), p.drivers...)
+}
+
+// Name returns the names of the drivers joined by "+", e.g. "docker+claude".
+func (p *Pipeline) Name() string {
+	names := make([]string, len(p.drivers))
+	for i, d := range p.drivers {
+		names[i] = d.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+// Parse feeds the chunk to the first driver and the RawData of each driver's
+// result to the next. The result holds the SmartEvents and Messages of all
+// drivers, in driver order, the RawData of the last driver and the
+// AutoResponse of the last driver that set one. An error
+// from any driver, or ctx being done before a driver runs, stops the
+// pipeline.
+func (p *Pipeline) Parse(ctx context.Context, chunk []byte) (*ParseResult, error) {
+	result := &ParseResult{
+		RawData:     chunk,
+		SmartEvents: []SmartEvent{},
+		Messages:    []Message{},
+	}
+	for _, d := range p.drivers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		stage, err := d.Parse(ctx, result.RawData)
+		if err != nil {
+			return nil, fmt.Errorf("driver %s failed to parse output: %w", d.Name(), err)
+		}
+		if stage == nil {
+			result.RawData = nil
+			continue
+		}
+		result.RawData = stage.RawData
+		result.SmartEvents = append(result.SmartEvents, stage.SmartEvents...)
+		result.Messages = append(result.Messages, stage.Messages...)
+		if stage.AutoResponse != nil {
+			result.AutoResponse = stage.AutoResponse
+		}
+	}
+	return result, nil
+}
+
+// FormatInput formats an input action with the last driver.
+func (p *Pipeline) FormatInput(action InputAction) []byte {
+	return p.last().FormatInput(action)
+}
+
+// RespondToEvent generates the response input with the last driver.
+func (p *Pipeline) RespondToEvent(event SmartEvent, response string) []byte {
+	return p.last().RespondToEvent(event, response)
+}
+
+// Capabilities reports the parsing features supported by any driver, and
+// the input features of the last driver.
+func (p *Pipeline) Capabilities() DriverCapabilities {
+	caps := p.last().Capabilities()
+	for _, d := range p.drivers {
+		c := d.Capabilities()
+		caps.SupportsSmartEvents = caps.SupportsSmartEvents || c.SupportsSmartEvents
+		caps.SupportsConversationMessages = caps.SupportsConversationMessages || c.SupportsConversationMessages
+	}
+	return caps
+}
+
+// Reset resets every driver.
+func (p *Pipeline) Reset() {
+	for _, d := range p.drivers {
+		d.Reset()
+	}
+}
+
+// last returns the last driver of the pipeline.
+func (p *Pipeline) last() AgentDriver {
+	return p.drivers[len(p.drivers)-1]
+}
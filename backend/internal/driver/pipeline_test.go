@@ -0,0 +1,118 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// stageDriver is a test driver that strips a prefix from each chunk and
+// reports one event and message per chunk.
+type stageDriver struct {
+	GenericDriver
+	name   string
+	prefix string
+	err    error
+	resets int
+}
+
+func (d *stageDriver) Name() string {
+	return d.name
+}
+
+func (d *stageDriver) Parse(ctx context.Context, chunk []byte) (*ParseResult, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	return &ParseResult{
+		RawData:     bytes.TrimPrefix(chunk, []byte(d.prefix)),
+		SmartEvents: []SmartEvent{{Kind: d.name}},
+		Messages:    []Message{{Type: d.name, Content: string(chunk)}},
+	}, nil
+}
+
+func (d *stageDriver) FormatInput(action InputAction) []byte {
+	return []byte(d.name + ":" + action.Content)
+}
+
+func (d *stageDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{}
+}
+
+func (d *stageDriver) Reset() {
+	d.resets++
+}
+
+func TestPipeline_Parse(t *testing.T) {
+	outer := &stageDriver{name: "docker", prefix: "[docker] "}
+	inner := &stageDriver{name: "agent", prefix: "> "}
+	p := NewPipeline(outer, inner)
+
+	result, err := p.Parse(context.Background(), []byte("[docker] > hello"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.RawData) != "hello" {
+		t.Errorf("expected raw data 'hello', got '%s'", result.RawData)
+	}
+	if len(result.SmartEvents) != 2 || result.SmartEvents[0].Kind != "docker" || result.SmartEvents[1].Kind != "agent" {
+		t.Errorf("expected events of both stages in order, got %+v", result.SmartEvents)
+	}
+	// Each stage sees the previous stage's output
+	if len(result.Messages) != 2 || result.Messages[0].Content != "[docker] > hello" || result.Messages[1].Content != "> hello" {
+		t.Errorf("expected messages of both stages in order, got %+v", result.Messages)
+	}
+}
+
+func TestPipeline_ParseError(t *testing.T) {
+	failure := errors.New("bad frame")
+	inner := &stageDriver{name: "agent"}
+	p := NewPipeline(&stageDriver{name: "docker", err: failure}, inner)
+
+	if _, err := p.Parse(context.Background(), []byte("data")); !errors.Is(err, failure) {
+		t.Errorf("expected the stage's error, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewPipeline(inner).Parse(ctx, []byte("data")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPipeline_Delegation(t *testing.T) {
+	outer := &stageDriver{name: "docker"}
+	p := NewPipeline(outer, nil, NewClaudeDriver())
+
+	if p.Name() != "docker+claude" {
+		t.Errorf("expected name 'docker+claude', got '%s'", p.Name())
+	}
+
+	// Input goes through the last driver
+	if got := p.FormatInput(InputAction{Type: "key", Content: "enter"}); string(got) != KeyEnter {
+		t.Errorf("expected the claude driver's Enter, got %q", got)
+	}
+
+	// Parsing features of any stage, input features of the last
+	caps := NewPipeline(NewClaudeDriver(), outer).Capabilities()
+	expected := DriverCapabilities{SupportsSmartEvents: true, SupportsConversationMessages: true}
+	if caps != expected {
+		t.Errorf("expected capabilities %+v, got %+v", expected, caps)
+	}
+
+	p.Reset()
+	if outer.resets != 1 {
+		t.Errorf("expected every stage to be reset, got %d resets", outer.resets)
+	}
+}
+
+func TestPipeline_Empty(t *testing.T) {
+	p := NewPipeline()
+	if p.Name() != "generic" {
+		t.Errorf("expected an empty pipeline to act as the generic driver, got '%s'", p.Name())
+	}
+	result, err := p.Parse(context.Background(), []byte("hello"))
+	if err != nil || string(result.RawData) != "hello" {
+		t.Errorf("expected raw data to pass through, got %+v (err: %v)", result, err)
+	}
+}
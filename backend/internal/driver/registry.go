@@ -0,0 +1,155 @@
+package driver
+
+import (
+	"path"
+	"strings"
+	"sync"
+)
+
+// Factory creates a new AgentDriver instance.
+type Factory func() AgentDriver
+
+// Matcher reports whether a driver should handle the given command.
+type Matcher func(command string) bool
+
+// registryEntry holds a registered driver factory and its matcher.
+type registryEntry struct {
+	name    string
+	matcher Matcher
+	factory Factory
+}
+
+// Registry maps session commands to AgentDriver factories.
+// Entries are consulted in registration order; the first matcher that
+// accepts a command wins. It is safe for concurrent use.
+type Registry struct {
+	entries []registryEntry
+	mu      sync.RWMutex
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a driver factory under the given name.
+// Registering an existing name replaces the previous entry in place.
+func (r *Registry) Register(name string, matcher Matcher, factory Factory) {
+	if matcher == nil || factory == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := registryEntry{name: name, matcher: matcher, factory: factory}
+	for i, e := range r.entries {
+		if e.name == name {
+			r.entries[i] = entry
+			return
+		}
+	}
+	r.entries = append(r.entries, entry)
+}
+
+// Unregister removes the driver registered under the given name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, e := range r.entries {
+		if e.name == name {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Names returns the registered driver names in lookup order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.entries))
+	for i, e := range r.entries {
+		names[i] = e.name
+	}
+	return names
+}
+
+// ResolveDriver returns a new driver for the given command.
+// It falls back to a GenericDriver when no registered matcher accepts the command.
+func (r *Registry) ResolveDriver(command string) AgentDriver {
+	r.mu.RLock()
+	var factory Factory
+	for _, e := range r.entries {
+		if e.matcher(command) {
+			factory = e.factory
+			break
+		}
+	}
+	r.mu.RUnlock()
+
+	if factory != nil {
+		if d := factory(); d != nil {
+			return d
+		}
+	}
+	return NewGenericDriver()
+}
+
+// defaultRegistry is the process-wide registry with the built-in drivers.
+var defaultRegistry = NewRegistry()
+
+func init() {
+	defaultRegistry.Register("claude", CommandContains("claude"), func() AgentDriver {
+		return NewClaudeDriver()
+	})
+	defaultRegistry.Register("gemini", CommandContains("gemini"), func() AgentDriver {
+		return NewGeminiDriver()
+	})
+	defaultRegistry.Register("bash", CommandName("bash", "sh", "zsh", "fish"), func() AgentDriver {
+		return NewBashDriver()
+	})
+}
+
+// DefaultRegistry returns the process-wide driver registry.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register adds a driver factory to the default registry.
+// It is intended to be called from init functions.
+func Register(name string, matcher Matcher, factory Factory) {
+	defaultRegistry.Register(name, matcher, factory)
+}
+
+// ResolveDriver returns a driver for the command using the default registry.
+func ResolveDriver(command string) AgentDriver {
+	return defaultRegistry.ResolveDriver(command)
+}
+
+// CommandContains returns a Matcher that accepts commands containing substr.
+func CommandContains(substr string) Matcher {
+	return func(command string) bool {
+		return strings.Contains(command, substr)
+	}
+}
+
+// CommandName returns a Matcher that accepts commands whose program, without
+// its directory, is one of names. "/bin/bash -l" matches "bash".
+func CommandName(names ...string) Matcher {
+	return func(command string) bool {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return false
+		}
+		program := path.Base(fields[0])
+		for _, name := range names {
+			if program == name {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,113 @@
+package driver
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// stubDriver is a minimal AgentDriver used to verify registry lookups.
+type stubDriver struct {
+	GenericDriver
+	name string
+}
+
+func (d *stubDriver) Name() string {
+	return d.name
+}
+
+func TestRegistry_ResolveDriver(t *testing.T) {
+	r := NewRegistry()
+	r.Register("aider", CommandContains("aider"), func() AgentDriver {
+		return &stubDriver{name: "aider"}
+	})
+	r.Register("gemini", CommandContains("gemini"), func() AgentDriver {
+		return &stubDriver{name: "gemini"}
+	})
+
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"aider --model gpt-4", "aider"},
+		{"/usr/local/bin/gemini", "gemini"},
+		{"bash", "generic"},
+		{"", "generic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			d := r.ResolveDriver(tt.command)
+			if d == nil {
+				t.Fatal("driver should not be nil")
+			}
+			if d.Name() != tt.expected {
+				t.Errorf("expected driver '%s', got '%s'", tt.expected, d.Name())
+			}
+		})
+	}
+}
+
+func TestRegistry_FirstMatchWinsAndReplace(t *testing.T) {
+	r := NewRegistry()
+	r.Register("first", CommandContains("agent"), func() AgentDriver {
+		return &stubDriver{name: "first"}
+	})
+	r.Register("second", CommandContains("agent"), func() AgentDriver {
+		return &stubDriver{name: "second"}
+	})
+
+	if name := r.ResolveDriver("agent").Name(); name != "first" {
+		t.Errorf("expected first registered driver to win, got '%s'", name)
+	}
+
+	// Re-registering keeps the original position but swaps the factory
+	r.Register("first", CommandContains("agent"), func() AgentDriver {
+		return &stubDriver{name: "replaced"}
+	})
+	if name := r.ResolveDriver("agent").Name(); name != "replaced" {
+		t.Errorf("expected replaced driver, got '%s'", name)
+	}
+	if names := r.Names(); len(names) != 2 || names[0] != "first" || names[1] != "second" {
+		t.Errorf("unexpected registry order: %v", names)
+	}
+
+	r.Unregister("first")
+	if name := r.ResolveDriver("agent").Name(); name != "second" {
+		t.Errorf("expected second driver after unregister, got '%s'", name)
+	}
+}
+
+func TestRegistry_ReturnsFreshInstances(t *testing.T) {
+	d1 := ResolveDriver("claude")
+	d2 := ResolveDriver("claude")
+
+	if d1.Name() != "claude" {
+		t.Fatalf("expected default registry to resolve claude, got '%s'", d1.Name())
+	}
+	if d1 == d2 {
+		t.Error("expected a new driver instance per resolution")
+	}
+}
+
+func TestRegistry_ConcurrentRegister(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("driver-%d", i)
+			r.Register(name, CommandContains(name), func() AgentDriver {
+				return &stubDriver{name: name}
+			})
+			r.ResolveDriver(name)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(r.Names()) != 50 {
+		t.Errorf("expected 50 registered drivers, got %d", len(r.Names()))
+	}
+}
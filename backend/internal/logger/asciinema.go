@@ -1,10 +1,12 @@
 package logger
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -22,7 +24,7 @@ type AsciinemaHeader struct {
 // Format: [time_offset, event_type, data]
 type AsciinemaEvent struct {
 	TimeOffset float64
-	EventType  string // "o" for output, "i" for input
+	EventType  string // "o" for output, "i" for input, "r" for resize
 	Data       string
 }
 
@@ -62,27 +64,165 @@ func (e *AsciinemaEvent) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Size returns the terminal size carried by a resize ("r") event,
+// whose data has the form "COLSxROWS".
+func (e AsciinemaEvent) Size() (cols, rows int, ok bool) {
+	if e.EventType != "r" {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(e.Data, "%dx%d", &cols, &rows); err != nil || cols <= 0 || rows <= 0 {
+		return 0, 0, false
+	}
+	return cols, rows, true
+}
 
 // AsciinemaLogger records terminal sessions in Asciinema v2 JSON-Lines format.
 type AsciinemaLogger struct {
 	writer    io.Writer
-	file      *os.File // only set if we own the file
+	file      *os.File     // only set if we own the file
+	gz        *gzip.Writer // only set if the file is compressed
 	startTime time.Time
 	mu        sync.Mutex
+
+	// Size-based rotation, only used for loggers that own their file
+	basePath  string
+	compress  bool
+	maxBytes  int64 // Rotate once a part reaches this size; 0 never rotates
+	written   int64 // Uncompressed bytes written to the current part
+	part      int
+	header    AsciinemaHeader
+	hasHeader bool
+
+	redact Redactor // Applied to output and input events; may be nil
+}
+
+// AsciinemaLoggerOptions configures an AsciinemaLogger that writes to a file.
+type AsciinemaLoggerOptions struct {
+	// Compress writes the recording gzip-compressed, conventionally to a
+	// .cast.gz file. Open reads such files transparently.
+	Compress bool
+
+	// MaxBytes starts a new part once the current one has this many
+	// (uncompressed) bytes. Zero never rotates. See NewAsciinemaLoggerRotating.
+	MaxBytes int64
+
+	// Redactor, if set, rewrites the data of every output and input event
+	// before it is written, e.g. NewRegexRedactor.
+	Redactor Redactor
 }
 
 // NewAsciinemaLogger creates a new AsciinemaLogger that writes to the given file path.
 func NewAsciinemaLogger(filePath string) (*AsciinemaLogger, error) {
-	file, err := os.Create(filePath)
+	return NewAsciinemaLoggerWithOptions(filePath, AsciinemaLoggerOptions{})
+}
+
+// NewAsciinemaLoggerWithOptions creates a new AsciinemaLogger that writes to
+// the given file path with the given options.
+// Parts left over from an earlier recording at the same path are removed.
+func NewAsciinemaLoggerWithOptions(filePath string, opts AsciinemaLoggerOptions) (*AsciinemaLogger, error) {
+	l := &AsciinemaLogger{
+		startTime: time.Now(),
+		basePath:  filePath,
+		compress:  opts.Compress,
+		maxBytes:  opts.MaxBytes,
+		redact:    opts.Redactor,
+	}
+	if err := l.openPartLocked(); err != nil {
+		return nil, err
+	}
+
+	removeParts(filePath, 1)
+	return l, nil
+}
+
+// NewAsciinemaLoggerRotating creates a new AsciinemaLogger that writes to
+// basePath until it reaches maxBytes, then continues in basePath's numbered
+// parts: session.1.cast, session.2.cast and so on. Each part starts with the
+// recording's header and keeps event times relative to the start of the
+// recording, so a part can be played on its own and the parts concatenated
+// without their later headers form the whole recording. See OpenParts.
+func NewAsciinemaLoggerRotating(basePath string, maxBytes int64) (*AsciinemaLogger, error) {
+	return NewAsciinemaLoggerWithOptions(basePath, AsciinemaLoggerOptions{
+		Compress: strings.HasSuffix(basePath, ".gz"),
+		MaxBytes: maxBytes,
+	})
+}
+
+// openPartLocked creates the file of the current part. l.mu must be held
+// unless l is being constructed.
+func (l *AsciinemaLogger) openPartLocked() error {
+	file, err := os.Create(PartPath(l.basePath, l.part))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log file: %w", err)
+		return fmt.Errorf("failed to create log file: %w", err)
 	}
 
-	return &AsciinemaLogger{
-		writer:    file,
-		file:      file,
-		startTime: time.Now(),
-	}, nil
+	l.file = file
+	l.writer = file
+	l.gz = nil
+	if l.compress {
+		l.gz = gzip.NewWriter(file)
+		l.writer = l.gz
+	}
+	l.written = 0
+	return nil
+}
+
+// rotateLocked closes the current part and starts the next one with the
+// recording's header. l.mu must be held.
+func (l *AsciinemaLogger) rotateLocked() error {
+	if err := l.closeFileLocked(); err != nil {
+		return err
+	}
+	l.part++
+	if err := l.openPartLocked(); err != nil {
+		return err
+	}
+	if l.hasHeader {
+		return l.writeHeaderLocked()
+	}
+	return nil
+}
+
+// PartPath returns the path of a part of a rotated recording: basePath for
+// part 0 and, for example, session.2.cast or session.2.cast.gz for part 2
+// of session.cast or session.cast.gz.
+func PartPath(basePath string, part int) string {
+	if part == 0 {
+		return basePath
+	}
+	ext := ""
+	for _, e := range []string{".cast.gz", ".cast"} {
+		if strings.HasSuffix(basePath, e) {
+			ext = e
+			break
+		}
+	}
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(basePath, ext), part, ext)
+}
+
+// Parts returns the paths of the parts of the recording at basePath in
+// order, starting with basePath itself.
+func Parts(basePath string) ([]string, error) {
+	if _, err := os.Stat(basePath); err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	parts := []string{basePath}
+	for part := 1; ; part++ {
+		path := PartPath(basePath, part)
+		if _, err := os.Stat(path); err != nil {
+			return parts, nil
+		}
+		parts = append(parts, path)
+	}
+}
+
+// removeParts deletes the parts of the recording at basePath from part on.
+func removeParts(basePath string, from int) {
+	for part := from; ; part++ {
+		if err := os.Remove(PartPath(basePath, part)); err != nil {
+			return
+		}
+	}
 }
 
 // NewAsciinemaLoggerWithWriter creates a new AsciinemaLogger that writes to the given writer.
@@ -105,15 +245,21 @@ func (l *AsciinemaLogger) WriteHeaderWithEnv(cols, rows int, env map[string]stri
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	header := AsciinemaHeader{
+	l.header = AsciinemaHeader{
 		Version:   2,
 		Width:     cols,
 		Height:    rows,
 		Timestamp: l.startTime.Unix(),
 		Env:       env,
 	}
+	l.hasHeader = true
 
-	data, err := json.Marshal(header)
+	return l.writeHeaderLocked()
+}
+
+// writeHeaderLocked writes the recording's header. l.mu must be held.
+func (l *AsciinemaLogger) writeHeaderLocked() error {
+	data, err := json.Marshal(l.header)
 	if err != nil {
 		return fmt.Errorf("failed to marshal header: %w", err)
 	}
@@ -121,18 +267,39 @@ func (l *AsciinemaLogger) WriteHeaderWithEnv(cols, rows int, env map[string]stri
 	if _, err := l.writer.Write(append(data, '\n')); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
+	l.written += int64(len(data) + 1)
 
-	return nil
+	return l.flushLocked()
 }
 
 // WriteOutput writes an output event ("o") to the log file.
 func (l *AsciinemaLogger) WriteOutput(data []byte) error {
-	return l.writeEvent("o", data)
+	return l.writeEvent("o", l.redacted(data))
 }
 
 // WriteInput writes an input event ("i") to the log file.
+// Input is redacted too, since it may hold passwords typed at prompts.
 func (l *AsciinemaLogger) WriteInput(data []byte) error {
-	return l.writeEvent("i", data)
+	return l.writeEvent("i", l.redacted(data))
+}
+
+// redacted returns data passed through the logger's redactor, if any.
+func (l *AsciinemaLogger) redacted(data []byte) []byte {
+	if l.redact == nil {
+		return data
+	}
+	return l.redact(data)
+}
+
+// WriteMarker writes a marker event ("m") with the given label, a chapter
+// that players can jump to.
+func (l *AsciinemaLogger) WriteMarker(label string) error {
+	return l.writeEvent("m", []byte(label))
+}
+
+// WriteResize writes a resize event ("r") with the new terminal size.
+func (l *AsciinemaLogger) WriteResize(cols, rows int) error {
+	return l.writeEvent("r", []byte(fmt.Sprintf("%dx%d", cols, rows)))
 }
 
 // writeEvent writes an event to the log file with the given type.
@@ -156,17 +323,61 @@ func (l *AsciinemaLogger) writeEvent(eventType string, data []byte) error {
 	if _, err := l.writer.Write(append(eventData, '\n')); err != nil {
 		return fmt.Errorf("failed to write event: %w", err)
 	}
+	l.written += int64(len(eventData) + 1)
+
+	// A later part starts at the current size
+	if cols, rows, ok := event.Size(); ok {
+		l.header.Width, l.header.Height = cols, rows
+	}
+
+	if err := l.flushLocked(); err != nil {
+		return err
+	}
+
+	// Decide under l.mu, so concurrent writes rotate exactly once
+	if l.maxBytes > 0 && l.file != nil && l.written >= l.maxBytes {
+		return l.rotateLocked()
+	}
+	return nil
+}
 
+// flushLocked flushes compressed data to the file, so a recording that is
+// still being written can be replayed and survives a crash. l.mu must be held.
+func (l *AsciinemaLogger) flushLocked() error {
+	if l.gz == nil {
+		return nil
+	}
+	if err := l.gz.Flush(); err != nil {
+		return fmt.Errorf("failed to flush compressed log: %w", err)
+	}
 	return nil
 }
 
-// Close closes the log file.
+// Close closes the log file. A compressed recording is completed before
+// the file is closed.
 func (l *AsciinemaLogger) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.closeFileLocked()
+}
 
+// closeFileLocked completes and closes the current file. l.mu must be held.
+func (l *AsciinemaLogger) closeFileLocked() error {
+	if l.gz != nil {
+		err := l.gz.Close()
+		l.gz = nil
+		if err != nil {
+			if l.file != nil {
+				l.file.Close()
+				l.file = nil
+			}
+			return fmt.Errorf("failed to finish compressed log: %w", err)
+		}
+	}
 	if l.file != nil {
-		return l.file.Close()
+		err := l.file.Close()
+		l.file = nil
+		return err
 	}
 	return nil
 }
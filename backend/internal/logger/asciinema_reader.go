@@ -0,0 +1,296 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"strings"
+)
+
+// AsciinemaReader reads recordings in Asciinema v2 JSON-Lines format.
+type AsciinemaReader struct {
+	reader  *bufio.Reader
+	file    *os.File     // only set if we own the file
+	closer  io.Closer    // only set if we own the parts of a rotated recording
+	gz      *gzip.Reader // only set if the recording is compressed
+	header  AsciinemaHeader
+	skipped int
+	err     error
+}
+
+// Open opens the recording at the given file path and reads its header.
+// Compressed (.cast.gz) recordings are decompressed transparently, and the
+// events of a rotated recording are read from all of its parts.
+func Open(filePath string) (*AsciinemaReader, error) {
+	if parts, err := Parts(filePath); err == nil && len(parts) > 1 {
+		rc, err := OpenParts(filePath)
+		if err != nil {
+			return nil, err
+		}
+		r, err := NewAsciinemaReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		r.closer = rc
+		return r, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	r, err := NewAsciinemaReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.file = file
+	return r, nil
+}
+
+// OpenCast opens the recording at the given file path for reading as plain
+// Asciinema v2 text, whether it is a .cast or .cast.gz file. A rotated
+// recording is read from all of its parts; see OpenParts.
+func OpenCast(filePath string) (io.ReadCloser, error) {
+	if parts, err := Parts(filePath); err == nil && len(parts) > 1 {
+		return OpenParts(filePath)
+	}
+	return OpenDecompressed(filePath)
+}
+
+// OpenDecompressed opens the recording at the given file path for reading
+// as plain Asciinema v2 text, decompressing it if it is gzip-compressed.
+func OpenDecompressed(filePath string) (io.ReadCloser, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	compressed, err := IsCompressed(filePath)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !compressed {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read compressed log: %w", err)
+	}
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+// OpenParts opens all parts of the recording at basePath for reading as one
+// plain Asciinema v2 recording: the first part followed by the events of
+// the later parts, whose repeated headers are dropped. Parts are
+// decompressed as needed.
+func OpenParts(basePath string) (io.ReadCloser, error) {
+	paths, err := Parts(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &partsReader{}
+	readers := make([]io.Reader, 0, len(paths))
+	for i, path := range paths {
+		rc, err := OpenDecompressed(path)
+		if err != nil {
+			pr.Close()
+			return nil, err
+		}
+		pr.closers = append(pr.closers, rc)
+
+		var part io.Reader = rc
+		if _, ok := rc.(*gzipFile); ok {
+			// The last part may still be being written
+			part = unfinishedGzip{rc}
+		}
+		if i > 0 {
+			// Drop the part's copy of the header
+			br := bufio.NewReader(part)
+			if _, err := br.ReadBytes('\n'); err != nil {
+				continue
+			}
+			part = br
+		}
+		readers = append(readers, part)
+	}
+	pr.Reader = io.MultiReader(readers...)
+	return pr, nil
+}
+
+// partsReader reads the parts of a rotated recording in sequence.
+type partsReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes every part.
+func (r *partsReader) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// unfinishedGzip ends a compressed part without a gzip trailer, which is
+// still being written, like a complete one.
+type unfinishedGzip struct {
+	io.Reader
+}
+
+// Read reads from the part, reporting a missing trailer as io.EOF.
+func (r unfinishedGzip) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// IsCompressed reports whether the recording at the given file path is
+// gzip-compressed, by its .gz extension or its first bytes.
+func IsCompressed(filePath string) (bool, error) {
+	if strings.HasSuffix(filePath, ".gz") {
+		return true, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		// Too short to be compressed
+		return false, nil
+	}
+	return bytes.Equal(magic, gzipMagic), nil
+}
+
+// gzipFile closes a gzip reader and the file it reads.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close closes the gzip reader and the file.
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// NewAsciinemaReader creates a new AsciinemaReader that reads from the given reader.
+// The header is read immediately; the events are read as they are iterated.
+// A gzip-compressed recording is detected and decompressed transparently.
+func NewAsciinemaReader(rd io.Reader) (*AsciinemaReader, error) {
+	r := &AsciinemaReader{reader: bufio.NewReader(rd)}
+
+	if magic, _ := r.reader.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(r.reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compressed log: %w", err)
+		}
+		r.gz = gz
+		r.reader = bufio.NewReader(gz)
+	}
+
+	line, err := r.readLine()
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if err := json.Unmarshal(line, &r.header); err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+	if r.header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciinema version %d", r.header.Version)
+	}
+
+	return r, nil
+}
+
+// Header returns the recording's header.
+func (r *AsciinemaReader) Header() AsciinemaHeader {
+	return r.header
+}
+
+// Events returns an iterator over the recording's events in file order.
+// Malformed lines are skipped and counted in Skipped. The events are read
+// from the underlying reader, so they can only be iterated once.
+func (r *AsciinemaReader) Events() iter.Seq[AsciinemaEvent] {
+	return func(yield func(AsciinemaEvent) bool) {
+		for {
+			line, err := r.readLine()
+			if len(bytes.TrimSpace(line)) > 0 {
+				var event AsciinemaEvent
+				if jsonErr := json.Unmarshal(line, &event); jsonErr != nil {
+					r.skipped++
+				} else if !yield(event) {
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !r.isUnfinished(err) {
+					r.err = fmt.Errorf("failed to read event: %w", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// isUnfinished reports whether err is the end of a compressed recording
+// that is still being written and so has no gzip trailer yet.
+func (r *AsciinemaReader) isUnfinished(err error) bool {
+	return r.gz != nil && errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Skipped returns the number of malformed event lines skipped so far.
+func (r *AsciinemaReader) Skipped() int {
+	return r.skipped
+}
+
+// Err returns the first read error encountered while iterating events,
+// or nil if the events were read to the end of the recording.
+func (r *AsciinemaReader) Err() error {
+	return r.err
+}
+
+// Close closes the log file.
+func (r *AsciinemaReader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	if r.file != nil {
+		return r.file.Close()
+	}
+	return nil
+}
+
+// readLine reads the next line without its trailing newline.
+// Lines may be arbitrarily long, since output events are not split.
+func (r *AsciinemaReader) readLine() ([]byte, error) {
+	line, err := r.reader.ReadBytes('\n')
+	return bytes.TrimRight(line, "\r\n"), err
+}
@@ -0,0 +1,538 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAsciinemaReader_RoundTrip tests that events written by AsciinemaLogger read back unchanged
+func TestAsciinemaReader_RoundTrip(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "session.cast")
+	l, err := NewAsciinemaLogger(logPath)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	env := map[string]string{"SHELL": "/bin/bash", "TERM": "xterm-256color"}
+	if err := l.WriteHeaderWithEnv(120, 40, env); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+
+	written := []AsciinemaEvent{
+		{EventType: "o", Data: "hello\r\n"},
+		{EventType: "i", Data: "ls -la\r"},
+		{EventType: "o", Data: "\x1b[31mred\x1b[0m \"quoted\" \\ tab\t"},
+		{EventType: "o", Data: "héllo ✻ 世界"},
+		{EventType: "r", Data: "100x30"},
+		{EventType: "m", Data: "chapter 1"},
+		{EventType: "o", Data: strings.Repeat("x", 256*1024)},
+	}
+	for _, e := range written {
+		switch e.EventType {
+		case "i":
+			err = l.WriteInput([]byte(e.Data))
+		case "r":
+			err = l.WriteResize(100, 30)
+		case "m":
+			err = l.WriteMarker(e.Data)
+		default:
+			err = l.WriteOutput([]byte(e.Data))
+		}
+		if err != nil {
+			t.Fatalf("failed to write event: %v", err)
+		}
+	}
+	l.Close()
+
+	r, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("failed to open recording: %v", err)
+	}
+	defer r.Close()
+
+	header := r.Header()
+	if header.Version != 2 || header.Width != 120 || header.Height != 40 {
+		t.Errorf("Expected 120x40 v2 header, got %+v", header)
+	}
+	if header.Timestamp != l.StartTime().Unix() {
+		t.Errorf("Expected timestamp %d, got %d", l.StartTime().Unix(), header.Timestamp)
+	}
+	if header.Env["TERM"] != "xterm-256color" || header.Env["SHELL"] != "/bin/bash" {
+		t.Errorf("Expected env to round-trip, got %v", header.Env)
+	}
+
+	var read []AsciinemaEvent
+	for e := range r.Events() {
+		read = append(read, e)
+	}
+	if len(read) != len(written) {
+		t.Fatalf("Expected %d events, got %d", len(written), len(read))
+	}
+	last := 0.0
+	for i := range written {
+		if read[i].EventType != written[i].EventType || read[i].Data != written[i].Data {
+			t.Errorf("Event %d: expected %s %q, got %s %q", i, written[i].EventType, trim(written[i].Data), read[i].EventType, trim(read[i].Data))
+		}
+		if read[i].TimeOffset < last {
+			t.Errorf("Event %d: expected time offset >= %f, got %f", i, last, read[i].TimeOffset)
+		}
+		last = read[i].TimeOffset
+	}
+	if r.Skipped() != 0 || r.Err() != nil {
+		t.Errorf("Expected a clean read, got %d skipped, err %v", r.Skipped(), r.Err())
+	}
+}
+
+// TestAsciinemaReader_Compressed tests that gzip-compressed recordings are
+// written and read back transparently, including while still being written
+func TestAsciinemaReader_Compressed(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "session.cast.gz")
+	l, err := NewAsciinemaLoggerWithOptions(logPath, AsciinemaLoggerOptions{Compress: true})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	if err := l.WriteHeader(80, 24); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+	big := strings.Repeat("compressible output ", 10000)
+	for _, data := range []string{"hello\r\n", big} {
+		if err := l.WriteOutput([]byte(data)); err != nil {
+			t.Fatalf("failed to write event: %v", err)
+		}
+	}
+
+	readEvents := func() []AsciinemaEvent {
+		t.Helper()
+		r, err := Open(logPath)
+		if err != nil {
+			t.Fatalf("failed to open recording: %v", err)
+		}
+		defer r.Close()
+		if r.Header().Width != 80 || r.Header().Height != 24 {
+			t.Errorf("Expected 80x24 header, got %+v", r.Header())
+		}
+		var events []AsciinemaEvent
+		for e := range r.Events() {
+			events = append(events, e)
+		}
+		if r.Err() != nil {
+			t.Errorf("Expected a clean read, got %v", r.Err())
+		}
+		return events
+	}
+
+	// Flushed events can be read before the recording is closed
+	if events := readEvents(); len(events) != 2 || events[1].Data != big {
+		t.Fatalf("Expected 2 events from the unfinished recording, got %d", len(events))
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close logger: %v", err)
+	}
+	if events := readEvents(); len(events) != 2 || events[0].Data != "hello\r\n" {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatalf("failed to stat recording: %v", err)
+	}
+	if info.Size() >= int64(len(big)) {
+		t.Errorf("Expected recording to be compressed, got %d bytes", info.Size())
+	}
+
+	compressed, err := IsCompressed(logPath)
+	if err != nil || !compressed {
+		t.Errorf("Expected recording to be detected as compressed, got %v (err=%v)", compressed, err)
+	}
+
+	rc, err := OpenDecompressed(logPath)
+	if err != nil {
+		t.Fatalf("failed to open decompressed recording: %v", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read decompressed recording: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("Expected header and 2 event lines, got %d", lines)
+	}
+}
+
+// TestIsCompressed tests detecting compression by magic bytes without a .gz extension
+func TestIsCompressed(t *testing.T) {
+	dir := t.TempDir()
+
+	plainPath := filepath.Join(dir, "plain.cast")
+	l, err := NewAsciinemaLogger(plainPath)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	l.WriteHeader(80, 24)
+	l.Close()
+
+	gzPath := filepath.Join(dir, "renamed.cast")
+	l, err = NewAsciinemaLoggerWithOptions(gzPath, AsciinemaLoggerOptions{Compress: true})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	l.WriteHeader(80, 24)
+	l.Close()
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{plainPath, false},
+		{gzPath, true},
+	}
+	for _, tt := range tests {
+		compressed, err := IsCompressed(tt.path)
+		if err != nil {
+			t.Fatalf("IsCompressed(%s) failed: %v", tt.path, err)
+		}
+		if compressed != tt.expected {
+			t.Errorf("IsCompressed(%s): expected %v, got %v", filepath.Base(tt.path), tt.expected, compressed)
+		}
+
+		r, err := Open(tt.path)
+		if err != nil {
+			t.Fatalf("Open(%s) failed: %v", tt.path, err)
+		}
+		if r.Header().Width != 80 {
+			t.Errorf("Open(%s): expected 80 column header, got %+v", filepath.Base(tt.path), r.Header())
+		}
+		r.Close()
+	}
+}
+
+// TestAsciinemaLogger_Rotation tests that a rotating recording splits into parts that read back as one
+func TestAsciinemaLogger_Rotation(t *testing.T) {
+	for _, name := range []string{"session.cast", "session.cast.gz"} {
+		t.Run(name, func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), name)
+			l, err := NewAsciinemaLoggerRotating(logPath, 256)
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			if err := l.WriteHeader(80, 24); err != nil {
+				t.Fatalf("failed to write header: %v", err)
+			}
+			var want []string
+			for i := 0; i < 20; i++ {
+				data := fmt.Sprintf("line %d %s\r\n", i, strings.Repeat("x", 40))
+				want = append(want, data)
+				if err := l.WriteOutput([]byte(data)); err != nil {
+					t.Fatalf("failed to write event: %v", err)
+				}
+			}
+			if err := l.Close(); err != nil {
+				t.Fatalf("failed to close logger: %v", err)
+			}
+
+			parts, err := Parts(logPath)
+			if err != nil {
+				t.Fatalf("failed to list parts: %v", err)
+			}
+			if len(parts) < 2 {
+				t.Fatalf("Expected the recording to be rotated, got %d part(s)", len(parts))
+			}
+
+			// Each part is a recording of its own
+			for i, part := range parts {
+				if part != PartPath(logPath, i) {
+					t.Errorf("Expected part %d at %s, got %s", i, PartPath(logPath, i), part)
+				}
+				r, err := Open(part)
+				if err != nil {
+					t.Fatalf("failed to open part %d: %v", i, err)
+				}
+				if r.Header().Width != 80 || r.Header().Height != 24 {
+					t.Errorf("Expected 80x24 header in part %d, got %+v", i, r.Header())
+				}
+				r.Close()
+			}
+
+			// Opening the base path reads all parts in order
+			r, err := Open(logPath)
+			if err != nil {
+				t.Fatalf("failed to open recording: %v", err)
+			}
+			defer r.Close()
+			var got []string
+			var last float64
+			for e := range r.Events() {
+				if e.TimeOffset < last {
+					t.Errorf("Expected event times to increase across parts, got %f after %f", e.TimeOffset, last)
+				}
+				last = e.TimeOffset
+				got = append(got, e.Data)
+			}
+			if r.Err() != nil || r.Skipped() != 0 {
+				t.Errorf("Expected a clean read, got err=%v skipped=%d", r.Err(), r.Skipped())
+			}
+			if strings.Join(got, "") != strings.Join(want, "") {
+				t.Errorf("Expected %d events in order, got %d", len(want), len(got))
+			}
+		})
+	}
+}
+
+// TestAsciinemaLogger_RemovesStaleParts tests that a new recording deletes parts left by an earlier one
+func TestAsciinemaLogger_RemovesStaleParts(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "session.cast")
+	l, err := NewAsciinemaLoggerRotating(logPath, 64)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	l.WriteHeader(80, 24)
+	for i := 0; i < 10; i++ {
+		l.WriteOutput([]byte(strings.Repeat("y", 64)))
+	}
+	l.Close()
+	if parts, _ := Parts(logPath); len(parts) < 2 {
+		t.Fatalf("Expected the first recording to be rotated, got %d part(s)", len(parts))
+	}
+
+	l, err = NewAsciinemaLogger(logPath)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	l.WriteHeader(80, 24)
+	l.Close()
+	parts, err := Parts(logPath)
+	if err != nil {
+		t.Fatalf("failed to list parts: %v", err)
+	}
+	if len(parts) != 1 {
+		t.Errorf("Expected stale parts to be removed, got %v", parts)
+	}
+}
+
+// TestOpenParts tests that later headers are dropped when concatenating parts
+func TestOpenParts(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "session.cast.gz")
+	l, err := NewAsciinemaLoggerRotating(logPath, 128)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	l.WriteHeader(80, 24)
+	for i := 0; i < 10; i++ {
+		l.WriteOutput([]byte(strings.Repeat("z", 64)))
+	}
+	l.Close()
+
+	rc, err := OpenParts(logPath)
+	if err != nil {
+		t.Fatalf("failed to open parts: %v", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read parts: %v", err)
+	}
+	if headers := strings.Count(string(data), `"version"`); headers != 1 {
+		t.Errorf("Expected a single header, got %d", headers)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 11 {
+		t.Errorf("Expected header and 10 event lines, got %d", lines)
+	}
+}
+
+// TestOpenCast tests reading plain, compressed and rotated recordings as plain text
+func TestOpenCast(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		path     string
+		compress bool
+		maxBytes int64
+	}{
+		{"plain", filepath.Join(dir, "plain.cast"), false, 0},
+		{"compressed", filepath.Join(dir, "compressed.cast.gz"), true, 0},
+		{"rotated", filepath.Join(dir, "rotated.cast.gz"), true, 128},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l *AsciinemaLogger
+			var err error
+			if tt.maxBytes > 0 {
+				l, err = NewAsciinemaLoggerRotating(tt.path, tt.maxBytes)
+			} else {
+				l, err = NewAsciinemaLoggerWithOptions(tt.path, AsciinemaLoggerOptions{Compress: tt.compress})
+			}
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			l.WriteHeader(80, 24)
+			for i := 0; i < 5; i++ {
+				l.WriteOutput([]byte(strings.Repeat("z", 64)))
+			}
+			l.Close()
+
+			rc, err := OpenCast(tt.path)
+			if err != nil {
+				t.Fatalf("OpenCast failed: %v", err)
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("failed to read recording: %v", err)
+			}
+			if !strings.HasPrefix(string(data), `{"version":2`) {
+				t.Errorf("Expected a plain header, got %q", data[:min(len(data), 20)])
+			}
+			if lines := strings.Count(string(data), "\n"); lines != 6 {
+				t.Errorf("Expected header and 5 event lines, got %d", lines)
+			}
+		})
+	}
+}
+
+// TestPartPath tests the file names of recording parts
+func TestPartPath(t *testing.T) {
+	tests := []struct {
+		basePath string
+		part     int
+		expected string
+	}{
+		{"logs/abc.cast", 0, "logs/abc.cast"},
+		{"logs/abc.cast", 1, "logs/abc.1.cast"},
+		{"logs/abc.cast.gz", 2, "logs/abc.2.cast.gz"},
+		{"logs/abc", 3, "logs/abc.3"},
+	}
+	for _, tt := range tests {
+		if got := PartPath(tt.basePath, tt.part); got != tt.expected {
+			t.Errorf("PartPath(%q, %d): expected %q, got %q", tt.basePath, tt.part, tt.expected, got)
+		}
+	}
+}
+
+// TestAsciinemaReader_SkipsMalformedLines tests that malformed event lines are counted and skipped
+func TestAsciinemaReader_SkipsMalformedLines(t *testing.T) {
+	recording := strings.Join([]string{
+		`{"version":2,"width":80,"height":24,"timestamp":1700000000}`,
+		`[0.25,"o","first"]`,
+		`not json`,
+		`[0.5,"o"]`,
+		``,
+		`{"time":1,"type":"o","data":"object"}`,
+		`[1.125,"i","second"]`,
+		`[2.5,"o","no trailing newline"]`,
+	}, "\n")
+
+	r, err := NewAsciinemaReader(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("failed to read header: %v", err)
+	}
+
+	expected := []AsciinemaEvent{
+		{TimeOffset: 0.25, EventType: "o", Data: "first"},
+		{TimeOffset: 1.125, EventType: "i", Data: "second"},
+		{TimeOffset: 2.5, EventType: "o", Data: "no trailing newline"},
+	}
+	var read []AsciinemaEvent
+	for e := range r.Events() {
+		read = append(read, e)
+	}
+	if len(read) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(read), read)
+	}
+	for i := range expected {
+		if read[i] != expected[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, expected[i], read[i])
+		}
+	}
+	if r.Skipped() != 3 {
+		t.Errorf("Expected 3 skipped lines, got %d", r.Skipped())
+	}
+}
+
+// TestAsciinemaReader_StopEarly tests that breaking out of Events leaves the rest unread
+func TestAsciinemaReader_StopEarly(t *testing.T) {
+	recording := `{"version":2,"width":80,"height":24,"timestamp":0}
+[0.1,"o","a"]
+[0.2,"o","b"]
+[0.3,"o","c"]
+`
+	r, err := NewAsciinemaReader(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("failed to read header: %v", err)
+	}
+
+	for e := range r.Events() {
+		if e.Data != "a" {
+			t.Fatalf("Expected first event 'a', got %q", e.Data)
+		}
+		break
+	}
+
+	var rest []string
+	for e := range r.Events() {
+		rest = append(rest, e.Data)
+	}
+	if strings.Join(rest, ",") != "b,c" {
+		t.Errorf("Expected remaining events b,c, got %v", rest)
+	}
+}
+
+// TestAsciinemaReader_InvalidHeader tests that recordings without a valid v2 header are rejected
+func TestAsciinemaReader_InvalidHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		recording string
+	}{
+		{"empty", ""},
+		{"not json", "hello\n"},
+		{"event first", `[0.1,"o","a"]` + "\n"},
+		{"wrong version", `{"version":1,"width":80,"height":24}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAsciinemaReader(strings.NewReader(tt.recording)); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.cast")); err == nil {
+		t.Error("Expected error opening a missing file, got nil")
+	}
+}
+
+// TestAsciinemaEvent_Size tests parsing the terminal size of resize events
+func TestAsciinemaEvent_Size(t *testing.T) {
+	tests := []struct {
+		event      AsciinemaEvent
+		cols, rows int
+		ok         bool
+	}{
+		{AsciinemaEvent{EventType: "r", Data: "80x24"}, 80, 24, true},
+		{AsciinemaEvent{EventType: "r", Data: "213x57"}, 213, 57, true},
+		{AsciinemaEvent{EventType: "r", Data: "80"}, 0, 0, false},
+		{AsciinemaEvent{EventType: "r", Data: "0x24"}, 0, 0, false},
+		{AsciinemaEvent{EventType: "o", Data: "80x24"}, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		cols, rows, ok := tt.event.Size()
+		if cols != tt.cols || rows != tt.rows || ok != tt.ok {
+			t.Errorf("%+v: expected (%d, %d, %v), got (%d, %d, %v)", tt.event, tt.cols, tt.rows, tt.ok, cols, rows, ok)
+		}
+	}
+}
+
+// trim shortens long event data for error messages.
+func trim(s string) string {
+	if len(s) > 40 {
+		return s[:40] + "..."
+	}
+	return s
+}
@@ -1,2 +1,3 @@
-// Package logger provides Asciinema v2 format logging for terminal sessions.
+// Package logger provides Asciinema v2 format logging for terminal sessions,
+// and reading recordings back for server-side processing.
 package logger
@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"context"
+	"time"
+)
+
+// PlayerOptions configures a Player.
+type PlayerOptions struct {
+	// Speed multiplies the recorded playback speed; 2 plays twice as fast.
+	// Zero or less plays at the recorded speed.
+	Speed float64
+
+	// From is the offset in seconds to start playing from. Earlier events
+	// are delivered at once, so a terminal fed the events shows the state
+	// of the recording at From before playback continues in real time.
+	From float64
+}
+
+// Player replays the events of a recording with their original timing.
+type Player struct {
+	reader *AsciinemaReader
+	speed  float64
+	from   float64
+
+	// wait pauses for d or until ctx is done
+	wait func(ctx context.Context, d time.Duration) error
+}
+
+// NewPlayer creates a Player for the events of reader.
+func NewPlayer(reader *AsciinemaReader, opts PlayerOptions) *Player {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	return &Player{
+		reader: reader,
+		speed:  speed,
+		from:   max(opts.From, 0),
+		wait:   sleep,
+	}
+}
+
+// Header returns the header of the recording.
+func (p *Player) Header() AsciinemaHeader {
+	return p.reader.Header()
+}
+
+// Play calls fn for each event of the recording in order, first waiting out
+// the recorded gap since the previous event scaled by the playback speed.
+// An error returned by fn stops playback and is returned. Play returns
+// ctx.Err() if ctx is done first, or an error reading the recording.
+// Malformed events are skipped; see AsciinemaReader.Skipped.
+func (p *Player) Play(ctx context.Context, fn func(AsciinemaEvent) error) error {
+	last := p.from
+	for event := range p.reader.Events() {
+		if gap := event.TimeOffset - last; gap > 0 {
+			if err := p.wait(ctx, time.Duration(gap/p.speed*float64(time.Second))); err != nil {
+				return err
+			}
+			last = event.TimeOffset
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return p.reader.Err()
+}
+
+// sleep pauses for d or until ctx is done, returning ctx.Err() in that case.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const playerRecording = `{"version": 2, "width": 80, "height": 24, "timestamp": 1700000000}
+[0.5, "o", "one"]
+[1.5, "o", "two"]
+[1.5, "r", "100x30"]
+[4.0, "o", "three"]
+`
+
+// newTestPlayer returns a player for playerRecording that records the
+// delays it waits instead of sleeping.
+func newTestPlayer(t *testing.T, opts PlayerOptions) (*Player, *[]time.Duration) {
+	t.Helper()
+	r, err := NewAsciinemaReader(strings.NewReader(playerRecording))
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	p := NewPlayer(r, opts)
+	var delays []time.Duration
+	p.wait = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return p, &delays
+}
+
+// TestPlayer_Timing tests the delays before events at different speeds and offsets
+func TestPlayer_Timing(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           PlayerOptions
+		expectedDelays []time.Duration
+	}{
+		{"recorded speed", PlayerOptions{}, []time.Duration{500 * time.Millisecond, time.Second, 2500 * time.Millisecond}},
+		{"double speed", PlayerOptions{Speed: 2}, []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, 1250 * time.Millisecond}},
+		{"from offset", PlayerOptions{From: 1.5}, []time.Duration{2500 * time.Millisecond}},
+		{"from mid gap", PlayerOptions{From: 3, Speed: 0.5}, []time.Duration{2 * time.Second}},
+		{"from past the end", PlayerOptions{From: 10}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, delays := newTestPlayer(t, tt.opts)
+			var events []string
+			err := p.Play(context.Background(), func(e AsciinemaEvent) error {
+				events = append(events, e.Data)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Play failed: %v", err)
+			}
+
+			// Every event is delivered, earlier ones without delay
+			if strings.Join(events, ",") != "one,two,100x30,three" {
+				t.Errorf("Expected all events in order, got %v", events)
+			}
+			if len(*delays) != len(tt.expectedDelays) {
+				t.Fatalf("Expected delays %v, got %v", tt.expectedDelays, *delays)
+			}
+			for i, d := range *delays {
+				if d != tt.expectedDelays[i] {
+					t.Errorf("Expected delays %v, got %v", tt.expectedDelays, *delays)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestPlayer_Stop tests that playback stops on callback errors and cancellation
+func TestPlayer_Stop(t *testing.T) {
+	p, _ := newTestPlayer(t, PlayerOptions{})
+	errStop := errors.New("stop")
+	count := 0
+	err := p.Play(context.Background(), func(e AsciinemaEvent) error {
+		count++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || count != 1 {
+		t.Errorf("Expected playback to stop after the first event, got %d events and err %v", count, err)
+	}
+
+	// Cancelling while waiting stops playback with the context's error
+	r, err := NewAsciinemaReader(strings.NewReader(playerRecording))
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	err = NewPlayer(r, PlayerOptions{Speed: 0.01}).Play(ctx, func(e AsciinemaEvent) error {
+		t.Errorf("Expected no event before cancellation, got %+v", e)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected cancellation to interrupt the wait, took %v", elapsed)
+	}
+}
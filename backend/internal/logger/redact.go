@@ -0,0 +1,26 @@
+package logger
+
+import "regexp"
+
+// Redacted is the default replacement for spans removed by a regex redactor.
+const Redacted = "[REDACTED]"
+
+// Redactor rewrites terminal data before it is recorded, e.g. to remove
+// passwords, API keys or tokens. It must not modify data in place.
+type Redactor func(data []byte) []byte
+
+// NewRegexRedactor returns a Redactor that replaces every match of patterns
+// with replacement, or with Redacted if replacement is nil. Patterns are
+// applied in order. Data is redacted one write at a time, so a secret split
+// across two writes is not matched.
+func NewRegexRedactor(patterns []*regexp.Regexp, replacement []byte) Redactor {
+	if replacement == nil {
+		replacement = []byte(Redacted)
+	}
+	return func(data []byte) []byte {
+		for _, re := range patterns {
+			data = re.ReplaceAllLiteral(data, replacement)
+		}
+		return data
+	}
+}
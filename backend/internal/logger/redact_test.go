@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestRegexRedactor tests replacing matched spans
+func TestRegexRedactor(t *testing.T) {
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`sk-[A-Za-z0-9]{8,}`),
+		regexp.MustCompile(`(?i)password=\S+`),
+	}
+
+	tests := []struct {
+		name        string
+		replacement []byte
+		input       string
+		expected    string
+	}{
+		{"no match", nil, "hello world", "hello world"},
+		{"api key", nil, "key: sk-abcdef123456\r\n", "key: [REDACTED]\r\n"},
+		{"several matches", nil, "PASSWORD=hunter2 sk-abcdefgh", "[REDACTED] [REDACTED]"},
+		{"custom replacement", []byte("***"), "password=hunter2", "***"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redact := NewRegexRedactor(patterns, tt.replacement)
+			input := []byte(tt.input)
+			if got := string(redact(input)); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if string(input) != tt.input {
+				t.Errorf("Expected input to be unchanged, got %q", input)
+			}
+		})
+	}
+}
+
+// TestAsciinemaLoggerRedactor tests that output and input events are
+// redacted before they are written, and resize events are not
+func TestAsciinemaLoggerRedactor(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "session.cast")
+	l, err := NewAsciinemaLoggerWithOptions(logPath, AsciinemaLoggerOptions{
+		Redactor: NewRegexRedactor([]*regexp.Regexp{regexp.MustCompile(`hunter2|\d+x\d+`)}, nil),
+	})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	if err := l.WriteHeader(80, 24); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+	l.WriteOutput([]byte("Password: "))
+	l.WriteInput([]byte("hunter2\r"))
+	l.WriteOutput([]byte("echo hunter2\r\n"))
+	l.WriteResize(100, 30)
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close logger: %v", err)
+	}
+
+	r, err := Open(logPath)
+	if err != nil {
+		t.Fatalf("failed to open recording: %v", err)
+	}
+	defer r.Close()
+
+	expected := []AsciinemaEvent{
+		{EventType: "o", Data: "Password: "},
+		{EventType: "i", Data: "[REDACTED]\r"},
+		{EventType: "o", Data: "echo [REDACTED]\r\n"},
+		{EventType: "r", Data: "100x30"},
+	}
+	var events []AsciinemaEvent
+	for e := range r.Events() {
+		events = append(events, e)
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, e := range events {
+		if e.EventType != expected[i].EventType || e.Data != expected[i].Data {
+			t.Errorf("Expected event %d to be %q %q, got %q %q", i, expected[i].EventType, expected[i].Data, e.EventType, e.Data)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// tailBlockSize is how many bytes ReadLastNEvents reads at a time when
+// reading a recording backwards.
+var tailBlockSize int64 = 64 * 1024
+
+// ReadLastNEvents returns the last n events of the recording at the given
+// file path, in file order. Fewer are returned if the recording has fewer.
+//
+// A plain .cast file is read backwards from its end, so only the lines of
+// the returned events are read, however long the recording. A compressed
+// file cannot be read backwards and is read from the start. The events of
+// a rotated recording are taken from its last parts first. The header and
+// malformed lines are skipped.
+func ReadLastNEvents(filePath string, n int) ([]AsciinemaEvent, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	parts, err := Parts(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []AsciinemaEvent
+	for i := len(parts) - 1; i >= 0 && len(events) < n; i-- {
+		partEvents, err := lastEvents(parts[i], n-len(events))
+		if err != nil {
+			return nil, err
+		}
+		events = append(partEvents, events...)
+	}
+	return events, nil
+}
+
+// lastEvents returns the last n events of a single recording file.
+func lastEvents(filePath string, n int) ([]AsciinemaEvent, error) {
+	compressed, err := IsCompressed(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		return lastEventsStreamed(filePath, n)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	// Events are collected newest first. partial is the start of the data
+	// read so far, up to its first newline, which may continue in the
+	// block before it.
+	var events []AsciinemaEvent
+	var partial []byte
+	pos := info.Size()
+	for pos > 0 && len(events) < n {
+		size := min(tailBlockSize, pos)
+		pos -= size
+		block := make([]byte, size, size+int64(len(partial)))
+		if _, err := file.ReadAt(block, pos); err != nil {
+			return nil, fmt.Errorf("failed to read log file: %w", err)
+		}
+		block = append(block, partial...)
+
+		lines := bytes.Split(block, []byte{'\n'})
+		first := 0
+		if pos > 0 {
+			partial, first = lines[0], 1
+		}
+		for i := len(lines) - 1; i >= first && len(events) < n; i-- {
+			if event, ok := parseEventLine(lines[i]); ok {
+				events = append(events, event)
+			}
+		}
+	}
+	slices.Reverse(events)
+	return events, nil
+}
+
+// lastEventsStreamed returns the last n events of a recording file by
+// reading all of its events.
+func lastEventsStreamed(filePath string, n int) ([]AsciinemaEvent, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	r, err := NewAsciinemaReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.file = file
+	defer r.Close()
+
+	var events []AsciinemaEvent
+	for event := range r.Events() {
+		if len(events) == n {
+			events = events[1:]
+		}
+		events = append(events, event)
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	return events, nil
+}
+
+// parseEventLine parses a line of a recording as an event. It reports
+// false for the header, blank and malformed lines.
+func parseEventLine(line []byte) (AsciinemaEvent, bool) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return AsciinemaEvent{}, false
+	}
+	var event AsciinemaEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		return AsciinemaEvent{}, false
+	}
+	return event, true
+}
@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeNumberedRecording records count output events "event <i>" to logPath.
+func writeNumberedRecording(t *testing.T, logPath string, maxBytes int64, count int) {
+	t.Helper()
+	l, err := NewAsciinemaLoggerRotating(logPath, maxBytes)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	if err := l.WriteHeader(80, 24); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+	for i := 0; i < count; i++ {
+		if err := l.WriteOutput([]byte(fmt.Sprintf("event %d", i))); err != nil {
+			t.Fatalf("failed to write event: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close logger: %v", err)
+	}
+}
+
+// TestReadLastNEvents tests reading the last events of plain, compressed and rotated recordings
+func TestReadLastNEvents(t *testing.T) {
+	// Small blocks so lines span several reads
+	defer func(size int64) { tailBlockSize = size }(tailBlockSize)
+	tailBlockSize = 16
+
+	tests := []struct {
+		name     string
+		file     string
+		maxBytes int64
+	}{
+		{"plain", "session.cast", 0},
+		{"compressed", "session.cast.gz", 0},
+		{"rotated", "rotated.cast", 256},
+		{"rotated compressed", "rotated.cast.gz", 256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), tt.file)
+			writeNumberedRecording(t, logPath, tt.maxBytes, 50)
+			if tt.maxBytes > 0 {
+				if parts, _ := Parts(logPath); len(parts) < 3 {
+					t.Fatalf("Expected the recording to be rotated, got %d part(s)", len(parts))
+				}
+			}
+
+			events, err := ReadLastNEvents(logPath, 12)
+			if err != nil {
+				t.Fatalf("ReadLastNEvents failed: %v", err)
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Data)
+			}
+			var want []string
+			for i := 38; i < 50; i++ {
+				want = append(want, fmt.Sprintf("event %d", i))
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+
+			// Asking for more than recorded returns every event
+			events, err = ReadLastNEvents(logPath, 1000)
+			if err != nil {
+				t.Fatalf("ReadLastNEvents failed: %v", err)
+			}
+			if len(events) != 50 || events[0].Data != "event 0" {
+				t.Errorf("Expected all 50 events from the first, got %d", len(events))
+			}
+		})
+	}
+}
+
+// TestReadLastNEvents_SkipsMalformedLines tests that the header and malformed lines are not returned
+func TestReadLastNEvents_SkipsMalformedLines(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "session.cast")
+	recording := strings.Join([]string{
+		`{"version":2,"width":80,"height":24,"timestamp":1700000000}`,
+		`[0.25,"o","first"]`,
+		`not json`,
+		`[0.5,"i","second"]`,
+		``,
+		`[1.5,"o","partial`,
+	}, "\n")
+	if err := os.WriteFile(logPath, []byte(recording), 0644); err != nil {
+		t.Fatalf("failed to write recording: %v", err)
+	}
+
+	events, err := ReadLastNEvents(logPath, 10)
+	if err != nil {
+		t.Fatalf("ReadLastNEvents failed: %v", err)
+	}
+	expected := []AsciinemaEvent{
+		{TimeOffset: 0.25, EventType: "o", Data: "first"},
+		{TimeOffset: 0.5, EventType: "i", Data: "second"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, expected[i], events[i])
+		}
+	}
+
+	if _, err := ReadLastNEvents(filepath.Join(t.TempDir(), "missing.cast"), 10); err == nil {
+		t.Error("Expected error reading a missing file, got nil")
+	}
+}
@@ -0,0 +1,51 @@
+// Package logging defines the leveled, structured Logger the server's
+// packages log through, so their output can be collected by log
+// aggregators. It is unrelated to package logger, which records sessions.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Logger logs messages at four levels. Each message is followed by
+// alternating keys and values, such as "session_id", id, "error", err.
+// *slog.Logger implements it.
+type Logger interface {
+	Debug(msg string, keysAndValues ...any)
+	Info(msg string, keysAndValues ...any)
+	Warn(msg string, keysAndValues ...any)
+	Error(msg string, keysAndValues ...any)
+}
+
+// Nop is a Logger that discards all messages. It is the default of the
+// packages that accept a Logger, which keeps tests quiet.
+type Nop struct{}
+
+func (Nop) Debug(string, ...any) {}
+func (Nop) Info(string, ...any)  {}
+func (Nop) Warn(string, ...any)  {}
+func (Nop) Error(string, ...any) {}
+
+// New returns a Logger, backed by log/slog, that writes messages of at
+// least level to w as JSON lines.
+func New(w io.Writer, level slog.Level) Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// ParseLevel parses a level name: debug, info, warn or error, in any case.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// Both loggers implement Logger
+var (
+	_ Logger = Nop{}
+	_ Logger = (*slog.Logger)(nil)
+)
+
+// TestNew tests that messages are written as JSON with their fields and
+// that messages below the level are dropped
+func TestNew(t *testing.T) {
+	var b bytes.Buffer
+	logger := New(&b, slog.LevelInfo)
+
+	logger.Debug("Not written", "session_id", "s1")
+	logger.Warn("Failed to write to PTY", "session_id", "s1", "bytes", 3)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %d: %q", len(lines), b.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", lines[0], err)
+	}
+	expected := map[string]any{
+		"level":      "WARN",
+		"msg":        "Failed to write to PTY",
+		"session_id": "s1",
+		"bytes":      float64(3),
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, entry[key])
+		}
+	}
+}
+
+// TestParseLevel tests parsing of level names
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected slog.Level
+		wantErr  bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"warning", slog.LevelWarn, false},
+		{"Error", slog.LevelError, false},
+		{"verbose", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		level, err := ParseLevel(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Expected error %v for %q, got %v", tt.wantErr, tt.name, err)
+			continue
+		}
+		if level != tt.expected {
+			t.Errorf("Expected %v for %q, got %v", tt.expected, tt.name, level)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package metrics instruments the server and exports the measurements in the
+// Prometheus text exposition format, without depending on the Prometheus
+// client library.
+package metrics
+
+// Namespace prefixes the names of the server's metrics.
+const Namespace = "remote_agent_terminal"
+
+// Recorder receives measurements from the server's hot paths: hub
+// broadcasts, PTY writes and the process lifecycle. Implementations must be
+// safe for concurrent use and cheap, as they are called under locks.
+// Nop disables instrumentation.
+type Recorder interface {
+	// MessageBroadcast counts a message of the given type broadcast by a hub.
+	MessageBroadcast(msgType string)
+
+	// PTYWrite counts bytes written to a PTY.
+	PTYWrite(bytes int)
+
+	// SessionSpawned counts a spawned PTY process.
+	SessionSpawned()
+
+	// SessionExited counts a PTY process that exited with the given
+	// session status, such as "exited" or "failed".
+	SessionExited(status string)
+}
+
+// Nop is a Recorder that discards all measurements.
+type Nop struct{}
+
+func (Nop) MessageBroadcast(string) {}
+func (Nop) PTYWrite(int)            {}
+func (Nop) SessionSpawned()         {}
+func (Nop) SessionExited(string)    {}
+
+// ServerMetrics is the Recorder that keeps the server's counters in a
+// Registry for export.
+type ServerMetrics struct {
+	Registry *Registry
+
+	messagesBroadcast *CounterVec
+	ptyBytesWritten   *Counter
+	sessionsSpawned   *Counter
+	sessionsExited    *CounterVec
+}
+
+// New creates ServerMetrics with its counters registered in a new Registry.
+// Gauges, such as the number of active sessions, can be added to the
+// Registry with NewGaugeFunc.
+func New() *ServerMetrics {
+	r := NewRegistry()
+	return &ServerMetrics{
+		Registry: r,
+		messagesBroadcast: r.NewCounterVec(Namespace+"_messages_broadcast_total",
+			"Messages broadcast to WebSocket clients, by message type.", "type"),
+		ptyBytesWritten: r.NewCounter(Namespace+"_pty_bytes_written_total",
+			"Bytes of input written to PTYs."),
+		sessionsSpawned: r.NewCounter(Namespace+"_sessions_spawned_total",
+			"PTY processes spawned."),
+		sessionsExited: r.NewCounterVec(Namespace+"_sessions_exited_total",
+			"PTY processes that exited, by session status.", "status"),
+	}
+}
+
+// MessageBroadcast implements Recorder.
+func (m *ServerMetrics) MessageBroadcast(msgType string) {
+	m.messagesBroadcast.Inc(msgType)
+}
+
+// PTYWrite implements Recorder.
+func (m *ServerMetrics) PTYWrite(bytes int) {
+	m.ptyBytesWritten.Add(uint64(bytes))
+}
+
+// SessionSpawned implements Recorder.
+func (m *ServerMetrics) SessionSpawned() {
+	m.sessionsSpawned.Inc()
+}
+
+// SessionExited implements Recorder.
+func (m *ServerMetrics) SessionExited(status string) {
+	m.sessionsExited.Inc(status)
+}
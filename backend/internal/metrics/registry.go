@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metric is a registered metric family that can write its samples.
+type metric interface {
+	name() string
+	writeText(w *bufio.Writer)
+}
+
+// Registry holds metrics and writes them in the Prometheus text exposition
+// format. Metrics are written in registration order.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register adds m to the registry. It panics if the name is already taken,
+// as registration happens at startup.
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[m.name()] {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	r.names[m.name()] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// NewCounter registers and returns a counter without labels.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{family: family{n: name, help: help, kind: "counter"}}
+	r.register(c)
+	return c
+}
+
+// NewCounterVec registers and returns a counter with one label.
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{family: family{n: name, help: help, kind: "counter"}, label: label}
+	r.register(c)
+	return c
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn when the
+// metrics are written, so it costs nothing between scrapes.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{family: family{n: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.writeText(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP writes the metrics for a Prometheus scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteText(w)
+}
+
+// family holds the metadata shared by the samples of a metric.
+type family struct {
+	n    string
+	help string
+	kind string // "counter" or "gauge"
+}
+
+func (f *family) name() string {
+	return f.n
+}
+
+// writeHeader writes the HELP and TYPE lines of the family.
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.n, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.n, f.kind)
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	family
+	value atomic.Uint64
+}
+
+// Add increases the counter by n.
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+// Inc increases the counter by one.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+func (c *Counter) writeText(w *bufio.Writer) {
+	c.writeHeader(w)
+	fmt.Fprintf(w, "%s %d\n", c.n, c.value.Load())
+}
+
+// CounterVec is a set of counters partitioned by the value of one label.
+type CounterVec struct {
+	family
+	label  string
+	values sync.Map // label value -> *atomic.Uint64
+}
+
+// Add increases the counter for the label value by n.
+func (c *CounterVec) Add(value string, n uint64) {
+	counter, ok := c.values.Load(value)
+	if !ok {
+		counter, _ = c.values.LoadOrStore(value, new(atomic.Uint64))
+	}
+	counter.(*atomic.Uint64).Add(n)
+}
+
+// Inc increases the counter for the label value by one.
+func (c *CounterVec) Inc(value string) {
+	c.Add(value, 1)
+}
+
+// Value returns the current count for the label value.
+func (c *CounterVec) Value(value string) uint64 {
+	if counter, ok := c.values.Load(value); ok {
+		return counter.(*atomic.Uint64).Load()
+	}
+	return 0
+}
+
+func (c *CounterVec) writeText(w *bufio.Writer) {
+	c.writeHeader(w)
+
+	var values []string
+	c.values.Range(func(key, _ any) bool {
+		values = append(values, key.(string))
+		return true
+	})
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", c.n, c.label, escapeLabel(value), c.Value(value))
+	}
+}
+
+// gaugeFunc is a gauge whose value is computed when it is written.
+type gaugeFunc struct {
+	family
+	fn func() float64
+}
+
+func (g *gaugeFunc) writeText(w *bufio.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.n, formatFloat(g.fn()))
+}
+
+// formatFloat formats a sample value as the exposition format expects.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes backslashes and newlines in HELP text.
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// escapeLabel escapes backslashes, newlines and quotes in a label value.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
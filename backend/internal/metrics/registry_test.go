@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Both recorders implement Recorder
+var (
+	_ Recorder = Nop{}
+	_ Recorder = (*ServerMetrics)(nil)
+)
+
+// TestRegistryWriteText tests the text exposition format of each metric kind
+func TestRegistryWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Requests served.")
+	errors := r.NewCounterVec("test_errors_total", "Errors by code.", "code")
+	r.NewGaugeFunc("test_temperature", "Current temperature.", func() float64 { return 21.5 })
+
+	requests.Add(3)
+	requests.Inc()
+	errors.Inc("timeout")
+	errors.Add("bad_request", 2)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("failed to write metrics: %v", err)
+	}
+
+	expected := `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total 4
+# HELP test_errors_total Errors by code.
+# TYPE test_errors_total counter
+test_errors_total{code="bad_request"} 2
+test_errors_total{code="timeout"} 1
+# HELP test_temperature Current temperature.
+# TYPE test_temperature gauge
+test_temperature 21.5
+`
+	if b.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+// TestEscaping tests escaping of HELP text and label values
+func TestEscaping(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func(string) string
+		input    string
+		expected string
+	}{
+		{"help plain", escapeHelp, "Plain text", "Plain text"},
+		{"help backslash and newline", escapeHelp, "a\\b\nc", `a\\b\nc`},
+		{"help keeps quotes", escapeHelp, `say "hi"`, `say "hi"`},
+		{"label quotes", escapeLabel, `say "hi"`, `say \"hi\"`},
+		{"label backslash and newline", escapeLabel, "a\\b\nc", `a\\b\nc`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestFormatFloat tests formatting of gauge values
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.25, "0.25"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		if got := formatFloat(tt.value); got != tt.expected {
+			t.Errorf("Expected %s for %v, got %s", tt.expected, tt.value, got)
+		}
+	}
+}
+
+// TestDuplicateMetric tests that registering a name twice panics
+func TestDuplicateMetric(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test.")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a duplicate metric")
+		}
+	}()
+	r.NewGaugeFunc("test_total", "Test.", func() float64 { return 0 })
+}
+
+// TestServerMetrics tests the server's counters and the scrape handler
+func TestServerMetrics(t *testing.T) {
+	m := New()
+	m.MessageBroadcast("stdout")
+	m.MessageBroadcast("stdout")
+	m.MessageBroadcast("status")
+	m.PTYWrite(5)
+	m.PTYWrite(7)
+	m.SessionSpawned()
+	m.SessionExited("exited")
+	m.SessionExited("failed")
+	m.SessionExited("exited")
+
+	rec := httptest.NewRecorder()
+	m.Registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected content type %q, got %q", ContentType, ct)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		`remote_agent_terminal_messages_broadcast_total{type="status"} 1`,
+		`remote_agent_terminal_messages_broadcast_total{type="stdout"} 2`,
+		`remote_agent_terminal_pty_bytes_written_total 12`,
+		`remote_agent_terminal_sessions_spawned_total 1`,
+		`remote_agent_terminal_sessions_exited_total{status="exited"} 2`,
+		`remote_agent_terminal_sessions_exited_total{status="failed"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %q in:\n%s", line, body)
+		}
+	}
+}
@@ -17,4 +17,22 @@ var (
 
 	// ErrConcurrencyLimit is returned when the maximum number of concurrent sessions is reached.
 	ErrConcurrencyLimit = errors.New("concurrent session limit exceeded")
+
+	// ErrInvalidStatus is returned when a session filter has an unknown status.
+	ErrInvalidStatus = errors.New("invalid session status")
+
+	// ErrInvalidMaxDuration is returned when a session's maximum duration is negative.
+	ErrInvalidMaxDuration = errors.New("max duration must not be negative")
+
+	// ErrNameRequired is returned when a session update sets an empty name.
+	ErrNameRequired = errors.New("name must not be empty")
+
+	// ErrInvalidTag is returned when a session update has an empty, too long or too many tags.
+	ErrInvalidTag = errors.New("invalid tag")
+
+	// ErrInvalidTimeRange is returned when a session filter's time range is empty.
+	ErrInvalidTimeRange = errors.New("created-after must not be later than created-before")
+
+	// ErrInvalidCursor is returned when a session list cursor cannot be decoded.
+	ErrInvalidCursor = errors.New("invalid cursor")
 )
@@ -1,7 +1,10 @@
 package model
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -12,6 +15,7 @@ const (
 	SessionStatusRunning SessionStatus = "running"
 	SessionStatusExited  SessionStatus = "exited"
 	SessionStatusFailed  SessionStatus = "failed"
+	SessionStatusExpired SessionStatus = "expired" // Terminated after MaxDuration
 )
 
 // Session represents a terminal session in the system.
@@ -27,6 +31,8 @@ type Session struct {
 	PID         *int              `json:"pid,omitempty"`
 	LogFilePath string            `json:"logFilePath"`
 	PreviewLine string            `json:"previewLine,omitempty"`
+	MaxDuration time.Duration     `json:"maxDuration,omitempty"` // Lifetime before termination; zero is unlimited
+	Tags        []string          `json:"tags,omitempty"`
 	CreatedAt   time.Time         `json:"createdAt"`
 	UpdatedAt   time.Time         `json:"updatedAt"`
 }
@@ -52,6 +58,26 @@ func (s *Session) EnvFromJSON(data string) error {
 	return json.Unmarshal([]byte(data), &s.Env)
 }
 
+// TagsToJSON converts the Tags slice to a JSON string for storage.
+func (s *Session) TagsToJSON() (string, error) {
+	if len(s.Tags) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(s.Tags)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// TagsFromJSON parses a JSON string into the Tags slice.
+func (s *Session) TagsFromJSON(data string) error {
+	if data == "" {
+		s.Tags = nil
+		return nil
+	}
+	return json.Unmarshal([]byte(data), &s.Tags)
+}
 
 // Duration returns the running duration of the session.
 func (s *Session) Duration() time.Duration {
@@ -60,11 +86,12 @@ func (s *Session) Duration() time.Duration {
 
 // CreateSessionRequest represents a request to create a new session.
 type CreateSessionRequest struct {
-	Command string            `json:"command" binding:"required"`
-	Name    string            `json:"name"`
-	Workdir string            `json:"workdir"`
-	Env     map[string]string `json:"env"`
-	UserID  string            `json:"-"`
+	Command     string            `json:"command" binding:"required"`
+	Name        string            `json:"name"`
+	Workdir     string            `json:"workdir"`
+	Env         map[string]string `json:"env"`
+	MaxDuration time.Duration     `json:"maxDuration,omitempty"`
+	UserID      string            `json:"-"`
 }
 
 // Validate validates the create session request.
@@ -72,5 +99,139 @@ func (r *CreateSessionRequest) Validate() error {
 	if r.Command == "" {
 		return ErrCommandRequired
 	}
+	if r.MaxDuration < 0 {
+		return ErrInvalidMaxDuration
+	}
+	return nil
+}
+
+const (
+	// MaxTags is the largest number of tags a session may have.
+	MaxTags = 20
+
+	// MaxTagLength is the longest accepted tag, in bytes.
+	MaxTagLength = 64
+)
+
+// UpdateSessionRequest represents a request to change a session's metadata.
+// Nil fields are left unchanged; an empty Tags slice removes all tags.
+type UpdateSessionRequest struct {
+	Name *string   `json:"name"`
+	Tags *[]string `json:"tags"`
+}
+
+// Validate validates the update session request, trimming the name and
+// tags and removing duplicate tags.
+func (r *UpdateSessionRequest) Validate() error {
+	if r.Name != nil {
+		name := strings.TrimSpace(*r.Name)
+		if name == "" {
+			return ErrNameRequired
+		}
+		r.Name = &name
+	}
+	if r.Tags != nil {
+		tags := make([]string, 0, len(*r.Tags))
+		seen := make(map[string]bool)
+		for _, tag := range *r.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || len(tag) > MaxTagLength {
+				return fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > MaxTags {
+			return fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTag, MaxTags)
+		}
+		r.Tags = &tags
+	}
+	return nil
+}
+
+// SessionFilter narrows a session listing. Zero fields do not filter.
+type SessionFilter struct {
+	// Status matches sessions in this status.
+	Status SessionStatus
+
+	// Command matches sessions whose command contains this substring.
+	Command string
+
+	// Query matches sessions whose name or command contains this substring.
+	Query string
+
+	// Tag matches sessions that have this tag.
+	Tag string
+
+	// CreatedAfter and CreatedBefore bound the creation time (inclusive).
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// IsEmpty returns true if the filter matches every session.
+func (f SessionFilter) IsEmpty() bool {
+	return f == SessionFilter{}
+}
+
+// Validate validates the session filter.
+func (f SessionFilter) Validate() error {
+	switch f.Status {
+	case "", SessionStatusRunning, SessionStatusExited, SessionStatusFailed, SessionStatusExpired:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, f.Status)
+	}
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && f.CreatedAfter.After(f.CreatedBefore) {
+		return ErrInvalidTimeRange
+	}
 	return nil
 }
+
+// ListOptions selects a page of a user's sessions, newest first.
+type ListOptions struct {
+	// UserID is the owner of the sessions.
+	UserID string
+
+	// Limit is the largest number of sessions returned. Zero or less
+	// returns all remaining sessions.
+	Limit int
+
+	// Cursor is the NextCursor of the previous page, or empty for the
+	// first page.
+	Cursor string
+
+	// Filter narrows the sessions listed.
+	Filter SessionFilter
+}
+
+// SessionCursor is the position after a session in a listing ordered by
+// creation time and ID, both descending.
+type SessionCursor struct {
+	CreatedAt time.Time `json:"createdAt"`
+	ID        string    `json:"id"`
+}
+
+// CursorAfter returns the cursor of the page following session.
+func CursorAfter(session *Session) SessionCursor {
+	return SessionCursor{CreatedAt: session.CreatedAt, ID: session.ID}
+}
+
+// Encode returns the cursor as an opaque token for use in a URL.
+func (c SessionCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token returned by SessionCursor.Encode.
+func DecodeCursor(token string) (SessionCursor, error) {
+	var c SessionCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" || c.CreatedAt.IsZero() {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -2,14 +2,19 @@ package pty
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/remote-agent-terminal/backend/internal/buffer"
 	"github.com/remote-agent-terminal/backend/internal/logger"
+	"github.com/remote-agent-terminal/backend/internal/metrics"
 	"github.com/remote-agent-terminal/backend/internal/model"
 )
 
@@ -20,6 +25,14 @@ const (
 	// DefaultReadBufferSize is the buffer size for reading PTY output.
 	DefaultReadBufferSize = 4096
 
+	// DefaultShutdownGrace is how long Close waits after SIGTERM before
+	// killing the process.
+	DefaultShutdownGrace = 2 * time.Second
+
+	// outputDrainTimeout bounds how long the exit callback waits for the
+	// remaining PTY output to be read after the process exits.
+	outputDrainTimeout = time.Second
+
 	// Input handling constants for CLI applications like Claude
 	// These delays are necessary to prevent input buffer issues
 
@@ -45,9 +58,52 @@ const (
 	DismissDelay = 500
 )
 
-// sleepMs sleeps for the specified number of milliseconds
-func sleepMs(ms int) {
-	time.Sleep(time.Duration(ms) * time.Millisecond)
+// ErrIdleTimeout is passed to the exit callback when a process is closed
+// because it produced no output and received no input for its idle timeout.
+var ErrIdleTimeout = errors.New("process idle timeout")
+
+// ErrProcessClosed is returned when writing to, resizing or otherwise using
+// a process that has been closed.
+var ErrProcessClosed = errors.New("process is closed")
+
+// ErrNotRecorded is returned when adding a marker to a process without a
+// session log.
+var ErrNotRecorded = errors.New("process is not recorded")
+
+// InputDelays holds the pauses used when writing commands to a PTY.
+// A zero field uses the corresponding package default.
+type InputDelays struct {
+	// Clear is the delay after sending Ctrl+U to clear input.
+	Clear time.Duration
+
+	// Text is the delay after sending command text before Enter.
+	Text time.Duration
+
+	// Dismiss is the delay around the Enter that dismisses interactive output.
+	Dismiss time.Duration
+}
+
+// DefaultInputDelays returns the package default input delays.
+func DefaultInputDelays() InputDelays {
+	return InputDelays{
+		Clear:   time.Duration(InputClearDelay) * time.Millisecond,
+		Text:    time.Duration(InputTextDelay) * time.Millisecond,
+		Dismiss: time.Duration(DismissDelay) * time.Millisecond,
+	}
+}
+
+// withDefaults fills zero fields from fallback.
+func (d InputDelays) withDefaults(fallback InputDelays) InputDelays {
+	if d.Clear <= 0 {
+		d.Clear = fallback.Clear
+	}
+	if d.Text <= 0 {
+		d.Text = fallback.Text
+	}
+	if d.Dismiss <= 0 {
+		d.Dismiss = fallback.Dismiss
+	}
+	return d
 }
 
 // PTYProcess represents a running PTY process with associated resources.
@@ -58,16 +114,57 @@ type PTYProcess struct {
 	RingBuffer *buffer.RingBuffer
 	Logger     *logger.AsciinemaLogger
 
-	// OutputCallback is called when PTY produces output.
-	// This can be used to broadcast output to WebSocket clients.
-	OutputCallback func(data []byte)
-
 	// ExitCallback is called when the process exits.
 	ExitCallback func(exitCode int, err error)
 
+	// WatchdogCallback is called with the session ID when the process has
+	// produced no output for its watchdog timeout. It is called once per
+	// silent period and again only after output resumes and stops.
+	WatchdogCallback func(sessionID string)
+
+	// inputDelays are the pauses used by WriteCommand and DismissOutput.
+	inputDelays InputDelays
+
+	// metrics records PTY writes and the exit
+	metrics metrics.Recorder
+
+	// idleTimeout closes the process after this long without output or
+	// input. Zero disables it.
+	idleTimeout  time.Duration
+	lastActivity atomic.Int64 // UnixNano of the last output or input
+	idledOut     atomic.Bool  // Closed by the idle timer
+
+	// watchdogTimeout reports the process as stuck after this long without
+	// output, even if it receives input. Zero disables the watchdog.
+	watchdogTimeout time.Duration
+	lastOutput      atomic.Int64 // UnixNano of the last output
+
+	// shutdownGrace is the grace period used by Close.
+	shutdownGrace time.Duration
+
 	mu       sync.RWMutex
 	closed   bool
+	rows     uint16 // Current window size, guarded by mu
+	cols     uint16
 	closedCh chan struct{}
+	exitedCh chan struct{} // Closed when the process has exited
+	exitCode int           // Set before exitedCh is closed
+	exitErr  error
+	readDone chan struct{} // Closed when readLoop returns
+
+	// commandTail is closed when the latest WriteCommandAsync call finishes,
+	// guarded by mu. Each async command waits for the one before it.
+	commandTail chan struct{}
+
+	// listeners receive PTY output. The slice is replaced, never modified,
+	// so readLoop can call a snapshot without holding listenersMu.
+	listenersMu sync.RWMutex
+	listeners   []*outputListener
+}
+
+// outputListener is a function registered with AddOutputListener.
+type outputListener struct {
+	fn func(data []byte)
 }
 
 // Manager manages PTY processes for terminal sessions.
@@ -80,15 +177,159 @@ type Manager struct {
 
 	// LogDir is the directory where log files are stored.
 	LogDir string
+
+	// InputDelays are the default input delays for each process.
+	InputDelays InputDelays
+
+	// ANSISafeHistory makes ring buffers evict on line or escape sequence
+	// boundaries so hot restore history is always renderable.
+	ANSISafeHistory bool
+
+	// ShutdownGrace is how long closing a process waits after SIGTERM
+	// before sending SIGKILL.
+	ShutdownGrace time.Duration
+
+	// LogMaxBytes is the size at which a process's recording is rotated
+	// to a new part. Zero disables rotation.
+	LogMaxBytes int64
+
+	// metrics records spawns, exits and PTY writes; see SetMetrics.
+	metrics metrics.Recorder
 }
 
 // NewManager creates a new PTY manager.
 func NewManager(logDir string) *Manager {
 	return &Manager{
-		processes:      make(map[string]*PTYProcess),
-		RingBufferSize: DefaultRingBufferSize,
-		LogDir:         logDir,
+		processes:       make(map[string]*PTYProcess),
+		RingBufferSize:  DefaultRingBufferSize,
+		LogDir:          logDir,
+		InputDelays:     DefaultInputDelays(),
+		ANSISafeHistory: true,
+		ShutdownGrace:   DefaultShutdownGrace,
+		metrics:         metrics.Nop{},
+	}
+}
+
+// SetMetrics sets the recorder for processes spawned after the call.
+// A nil recorder disables instrumentation.
+func (m *Manager) SetMetrics(recorder metrics.Recorder) {
+	if recorder == nil {
+		recorder = metrics.Nop{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics = recorder
+}
+
+// recorder returns the metrics recorder for a newly spawned process.
+func (m *Manager) recorder() metrics.Recorder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.metrics == nil {
+		return metrics.Nop{}
+	}
+	return m.metrics
+}
+
+// SetShutdownGrace sets the SIGTERM grace period for newly spawned
+// processes. A negative value kills processes immediately on close.
+func (m *Manager) SetShutdownGrace(grace time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ShutdownGrace = grace
+}
+
+// shutdownGrace returns the grace period for a newly spawned process.
+func (m *Manager) shutdownGrace() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ShutdownGrace
+}
+
+// SetRingBufferSize sets the default ring buffer size for newly spawned processes.
+// A size <= 0 restores DefaultRingBufferSize. Running processes are not affected.
+func (m *Manager) SetRingBufferSize(size int) {
+	if size <= 0 {
+		size = DefaultRingBufferSize
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.RingBufferSize = size
+}
+
+// SetLogMaxBytes sets the size at which recordings of newly spawned processes
+// are rotated to a new part. A size <= 0 disables rotation.
+func (m *Manager) SetLogMaxBytes(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.LogMaxBytes = size
+}
+
+// logMaxBytes returns the recording rotation size for a newly spawned process.
+func (m *Manager) logMaxBytes() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.LogMaxBytes
+}
+
+// ringBufferSize returns the ring buffer size for a spawn request.
+func (m *Manager) ringBufferSize(requested int) int {
+	if requested > 0 {
+		return requested
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.RingBufferSize > 0 {
+		return m.RingBufferSize
+	}
+	return DefaultRingBufferSize
+}
+
+// SetANSISafeHistory enables or disables ANSI-safe ring buffer eviction for
+// newly spawned processes. It is enabled by default.
+func (m *Manager) SetANSISafeHistory(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ANSISafeHistory = enabled
+}
+
+// newRingBuffer creates the ring buffer for a spawn request, starting at
+// initialCursor.
+func (m *Manager) newRingBuffer(requestedSize, initialCursor int) *buffer.RingBuffer {
+	size := m.ringBufferSize(requestedSize)
+
+	m.mu.RLock()
+	ansiSafe := m.ANSISafeHistory
+	m.mu.RUnlock()
+
+	var rb *buffer.RingBuffer
+	if ansiSafe {
+		rb = buffer.NewANSISafeRingBuffer(size)
+	} else {
+		rb = buffer.NewRingBuffer(size)
+	}
+	if initialCursor > 0 {
+		rb.StartAt(initialCursor)
+	}
+	return rb
+}
+
+// SetInputDelays sets the default input delays for newly spawned processes.
+// Zero fields restore the package defaults. Running processes are not affected.
+func (m *Manager) SetInputDelays(delays InputDelays) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.InputDelays = delays.withDefaults(DefaultInputDelays())
+}
+
+// inputDelays returns the input delays for a spawn request.
+func (m *Manager) inputDelays(requested InputDelays) InputDelays {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return requested.withDefaults(m.InputDelays.withDefaults(DefaultInputDelays()))
 }
 
 // SpawnOptions contains options for spawning a PTY process.
@@ -102,11 +343,43 @@ type SpawnOptions struct {
 	// InitialCols is the initial number of columns.
 	InitialCols uint16
 
-	// OutputCallback is called when PTY produces output.
+	// RingBufferSize is the hot restore buffer size in bytes.
+	// If zero, the manager's RingBufferSize is used.
+	RingBufferSize int
+
+	// InitialCursor is the ring buffer cursor the process's output starts
+	// at, such as the cursor reached by the process it replaces on restart,
+	// so cursors issued for the earlier output are not mistaken for
+	// positions in the new one. See buffer.RingBuffer.StartAt.
+	InitialCursor int
+
+	// InputDelays overrides the manager's input delays for this process.
+	// Zero fields use the manager's values.
+	InputDelays InputDelays
+
+	// LogRedactor, if set, rewrites output and input before it is recorded
+	// to the session log, e.g. logger.NewRegexRedactor. The ring buffer and
+	// clients still receive the output unchanged.
+	LogRedactor func(data []byte) []byte
+
+	// IdleTimeout closes the process when it produces no output and
+	// receives no input for this long. The exit callback is then called
+	// with ErrIdleTimeout. Zero disables the timeout.
+	IdleTimeout time.Duration
+
+	// WatchdogTimeout calls WatchdogCallback when the process produces no
+	// output for this long, without closing it. Zero disables the watchdog.
+	WatchdogTimeout time.Duration
+
+	// OutputCallback, if set, is registered as the first output listener,
+	// so it sees all output from the start. See AddOutputListener.
 	OutputCallback func(data []byte)
 
 	// ExitCallback is called when the process exits.
 	ExitCallback func(exitCode int, err error)
+
+	// WatchdogCallback is called when the watchdog timeout expires.
+	WatchdogCallback func(sessionID string)
 }
 
 // Spawn creates and starts a new PTY process for the given session.
@@ -142,7 +415,11 @@ func (m *Manager) Spawn(ctx context.Context, opts SpawnOptions) (*PTYProcess, er
 	var asciinemaLogger *logger.AsciinemaLogger
 	if opts.Session.LogFilePath != "" {
 		var err error
-		asciinemaLogger, err = logger.NewAsciinemaLogger(opts.Session.LogFilePath)
+		asciinemaLogger, err = logger.NewAsciinemaLoggerWithOptions(opts.Session.LogFilePath, logger.AsciinemaLoggerOptions{
+			Compress: strings.HasSuffix(opts.Session.LogFilePath, ".gz"),
+			MaxBytes: m.logMaxBytes(),
+			Redactor: opts.LogRedactor,
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create logger: %w", err)
 		}
@@ -215,14 +492,28 @@ func (m *Manager) Spawn(ctx context.Context, opts SpawnOptions) (*PTYProcess, er
 
 	// Create the PTY process wrapper
 	ptyProcess := &PTYProcess{
-		ID:             opts.Session.ID,
-		Session:        opts.Session,
-		Process:        process,
-		RingBuffer:     buffer.NewRingBuffer(m.RingBufferSize),
-		Logger:         asciinemaLogger,
-		OutputCallback: opts.OutputCallback,
-		ExitCallback:   opts.ExitCallback,
-		closedCh:       make(chan struct{}),
+		ID:               opts.Session.ID,
+		Session:          opts.Session,
+		Process:          process,
+		RingBuffer:       m.newRingBuffer(opts.RingBufferSize, opts.InitialCursor),
+		Logger:           asciinemaLogger,
+		ExitCallback:     opts.ExitCallback,
+		WatchdogCallback: opts.WatchdogCallback,
+		inputDelays:      m.inputDelays(opts.InputDelays),
+		metrics:          m.recorder(),
+		idleTimeout:      opts.IdleTimeout,
+		watchdogTimeout:  opts.WatchdogTimeout,
+		shutdownGrace:    m.shutdownGrace(),
+		rows:             opts.InitialRows,
+		cols:             opts.InitialCols,
+		closedCh:         make(chan struct{}),
+		exitedCh:         make(chan struct{}),
+		readDone:         make(chan struct{}),
+	}
+	ptyProcess.touch()
+	ptyProcess.lastOutput.Store(time.Now().UnixNano())
+	if opts.OutputCallback != nil {
+		ptyProcess.AddOutputListener(opts.OutputCallback)
 	}
 
 	// Register the process
@@ -230,12 +521,24 @@ func (m *Manager) Spawn(ctx context.Context, opts SpawnOptions) (*PTYProcess, er
 	m.processes[opts.Session.ID] = ptyProcess
 	m.mu.Unlock()
 
+	ptyProcess.metrics.SessionSpawned()
+
 	// Start the output reader goroutine
 	go ptyProcess.readLoop()
 
 	// Start the wait goroutine
 	go ptyProcess.waitLoop(m)
 
+	// Start the idle timer
+	if ptyProcess.idleTimeout > 0 {
+		go ptyProcess.idleLoop()
+	}
+
+	// Start the watchdog
+	if ptyProcess.watchdogTimeout > 0 {
+		go ptyProcess.watchdogLoop()
+	}
+
 	return ptyProcess, nil
 }
 
@@ -301,6 +604,56 @@ func (m *Manager) WriteCommand(id string, command []byte) error {
 	return p.WriteCommand(command)
 }
 
+// WriteCommandContext is like WriteCommand but returns early if ctx is cancelled.
+func (m *Manager) WriteCommandContext(ctx context.Context, id string, command []byte) error {
+	m.mu.RLock()
+	p, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("process not found: %s", id)
+	}
+
+	return p.WriteCommandContext(ctx, command)
+}
+
+// WriteCommandAsync runs WriteCommandContext in a new goroutine and returns
+// immediately. The result is sent on the returned channel, which is then
+// closed; it is buffered, so callers that don't need the result may ignore it.
+//
+// Async commands are written in the order WriteCommandAsync was called, so
+// their clearing sequences never interleave. The cancel function aborts the
+// command between steps, or before it starts, and context.Canceled is sent.
+func (p *PTYProcess) WriteCommandAsync(command []byte) (<-chan error, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+
+	p.mu.Lock()
+	prev := p.commandTail
+	tail := make(chan struct{})
+	p.commandTail = tail
+	p.mu.Unlock()
+
+	go func() {
+		defer close(result)
+		defer close(tail)
+		defer cancel()
+
+		// Wait for the previous command to finish
+		if prev != nil {
+			select {
+			case <-prev:
+			case <-ctx.Done():
+				result <- ctx.Err()
+				return
+			}
+		}
+		result <- p.WriteCommandContext(ctx, command)
+	}()
+
+	return result, cancel
+}
+
 // DismissOutput sends Enter to dismiss interactive command output.
 // Use this after commands like /doctor or /cost that wait for user input.
 func (m *Manager) DismissOutput(id string) error {
@@ -336,6 +689,7 @@ func (m *Manager) List() []*PTYProcess {
 }
 
 // Close closes all PTY processes and releases resources.
+// Processes are closed concurrently so their grace periods overlap.
 func (m *Manager) Close() error {
 	m.mu.Lock()
 	processes := make([]*PTYProcess, 0, len(m.processes))
@@ -344,18 +698,29 @@ func (m *Manager) Close() error {
 	}
 	m.mu.Unlock()
 
-	var firstErr error
-	for _, p := range processes {
-		if err := p.Close(); err != nil && firstErr == nil {
-			firstErr = err
-		}
+	errs := make([]error, len(processes))
+	var wg sync.WaitGroup
+	for i, p := range processes {
+		wg.Add(1)
+		go func(i int, p *PTYProcess) {
+			defer wg.Done()
+			errs[i] = p.Close()
+		}(i, p)
 	}
+	wg.Wait()
 
-	return firstErr
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // readLoop reads output from the PTY and distributes it.
 func (p *PTYProcess) readLoop() {
+	defer close(p.readDone)
+
 	buf := make([]byte, DefaultReadBufferSize)
 
 	for {
@@ -369,6 +734,8 @@ func (p *PTYProcess) readLoop() {
 
 		if n > 0 {
 			data := buf[:n]
+			p.touch()
+			p.lastOutput.Store(time.Now().UnixNano())
 
 			// Write to ring buffer for hot restore
 			p.RingBuffer.Write(data)
@@ -378,17 +745,60 @@ func (p *PTYProcess) readLoop() {
 				p.Logger.WriteOutput(data)
 			}
 
-			// Call output callback (for WebSocket broadcast)
-			if p.OutputCallback != nil {
-				p.OutputCallback(data)
+			// Call output listeners (for WebSocket broadcast)
+			p.listenersMu.RLock()
+			listeners := p.listeners
+			p.listenersMu.RUnlock()
+			for _, l := range listeners {
+				l.fn(data)
 			}
 		}
 	}
 }
 
+// AddOutputListener registers fn to be called with each chunk of PTY output,
+// in registration order, from the goroutine reading the PTY. The chunk is
+// only valid during the call. It is safe to call while the process runs.
+// The returned function removes the listener; calling it again does nothing.
+func (p *PTYProcess) AddOutputListener(fn func(data []byte)) (remove func()) {
+	l := &outputListener{fn: fn}
+
+	p.listenersMu.Lock()
+	p.listeners = append(p.listeners[:len(p.listeners):len(p.listeners)], l)
+	p.listenersMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.listenersMu.Lock()
+			defer p.listenersMu.Unlock()
+			for i, other := range p.listeners {
+				if other == l {
+					p.listeners = append(p.listeners[:i:i], p.listeners[i+1:]...)
+					return
+				}
+			}
+		})
+	}
+}
+
 // waitLoop waits for the process to exit and handles cleanup.
 func (p *PTYProcess) waitLoop(m *Manager) {
 	exitCode, err := p.Process.Wait()
+	if p.idledOut.Load() {
+		err = ErrIdleTimeout
+	}
+	p.exitCode, p.exitErr = exitCode, err
+	close(p.exitedCh)
+
+	status := model.SessionStatusExited
+	if err != nil {
+		status = model.SessionStatusFailed
+	}
+	p.metrics.SessionExited(string(status))
+
+	// Deliver the last output before reporting the exit
+	p.drainOutput()
 
 	// Call exit callback
 	if p.ExitCallback != nil {
@@ -402,19 +812,78 @@ func (p *PTYProcess) waitLoop(m *Manager) {
 	m.Remove(p.ID)
 }
 
+// idleLoop closes the process once it has been idle for idleTimeout.
+// It returns when the process closes.
+func (p *PTYProcess) idleLoop() {
+	timer := time.NewTimer(p.idleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, p.lastActivity.Load()))
+			if idle < p.idleTimeout {
+				timer.Reset(p.idleTimeout - idle)
+				continue
+			}
+			// Killing the process makes waitLoop call the exit callback
+			p.idledOut.Store(true)
+			p.Close()
+			return
+		case <-p.closedCh:
+			return
+		}
+	}
+}
+
+// watchdogLoop calls WatchdogCallback when the process has produced no
+// output for watchdogTimeout. Output resets the watchdog, so each silent
+// period is reported once. It returns when the process closes.
+func (p *PTYProcess) watchdogLoop() {
+	timer := time.NewTimer(p.watchdogTimeout)
+	defer timer.Stop()
+
+	var reported int64 // lastOutput of the silent period already reported
+	for {
+		select {
+		case <-timer.C:
+			last := p.lastOutput.Load()
+			silent := time.Since(time.Unix(0, last))
+			if silent < p.watchdogTimeout {
+				timer.Reset(p.watchdogTimeout - silent)
+				continue
+			}
+			if last != reported {
+				reported = last
+				if p.WatchdogCallback != nil {
+					p.WatchdogCallback(p.ID)
+				}
+			}
+			timer.Reset(p.watchdogTimeout)
+		case <-p.closedCh:
+			return
+		}
+	}
+}
+
+// touch records output or input activity for the idle timer.
+func (p *PTYProcess) touch() {
+	p.lastActivity.Store(time.Now().UnixNano())
+}
+
 // Write writes data to the PTY input.
 func (p *PTYProcess) Write(data []byte) error {
 	p.mu.RLock()
 	if p.closed {
 		p.mu.RUnlock()
-		return fmt.Errorf("process is closed")
+		return ErrProcessClosed
 	}
 	p.mu.RUnlock()
 
-	_, err := p.Process.PTY.Write(data)
-	if err != nil {
+	if err := p.writePTY(data); err != nil {
 		return fmt.Errorf("failed to write to PTY: %w", err)
 	}
+	p.touch()
 
 	// Log input
 	if p.Logger != nil {
@@ -424,25 +893,42 @@ func (p *PTYProcess) Write(data []byte) error {
 	return nil
 }
 
+// writePTY writes data to the PTY and records the bytes written.
+func (p *PTYProcess) writePTY(data []byte) error {
+	n, err := p.Process.PTY.Write(data)
+	p.metrics.PTYWrite(n)
+	return err
+}
+
 // WriteCommand writes a command to the PTY with proper input clearing.
+// It is equivalent to WriteCommandContext with context.Background().
+func (p *PTYProcess) WriteCommand(command []byte) error {
+	return p.WriteCommandContext(context.Background(), command)
+}
+
+// WriteCommandContext writes a command to the PTY with proper input clearing.
 // This is designed for CLI applications like Claude that need input buffer management.
 //
 // The method follows this pattern:
-// 1. Clear input buffer with Ctrl+U (wait 500ms)
-// 2. Send command text without Enter (wait 500ms)
+// 1. Clear input buffer with Ctrl+U (wait InputDelays.Clear)
+// 2. Send command text without Enter (wait InputDelays.Text)
 // 3. Send Enter to execute
 //
 // This prevents commands from being appended to existing input.
-func (p *PTYProcess) WriteCommand(command []byte) error {
+// If ctx is cancelled during a wait, the remaining steps are skipped and
+// ctx.Err() is returned. If the process closes during a wait, an error is
+// returned instead of writing to the dead PTY.
+func (p *PTYProcess) WriteCommandContext(ctx context.Context, command []byte) error {
 	p.mu.RLock()
 	if p.closed {
 		p.mu.RUnlock()
-		return fmt.Errorf("process is closed")
+		return ErrProcessClosed
 	}
 	p.mu.RUnlock()
+	p.touch()
 
 	// Step 1: Clear current input with Ctrl+U
-	if _, err := p.Process.PTY.Write([]byte(KeyCtrlU)); err != nil {
+	if err := p.writePTY([]byte(KeyCtrlU)); err != nil {
 		return fmt.Errorf("failed to clear input: %w", err)
 	}
 
@@ -452,7 +938,9 @@ func (p *PTYProcess) WriteCommand(command []byte) error {
 	}
 
 	// Wait for clear to take effect
-	sleepMs(InputClearDelay)
+	if err := p.wait(ctx, p.inputDelays.Clear); err != nil {
+		return err
+	}
 
 	// Step 2: Determine if command has Enter at the end
 	hasEnter := len(command) > 0 && (command[len(command)-1] == '\r' || command[len(command)-1] == '\n')
@@ -466,7 +954,7 @@ func (p *PTYProcess) WriteCommand(command []byte) error {
 
 	// Send command text
 	if len(cmdText) > 0 {
-		if _, err := p.Process.PTY.Write(cmdText); err != nil {
+		if err := p.writePTY(cmdText); err != nil {
 			return fmt.Errorf("failed to write command: %w", err)
 		}
 
@@ -477,13 +965,16 @@ func (p *PTYProcess) WriteCommand(command []byte) error {
 	}
 
 	// Wait before sending Enter
-	sleepMs(InputTextDelay)
+	if err := p.wait(ctx, p.inputDelays.Text); err != nil {
+		return err
+	}
 
 	// Step 3: Send Enter if the original command had it
 	if hasEnter {
-		if _, err := p.Process.PTY.Write([]byte(KeyEnter)); err != nil {
+		if err := p.writePTY([]byte(KeyEnter)); err != nil {
 			return fmt.Errorf("failed to send enter: %w", err)
 		}
+		p.touch()
 
 		// Log the Enter
 		if p.Logger != nil {
@@ -500,43 +991,103 @@ func (p *PTYProcess) DismissOutput() error {
 	p.mu.RLock()
 	if p.closed {
 		p.mu.RUnlock()
-		return fmt.Errorf("process is closed")
+		return ErrProcessClosed
 	}
 	p.mu.RUnlock()
 
 	// Wait a bit before dismissing
-	sleepMs(DismissDelay)
+	if err := p.wait(context.Background(), p.inputDelays.Dismiss); err != nil {
+		return err
+	}
 
 	// Send Enter to dismiss
-	if _, err := p.Process.PTY.Write([]byte(KeyEnter)); err != nil {
+	if err := p.writePTY([]byte(KeyEnter)); err != nil {
 		return fmt.Errorf("failed to dismiss output: %w", err)
 	}
+	p.touch()
 
 	// Log the Enter
 	if p.Logger != nil {
 		p.Logger.WriteInput([]byte(KeyEnter))
 	}
 
-	// Wait for dismiss to take effect
-	sleepMs(DismissDelay)
+	// Wait for dismiss to take effect; the Enter has already been sent,
+	// so the process exiting here is not an error
+	p.wait(context.Background(), p.inputDelays.Dismiss)
 
 	return nil
 }
 
+// wait pauses for d, returning early if ctx is cancelled or the process closes.
+func (p *PTYProcess) wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.closedCh:
+		return ErrProcessClosed
+	}
+}
+
 // Resize changes the PTY window size.
 func (p *PTYProcess) Resize(rows, cols uint16) error {
 	p.mu.RLock()
 	if p.closed {
 		p.mu.RUnlock()
-		return fmt.Errorf("process is closed")
+		return ErrProcessClosed
 	}
 	p.mu.RUnlock()
 
-	return p.Process.PTY.Resize(rows, cols)
+	if err := p.Process.PTY.Resize(rows, cols); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.rows, p.cols = rows, cols
+	p.mu.Unlock()
+
+	// Record the new size so replays can follow it
+	if p.Logger != nil {
+		p.Logger.WriteResize(int(cols), int(rows))
+	}
+	return nil
+}
+
+// AddMarker adds a marker with the given label to the session's recording
+// at the current time.
+func (p *PTYProcess) AddMarker(label string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProcessClosed
+	}
+	if p.Logger == nil {
+		return ErrNotRecorded
+	}
+	return p.Logger.WriteMarker(label)
+}
+
+// Size returns the current PTY window size.
+func (p *PTYProcess) Size() (rows, cols uint16) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.rows, p.cols
 }
 
 // Close closes the PTY process and releases resources.
+// It is equivalent to CloseGraceful with the manager's ShutdownGrace.
 func (p *PTYProcess) Close() error {
+	return p.CloseGraceful(p.shutdownGrace)
+}
+
+// CloseGraceful sends SIGTERM to the process group and waits up to grace
+// for the process to exit before killing it, then releases resources.
+// A grace <= 0 kills the process immediately.
+func (p *PTYProcess) CloseGraceful(grace time.Duration) error {
 	p.mu.Lock()
 	if p.closed {
 		p.mu.Unlock()
@@ -548,8 +1099,11 @@ func (p *PTYProcess) Close() error {
 
 	var firstErr error
 
-	// Kill the process
-	if err := p.Process.Kill(); err != nil && firstErr == nil {
+	// Ask the process to exit, then kill it if it has not. Output written
+	// while shutting down is read before the PTY is closed.
+	if p.terminate(grace) {
+		p.drainOutput()
+	} else if err := p.Process.Kill(); err != nil && firstErr == nil {
 		firstErr = err
 	}
 
@@ -568,6 +1122,64 @@ func (p *PTYProcess) Close() error {
 	return firstErr
 }
 
+// terminate sends SIGTERM and reports whether the process exited within grace.
+func (p *PTYProcess) terminate(grace time.Duration) bool {
+	if p.hasExited() {
+		return true
+	}
+	if grace <= 0 {
+		return false
+	}
+	if err := p.Process.Signal(syscall.SIGTERM); err != nil {
+		return false
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-p.exitedCh:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// drainOutput waits for readLoop to read the remaining PTY output. The wait
+// is bounded because a background child can keep the PTY open.
+func (p *PTYProcess) drainOutput() {
+	timer := time.NewTimer(outputDrainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-p.readDone:
+	case <-timer.C:
+	}
+}
+
+// hasExited returns true if waitLoop has seen the process exit.
+func (p *PTYProcess) hasExited() bool {
+	if p.exitedCh == nil {
+		return false
+	}
+	select {
+	case <-p.exitedCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExitStatus returns the exit code of the process and the error it failed
+// with, as passed to the exit callback. exited is false while the process
+// is running.
+func (p *PTYProcess) ExitStatus() (exitCode int, exited bool, err error) {
+	if !p.hasExited() {
+		return 0, false, nil
+	}
+	return p.exitCode, true, p.exitErr
+}
+
 // IsClosed returns true if the process has been closed.
 func (p *PTYProcess) IsClosed() bool {
 	p.mu.RLock()
@@ -585,6 +1197,18 @@ func (p *PTYProcess) GetHistory() []byte {
 	return p.RingBuffer.ReadAll()
 }
 
+// GetHistoryFrom returns the output written after cursor and the cursor for
+// the end of the buffer. See buffer.RingBuffer.ReadFrom.
+func (p *PTYProcess) GetHistoryFrom(cursor int) ([]byte, int) {
+	return p.RingBuffer.ReadFrom(cursor)
+}
+
+// RingBufferSize returns the capacity of the process's hot restore buffer,
+// after falling back to the manager's default.
+func (p *PTYProcess) RingBufferSize() int {
+	return p.RingBuffer.Cap()
+}
+
 // PID returns the process ID.
 func (p *PTYProcess) PID() int {
 	return p.Process.PID()
@@ -1,7 +1,16 @@
 package pty
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
 )
 
 // TestKeyConstants tests that key constants are correct
@@ -158,3 +167,647 @@ func TestDefaultConstants(t *testing.T) {
 		t.Errorf("Expected DefaultReadBufferSize 4096, got %d", DefaultReadBufferSize)
 	}
 }
+
+// TestManagerSetRingBufferSize tests overriding the default ring buffer size
+func TestManagerSetRingBufferSize(t *testing.T) {
+	manager := NewManager("/tmp/logs")
+
+	manager.SetRingBufferSize(1024 * 1024)
+	if manager.RingBufferSize != 1024*1024 {
+		t.Errorf("Expected RingBufferSize 1MB, got %d", manager.RingBufferSize)
+	}
+
+	manager.SetRingBufferSize(0)
+	if manager.RingBufferSize != DefaultRingBufferSize {
+		t.Errorf("Expected RingBufferSize reset to default, got %d", manager.RingBufferSize)
+	}
+}
+
+// TestSpawnRingBufferSize tests that per-session ring buffer size overrides the manager default
+func TestSpawnRingBufferSize(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+	manager.SetRingBufferSize(8 * 1024)
+
+	tests := []struct {
+		name     string
+		id       string
+		size     int
+		expected int
+	}{
+		{"manager default", "rb-default", 0, 8 * 1024},
+		{"per-session override", "rb-override", 256 * 1024, 256 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := manager.Spawn(context.Background(), SpawnOptions{
+				Session:        &model.Session{ID: tt.id, Command: "/bin/cat"},
+				RingBufferSize: tt.size,
+			})
+			if err != nil {
+				t.Fatalf("Failed to spawn: %v", err)
+			}
+			defer p.Close()
+
+			if p.RingBufferSize() != tt.expected {
+				t.Errorf("Expected ring buffer size %d, got %d", tt.expected, p.RingBufferSize())
+			}
+		})
+	}
+}
+
+// TestPTYProcessSize tests that Size reports the initial and resized window size
+func TestPTYProcessSize(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session: &model.Session{ID: "size-session", Command: "/bin/cat"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+	defer p.Close()
+
+	if rows, cols := p.Size(); rows != 24 || cols != 80 {
+		t.Errorf("Expected default size 24x80, got %dx%d", rows, cols)
+	}
+
+	if err := p.Resize(40, 120); err != nil {
+		t.Fatalf("Failed to resize: %v", err)
+	}
+	if rows, cols := p.Size(); rows != 40 || cols != 120 {
+		t.Errorf("Expected size 40x120 after resize, got %dx%d", rows, cols)
+	}
+}
+
+// TestSpawnInputDelays tests that per-process input delays override the manager defaults
+func TestSpawnInputDelays(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+	manager.SetInputDelays(InputDelays{Clear: 10 * time.Millisecond})
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:     &model.Session{ID: "delays", Command: "/bin/cat"},
+		InputDelays: InputDelays{Text: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+	defer p.Close()
+
+	expected := InputDelays{
+		Clear:   10 * time.Millisecond,
+		Text:    20 * time.Millisecond,
+		Dismiss: time.Duration(DismissDelay) * time.Millisecond,
+	}
+	if p.inputDelays != expected {
+		t.Errorf("Expected delays %+v, got %+v", expected, p.inputDelays)
+	}
+}
+
+// TestWriteCommandContextCancel tests that WriteCommandContext returns early when cancelled
+func TestWriteCommandContextCancel(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:     &model.Session{ID: "cancel", Command: "/bin/cat"},
+		InputDelays: InputDelays{Clear: 10 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = manager.WriteCommandContext(ctx, "cancel", []byte("hello\r"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected early return, took %v", elapsed)
+	}
+}
+
+// TestWriteCommandAsync tests that async commands return immediately and are written in order
+func TestWriteCommandAsync(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:     &model.Session{ID: "async", Command: "/bin/cat"},
+		InputDelays: InputDelays{Clear: 20 * time.Millisecond, Text: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+	defer p.Close()
+
+	start := time.Now()
+	first, _ := p.WriteCommandAsync([]byte("first\r"))
+	second, _ := p.WriteCommandAsync([]byte("second\r"))
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("Expected WriteCommandAsync to return immediately, took %v", elapsed)
+	}
+
+	for i, result := range []<-chan error{first, second} {
+		select {
+		case err := <-result:
+			if err != nil {
+				t.Errorf("command %d: expected no error, got %v", i, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("command %d: timed out waiting for result", i)
+		}
+	}
+
+	// cat echoes each line as typed and again once Enter is received
+	deadline := time.Now().Add(2 * time.Second)
+	for strings.Count(string(p.GetHistory()), "second") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	history := string(p.GetHistory())
+	if i, j := strings.Index(history, "first"), strings.Index(history, "second"); i < 0 || j < i {
+		t.Errorf("Expected first before second, got %q", history)
+	}
+}
+
+// TestWriteCommandAsyncCancel tests that cancelling an async command skips its remaining steps
+func TestWriteCommandAsyncCancel(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:     &model.Session{ID: "async-cancel", Command: "/bin/cat"},
+		InputDelays: InputDelays{Clear: 10 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+	defer p.Close()
+
+	first, cancelFirst := p.WriteCommandAsync([]byte("first\r"))
+	second, cancelSecond := p.WriteCommandAsync([]byte("second\r"))
+
+	// The queued command is cancelled before it starts
+	cancelSecond()
+	select {
+	case err := <-second:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled for queued command, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for queued command")
+	}
+
+	// The running command is cancelled during its clear delay
+	cancelFirst()
+	select {
+	case err := <-first:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for cancelled command")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if history := string(p.GetHistory()); strings.Contains(history, "first") || strings.Contains(history, "second") {
+		t.Errorf("Expected no command text after cancel, got %q", history)
+	}
+}
+
+// TestWriteCommandContextProcessClosed tests that a pending write aborts when the process closes
+func TestWriteCommandContextProcessClosed(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:     &model.Session{ID: "closed", Command: "/bin/cat"},
+		InputDelays: InputDelays{Clear: 10 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.WriteCommandContext(context.Background(), []byte("hello\r"))
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	p.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("Expected error after process closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteCommandContext did not return after process closed")
+	}
+}
+
+// TestSpawnANSISafeHistory tests that the manager controls ANSI-safe eviction
+func TestSpawnANSISafeHistory(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	if !manager.ANSISafeHistory {
+		t.Error("Expected ANSI-safe history to be enabled by default")
+	}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		expected string
+	}{
+		{"enabled", true, "\x1b[0mend"},
+		{"disabled", false, "d\x1b[0mend"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager.SetANSISafeHistory(tt.enabled)
+			p, err := manager.Spawn(context.Background(), SpawnOptions{
+				Session:        &model.Session{ID: "ansi-" + tt.name, Command: "/bin/cat"},
+				RingBufferSize: 8,
+			})
+			if err != nil {
+				t.Fatalf("Failed to spawn: %v", err)
+			}
+			defer p.Close()
+
+			p.RingBuffer.Write([]byte("\x1b[31mred\x1b[0mend"))
+			if got := string(p.GetHistory()); got != tt.expected {
+				t.Errorf("Expected history %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestSpawnIdleTimeout tests that an idle process is closed and reported via the exit callback
+func TestSpawnIdleTimeout(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	exitCh := make(chan error, 1)
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:     &model.Session{ID: "idle", Command: "/bin/cat"},
+		IdleTimeout: 200 * time.Millisecond,
+		ExitCallback: func(exitCode int, err error) {
+			exitCh <- err
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+
+	// Input keeps the process alive past the timeout
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := p.Write([]byte("x")); err != nil {
+			t.Fatalf("Write failed while active: %v", err)
+		}
+	}
+	if p.IsClosed() {
+		t.Fatal("Expected active process to stay open")
+	}
+
+	select {
+	case err := <-exitCh:
+		if !errors.Is(err, ErrIdleTimeout) {
+			t.Errorf("Expected ErrIdleTimeout, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected idle process to exit")
+	}
+	if !p.IsClosed() {
+		t.Error("Expected idle process to be closed")
+	}
+}
+
+// TestAddOutputListener tests that every listener receives output until it is removed
+func TestAddOutputListener(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	var mu sync.Mutex
+	received := map[string]string{}
+	record := func(name string) func([]byte) {
+		return func(data []byte) {
+			mu.Lock()
+			received[name] += string(data)
+			mu.Unlock()
+		}
+	}
+	output := func(name string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		return received[name]
+	}
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:        &model.Session{ID: "listeners", Command: "/bin/cat"},
+		OutputCallback: record("spawn"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+	defer p.Close()
+
+	removeFirst := p.AddOutputListener(record("first"))
+	p.AddOutputListener(record("second"))
+
+	waitFor := func(name, text string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !strings.Contains(output(name), text) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected listener %s to receive %q, got %q", name, text, output(name))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	p.Write([]byte("one"))
+	for _, name := range []string{"spawn", "first", "second"} {
+		waitFor(name, "one")
+	}
+
+	removeFirst()
+	removeFirst() // removing twice is harmless
+
+	p.Write([]byte("two"))
+	waitFor("spawn", "two")
+	waitFor("second", "two")
+	if strings.Contains(output("first"), "two") {
+		t.Errorf("Expected removed listener to receive nothing, got %q", output("first"))
+	}
+}
+
+// TestSpawnWatchdog tests that a silent process is reported once per silent period
+func TestSpawnWatchdog(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	stuck := make(chan string, 10)
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:         &model.Session{ID: "watchdog", Command: "/bin/cat"},
+		WatchdogTimeout: 100 * time.Millisecond,
+		WatchdogCallback: func(sessionID string) {
+			stuck <- sessionID
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+	defer p.Close()
+
+	select {
+	case id := <-stuck:
+		if id != "watchdog" {
+			t.Errorf("Expected session ID 'watchdog', got '%s'", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected watchdog to report the silent process")
+	}
+
+	// The same silent period is not reported again
+	select {
+	case <-stuck:
+		t.Error("Expected a single report per silent period")
+	case <-time.After(300 * time.Millisecond):
+	}
+	if p.IsClosed() {
+		t.Error("Expected the watchdog to leave the process running")
+	}
+
+	// Output (cat's echo) resets the watchdog
+	if err := p.Write([]byte("x")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	select {
+	case <-stuck:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected watchdog to report again after output stopped")
+	}
+}
+
+// TestSpawnIdleTimeoutDisabled tests that a zero idle timeout keeps the process running
+func TestSpawnIdleTimeoutDisabled(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session: &model.Session{ID: "no-idle", Command: "/bin/cat"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if p.IsClosed() {
+		t.Error("Expected process without idle timeout to keep running")
+	}
+}
+
+// TestCloseGraceful tests that Close lets the process handle SIGTERM before killing it
+func TestCloseGraceful(t *testing.T) {
+	tests := []struct {
+		name         string
+		command      string
+		grace        time.Duration
+		expectedCode int
+		minDuration  time.Duration
+	}{
+		{"exits on SIGTERM", `/bin/sh -c "trap 'echo bye; exit 3' TERM; while :; do sleep 0.05; done"`, 2 * time.Second, 3, 0},
+		{"killed after grace", `/bin/sh -c "trap '' TERM; echo ready; while :; do sleep 0.05; done"`, 200 * time.Millisecond, -1, 200 * time.Millisecond},
+		{"killed without grace", "/bin/cat", -1, -1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(t.TempDir())
+			manager.SetShutdownGrace(tt.grace)
+			defer manager.Close()
+
+			var mu sync.Mutex
+			var output []byte
+			var calls int
+			exitCh := make(chan int, 2)
+			p, err := manager.Spawn(context.Background(), SpawnOptions{
+				Session: &model.Session{ID: "graceful", Command: tt.command},
+				OutputCallback: func(data []byte) {
+					mu.Lock()
+					output = append(output, data...)
+					mu.Unlock()
+				},
+				ExitCallback: func(exitCode int, err error) {
+					mu.Lock()
+					calls++
+					mu.Unlock()
+					exitCh <- exitCode
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to spawn: %v", err)
+			}
+
+			// Give the shell time to install its trap
+			time.Sleep(200 * time.Millisecond)
+
+			start := time.Now()
+			if err := p.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDuration {
+				t.Errorf("Expected Close to wait at least %v, took %v", tt.minDuration, elapsed)
+			}
+
+			select {
+			case code := <-exitCh:
+				if code != tt.expectedCode {
+					t.Errorf("Expected exit code %d, got %d", tt.expectedCode, code)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatal("Expected exit callback")
+			}
+
+			// The exit callback fires exactly once
+			time.Sleep(100 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if calls != 1 {
+				t.Errorf("Expected 1 exit callback, got %d", calls)
+			}
+			if tt.expectedCode == 3 && !strings.Contains(string(output), "bye") {
+				t.Errorf("Expected output written during shutdown, got %q", output)
+			}
+		})
+	}
+}
+
+// TestAddMarker tests adding markers to a session's recording
+func TestAddMarker(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	logPath := filepath.Join(t.TempDir(), "marker.cast")
+	recorded, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session: &model.Session{ID: "marker-recorded", Command: "cat", LogFilePath: logPath},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn: %v", err)
+	}
+	unrecorded, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session: &model.Session{ID: "marker-unrecorded", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn: %v", err)
+	}
+
+	if err := recorded.AddMarker("build started"); err != nil {
+		t.Errorf("Expected marker to be added, got %v", err)
+	}
+	if err := unrecorded.AddMarker("build started"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("Expected ErrNotRecorded, got %v", err)
+	}
+
+	recorded.Close()
+	if err := recorded.AddMarker("too late"); !errors.Is(err, ErrProcessClosed) {
+		t.Errorf("Expected ErrProcessClosed after close, got %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	if !strings.Contains(string(data), `,"m","build started"]`) {
+		t.Errorf("Expected a marker event in the recording, got %s", data)
+	}
+	if strings.Contains(string(data), "too late") {
+		t.Errorf("Expected no marker after close, got %s", data)
+	}
+}
+
+// fakeRecorder counts the measurements it receives.
+type fakeRecorder struct {
+	mu      sync.Mutex
+	spawned int
+	exited  map[string]int
+	written int
+}
+
+func (r *fakeRecorder) MessageBroadcast(string) {}
+
+func (r *fakeRecorder) PTYWrite(bytes int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written += bytes
+}
+
+func (r *fakeRecorder) SessionSpawned() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spawned++
+}
+
+func (r *fakeRecorder) SessionExited(status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exited[status]++
+}
+
+// TestManagerMetrics tests that spawns, exits and PTY writes are recorded
+func TestManagerMetrics(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+	recorder := &fakeRecorder{exited: make(map[string]int)}
+	manager.SetMetrics(recorder)
+
+	p, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:     &model.Session{ID: "metrics-cat", Command: "cat"},
+		InputDelays: InputDelays{Clear: time.Millisecond, Text: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn: %v", err)
+	}
+	if err := p.Write([]byte("abc")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	// Ctrl+U, the text and Enter
+	if err := p.WriteCommand([]byte("ls\n")); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+
+	exited := make(chan struct{})
+	if _, err := manager.Spawn(context.Background(), SpawnOptions{
+		Session:      &model.Session{ID: "metrics-true", Command: "true"},
+		ExitCallback: func(int, error) { close(exited) },
+	}); err != nil {
+		t.Fatalf("failed to spawn: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(2 * time.Second):
+		t.Fatal("process did not exit")
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.spawned != 2 {
+		t.Errorf("Expected 2 spawns, got %d", recorder.spawned)
+	}
+	if recorder.written != 7 {
+		t.Errorf("Expected 7 bytes written, got %d", recorder.written)
+	}
+	if recorder.exited[string(model.SessionStatusExited)] != 1 {
+		t.Errorf("Expected 1 exited process, got %v", recorder.exited)
+	}
+}
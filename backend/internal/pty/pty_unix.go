@@ -114,6 +114,23 @@ func Start(opts StartOptions) (*Process, error) {
 	}, nil
 }
 
+// Signal sends sig to the process group, so that children of the command
+// are signalled too. The process is a session leader, so its group ID is
+// its PID.
+func (p *Process) Signal(sig os.Signal) error {
+	if p.Cmd.Process == nil {
+		return nil
+	}
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Cmd.Process.Signal(sig)
+	}
+	if err := syscall.Kill(-p.pid, s); err != nil {
+		return fmt.Errorf("failed to signal process group: %w", err)
+	}
+	return nil
+}
+
 // openPTY opens a new PTY master/slave pair.
 func openPTY() (master, slave *os.File, err error) {
 	// Open the PTY master
@@ -82,6 +82,12 @@ func (p *windowsPTY) Resize(rows, cols uint16) error {
 	return nil
 }
 
+// Signal terminates the process. Windows has no SIGTERM equivalent for
+// console processes, so every signal falls back to Kill.
+func (p *Process) Signal(sig os.Signal) error {
+	return p.Kill()
+}
+
 // Start starts a new PTY process with the given options.
 // This is the Windows implementation using ConPTY.
 func Start(opts StartOptions) (*Process, error) {
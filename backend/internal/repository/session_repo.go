@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/remote-agent-terminal/backend/internal/model"
@@ -25,13 +26,23 @@ func (r *SessionRepository) Create(ctx context.Context, session *model.Session)
 	if err != nil {
 		return fmt.Errorf("failed to serialize env: %w", err)
 	}
+	tagsJSON, err := session.TagsToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize tags: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
 	query := `
-		INSERT INTO sessions (id, user_id, name, command, env, status, pid, log_file_path, preview_line, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO sessions (id, user_id, name, command, env, status, pid, log_file_path, preview_line, tags, max_duration, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err = r.db.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		session.ID,
 		session.UserID,
 		session.Name,
@@ -41,6 +52,8 @@ func (r *SessionRepository) Create(ctx context.Context, session *model.Session)
 		session.PID,
 		session.LogFilePath,
 		session.PreviewLine,
+		nullString(tagsJSON),
+		int64(session.MaxDuration),
 		session.CreatedAt,
 		session.UpdatedAt,
 	)
@@ -48,14 +61,84 @@ func (r *SessionRepository) Create(ctx context.Context, session *model.Session)
 		return fmt.Errorf("failed to create session: %w", err)
 	}
 
+	if err := insertTags(ctx, tx, session.ID, session.Tags); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
 	return nil
 }
 
+// UpdateMetadata sets the name and tags of a session.
+func (r *SessionRepository) UpdateMetadata(ctx context.Context, id string, name string, tags []string) error {
+	tagsJSON, err := (&model.Session{Tags: tags}).TagsToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize tags: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE sessions
+		SET name = ?, tags = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := tx.ExecContext(ctx, query, name, nullString(tagsJSON), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update session metadata: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return model.ErrSessionNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM session_tags WHERE session_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to update session tags: %w", err)
+	}
+	if err := insertTags(ctx, tx, id, tags); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update session metadata: %w", err)
+	}
+
+	return nil
+}
+
+// insertTags adds the tag lookup rows of a session.
+func insertTags(ctx context.Context, tx *sql.Tx, sessionID string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO session_tags (session_id, tag) VALUES (?, ?)`, sessionID, tag); err != nil {
+			return fmt.Errorf("failed to save session tags: %w", err)
+		}
+	}
+	return nil
+}
+
+// nullString returns NULL for an empty string.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 
 // GetByID retrieves a session by its ID.
 func (r *SessionRepository) GetByID(ctx context.Context, id string) (*model.Session, error) {
 	query := `
-		SELECT id, user_id, name, command, env, status, exit_code, pid, log_file_path, preview_line, created_at, updated_at
+		SELECT id, user_id, name, command, env, status, exit_code, pid, log_file_path, preview_line, tags, max_duration, created_at, updated_at
 		FROM sessions
 		WHERE id = ?
 	`
@@ -65,6 +148,7 @@ func (r *SessionRepository) GetByID(ctx context.Context, id string) (*model.Sess
 	var exitCode sql.NullInt64
 	var pid sql.NullInt64
 	var previewLine sql.NullString
+	var tagsJSON sql.NullString
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&session.ID,
@@ -77,6 +161,8 @@ func (r *SessionRepository) GetByID(ctx context.Context, id string) (*model.Sess
 		&pid,
 		&session.LogFilePath,
 		&previewLine,
+		&tagsJSON,
+		&session.MaxDuration,
 		&session.CreatedAt,
 		&session.UpdatedAt,
 	)
@@ -107,24 +193,159 @@ func (r *SessionRepository) GetByID(ctx context.Context, id string) (*model.Sess
 		session.PreviewLine = previewLine.String
 	}
 
+	if tagsJSON.Valid {
+		if err := session.TagsFromJSON(tagsJSON.String); err != nil {
+			return nil, fmt.Errorf("failed to parse tags: %w", err)
+		}
+	}
+
 	return session, nil
 }
 
-// List retrieves all sessions for a user.
-func (r *SessionRepository) List(ctx context.Context, userID string) ([]*model.Session, error) {
+// List retrieves a page of the sessions for opts.UserID that match
+// opts.Filter, newest first, starting after opts.Cursor. It also returns the
+// cursor of the next page, which is empty on the last page.
+func (r *SessionRepository) List(ctx context.Context, opts model.ListOptions) ([]*model.Session, string, error) {
+	where, args := filterConditions(opts.UserID, opts.Filter)
+	if opts.Cursor != "" {
+		cursor, err := model.DecodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		where += " AND (created_at, id) < (?, ?)"
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+
+	// Fetch one more session than requested to tell whether there is a next page
+	limit := -1
+	if opts.Limit > 0 {
+		limit = opts.Limit + 1
+	}
+	args = append(args, limit)
+
+	query := `
+		SELECT id, user_id, name, command, env, status, exit_code, pid, log_file_path, preview_line, tags, max_duration, created_at, updated_at
+		FROM sessions
+		WHERE ` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions, err := scanSessions(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if opts.Limit > 0 && len(sessions) > opts.Limit {
+		sessions = sessions[:opts.Limit]
+		next = model.CursorAfter(sessions[len(sessions)-1]).Encode()
+	}
+	return sessions, next, nil
+}
+
+// ListFiltered retrieves a page of the sessions for a user that match the
+// filter, newest first, skipping the first offset. A limit of zero or less
+// returns all sessions from offset on.
+func (r *SessionRepository) ListFiltered(ctx context.Context, userID string, filter model.SessionFilter, limit, offset int) ([]*model.Session, error) {
+	where, args := filterConditions(userID, filter)
+
+	// SQLite treats a negative LIMIT as no limit
+	if limit <= 0 {
+		limit = -1
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	args = append(args, limit, offset)
+
 	query := `
-		SELECT id, user_id, name, command, env, status, exit_code, pid, log_file_path, preview_line, created_at, updated_at
+		SELECT id, user_id, name, command, env, status, exit_code, pid, log_file_path, preview_line, tags, max_duration, created_at, updated_at
 		FROM sessions
-		WHERE user_id = ?
-		ORDER BY created_at DESC
+		WHERE ` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list sessions: %w", err)
 	}
 	defer rows.Close()
 
+	return scanSessions(rows)
+}
+
+// CountByUser returns the number of sessions for a user that match the filter.
+// An empty filter counts all of the user's sessions.
+func (r *SessionRepository) CountByUser(ctx context.Context, userID string, filter model.SessionFilter) (int, error) {
+	where, args := filterConditions(userID, filter)
+	query := `SELECT COUNT(*) FROM sessions WHERE ` + where
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
+	return count, nil
+}
+
+// filterConditions builds the WHERE clause and its arguments for a user's
+// sessions matching filter.
+func filterConditions(userID string, filter model.SessionFilter) (string, []interface{}) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Command != "" {
+		conditions = append(conditions, `command LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(filter.Command)+"%")
+	}
+	if filter.Query != "" {
+		conditions = append(conditions, `(name LIKE ? ESCAPE '\' OR command LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if filter.Tag != "" {
+		// session_tags mirrors the tags column with an index on tag
+		conditions = append(conditions, "id IN (SELECT session_id FROM session_tags WHERE tag = ?)")
+		args = append(args, filter.Tag)
+	}
+	// Compare as Julian day numbers, since stored timestamps may carry
+	// different UTC offsets
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "julianday(created_at) >= julianday(?)")
+		args = append(args, sqliteTime(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "julianday(created_at) <= julianday(?)")
+		args = append(args, sqliteTime(filter.CreatedBefore))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the LIKE wildcards in s, using backslash as the escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// sqliteTime formats t in UTC as an SQLite time string.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.000")
+}
+
+// scanSessions reads all sessions from rows.
+func scanSessions(rows *sql.Rows) ([]*model.Session, error) {
 	var sessions []*model.Session
 	for rows.Next() {
 		session := &model.Session{}
@@ -132,6 +353,7 @@ func (r *SessionRepository) List(ctx context.Context, userID string) ([]*model.S
 		var exitCode sql.NullInt64
 		var pid sql.NullInt64
 		var previewLine sql.NullString
+		var tagsJSON sql.NullString
 
 		err := rows.Scan(
 			&session.ID,
@@ -144,6 +366,8 @@ func (r *SessionRepository) List(ctx context.Context, userID string) ([]*model.S
 			&pid,
 			&session.LogFilePath,
 			&previewLine,
+			&tagsJSON,
+			&session.MaxDuration,
 			&session.CreatedAt,
 			&session.UpdatedAt,
 		)
@@ -171,6 +395,12 @@ func (r *SessionRepository) List(ctx context.Context, userID string) ([]*model.S
 			session.PreviewLine = previewLine.String
 		}
 
+		if tagsJSON.Valid {
+			if err := session.TagsFromJSON(tagsJSON.String); err != nil {
+				return nil, fmt.Errorf("failed to parse tags: %w", err)
+			}
+		}
+
 		sessions = append(sessions, session)
 	}
 
@@ -184,9 +414,19 @@ func (r *SessionRepository) List(ctx context.Context, userID string) ([]*model.S
 
 // Delete removes a session from the database.
 func (r *SessionRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM session_tags WHERE session_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete session tags: %w", err)
+	}
+
 	query := `DELETE FROM sessions WHERE id = ?`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
@@ -200,9 +440,46 @@ func (r *SessionRepository) Delete(ctx context.Context, id string) error {
 		return model.ErrSessionNotFound
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
 	return nil
 }
 
+// DeleteByStatus removes all of a user's sessions in the given status and
+// returns how many were deleted.
+func (r *SessionRepository) DeleteByStatus(ctx context.Context, userID string, status model.SessionStatus) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tagsQuery := `DELETE FROM session_tags WHERE session_id IN (SELECT id FROM sessions WHERE user_id = ? AND status = ?)`
+	if _, err := tx.ExecContext(ctx, tagsQuery, userID, status); err != nil {
+		return 0, fmt.Errorf("failed to delete session tags: %w", err)
+	}
+
+	query := `DELETE FROM sessions WHERE user_id = ? AND status = ?`
+
+	result, err := tx.ExecContext(ctx, query, userID, status)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
 // UpdateStatus updates the status of a session.
 func (r *SessionRepository) UpdateStatus(ctx context.Context, id string, status model.SessionStatus, exitCode *int) error {
 	query := `
@@ -228,6 +505,32 @@ func (r *SessionRepository) UpdateStatus(ctx context.Context, id string, status
 	return nil
 }
 
+// UpdateMaxDuration sets the maximum duration of a session; zero is
+// unlimited.
+func (r *SessionRepository) UpdateMaxDuration(ctx context.Context, id string, maxDuration time.Duration) error {
+	query := `
+		UPDATE sessions
+		SET max_duration = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, int64(maxDuration), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update max duration: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return model.ErrSessionNotFound
+	}
+
+	return nil
+}
+
 // UpdatePreviewLine updates the preview line of a session.
 func (r *SessionRepository) UpdatePreviewLine(ctx context.Context, id string, previewLine string) error {
 	query := `
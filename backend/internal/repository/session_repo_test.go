@@ -0,0 +1,553 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/db"
+	"github.com/remote-agent-terminal/backend/internal/model"
+)
+
+// newTestRepository returns a repository backed by a fresh database.
+func newTestRepository(t *testing.T) *SessionRepository {
+	t.Helper()
+	db.ResetDB()
+	testDB, err := db.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	t.Cleanup(func() { db.CloseDB() })
+	return NewSessionRepository(testDB)
+}
+
+// TestSessionRepository_ListFiltered tests each filter dimension
+func TestSessionRepository_ListFiltered(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	base := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	fixtures := []struct {
+		id      string
+		userID  string
+		command string
+		status  model.SessionStatus
+		created time.Time
+	}{
+		{"s1", "alice", "claude --resume", model.SessionStatusRunning, base},
+		{"s2", "alice", "bash", model.SessionStatusExited, base.Add(time.Hour)},
+		{"s3", "alice", "claude", model.SessionStatusFailed, base.Add(2 * time.Hour)},
+		{"s4", "alice", "echo 100%_done", model.SessionStatusExited, base.Add(3 * time.Hour)},
+		{"s5", "bob", "claude", model.SessionStatusRunning, base.Add(time.Hour)},
+	}
+	for _, f := range fixtures {
+		err := repo.Create(ctx, &model.Session{
+			ID:        f.id,
+			UserID:    f.userID,
+			Name:      f.id,
+			Command:   f.command,
+			Status:    f.status,
+			CreatedAt: f.created,
+			UpdatedAt: f.created,
+		})
+		if err != nil {
+			t.Fatalf("failed to create session %s: %v", f.id, err)
+		}
+	}
+
+	// A later session stored with a non-UTC offset
+	tokyo := time.FixedZone("JST", 9*60*60)
+	err := repo.Create(ctx, &model.Session{
+		ID:        "s6",
+		UserID:    "alice",
+		Name:      "s6",
+		Command:   "vim",
+		Status:    model.SessionStatusRunning,
+		CreatedAt: base.Add(4 * time.Hour).In(tokyo),
+		UpdatedAt: base.Add(4 * time.Hour).In(tokyo),
+	})
+	if err != nil {
+		t.Fatalf("failed to create session s6: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filter   model.SessionFilter
+		expected []string
+	}{
+		{"no filter", model.SessionFilter{}, []string{"s6", "s4", "s3", "s2", "s1"}},
+		{"status running", model.SessionFilter{Status: model.SessionStatusRunning}, []string{"s6", "s1"}},
+		{"status exited", model.SessionFilter{Status: model.SessionStatusExited}, []string{"s4", "s2"}},
+		{"status failed", model.SessionFilter{Status: model.SessionStatusFailed}, []string{"s3"}},
+		{"command substring", model.SessionFilter{Command: "claude"}, []string{"s3", "s1"}},
+		{"command wildcards are literal", model.SessionFilter{Command: "%_"}, []string{"s4"}},
+		{"command no match", model.SessionFilter{Command: "zsh"}, nil},
+		{"created after", model.SessionFilter{CreatedAfter: base.Add(2 * time.Hour)}, []string{"s6", "s4", "s3"}},
+		{"created before", model.SessionFilter{CreatedBefore: base.Add(time.Hour)}, []string{"s2", "s1"}},
+		{"created range", model.SessionFilter{CreatedAfter: base.Add(30 * time.Minute), CreatedBefore: base.Add(150 * time.Minute)}, []string{"s3", "s2"}},
+		{"created after other offset", model.SessionFilter{CreatedAfter: base.Add(210 * time.Minute).In(tokyo)}, []string{"s6"}},
+		{"combined", model.SessionFilter{Status: model.SessionStatusExited, Command: "bash", CreatedBefore: base.Add(2 * time.Hour)}, []string{"s2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, err := repo.ListFiltered(ctx, "alice", tt.filter, 0, 0)
+			if err != nil {
+				t.Fatalf("ListFiltered failed: %v", err)
+			}
+			var ids []string
+			for _, s := range sessions {
+				ids = append(ids, s.ID)
+			}
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Fatalf("Expected %v, got %v", tt.expected, ids)
+				}
+			}
+		})
+	}
+
+	// An empty filter behaves exactly like List
+	all, _, err := repo.List(ctx, model.ListOptions{UserID: "alice"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	filtered, _ := repo.ListFiltered(ctx, "alice", model.SessionFilter{}, 0, 0)
+	if len(all) != len(filtered) {
+		t.Errorf("Expected empty filter to match List, got %d and %d sessions", len(filtered), len(all))
+	}
+}
+
+// TestSessionRepository_UpdateMetadata tests renaming and tagging sessions
+// and filtering by name and tag
+func TestSessionRepository_UpdateMetadata(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	base := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	fixtures := []struct {
+		id      string
+		name    string
+		command string
+		tags    []string
+	}{
+		{"s1", "api server", "claude", []string{"prod"}},
+		{"s2", "scratch", "bash", nil},
+		{"s3", "db migration", "claude --resume", []string{"prod", "debug"}},
+	}
+	for i, f := range fixtures {
+		created := base.Add(time.Duration(i) * time.Hour)
+		err := repo.Create(ctx, &model.Session{
+			ID:        f.id,
+			UserID:    "alice",
+			Name:      f.name,
+			Command:   f.command,
+			Status:    model.SessionStatusRunning,
+			Tags:      f.tags,
+			CreatedAt: created,
+			UpdatedAt: created,
+		})
+		if err != nil {
+			t.Fatalf("failed to create session %s: %v", f.id, err)
+		}
+	}
+
+	listIDs := func(filter model.SessionFilter) []string {
+		t.Helper()
+		sessions, err := repo.ListFiltered(ctx, "alice", filter, 0, 0)
+		if err != nil {
+			t.Fatalf("ListFiltered failed: %v", err)
+		}
+		var ids []string
+		for _, s := range sessions {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		filter   model.SessionFilter
+		expected []string
+	}{
+		{"query matches name", model.SessionFilter{Query: "server"}, []string{"s1"}},
+		{"query matches command", model.SessionFilter{Query: "bash"}, []string{"s2"}},
+		{"query matches name or command", model.SessionFilter{Query: "s"}, []string{"s3", "s2", "s1"}},
+		{"query wildcards are literal", model.SessionFilter{Query: "%"}, nil},
+		{"tag", model.SessionFilter{Tag: "prod"}, []string{"s3", "s1"}},
+		{"tag is exact", model.SessionFilter{Tag: "pro"}, nil},
+		{"tag and query", model.SessionFilter{Tag: "prod", Query: "migration"}, []string{"s3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ids := listIDs(tt.filter); fmt.Sprint(ids) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+
+	// Rename s2 and replace the tags of s1
+	if err := repo.UpdateMetadata(ctx, "s2", "nightly build", []string{"prod"}); err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+	if err := repo.UpdateMetadata(ctx, "s1", "api server", nil); err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+
+	s2, err := repo.GetByID(ctx, "s2")
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if s2.Name != "nightly build" || fmt.Sprint(s2.Tags) != "[prod]" {
+		t.Errorf("Expected renamed and tagged session, got name %q tags %v", s2.Name, s2.Tags)
+	}
+	s1, err := repo.GetByID(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if s1.Tags != nil {
+		t.Errorf("Expected tags to be removed, got %v", s1.Tags)
+	}
+
+	if ids := listIDs(model.SessionFilter{Tag: "prod"}); fmt.Sprint(ids) != "[s3 s2]" {
+		t.Errorf("Expected [s3 s2] tagged prod after update, got %v", ids)
+	}
+	if ids := listIDs(model.SessionFilter{Query: "nightly"}); fmt.Sprint(ids) != "[s2]" {
+		t.Errorf("Expected [s2] to match the new name, got %v", ids)
+	}
+
+	if err := repo.UpdateMetadata(ctx, "missing", "x", nil); !errors.Is(err, model.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+
+	// Deleting a session removes its tags
+	if err := repo.Delete(ctx, "s3"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	var tagRows int
+	if err := repo.db.QueryRow(`SELECT COUNT(*) FROM session_tags WHERE session_id = ?`, "s3").Scan(&tagRows); err != nil {
+		t.Fatalf("failed to count tags: %v", err)
+	}
+	if tagRows != 0 {
+		t.Errorf("Expected tags of deleted session to be removed, got %d", tagRows)
+	}
+}
+
+// TestSessionRepository_MigratesTags tests that a database created before
+// tags were added gains the tags column
+func TestSessionRepository_MigratesTags(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	_, err = old.Exec(`
+		CREATE TABLE sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			command TEXT NOT NULL,
+			env TEXT,
+			status TEXT NOT NULL DEFAULT 'running',
+			exit_code INTEGER,
+			pid INTEGER,
+			log_file_path TEXT NOT NULL,
+			preview_line TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO sessions (id, user_id, name, command, log_file_path) VALUES ('s1', 'alice', 'old', 'bash', 's1.cast');
+	`)
+	old.Close()
+	if err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+
+	db.ResetDB()
+	testDB, err := db.InitDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	t.Cleanup(func() { db.CloseDB() })
+	repo := NewSessionRepository(testDB)
+	ctx := context.Background()
+
+	if err := repo.UpdateMetadata(ctx, "s1", "old", []string{"legacy"}); err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+	s1, err := repo.GetByID(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if fmt.Sprint(s1.Tags) != "[legacy]" {
+		t.Errorf("Expected [legacy] tags, got %v", s1.Tags)
+	}
+}
+
+// TestSessionRepository_DeleteByStatus tests deleting a user's sessions by status
+func TestSessionRepository_DeleteByStatus(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	fixtures := []struct {
+		id     string
+		userID string
+		status model.SessionStatus
+	}{
+		{"s1", "alice", model.SessionStatusExited},
+		{"s2", "alice", model.SessionStatusExited},
+		{"s3", "alice", model.SessionStatusRunning},
+		{"s4", "bob", model.SessionStatusExited},
+	}
+	for _, f := range fixtures {
+		err := repo.Create(ctx, &model.Session{
+			ID:        f.id,
+			UserID:    f.userID,
+			Name:      f.id,
+			Command:   "bash",
+			Status:    f.status,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("failed to create session %s: %v", f.id, err)
+		}
+	}
+
+	deleted, err := repo.DeleteByStatus(ctx, "alice", model.SessionStatusExited)
+	if err != nil {
+		t.Fatalf("DeleteByStatus failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 sessions deleted, got %d", deleted)
+	}
+
+	for id, want := range map[string]bool{"s1": false, "s2": false, "s3": true, "s4": true} {
+		exists, err := repo.Exists(ctx, id)
+		if err != nil {
+			t.Fatalf("Exists failed: %v", err)
+		}
+		if exists != want {
+			t.Errorf("Expected session %s exists=%v, got %v", id, want, exists)
+		}
+	}
+
+	// Nothing left to delete is not an error
+	deleted, err = repo.DeleteByStatus(ctx, "alice", model.SessionStatusExited)
+	if err != nil || deleted != 0 {
+		t.Errorf("Expected 0 sessions deleted, got %d (err=%v)", deleted, err)
+	}
+}
+
+// TestSessionRepository_Paging tests paging through sessions with limit and offset
+func TestSessionRepository_Paging(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	const numSessions = 120
+	base := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < numSessions; i++ {
+		status := model.SessionStatusExited
+		if i%3 == 0 {
+			status = model.SessionStatusRunning
+		}
+		err := repo.Create(ctx, &model.Session{
+			ID:        fmt.Sprintf("s%03d", i),
+			UserID:    "alice",
+			Name:      "paged",
+			Command:   "bash",
+			Status:    status,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+			UpdatedAt: base,
+		})
+		if err != nil {
+			t.Fatalf("failed to create session %d: %v", i, err)
+		}
+	}
+
+	total, err := repo.CountByUser(ctx, "alice", model.SessionFilter{})
+	if err != nil {
+		t.Fatalf("CountByUser failed: %v", err)
+	}
+	if total != numSessions {
+		t.Errorf("Expected total %d, got %d", numSessions, total)
+	}
+
+	// Page through newest first and expect every session exactly once
+	const limit = 50
+	var pageSizes []int
+	next := numSessions - 1
+	for offset := 0; offset < total; offset += limit {
+		page, err := repo.ListFiltered(ctx, "alice", model.SessionFilter{}, limit, offset)
+		if err != nil {
+			t.Fatalf("List failed at offset %d: %v", offset, err)
+		}
+		pageSizes = append(pageSizes, len(page))
+		for _, s := range page {
+			if expected := fmt.Sprintf("s%03d", next); s.ID != expected {
+				t.Fatalf("Expected %s at offset %d, got %s", expected, offset, s.ID)
+			}
+			next--
+		}
+	}
+	if fmt.Sprint(pageSizes) != "[50 50 20]" {
+		t.Errorf("Expected page sizes [50 50 20], got %v", pageSizes)
+	}
+
+	// Past the end is an empty page, not an error
+	page, err := repo.ListFiltered(ctx, "alice", model.SessionFilter{}, limit, numSessions)
+	if err != nil || len(page) != 0 {
+		t.Errorf("Expected empty page past the end, got %d sessions, err %v", len(page), err)
+	}
+
+	// Counts and pages respect the filter
+	running := model.SessionFilter{Status: model.SessionStatusRunning}
+	count, err := repo.CountByUser(ctx, "alice", running)
+	if err != nil || count != numSessions/3 {
+		t.Errorf("Expected %d running sessions, got %d, err %v", numSessions/3, count, err)
+	}
+	page, err = repo.ListFiltered(ctx, "alice", running, 30, 30)
+	if err != nil || len(page) != 10 {
+		t.Errorf("Expected 10 running sessions on the second page, got %d, err %v", len(page), err)
+	}
+
+	// Other users are not counted
+	if count, _ := repo.CountByUser(ctx, "bob", model.SessionFilter{}); count != 0 {
+		t.Errorf("Expected no sessions for bob, got %d", count)
+	}
+}
+
+// TestSessionRepository_CursorPaging tests paging through sessions with a cursor
+func TestSessionRepository_CursorPaging(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	// Sessions created in the same second share a timestamp, so the cursor
+	// must break ties by ID
+	const numSessions = 45
+	base := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	create := func(id string, createdAt time.Time) {
+		t.Helper()
+		err := repo.Create(ctx, &model.Session{
+			ID:        id,
+			UserID:    "alice",
+			Name:      "paged",
+			Command:   "bash",
+			Status:    model.SessionStatusExited,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		})
+		if err != nil {
+			t.Fatalf("failed to create session %s: %v", id, err)
+		}
+	}
+	for i := 0; i < numSessions; i++ {
+		create(fmt.Sprintf("s%03d", i), base.Add(time.Duration(i/5)*time.Second))
+	}
+
+	var ids []string
+	var pageSizes []int
+	cursor := ""
+	for {
+		page, next, err := repo.List(ctx, model.ListOptions{UserID: "alice", Limit: 20, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		pageSizes = append(pageSizes, len(page))
+		for _, s := range page {
+			ids = append(ids, s.ID)
+		}
+		// Sessions created while paging do not shift later pages
+		if cursor == "" {
+			create("new", base.Add(time.Hour))
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if fmt.Sprint(pageSizes) != "[20 20 5]" {
+		t.Errorf("Expected page sizes [20 20 5], got %v", pageSizes)
+	}
+	if len(ids) != numSessions {
+		t.Fatalf("Expected %d sessions, got %d", numSessions, len(ids))
+	}
+	for i, id := range ids {
+		if expected := fmt.Sprintf("s%03d", numSessions-1-i); id != expected {
+			t.Fatalf("Expected %s at position %d, got %s", expected, i, id)
+		}
+	}
+
+	// A page that is exactly full has no next cursor
+	page, next, err := repo.List(ctx, model.ListOptions{UserID: "alice", Limit: numSessions + 1})
+	if err != nil || len(page) != numSessions+1 || next != "" {
+		t.Errorf("Expected all %d sessions without a next cursor, got %d, cursor %q, err %v", numSessions+1, len(page), next, err)
+	}
+
+	if _, _, err := repo.List(ctx, model.ListOptions{UserID: "alice", Cursor: "not a cursor"}); !errors.Is(err, model.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+// TestDecodeCursor tests that cursors round-trip and malformed ones are rejected
+func TestDecodeCursor(t *testing.T) {
+	cursor := model.SessionCursor{
+		CreatedAt: time.Date(2026, 1, 10, 12, 0, 0, 123456789, time.FixedZone("", 2*3600)),
+		ID:        "abc",
+	}
+	decoded, err := model.DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor failed: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("Expected %+v, got %+v", cursor, decoded)
+	}
+
+	tests := []string{
+		"",
+		"!!!",
+		"bm90IGpzb24",      // "not json"
+		"eyJpZCI6ImFiYyJ9", // no createdAt
+		"eyJjcmVhdGVkQXQiOiIyMDI2LTAxLTEwVDEyOjAwOjAwWiJ9", // no id
+	}
+	for _, token := range tests {
+		if _, err := model.DecodeCursor(token); !errors.Is(err, model.ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q): expected ErrInvalidCursor, got %v", token, err)
+		}
+	}
+}
+
+// TestSessionFilter_Validate tests session filter validation
+func TestSessionFilter_Validate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		filter  model.SessionFilter
+		wantErr bool
+	}{
+		{"empty", model.SessionFilter{}, false},
+		{"known status", model.SessionFilter{Status: model.SessionStatusFailed}, false},
+		{"unknown status", model.SessionFilter{Status: "paused"}, true},
+		{"valid range", model.SessionFilter{CreatedAfter: now.Add(-time.Hour), CreatedBefore: now}, false},
+		{"inverted range", model.SessionFilter{CreatedAfter: now, CreatedBefore: now.Add(-time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
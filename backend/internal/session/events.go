@@ -0,0 +1,82 @@
+package session
+
+import (
+	"sync"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
+)
+
+// EventType identifies a change to a user's list of sessions.
+type EventType string
+
+const (
+	// EventSessionCreated is published when a session is created; its
+	// Session is the new session.
+	EventSessionCreated EventType = "session_created"
+
+	// EventSessionStatus is published when a session's status changes: its
+	// process exits, it is restarted or it expires.
+	EventSessionStatus EventType = "session_status"
+
+	// EventSessionDeleted is published when a session is deleted.
+	EventSessionDeleted EventType = "session_deleted"
+)
+
+// Event is a change to a user's sessions published on an EventBus.
+type Event struct {
+	Type      EventType
+	UserID    string
+	SessionID string
+
+	// Session is a copy of the session after the change, for
+	// EventSessionCreated and EventSessionStatus.
+	Session *model.Session
+
+	Status   model.SessionStatus
+	ExitCode *int
+}
+
+// EventBus is an in-process pub/sub of session list changes. Unlike
+// StatusBus, subscribers receive the events of all sessions and are called
+// synchronously, so none are dropped.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[uint64]func(Event)
+	nextID      uint64
+}
+
+// NewEventBus creates an empty EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[uint64]func(Event))}
+}
+
+// Subscribe registers fn to be called with every published event and
+// returns a function that unsubscribes. fn is called on the publisher's
+// goroutine, so it must not block.
+func (b *EventBus) Subscribe(fn func(Event)) func() {
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	b.subscribers[id] = fn
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish calls every subscriber with event.
+func (b *EventBus) Publish(event Event) {
+	b.mu.RLock()
+	subscribers := make([]func(Event), 0, len(b.subscribers))
+	for _, fn := range b.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	b.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
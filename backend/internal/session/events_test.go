@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+
+	var first, second []Event
+	unsubscribe := bus.Subscribe(func(e Event) { first = append(first, e) })
+	bus.Subscribe(func(e Event) { second = append(second, e) })
+
+	bus.Publish(Event{Type: EventSessionCreated, UserID: "user1", SessionID: "s1"})
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("Expected both subscribers to receive the event, got %d and %d", len(first), len(second))
+	}
+	if first[0].SessionID != "s1" {
+		t.Errorf("Expected session 's1', got '%s'", first[0].SessionID)
+	}
+
+	// Unsubscribing stops delivery to that subscriber only
+	unsubscribe()
+	bus.Publish(Event{Type: EventSessionDeleted, UserID: "user1", SessionID: "s1"})
+	if len(first) != 1 {
+		t.Errorf("Expected no events after unsubscribing, got %d", len(first)-1)
+	}
+	if len(second) != 2 {
+		t.Errorf("Expected 2 events for the remaining subscriber, got %d", len(second))
+	}
+}
+
+func TestManager_Events(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	events := make(chan Event, 16)
+	defer manager.Events().Subscribe(func(e Event) { events <- e })()
+
+	next := func(expected EventType) Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != expected {
+				t.Fatalf("Expected %s event, got %+v", expected, e)
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", expected)
+		}
+		return Event{}
+	}
+
+	ctx := context.Background()
+	created, err := manager.Create(ctx, &model.CreateSessionRequest{
+		Command: "/usr/bin/echo hello",
+		UserID:  "user1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	e := next(EventSessionCreated)
+	if e.UserID != "user1" || e.SessionID != created.ID {
+		t.Errorf("Expected event for session %s of user1, got %+v", created.ID, e)
+	}
+	if e.Session == nil || e.Session.Status != model.SessionStatusRunning {
+		t.Errorf("Expected a running session in the event, got %+v", e.Session)
+	}
+
+	// The process exits on its own
+	e = next(EventSessionStatus)
+	if e.Status != model.SessionStatusExited || e.ExitCode == nil || *e.ExitCode != 0 {
+		t.Errorf("Expected exited with code 0, got %+v", e)
+	}
+	if e.Session == nil || e.Session.Status != model.SessionStatusExited {
+		t.Errorf("Expected the exited session in the event, got %+v", e.Session)
+	}
+
+	if err := manager.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	e = next(EventSessionDeleted)
+	if e.UserID != "user1" || e.SessionID != created.ID {
+		t.Errorf("Expected deletion of session %s of user1, got %+v", created.ID, e)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/remote-agent-terminal/backend/internal/logging"
 	"github.com/remote-agent-terminal/backend/internal/model"
 	"github.com/remote-agent-terminal/backend/internal/pty"
 	"github.com/remote-agent-terminal/backend/internal/repository"
@@ -20,12 +21,39 @@ type Manager struct {
 	ptyManager *pty.Manager
 	repo       *repository.SessionRepository
 	logDir     string
+	compress   bool
 
 	// Configuration
 	maxSessionsPerUser int
+	idleTimeout        time.Duration
+	watchdogTimeout    time.Duration
+	driverRegistry     *driver.Registry
+	logger             logging.Logger
 
-	mu       sync.RWMutex
-	sessions map[string]*SessionContext
+	// onWatchdog is called when a session's process stops producing output
+	onWatchdog func(sessionID string, timeout time.Duration)
+
+	// onSpawn is called after a session's process is spawned
+	onSpawn func(sessionID string, ptyProcess *pty.PTYProcess, agentDriver driver.AgentDriver)
+
+	// onExpire is called when a session's process is terminated for
+	// exceeding its MaxDuration
+	onExpire func(sessionID string, maxDuration time.Duration)
+
+	// statusBus publishes session status changes
+	statusBus *StatusBus
+
+	// events publishes changes to users' session lists
+	events *EventBus
+
+	mu        sync.RWMutex
+	sessions  map[string]*SessionContext
+	ttlTimers map[string]*ttlTimer
+}
+
+// ttlTimer terminates a session when its MaxDuration has passed.
+type ttlTimer struct {
+	timer *time.Timer
 }
 
 // SessionContext holds the runtime context for a session.
@@ -33,12 +61,34 @@ type SessionContext struct {
 	Session    *model.Session
 	PTYProcess *pty.PTYProcess
 	Driver     driver.AgentDriver
+
+	// startedAt is when PTYProcess was spawned; MaxDuration counts from it
+	startedAt time.Time
 }
 
 // Config holds configuration for the session manager.
 type Config struct {
 	LogDir             string
 	MaxSessionsPerUser int
+
+	// CompressLogs records sessions gzip-compressed to .cast.gz files.
+	CompressLogs bool
+
+	// DriverRegistry resolves the AgentDriver for a session command.
+	// If nil, the default registry is used.
+	DriverRegistry *driver.Registry
+
+	// IdleTimeout terminates sessions that produce no output and receive
+	// no input for this long. Zero disables it.
+	IdleTimeout time.Duration
+
+	// WatchdogTimeout reports sessions that produce no output for this
+	// long to the SetOnWatchdog callback. Zero disables it.
+	WatchdogTimeout time.Duration
+
+	// Logger receives errors the manager handles itself, such as a failed
+	// status update. If nil, they are discarded.
+	Logger logging.Logger
 }
 
 // NewManager creates a new session manager.
@@ -46,13 +96,27 @@ func NewManager(ptyManager *pty.Manager, repo *repository.SessionRepository, con
 	if config.MaxSessionsPerUser == 0 {
 		config.MaxSessionsPerUser = 10 // Default limit
 	}
+	if config.DriverRegistry == nil {
+		config.DriverRegistry = driver.DefaultRegistry()
+	}
+	if config.Logger == nil {
+		config.Logger = logging.Nop{}
+	}
 
 	return &Manager{
 		ptyManager:         ptyManager,
 		repo:               repo,
 		logDir:             config.LogDir,
+		compress:           config.CompressLogs,
 		maxSessionsPerUser: config.MaxSessionsPerUser,
+		idleTimeout:        config.IdleTimeout,
+		watchdogTimeout:    config.WatchdogTimeout,
+		driverRegistry:     config.DriverRegistry,
+		logger:             config.Logger,
 		sessions:           make(map[string]*SessionContext),
+		ttlTimers:          make(map[string]*ttlTimer),
+		statusBus:          NewStatusBus(),
+		events:             NewEventBus(),
 	}
 }
 
@@ -78,6 +142,9 @@ func (m *Manager) Create(ctx context.Context, req *model.CreateSessionRequest) (
 
 	// Generate log file path
 	logFilePath := filepath.Join(m.logDir, fmt.Sprintf("%s.cast", sessionID))
+	if m.compress {
+		logFilePath += ".gz"
+	}
 
 	// Create session model
 	now := time.Now()
@@ -90,6 +157,7 @@ func (m *Manager) Create(ctx context.Context, req *model.CreateSessionRequest) (
 		Env:         req.Env,
 		Status:      model.SessionStatusRunning,
 		LogFilePath: logFilePath,
+		MaxDuration: req.MaxDuration,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -106,17 +174,16 @@ func (m *Manager) Create(ctx context.Context, req *model.CreateSessionRequest) (
 
 	// Spawn PTY process
 	ptyProcess, err := m.ptyManager.Spawn(ctx, pty.SpawnOptions{
-		Session:     session,
-		InitialRows: 24,
-		InitialCols: 80,
-		OutputCallback: func(data []byte) {
-			// Output callback will be used by WebSocket hub
-			// For now, we just need to ensure the process is spawned
-		},
+		Session:         session,
+		InitialRows:     24,
+		InitialCols:     80,
+		IdleTimeout:     m.idleTimeout,
+		WatchdogTimeout: m.watchdogTimeout,
 		ExitCallback: func(exitCode int, err error) {
 			// Handle process exit
 			m.handleProcessExit(sessionID, exitCode, err)
 		},
+		WatchdogCallback: m.handleWatchdog,
 	})
 	if err != nil {
 		// Rollback: delete from database
@@ -137,9 +204,22 @@ func (m *Manager) Create(ctx context.Context, req *model.CreateSessionRequest) (
 		Session:    session,
 		PTYProcess: ptyProcess,
 		Driver:     agentDriver,
+		startedAt:  session.CreatedAt,
 	}
+	m.scheduleTTLLocked(sessionID, session.CreatedAt, session.MaxDuration)
+	created := *session
 	m.mu.Unlock()
 
+	m.notifySpawn(sessionID, ptyProcess, agentDriver)
+	m.statusBus.Publish(StatusEvent{SessionID: sessionID, Status: created.Status, PID: &pid})
+	m.events.Publish(Event{
+		Type:      EventSessionCreated,
+		UserID:    created.UserID,
+		SessionID: sessionID,
+		Session:   &created,
+		Status:    created.Status,
+	})
+
 	return session, nil
 }
 
@@ -174,7 +254,60 @@ func (m *Manager) GetContext(id string) (*SessionContext, bool) {
 
 // List retrieves all sessions for a user.
 func (m *Manager) List(ctx context.Context, userID string) ([]*model.Session, error) {
-	return m.repo.List(ctx, userID)
+	return m.repo.ListFiltered(ctx, userID, model.SessionFilter{}, 0, 0)
+}
+
+// ListPage returns a page of the sessions selected by opts and the cursor of
+// the next page, which is empty on the last page.
+func (m *Manager) ListPage(ctx context.Context, opts model.ListOptions) ([]*model.Session, string, error) {
+	return m.repo.List(ctx, opts)
+}
+
+// ListFiltered returns a page of the sessions for a user that match the filter.
+// A limit of zero or less returns all matching sessions from offset on.
+func (m *Manager) ListFiltered(ctx context.Context, userID string, filter model.SessionFilter, limit, offset int) ([]*model.Session, error) {
+	return m.repo.ListFiltered(ctx, userID, filter, limit, offset)
+}
+
+// CountByUser returns the number of sessions for a user that match the filter.
+func (m *Manager) CountByUser(ctx context.Context, userID string, filter model.SessionFilter) (int, error) {
+	return m.repo.CountByUser(ctx, userID, filter)
+}
+
+// UpdateMetadata changes the name and tags of a session. Fields of req that
+// are nil keep their current value.
+func (m *Manager) UpdateMetadata(ctx context.Context, id string, req *model.UpdateSessionRequest) (*model.Session, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	session, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	name, tags := session.Name, session.Tags
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Tags != nil {
+		tags = *req.Tags
+		if len(tags) == 0 {
+			tags = nil
+		}
+	}
+
+	if err := m.repo.UpdateMetadata(ctx, id, name, tags); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	session.Name = name
+	session.Tags = tags
+	session.UpdatedAt = time.Now()
+	m.mu.Unlock()
+
+	return session, nil
 }
 
 // Delete terminates and removes a session.
@@ -182,16 +315,26 @@ func (m *Manager) Delete(ctx context.Context, id string) error {
 	// Get session context
 	m.mu.Lock()
 	sessionCtx, exists := m.sessions[id]
+	userID := ""
 	if exists {
+		userID = sessionCtx.Session.UserID
 		delete(m.sessions, id)
 	}
+	m.stopTTLLocked(id)
 	m.mu.Unlock()
 
 	// Kill PTY process if running
 	if exists && sessionCtx.PTYProcess != nil {
 		if err := sessionCtx.PTYProcess.Close(); err != nil {
 			// Log error but continue with deletion
-			fmt.Printf("Error closing PTY process: %v\n", err)
+			m.logger.Warn("Failed to close PTY process", "session_id", id, "error", err)
+		}
+	}
+
+	// Look up the owner to report the deletion to
+	if !exists {
+		if sess, err := m.repo.GetByID(ctx, id); err == nil {
+			userID = sess.UserID
 		}
 	}
 
@@ -200,10 +343,69 @@ func (m *Manager) Delete(ctx context.Context, id string) error {
 		return err
 	}
 
+	m.statusBus.Publish(StatusEvent{SessionID: id, Status: StatusDeleted})
+	m.events.Publish(Event{Type: EventSessionDeleted, UserID: userID, SessionID: id})
 	return nil
 }
 
-// handleProcessExit handles PTY process exit events.
+// DeleteByStatus removes all of a user's sessions in the given status and
+// returns how many were deleted from the database. Matching sessions that
+// are in memory are removed too and their PTY processes are closed.
+func (m *Manager) DeleteByStatus(ctx context.Context, userID string, status model.SessionStatus) (int, error) {
+	if status == "" {
+		return 0, fmt.Errorf("%w: status is required", model.ErrInvalidStatus)
+	}
+	if err := (model.SessionFilter{Status: status}).Validate(); err != nil {
+		return 0, err
+	}
+
+	// Find the sessions to report as deleted
+	matching, err := m.repo.ListFiltered(ctx, userID, model.SessionFilter{Status: status}, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	// Delete from the database first: closing a process updates its status
+	deleted, err := m.repo.DeleteByStatus(ctx, userID, status)
+	if err != nil {
+		return 0, err
+	}
+
+	// Remove the deleted sessions from memory by ID: the in-memory status
+	// can be ahead of the database while a process exit is recorded
+	var processes []*pty.PTYProcess
+	m.mu.Lock()
+	for _, sess := range matching {
+		sessionCtx, exists := m.sessions[sess.ID]
+		if !exists {
+			continue
+		}
+		delete(m.sessions, sess.ID)
+		m.stopTTLLocked(sess.ID)
+		if sessionCtx.PTYProcess != nil {
+			processes = append(processes, sessionCtx.PTYProcess)
+		}
+	}
+	m.mu.Unlock()
+
+	// Kill PTY processes that are still running
+	for _, p := range processes {
+		if err := p.Close(); err != nil {
+			// Log error but continue with the other sessions
+			m.logger.Warn("Failed to close PTY process", "session_id", p.ID, "error", err)
+		}
+	}
+
+	for _, sess := range matching {
+		m.statusBus.Publish(StatusEvent{SessionID: sess.ID, Status: StatusDeleted})
+		m.events.Publish(Event{Type: EventSessionDeleted, UserID: userID, SessionID: sess.ID})
+	}
+
+	return deleted, nil
+}
+
+// handleProcessExit handles PTY process exit events. A session whose
+// process was terminated for exceeding its MaxDuration stays expired.
 func (m *Manager) handleProcessExit(sessionID string, exitCode int, err error) {
 	ctx := context.Background()
 
@@ -213,30 +415,208 @@ func (m *Manager) handleProcessExit(sessionID string, exitCode int, err error) {
 		status = model.SessionStatusFailed
 	}
 
-	// Update database
-	if updateErr := m.repo.UpdateStatus(ctx, sessionID, status, &exitCode); updateErr != nil {
-		fmt.Printf("Failed to update session status: %v\n", updateErr)
-	}
-
 	// Update in-memory session
+	var changed *model.Session
 	m.mu.Lock()
+	m.stopTTLLocked(sessionID)
 	if sessionCtx, exists := m.sessions[sessionID]; exists {
+		if sessionCtx.Session.Status == model.SessionStatusExpired {
+			status = model.SessionStatusExpired
+		}
 		sessionCtx.Session.Status = status
 		sessionCtx.Session.ExitCode = &exitCode
 		sessionCtx.Session.UpdatedAt = time.Now()
+		snapshot := *sessionCtx.Session
+		changed = &snapshot
 	}
 	m.mu.Unlock()
+
+	// Update database
+	if updateErr := m.repo.UpdateStatus(ctx, sessionID, status, &exitCode); updateErr != nil {
+		m.logger.Error("Failed to update session status", "session_id", sessionID, "status", status, "error", updateErr)
+	}
+
+	m.statusBus.Publish(StatusEvent{SessionID: sessionID, Status: status, ExitCode: &exitCode})
+
+	// A process closed by Delete exits after its session is gone
+	if changed != nil {
+		m.publishStatus(changed)
+	}
 }
 
-// createDriver creates an appropriate driver based on the command.
-func (m *Manager) createDriver(command string) driver.AgentDriver {
-	// Check if command contains "claude"
-	if contains(command, "claude") {
-		return driver.NewClaudeDriver()
+// StatusBus returns the bus on which session status changes are published.
+func (m *Manager) StatusBus() *StatusBus {
+	return m.statusBus
+}
+
+// Events returns the bus on which sessions being created, changing status
+// and being deleted are published.
+func (m *Manager) Events() *EventBus {
+	return m.events
+}
+
+// publishStatus publishes an EventSessionStatus for sess, a copy of the
+// session taken under m.mu.
+func (m *Manager) publishStatus(sess *model.Session) {
+	m.events.Publish(Event{
+		Type:      EventSessionStatus,
+		UserID:    sess.UserID,
+		SessionID: sess.ID,
+		Session:   sess,
+		Status:    sess.Status,
+		ExitCode:  sess.ExitCode,
+	})
+}
+
+// SetTTL sets the maximum duration of a session, measured from the start
+// of its process, replacing any previous one. The process is terminated
+// and the session marked SessionStatusExpired once it has run for d,
+// immediately if it already has. A d of zero or less removes the limit.
+// The limit is saved with the session and applies again when it is
+// restarted.
+func (m *Manager) SetTTL(id string, d time.Duration) error {
+	if d < 0 {
+		d = 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessionCtx, exists := m.sessions[id]
+	if !exists {
+		return fmt.Errorf("session not found: %s", id)
+	}
+	if err := m.repo.UpdateMaxDuration(context.Background(), id, d); err != nil {
+		return err
+	}
+
+	sessionCtx.Session.MaxDuration = d
+	if sessionCtx.PTYProcess != nil && !sessionCtx.PTYProcess.IsClosed() {
+		m.scheduleTTLLocked(id, sessionCtx.startedAt, d)
+	}
+	return nil
+}
+
+// scheduleTTLLocked arms the timer that expires a session maxDuration after
+// its process started at startedAt, replacing any previous timer. m.mu
+// must be held.
+func (m *Manager) scheduleTTLLocked(id string, startedAt time.Time, maxDuration time.Duration) {
+	m.stopTTLLocked(id)
+	if maxDuration <= 0 {
+		return
+	}
+
+	t := &ttlTimer{}
+	t.timer = time.AfterFunc(time.Until(startedAt.Add(maxDuration)), func() {
+		m.expire(id, t)
+	})
+	m.ttlTimers[id] = t
+}
+
+// stopTTLLocked stops a session's TTL timer, if any. m.mu must be held.
+func (m *Manager) stopTTLLocked(id string) {
+	if t, exists := m.ttlTimers[id]; exists {
+		t.timer.Stop()
+		delete(m.ttlTimers, id)
+	}
+}
+
+// expire marks a session whose TTL timer t has fired SessionStatusExpired
+// and terminates its process. The session itself is kept, so it can be
+// inspected, restarted or deleted like an exited one. It does nothing if t
+// has since been replaced or stopped.
+func (m *Manager) expire(id string, t *ttlTimer) {
+	m.mu.Lock()
+	if m.ttlTimers[id] != t {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.ttlTimers, id)
+
+	sessionCtx, exists := m.sessions[id]
+	if !exists {
+		m.mu.Unlock()
+		return
+	}
+	maxDuration := sessionCtx.Session.MaxDuration
+	ptyProcess := sessionCtx.PTYProcess
+	sessionCtx.Session.Status = model.SessionStatusExpired
+	sessionCtx.Session.UpdatedAt = time.Now()
+	changed := *sessionCtx.Session
+	callback := m.onExpire
+	m.mu.Unlock()
+
+	ctx := context.Background()
+	if err := m.repo.UpdateStatus(ctx, id, model.SessionStatusExpired, nil); err != nil {
+		m.logger.Error("Failed to update session status", "session_id", id, "status", model.SessionStatusExpired, "error", err)
+	}
+	m.statusBus.Publish(StatusEvent{SessionID: id, Status: model.SessionStatusExpired})
+	m.publishStatus(&changed)
+
+	// Tell clients before the process goes away
+	if callback != nil {
+		callback(id, maxDuration)
+	}
+
+	if ptyProcess != nil {
+		if err := ptyProcess.Close(); err != nil {
+			m.logger.Warn("Failed to close PTY process", "session_id", id, "error", err)
+		}
 	}
+}
+
+// SetOnExpire sets the callback for sessions whose process is terminated
+// for exceeding their MaxDuration. It is called before the process is
+// closed.
+func (m *Manager) SetOnExpire(callback func(sessionID string, maxDuration time.Duration)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onExpire = callback
+}
+
+// SetOnWatchdog sets the callback for sessions whose process has produced
+// no output for the watchdog timeout.
+func (m *Manager) SetOnWatchdog(callback func(sessionID string, timeout time.Duration)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onWatchdog = callback
+}
 
-	// Default to generic driver
-	return driver.NewGenericDriver()
+// SetOnSpawn sets the callback called after a session's process is spawned,
+// by Create and Restart, with the driver that parses its output. Use it to
+// subscribe to the process output once per process.
+func (m *Manager) SetOnSpawn(callback func(sessionID string, ptyProcess *pty.PTYProcess, agentDriver driver.AgentDriver)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onSpawn = callback
+}
+
+// notifySpawn calls the spawn callback, if any.
+func (m *Manager) notifySpawn(sessionID string, ptyProcess *pty.PTYProcess, agentDriver driver.AgentDriver) {
+	m.mu.RLock()
+	callback := m.onSpawn
+	m.mu.RUnlock()
+
+	if callback != nil {
+		callback(sessionID, ptyProcess, agentDriver)
+	}
+}
+
+// handleWatchdog reports a session whose process has stopped producing output.
+func (m *Manager) handleWatchdog(sessionID string) {
+	m.mu.RLock()
+	callback := m.onWatchdog
+	m.mu.RUnlock()
+
+	if callback != nil {
+		callback(sessionID, m.watchdogTimeout)
+	}
+}
+
+// createDriver creates an appropriate driver based on the command.
+// The driver registry falls back to a generic driver when nothing matches.
+func (m *Manager) createDriver(command string) driver.AgentDriver {
+	return m.driverRegistry.ResolveDriver(command)
 }
 
 // contains checks if a string contains a substring (case-insensitive).
@@ -320,17 +700,27 @@ func (m *Manager) Restart(ctx context.Context, id string) (*model.Session, error
 		return nil, fmt.Errorf("failed to update session status: %w", err)
 	}
 
+	// Continue the previous process's cursors, so clients resuming from
+	// them get the new output in full
+	initialCursor := 0
+	m.mu.RLock()
+	if sessionCtx, exists := m.sessions[id]; exists && sessionCtx.PTYProcess != nil {
+		initialCursor = sessionCtx.PTYProcess.RingBuffer.Cursor()
+	}
+	m.mu.RUnlock()
+
 	// Create new PTY process with the same configuration
 	ptyProcess, err := m.ptyManager.Spawn(ctx, pty.SpawnOptions{
-		Session:      sess,
-		InitialRows:  24,
-		InitialCols:  80,
-		OutputCallback: func(data []byte) {
-			// Output callback will be set by WebSocket service
-		},
+		Session:         sess,
+		InitialRows:     24,
+		InitialCols:     80,
+		InitialCursor:   initialCursor,
+		IdleTimeout:     m.idleTimeout,
+		WatchdogTimeout: m.watchdogTimeout,
 		ExitCallback: func(exitCode int, err error) {
 			m.handleProcessExit(id, exitCode, err)
 		},
+		WatchdogCallback: m.handleWatchdog,
 	})
 	if err != nil {
 		// Revert status on failure
@@ -338,22 +728,35 @@ func (m *Manager) Restart(ctx context.Context, id string) (*model.Session, error
 		return nil, fmt.Errorf("failed to spawn PTY: %w", err)
 	}
 
-	// Update session context
+	pid := ptyProcess.PID()
+	sess.PID = &pid
+
+	// Update session context. The new process and driver start without the
+	// previous process's history and parser state.
+	agentDriver := m.createDriver(command)
 	m.mu.Lock()
 	if sessionCtx, exists := m.sessions[id]; exists {
 		sessionCtx.Session = sess
 		sessionCtx.PTYProcess = ptyProcess
-		sessionCtx.Driver = m.createDriver(command)
+		sessionCtx.Driver = agentDriver
+		sessionCtx.startedAt = sess.UpdatedAt
 	} else {
 		// Create new session context if it doesn't exist
 		m.sessions[id] = &SessionContext{
 			Session:    sess,
 			PTYProcess: ptyProcess,
-			Driver:     m.createDriver(command),
+			Driver:     agentDriver,
+			startedAt:  sess.UpdatedAt,
 		}
 	}
+	m.scheduleTTLLocked(id, sess.UpdatedAt, sess.MaxDuration)
+	restarted := *sess
 	m.mu.Unlock()
 
+	m.notifySpawn(id, ptyProcess, agentDriver)
+	m.statusBus.Publish(StatusEvent{SessionID: id, Status: restarted.Status, PID: &pid})
+	m.publishStatus(&restarted)
+
 	return sess, nil
 }
 
@@ -425,23 +828,22 @@ func (m *Manager) GetHistory(id string) ([]byte, error) {
 	return sessionCtx.PTYProcess.GetHistory(), nil
 }
 
-// SetOutputCallback sets the output callback for a session.
-// This is used by WebSocket to receive PTY output.
-func (m *Manager) SetOutputCallback(id string, callback func(data []byte)) error {
+// AddOutputListener registers callback to receive a session's PTY output.
+// The returned function removes it. See pty.PTYProcess.AddOutputListener.
+func (m *Manager) AddOutputListener(id string, callback func(data []byte)) (remove func(), err error) {
 	m.mu.RLock()
 	sessionCtx, exists := m.sessions[id]
 	m.mu.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("session not found: %s", id)
+		return nil, fmt.Errorf("session not found: %s", id)
 	}
 
 	if sessionCtx.PTYProcess == nil {
-		return fmt.Errorf("session has no PTY process: %s", id)
+		return nil, fmt.Errorf("session has no PTY process: %s", id)
 	}
 
-	sessionCtx.PTYProcess.OutputCallback = callback
-	return nil
+	return sessionCtx.PTYProcess.AddOutputListener(callback), nil
 }
 
 // Close closes all sessions and releases resources.
@@ -458,6 +860,9 @@ func (m *Manager) Close() error {
 		}
 		delete(m.sessions, id)
 	}
+	for id := range m.ttlTimers {
+		m.stopTTLLocked(id)
+	}
 
 	return firstErr
 }
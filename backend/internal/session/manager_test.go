@@ -2,12 +2,17 @@ package session
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/remote-agent-terminal/backend/internal/db"
+	"github.com/remote-agent-terminal/backend/internal/driver"
 	"github.com/remote-agent-terminal/backend/internal/model"
 	"github.com/remote-agent-terminal/backend/internal/pty"
 	"github.com/remote-agent-terminal/backend/internal/repository"
@@ -27,6 +32,10 @@ func setupTestManager(t *testing.T) (*Manager, func()) {
 		t.Fatalf("Failed to create database: %v", err)
 	}
 
+	// Processes exit and expire in the background, and each connection to
+	// ":memory:" would open a separate, empty database
+	database.SetMaxOpenConns(1)
+
 	// Create repository
 	repo := repository.NewSessionRepository(database)
 
@@ -339,6 +348,369 @@ func TestManager_Delete(t *testing.T) {
 	})
 }
 
+func TestManager_DeleteByStatus(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	var running []*model.Session
+	for i := 0; i < 2; i++ {
+		session, err := manager.Create(ctx, &model.CreateSessionRequest{
+			Command: "/usr/bin/sleep 30",
+			UserID:  "user1",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		running = append(running, session)
+	}
+	other, err := manager.Create(ctx, &model.CreateSessionRequest{
+		Command: "/usr/bin/sleep 30",
+		UserID:  "user2",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	processes := make([]*pty.PTYProcess, 0, len(running))
+	for _, session := range running {
+		sessionCtx, _ := manager.GetContext(session.ID)
+		processes = append(processes, sessionCtx.PTYProcess)
+	}
+
+	t.Run("deletes matching sessions", func(t *testing.T) {
+		deleted, err := manager.DeleteByStatus(ctx, "user1", model.SessionStatusRunning)
+		if err != nil {
+			t.Fatalf("DeleteByStatus failed: %v", err)
+		}
+		if deleted != 2 {
+			t.Errorf("Expected 2 sessions deleted, got %d", deleted)
+		}
+
+		for i, session := range running {
+			if _, exists := manager.GetContext(session.ID); exists {
+				t.Errorf("Expected session %s to be removed from memory", session.ID)
+			}
+			if _, err := manager.Get(ctx, session.ID); err == nil {
+				t.Errorf("Expected session %s to be removed from the database", session.ID)
+			}
+			if !processes[i].IsClosed() {
+				t.Errorf("Expected PTY process of session %s to be closed", session.ID)
+			}
+		}
+
+		if !manager.IsSessionRunning(other.ID) {
+			t.Error("Expected another user's session to keep running")
+		}
+	})
+
+	t.Run("in-memory status ahead of the database", func(t *testing.T) {
+		session, err := manager.Create(ctx, &model.CreateSessionRequest{
+			Command: "/usr/bin/sleep 30",
+			UserID:  "user3",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		// An exit is recorded in memory before the database
+		manager.mu.Lock()
+		manager.sessions[session.ID].Session.Status = model.SessionStatusExited
+		manager.mu.Unlock()
+
+		deleted, err := manager.DeleteByStatus(ctx, "user3", model.SessionStatusRunning)
+		if err != nil {
+			t.Fatalf("DeleteByStatus failed: %v", err)
+		}
+		if deleted != 1 {
+			t.Errorf("Expected 1 session deleted, got %d", deleted)
+		}
+		if _, exists := manager.GetContext(session.ID); exists {
+			t.Error("Expected the deleted session to be removed from memory")
+		}
+	})
+
+	t.Run("invalid status", func(t *testing.T) {
+		for _, status := range []model.SessionStatus{"", "bogus"} {
+			if _, err := manager.DeleteByStatus(ctx, "user1", status); !errors.Is(err, model.ErrInvalidStatus) {
+				t.Errorf("Expected ErrInvalidStatus for %q, got %v", status, err)
+			}
+		}
+	})
+}
+
+// TestManager_UpdateMetadata tests renaming and tagging a session
+func TestManager_UpdateMetadata(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	session, err := manager.Create(ctx, &model.CreateSessionRequest{
+		Command: "/usr/bin/sleep 30",
+		Name:    "original",
+		UserID:  "user1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	name := "  renamed  "
+	tags := []string{"prod", " debug", "prod"}
+	updated, err := manager.UpdateMetadata(ctx, session.ID, &model.UpdateSessionRequest{Name: &name, Tags: &tags})
+	if err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+	if updated.Name != "renamed" {
+		t.Errorf("Expected trimmed name 'renamed', got %q", updated.Name)
+	}
+	if fmt.Sprint(updated.Tags) != "[prod debug]" {
+		t.Errorf("Expected deduplicated tags [prod debug], got %v", updated.Tags)
+	}
+
+	// Omitted fields are unchanged, in memory and in the database
+	empty := []string{}
+	if _, err := manager.UpdateMetadata(ctx, session.ID, &model.UpdateSessionRequest{Tags: &empty}); err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+	stored, err := manager.repo.GetByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	for _, s := range []*model.Session{stored, session} {
+		if s.Name != "renamed" || s.Tags != nil {
+			t.Errorf("Expected name 'renamed' without tags, got %q %v", s.Name, s.Tags)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		req      *model.UpdateSessionRequest
+		expected error
+	}{
+		{"blank name", &model.UpdateSessionRequest{Name: new(string)}, model.ErrNameRequired},
+		{"blank tag", &model.UpdateSessionRequest{Tags: &[]string{" "}}, model.ErrInvalidTag},
+		{"long tag", &model.UpdateSessionRequest{Tags: &[]string{strings.Repeat("x", model.MaxTagLength+1)}}, model.ErrInvalidTag},
+		{"too many tags", &model.UpdateSessionRequest{Tags: manyTags(model.MaxTags + 1)}, model.ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := manager.UpdateMetadata(ctx, session.ID, tt.req); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	if _, err := manager.UpdateMetadata(ctx, "missing", &model.UpdateSessionRequest{Name: &name}); !errors.Is(err, model.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+// manyTags returns n distinct tags.
+func manyTags(n int) *[]string {
+	tags := make([]string, n)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag%d", i)
+	}
+	return &tags
+}
+
+func TestManager_OnSpawn(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	type spawn struct {
+		id      string
+		process *pty.PTYProcess
+		driver  string
+	}
+	spawned := make(chan spawn, 1)
+	manager.SetOnSpawn(func(sessionID string, ptyProcess *pty.PTYProcess, agentDriver driver.AgentDriver) {
+		spawned <- spawn{sessionID, ptyProcess, agentDriver.Name()}
+	})
+
+	session, err := manager.Create(context.Background(), &model.CreateSessionRequest{
+		Command: "bash",
+		UserID:  "user1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	select {
+	case s := <-spawned:
+		sessionCtx, _ := manager.GetContext(session.ID)
+		if s.id != session.ID || s.process != sessionCtx.PTYProcess {
+			t.Errorf("Expected spawn callback for session %s and its process, got %s", session.ID, s.id)
+		}
+		if s.driver != "bash" {
+			t.Errorf("Expected bash driver, got '%s'", s.driver)
+		}
+	default:
+		t.Fatal("Expected spawn callback to be called by Create")
+	}
+}
+
+func TestManager_TTL(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type expiry struct {
+		id          string
+		maxDuration time.Duration
+		running     bool
+	}
+	expired := make(chan expiry, 2)
+	manager.SetOnExpire(func(sessionID string, maxDuration time.Duration) {
+		// Clients are told before the process is terminated
+		expired <- expiry{sessionID, maxDuration, manager.IsSessionRunning(sessionID)}
+	})
+
+	// waitExpired waits until the session's process has exited and its
+	// status has been saved
+	waitExpired := func(t *testing.T, id string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			manager.mu.RLock()
+			sessionCtx, exists := manager.sessions[id]
+			exited := exists && sessionCtx.Session.ExitCode != nil
+			manager.mu.RUnlock()
+			if !exists {
+				t.Fatal("Expected expired session to be kept")
+			}
+			if exited {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected expired session's process to exit")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("expires after max duration", func(t *testing.T) {
+		session, err := manager.Create(ctx, &model.CreateSessionRequest{
+			Command:     "/usr/bin/sleep 10",
+			UserID:      "user1",
+			MaxDuration: 100 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		select {
+		case e := <-expired:
+			if e.id != session.ID || e.maxDuration != 100*time.Millisecond {
+				t.Errorf("Expected expiry of %s after 100ms, got %s after %v", session.ID, e.id, e.maxDuration)
+			}
+			if !e.running {
+				t.Error("Expected expire callback before the process is terminated")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected session to expire")
+		}
+
+		// The session is kept, expired, in memory and in the database
+		waitExpired(t, session.ID)
+		stored, err := manager.repo.GetByID(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("Expected expired session to stay in the database, got %v", err)
+		}
+		if stored.Status != model.SessionStatusExpired || stored.MaxDuration != 100*time.Millisecond {
+			t.Errorf("Expected stored session expired with max duration 100ms, got %s and %v", stored.Status, stored.MaxDuration)
+		}
+
+		// Restarting it applies the saved max duration again
+		if _, err := manager.Restart(ctx, session.ID); err != nil {
+			t.Fatalf("Failed to restart expired session: %v", err)
+		}
+		select {
+		case e := <-expired:
+			if e.id != session.ID {
+				t.Errorf("Expected expiry of %s, got %s", session.ID, e.id)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected restarted session to expire")
+		}
+		waitExpired(t, session.ID)
+		manager.Delete(ctx, session.ID)
+	})
+
+	t.Run("SetTTL extends deadline", func(t *testing.T) {
+		session, err := manager.Create(ctx, &model.CreateSessionRequest{
+			Command:     "/usr/bin/sleep 10",
+			UserID:      "user1",
+			MaxDuration: 100 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		defer manager.Delete(ctx, session.ID)
+
+		if err := manager.SetTTL(session.ID, time.Hour); err != nil {
+			t.Fatalf("SetTTL failed: %v", err)
+		}
+		if session.MaxDuration != time.Hour {
+			t.Errorf("Expected MaxDuration 1h, got %v", session.MaxDuration)
+		}
+		if stored, err := manager.repo.GetByID(ctx, session.ID); err != nil || stored.MaxDuration != time.Hour {
+			t.Errorf("Expected stored MaxDuration 1h, got %+v (err: %v)", stored, err)
+		}
+
+		select {
+		case e := <-expired:
+			t.Fatalf("Expected extended session not to expire, got expiry of %s", e.id)
+		case <-time.After(300 * time.Millisecond):
+		}
+		if !manager.IsSessionRunning(session.ID) {
+			t.Error("Expected extended session to keep running")
+		}
+	})
+
+	t.Run("SetTTL in the past expires immediately", func(t *testing.T) {
+		session, err := manager.Create(ctx, &model.CreateSessionRequest{
+			Command: "/usr/bin/sleep 10",
+			UserID:  "user1",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		if err := manager.SetTTL(session.ID, time.Nanosecond); err != nil {
+			t.Fatalf("SetTTL failed: %v", err)
+		}
+
+		select {
+		case e := <-expired:
+			if e.id != session.ID {
+				t.Errorf("Expected expiry of %s, got %s", session.ID, e.id)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected session to expire")
+		}
+	})
+
+	t.Run("SetTTL unknown session", func(t *testing.T) {
+		if err := manager.SetTTL("non-existent-id", time.Hour); err == nil {
+			t.Error("Expected error for non-existent session")
+		}
+	})
+
+	t.Run("negative max duration", func(t *testing.T) {
+		_, err := manager.Create(ctx, &model.CreateSessionRequest{
+			Command:     "/usr/bin/sleep 10",
+			UserID:      "user1",
+			MaxDuration: -time.Second,
+		})
+		if err != model.ErrInvalidMaxDuration {
+			t.Errorf("Expected ErrInvalidMaxDuration, got %v", err)
+		}
+	})
+}
+
 func TestManager_CreateDriver(t *testing.T) {
 	manager, cleanup := setupTestManager(t)
 	defer cleanup()
@@ -359,8 +731,23 @@ func TestManager_CreateDriver(t *testing.T) {
 			expectType: "claude",
 		},
 		{
-			name:       "generic command",
+			name:       "gemini command",
+			command:    "gemini --yolo",
+			expectType: "gemini",
+		},
+		{
+			name:       "shell command",
 			command:    "bash",
+			expectType: "bash",
+		},
+		{
+			name:       "shell with path",
+			command:    "/usr/bin/zsh -l",
+			expectType: "bash",
+		},
+		{
+			name:       "generic command",
+			command:    "htop",
 			expectType: "generic",
 		},
 	}
@@ -415,6 +802,67 @@ func TestManager_ProcessExit(t *testing.T) {
 	}
 }
 
+// resetCountingDriver is a GenericDriver that counts calls to Reset.
+type resetCountingDriver struct {
+	*driver.GenericDriver
+	resets atomic.Int32
+}
+
+func (d *resetCountingDriver) Reset() {
+	d.resets.Add(1)
+}
+
+func TestManager_RestartUsesFreshState(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	registry := driver.NewRegistry()
+	registry.Register("resettable", driver.CommandContains("echo"), func() driver.AgentDriver {
+		return &resetCountingDriver{GenericDriver: driver.NewGenericDriver()}
+	})
+	manager.driverRegistry = registry
+
+	ctx := context.Background()
+	created, err := manager.Create(ctx, &model.CreateSessionRequest{
+		Command: "/usr/bin/echo before restart",
+		UserID:  "user1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	old, _ := manager.GetContext(created.ID)
+	oldProcess, oldDriver := old.PTYProcess, old.Driver
+
+	// Wait for the process to exit with its output buffered
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.IsSessionRunning(created.ID) || oldProcess.RingBuffer.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected process to exit with buffered output")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := manager.Restart(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to restart session: %v", err)
+	}
+
+	sessionCtx, _ := manager.GetContext(created.ID)
+	if sessionCtx.PTYProcess == oldProcess || sessionCtx.PTYProcess.RingBuffer == oldProcess.RingBuffer {
+		t.Error("Expected restart to use a new process and ring buffer")
+	}
+	if origin, cursor := sessionCtx.PTYProcess.RingBuffer.Origin(), oldProcess.RingBuffer.Cursor(); origin != cursor {
+		t.Errorf("Expected the new ring buffer to continue from cursor %d, got %d", cursor, origin)
+	}
+	newDriver, ok := sessionCtx.Driver.(*resetCountingDriver)
+	if !ok || sessionCtx.Driver == oldDriver {
+		t.Fatalf("Expected restart to use a new driver, got %T", sessionCtx.Driver)
+	}
+	if n := newDriver.resets.Load(); n != 0 {
+		t.Errorf("Expected the new driver to need no reset, got %d resets", n)
+	}
+}
+
 func TestManager_LogFilePath(t *testing.T) {
 	manager, cleanup := setupTestManager(t)
 	defer cleanup()
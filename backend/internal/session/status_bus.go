@@ -0,0 +1,74 @@
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
+)
+
+// statusBufferSize is how many status events a subscriber may fall behind
+// before further events are dropped.
+const statusBufferSize = 16
+
+// StatusDeleted is the status published when a session is deleted. It is
+// the session's last event and is never stored.
+const StatusDeleted model.SessionStatus = "deleted"
+
+// StatusEvent is a session status change published on a StatusBus.
+type StatusEvent struct {
+	SessionID string              `json:"-"`
+	Status    model.SessionStatus `json:"status"`
+	PID       *int                `json:"pid,omitempty"`
+	ExitCode  *int                `json:"exitCode,omitempty"`
+}
+
+// statusSubscription is a subscriber's channel for one session.
+type statusSubscription struct {
+	sessionID string
+	ch        chan StatusEvent
+}
+
+// StatusBus is an in-process pub/sub of session status changes.
+type StatusBus struct {
+	subscribers sync.Map // subscription ID -> *statusSubscription
+	nextID      atomic.Uint64
+}
+
+// NewStatusBus creates an empty StatusBus.
+func NewStatusBus() *StatusBus {
+	return &StatusBus{}
+}
+
+// Subscribe returns a channel receiving the status changes of a session and
+// a function that unsubscribes. The channel is never closed; stop reading
+// it after unsubscribing. Events are dropped for a subscriber that falls
+// too far behind.
+func (b *StatusBus) Subscribe(sessionID string) (<-chan StatusEvent, func()) {
+	id := b.nextID.Add(1)
+	sub := &statusSubscription{
+		sessionID: sessionID,
+		ch:        make(chan StatusEvent, statusBufferSize),
+	}
+	b.subscribers.Store(id, sub)
+
+	return sub.ch, func() {
+		b.subscribers.Delete(id)
+	}
+}
+
+// Publish sends event to the subscribers of its session without blocking.
+func (b *StatusBus) Publish(event StatusEvent) {
+	b.subscribers.Range(func(_, value any) bool {
+		sub := value.(*statusSubscription)
+		if sub.sessionID != event.SessionID {
+			return true
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Subscriber is not keeping up
+		}
+		return true
+	})
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
+)
+
+func TestStatusBus(t *testing.T) {
+	bus := NewStatusBus()
+
+	events, unsubscribe := bus.Subscribe("s1")
+	other, unsubscribeOther := bus.Subscribe("s2")
+	defer unsubscribeOther()
+
+	bus.Publish(StatusEvent{SessionID: "s1", Status: model.SessionStatusExited})
+
+	select {
+	case event := <-events:
+		if event.Status != model.SessionStatusExited {
+			t.Errorf("Expected status 'exited', got '%s'", event.Status)
+		}
+	default:
+		t.Fatal("Expected subscriber to receive the event")
+	}
+
+	select {
+	case event := <-other:
+		t.Errorf("Expected no event for another session, got %+v", event)
+	default:
+	}
+
+	// A subscriber that does not read does not block publishers
+	for i := 0; i < statusBufferSize*2; i++ {
+		bus.Publish(StatusEvent{SessionID: "s1", Status: model.SessionStatusRunning})
+	}
+	if len(events) != statusBufferSize {
+		t.Errorf("Expected %d buffered events, got %d", statusBufferSize, len(events))
+	}
+
+	// Unsubscribing stops delivery
+	for len(events) > 0 {
+		<-events
+	}
+	unsubscribe()
+	bus.Publish(StatusEvent{SessionID: "s1", Status: model.SessionStatusFailed})
+	if len(events) != 0 {
+		t.Error("Expected no events after unsubscribing")
+	}
+}
+
+func TestManager_StatusEvents(t *testing.T) {
+	manager, cleanup := setupTestManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// The session ID is only known once Create has published its running
+	// event, so watch the exit and restart that follow
+	created, err := manager.Create(ctx, &model.CreateSessionRequest{
+		Command: "/usr/bin/sleep 30",
+		UserID:  "user1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	events, unsubscribe := manager.StatusBus().Subscribe(created.ID)
+	defer unsubscribe()
+
+	sessionCtx, _ := manager.GetContext(created.ID)
+	sessionCtx.PTYProcess.Close()
+
+	select {
+	case event := <-events:
+		if event.Status != model.SessionStatusExited && event.Status != model.SessionStatusFailed {
+			t.Errorf("Expected an exit status, got '%s'", event.Status)
+		}
+		if event.ExitCode == nil {
+			t.Error("Expected exit code in exit event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a status event when the process exits")
+	}
+
+	if _, err := manager.Restart(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to restart session: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Status != model.SessionStatusRunning || event.PID == nil {
+			t.Errorf("Expected running event with a PID, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a status event when the session restarts")
+	}
+
+	if err := manager.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+
+	// Closing the restarted process may report its exit first
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Status == StatusDeleted {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected a deleted status event when the session is deleted")
+		}
+	}
+}
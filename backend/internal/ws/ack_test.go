@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// expectAck reads the client's next message and checks that it acknowledges
+// the message with the given ID.
+func expectAck(t *testing.T, client *Client, id, state, code string) {
+	t.Helper()
+	msg := receiveMessage(t, client, time.Second)
+	if msg == nil || msg.Type != MessageTypeAck || msg.ID != id {
+		t.Fatalf("Expected ack for %q, got %+v", id, msg)
+	}
+	if msg.State != state || msg.ErrorCode != code {
+		t.Errorf("Expected ack %q with code %q, got %q with code %q", state, code, msg.State, msg.ErrorCode)
+	}
+}
+
+// TestAckSerialization tests the JSON encoding of ack messages
+func TestAckSerialization(t *testing.T) {
+	tests := []struct {
+		msg      Message
+		expected string
+	}{
+		{
+			Message{Type: MessageTypeAck, ID: "m1", State: AckDelivered},
+			`{"type":"ack","state":"delivered","id":"m1"}`,
+		},
+		{
+			Message{Type: MessageTypeAck, ID: "m2", State: AckFailed, Error: "Failed to write input to the terminal", ErrorCode: ErrorCodeProcessExited},
+			`{"type":"ack","state":"failed","error":"Failed to write input to the terminal","errorCode":"PROCESS_EXITED","id":"m2"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.msg)
+		if err != nil {
+			t.Fatalf("failed to marshal %+v: %v", tt.msg, err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, data)
+		}
+	}
+}
+
+// TestAcknowledgedInput tests that stdin and command messages with an ID are
+// acknowledged once written, and fail with PROCESS_EXITED after the process
+// is closed
+func TestAcknowledgedInput(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-ack"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:     &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		InputDelays: pty.InputDelays{Clear: 10 * time.Millisecond, Text: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	other := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+	hub.Register(other)
+
+	handler.handleMessage(client, &Message{Type: MessageTypeStdin, Data: "a", ID: "s1"}, ptyProcess)
+	expectAck(t, client, "s1", AckDelivered, "")
+	handler.handleMessage(client, &Message{Type: MessageTypeCommand, Data: "echo hi", ID: "c1"}, ptyProcess)
+	expectAck(t, client, "c1", AckDelivered, "")
+
+	// Without an ID, a successful write is not acknowledged
+	handler.handleMessage(client, &Message{Type: MessageTypeStdin, Data: "b"}, ptyProcess)
+	if msg := receiveMessage(t, client, 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no reply without an id, got %+v", msg)
+	}
+
+	if err := ptyProcess.Close(); err != nil {
+		t.Fatalf("failed to close PTY: %v", err)
+	}
+
+	handler.handleMessage(client, &Message{Type: MessageTypeStdin, Data: "a", ID: "s2"}, ptyProcess)
+	expectAck(t, client, "s2", AckFailed, ErrorCodeProcessExited)
+	handler.handleMessage(client, &Message{Type: MessageTypeCommand, Data: "echo hi", ID: "c2"}, ptyProcess)
+	expectAck(t, client, "c2", AckFailed, ErrorCodeProcessExited)
+
+	// Without an ID, a failure is still reported as an error
+	handler.handleMessage(client, &Message{Type: MessageTypeStdin, Data: "a"}, ptyProcess)
+	expectError(t, client, ErrorCodeProcessExited, MessageTypeStdin)
+
+	// Acks go to the sender only
+	if msg := receiveMessage(t, other, 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no message for the other client, got %+v", msg)
+	}
+}
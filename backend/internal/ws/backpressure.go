@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+)
+
+// BackpressurePolicy decides what happens when a client's send queue is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureDisconnect closes the client when its queue is full.
+	BackpressureDisconnect BackpressurePolicy = iota
+
+	// BackpressureBlock waits up to the block timeout for queue space,
+	// then disconnects the client. Broadcasts wait without holding the
+	// hub's client list, so clients can still join and leave meanwhile,
+	// but later broadcasts of the hub queue up behind the wait.
+	BackpressureBlock
+
+	// BackpressureDropOldest discards the oldest queued stdout frame to make
+	// room for the new one and counts the drop. Control messages are never
+	// dropped; if no stdout frame can be dropped the client is disconnected.
+	BackpressureDropOldest
+)
+
+// DefaultBlockTimeout is how long BackpressureBlock waits for queue space.
+const DefaultBlockTimeout = 100 * time.Millisecond
+
+// String returns the configuration name of the policy.
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDropOldest:
+		return "drop_oldest"
+	default:
+		return "disconnect"
+	}
+}
+
+// ParseBackpressurePolicy parses a policy name as returned by String.
+func ParseBackpressurePolicy(name string) (BackpressurePolicy, error) {
+	switch name {
+	case "disconnect":
+		return BackpressureDisconnect, nil
+	case "block":
+		return BackpressureBlock, nil
+	case "drop_oldest":
+		return BackpressureDropOldest, nil
+	default:
+		return BackpressureDisconnect, fmt.Errorf("unknown backpressure policy: %s", name)
+	}
+}
+
+// ClientStats is a snapshot of a client's send queue.
+type ClientStats struct {
+	// Queued is the number of frames waiting to be written.
+	Queued int `json:"queued"`
+
+	// Dropped is the total number of frames discarded by BackpressureDropOldest.
+	Dropped uint64 `json:"dropped"`
+
+	// DroppedBytes is the total payload size of the dropped frames.
+	DroppedBytes uint64 `json:"dropped_bytes"`
+}
@@ -0,0 +1,243 @@
+package ws
+
+import (
+	"bytes"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultCoalesceWindow is the suggested time to hold stdout chunks
+	// before broadcasting them as one message (about one 60Hz frame).
+	DefaultCoalesceWindow = 16 * time.Millisecond
+
+	// DefaultCoalesceMaxBytes is the suggested pending output size that
+	// triggers an immediate flush.
+	DefaultCoalesceMaxBytes = 32 * 1024
+
+	// maxHeldSequence is the longest unfinished escape sequence held back
+	// by a flush at CoalesceMaxBytes; longer ones are sent as they are.
+	maxHeldSequence = 512
+)
+
+// outputCoalescer collects stdout chunks for one session until the
+// coalescing window elapses or enough bytes are pending.
+type outputCoalescer struct {
+	mu     sync.Mutex
+	data   []byte
+	cursor int64 // Ring buffer cursor after the last pending chunk
+	timer  *time.Timer
+}
+
+// coalescer returns the session's output coalescer, creating it if needed.
+func (h *Handler) coalescer(sessionID string) *outputCoalescer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.coalescers == nil {
+		h.coalescers = make(map[string]*outputCoalescer)
+	}
+	c, ok := h.coalescers[sessionID]
+	if !ok {
+		c = &outputCoalescer{}
+		h.coalescers[sessionID] = c
+	}
+	return c
+}
+
+// queueOutput adds a chunk to the session's pending output. The output is
+// broadcast when flushNow is set, when CoalesceMaxBytes is reached, or when
+// the CoalesceWindow timer fires. The size and timer flushes fall between
+// chunks of the PTY's output, so they keep back an escape sequence or UTF-8
+// character left unfinished at the end until the next flush.
+func (h *Handler) queueOutput(hub *Hub, sessionID string, data []byte, cursor int64, flushNow bool) error {
+	c := h.coalescer(sessionID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data = append(c.data, data...)
+	c.cursor = cursor
+
+	if flushNow {
+		return c.flushLocked(hub)
+	}
+	if h.CoalesceMaxBytes > 0 && len(c.data) >= h.CoalesceMaxBytes {
+		if err := c.flushCompleteLocked(hub); err != nil || len(c.data) == 0 {
+			return err
+		}
+	}
+
+	if c.timer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(h.CoalesceWindow, func() {
+			h.flushTimer(sessionID, c, &timer)
+		})
+		c.timer = timer
+	}
+	return nil
+}
+
+// flushTimer broadcasts the pending output when its flush timer fires,
+// unless it was flushed since. An unfinished escape sequence or UTF-8
+// character is kept and goes out with the next output. timer is only read
+// under c.mu, which queueOutput holds while setting it.
+func (h *Handler) flushTimer(sessionID string, c *outputCoalescer, timer **time.Timer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != *timer {
+		return
+	}
+	c.timer = nil
+
+	hub := h.hubManager.Get(sessionID)
+	if hub == nil {
+		c.reset()
+		return
+	}
+	c.flushCompleteLocked(hub)
+}
+
+// FlushOutput immediately broadcasts any stdout held back by coalescing,
+// except an escape sequence or UTF-8 character left unfinished at the end.
+// Status and error broadcasts call it first so the output of a session is
+// never delayed behind them; StopCoalescing also sends the unfinished end.
+func (h *Handler) FlushOutput(sessionID string) error {
+	return h.flushOutput(sessionID, false)
+}
+
+// flushOutput broadcasts the session's pending output, including an
+// unfinished end if force is set.
+func (h *Handler) flushOutput(sessionID string, force bool) error {
+	h.mu.RLock()
+	c := h.coalescers[sessionID]
+	h.mu.RUnlock()
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hub := h.hubManager.Get(sessionID)
+	if hub == nil {
+		// Nobody to deliver to; the output is still in the ring buffer
+		c.reset()
+		return nil
+	}
+	if force {
+		return c.flushLocked(hub)
+	}
+	return c.flushCompleteLocked(hub)
+}
+
+// StopCoalescing broadcasts all stdout held back by coalescing for the
+// session and drops its pending output state. Call it once the session's
+// process has exited, or its output is no longer watched and before its hub
+// is removed.
+func (h *Handler) StopCoalescing(sessionID string) error {
+	err := h.flushOutput(sessionID, true)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.coalescers, sessionID)
+	return err
+}
+
+// flushLocked broadcasts the pending output as one stdout message.
+// The caller must hold c.mu, which keeps flushes in order.
+func (c *outputCoalescer) flushLocked(hub *Hub) error {
+	data, cursor := c.data, c.cursor
+	c.reset()
+	return broadcastStdout(hub, data, cursor)
+}
+
+// flushCompleteLocked is like flushLocked, but keeps an escape sequence or
+// UTF-8 character left unfinished at the end of the pending output, and the
+// flush timer, for the next flush. The caller must hold c.mu.
+func (c *outputCoalescer) flushCompleteLocked(hub *Hub) error {
+	held := incompleteTail(c.data)
+	if held == 0 {
+		return c.flushLocked(hub)
+	}
+	n := len(c.data) - held
+	if n == 0 {
+		return nil
+	}
+
+	data, cursor := c.data[:n], c.cursor-int64(held)
+	c.data = append([]byte(nil), c.data[n:]...)
+	return broadcastStdout(hub, data, cursor)
+}
+
+// broadcastStdout broadcasts output ending at the ring buffer cursor as a
+// stdout message, unless it is empty.
+func broadcastStdout(hub *Hub, data []byte, cursor int64) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return hub.BroadcastMessage(&Message{
+		Type:   MessageTypeStdout,
+		Data:   string(data),
+		Cursor: cursor,
+	})
+}
+
+// incompleteTail returns the length of the escape sequence or UTF-8
+// character that data ends in the middle of, or 0 if it ends on a boundary.
+// Escape sequences are only recognised in the last maxHeldSequence bytes.
+func incompleteTail(data []byte) int {
+	window := data[max(len(data)-maxHeldSequence, 0):]
+	if i := bytes.LastIndexByte(window, 0x1b); i >= 0 && !escapeComplete(window[i+1:]) {
+		return len(window) - i
+	}
+
+	// A UTF-8 character is at most utf8.UTFMax bytes long
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return len(data) - i
+			}
+			break
+		}
+	}
+	return 0
+}
+
+// escapeComplete reports whether seq, the bytes after an ESC, completes the
+// escape sequence: a CSI sequence needs its final byte, an OSC, DCS, SOS, PM
+// or APC string its BEL or ST terminator, and other sequences a final byte
+// after any intermediate bytes. An ST's own ESC is a complete sequence.
+func escapeComplete(seq []byte) bool {
+	if len(seq) == 0 {
+		return false
+	}
+	switch seq[0] {
+	case '[':
+		for _, b := range seq[1:] {
+			if b >= 0x40 && b <= 0x7e {
+				return true
+			}
+		}
+		return false
+	case ']', 'P', 'X', '^', '_':
+		// Terminated by BEL here; an ESC \ terminator would be the last ESC
+		return bytes.IndexByte(seq, 0x07) >= 0
+	default:
+		for _, b := range seq {
+			if b < 0x20 || b > 0x2f {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// reset drops pending output and stops the flush timer.
+func (c *outputCoalescer) reset() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.data = nil
+}
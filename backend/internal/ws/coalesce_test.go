@@ -0,0 +1,299 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// newCoalescingHandler returns a handler with coalescing enabled and a
+// registered client for sessionID.
+func newCoalescingHandler(t testing.TB, sessionID string, window time.Duration, maxBytes int) (*Handler, *Client) {
+	t.Helper()
+	hubManager := NewHubManager()
+	t.Cleanup(hubManager.Close)
+
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+	handler.CoalesceWindow = window
+	handler.CoalesceMaxBytes = maxBytes
+
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+	return handler, client
+}
+
+// receiveMessage reads the next JSON message queued for the client.
+func receiveMessage(t *testing.T, client *Client, timeout time.Duration) *Message {
+	t.Helper()
+	data := receiveWithTimeoutTest(t, client, timeout)
+	if data == nil {
+		return nil
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return &msg
+}
+
+func TestCoalesceOutput_Window(t *testing.T) {
+	handler, client := newCoalescingHandler(t, "coalesce-window", 30*time.Millisecond, 0)
+
+	for _, b := range []byte("spinner") {
+		handler.BroadcastOutput("coalesce-window", []byte{b})
+	}
+
+	msg := receiveMessage(t, client, time.Second)
+	if msg == nil || msg.Type != MessageTypeStdout || msg.Data != "spinner" {
+		t.Fatalf("Expected one coalesced stdout message, got %+v", msg)
+	}
+	if extra := receiveMessage(t, client, 60*time.Millisecond); extra != nil {
+		t.Errorf("Expected no further messages, got %+v", extra)
+	}
+}
+
+func TestCoalesceOutput_MaxBytes(t *testing.T) {
+	handler, client := newCoalescingHandler(t, "coalesce-max", time.Hour, 4)
+
+	handler.BroadcastOutput("coalesce-max", []byte("ab"))
+	if msg := receiveMessage(t, client, 20*time.Millisecond); msg != nil {
+		t.Fatalf("Expected output to be held, got %+v", msg)
+	}
+
+	handler.BroadcastOutput("coalesce-max", []byte("cd"))
+	msg := receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Data != "abcd" {
+		t.Fatalf("Expected flush at max bytes, got %+v", msg)
+	}
+}
+
+func TestCoalesceOutput_FlushBeforeStatus(t *testing.T) {
+	handler, client := newCoalescingHandler(t, "coalesce-status", time.Hour, 0)
+
+	handler.BroadcastOutput("coalesce-status", []byte("final output"))
+	handler.BroadcastStatus("coalesce-status", "exited", nil)
+
+	expected := []struct {
+		msgType MessageType
+		data    string
+	}{
+		{MessageTypeStdout, "final output"},
+		{MessageTypeStatus, ""},
+	}
+	for _, e := range expected {
+		msg := receiveMessage(t, client, 100*time.Millisecond)
+		if msg == nil || msg.Type != e.msgType || msg.Data != e.data {
+			t.Fatalf("Expected %s %q, got %+v", e.msgType, e.data, msg)
+		}
+	}
+}
+
+func TestCoalesceOutput_FlushBeforeSmartEvent(t *testing.T) {
+	handler, client := newCoalescingHandler(t, "coalesce-event", time.Hour, 0)
+	handler.SetSessionDriver("coalesce-event", driver.NewClaudeDriver())
+
+	handler.BroadcastOutput("coalesce-event", []byte("Working... "))
+	handler.BroadcastOutput("coalesce-event", []byte("Continue? (y/n)"))
+
+	stdout := receiveMessage(t, client, 100*time.Millisecond)
+	if stdout == nil || stdout.Type != MessageTypeStdout || stdout.Data != "Working... Continue? (y/n)" {
+		t.Fatalf("Expected stdout flushed before the event, got %+v", stdout)
+	}
+	event := receiveMessage(t, client, 100*time.Millisecond)
+	if event == nil || event.Type != MessageTypeSmartEvent {
+		t.Fatalf("Expected smart event after stdout, got %+v", event)
+	}
+}
+
+// benchmarkBroadcastOutput broadcasts single-byte chunks and reports the
+// number of frames queued per second.
+func benchmarkBroadcastOutput(b *testing.B, window time.Duration) {
+	sessionID := "bench-session"
+	handler, client := newCoalescingHandler(b, sessionID, window, DefaultCoalesceMaxBytes)
+	client.policy, client.blockTimeout = BackpressureBlock, time.Minute
+
+	frames := 0
+	done := make(chan struct{})
+	go func() {
+		for range client.SendChan() {
+			frames++
+		}
+		close(done)
+	}()
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		handler.BroadcastOutput(sessionID, []byte{'.'})
+	}
+	handler.FlushOutput(sessionID)
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	client.Close()
+	<-done
+	b.ReportMetric(float64(frames)/elapsed.Seconds(), "frames/s")
+	b.ReportMetric(float64(frames)/float64(b.N), "frames/op")
+}
+
+func BenchmarkBroadcastOutput_NoCoalescing(b *testing.B) {
+	benchmarkBroadcastOutput(b, 0)
+}
+
+func BenchmarkBroadcastOutput_Coalescing(b *testing.B) {
+	benchmarkBroadcastOutput(b, DefaultCoalesceWindow)
+}
+
+func TestIncompleteTail(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		held int
+	}{
+		{"plain", "hello", 0},
+		{"empty", "", 0},
+		{"lone escape", "ab\x1b", 1},
+		{"csi without final byte", "ab\x1b[38;5", 6},
+		{"complete csi", "ab\x1b[31m", 0},
+		{"csi followed by text", "\x1b[2Jcleared", 0},
+		{"osc without terminator", "\x1b]0;title", 9},
+		{"osc ended by bel", "\x1b]0;title\x07", 0},
+		{"osc ended by st", "\x1b]0;title\x1b\\", 0},
+		{"charset designation", "\x1b(", 2},
+		{"complete charset designation", "\x1b(B", 0},
+		{"two-byte escape", "\x1b7", 0},
+		{"split utf-8", "caf\xc3", 1},
+		{"split 4-byte utf-8", "\xf0\x9f\x98", 3},
+		{"complete utf-8", "café", 0},
+		{"invalid utf-8", "ab\x80", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if held := incompleteTail([]byte(tt.data)); held != tt.held {
+				t.Errorf("incompleteTail(%q) = %d, want %d", tt.data, held, tt.held)
+			}
+		})
+	}
+}
+
+func TestCoalesceOutput_MaxBytesKeepsSequences(t *testing.T) {
+	handler, client := newCoalescingHandler(t, "coalesce-sequences", time.Hour, 8)
+
+	// The limit falls inside an SGR sequence, which waits for its end
+	handler.BroadcastOutput("coalesce-sequences", []byte("plain \x1b[3"))
+	msg := receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Data != "plain " {
+		t.Fatalf("Expected output up to the escape sequence, got %+v", msg)
+	}
+	handler.BroadcastOutput("coalesce-sequences", []byte("1mred"))
+	msg = receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Data != "\x1b[31mred" {
+		t.Fatalf("Expected the whole escape sequence, got %+v", msg)
+	}
+
+	// Likewise a UTF-8 character
+	handler.BroadcastOutput("coalesce-sequences", []byte("1234567\xc3"))
+	msg = receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Data != "1234567" {
+		t.Fatalf("Expected output up to the character, got %+v", msg)
+	}
+	handler.BroadcastOutput("coalesce-sequences", []byte("\xa9!"))
+	handler.FlushOutput("coalesce-sequences")
+	msg = receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Data != "é!" {
+		t.Fatalf("Expected the whole character, got %+v", msg)
+	}
+}
+
+// TestCoalesceOutput_KeepsSequences tests that timer and explicit flushes
+// also keep an unfinished escape sequence, and StopCoalescing sends it
+func TestCoalesceOutput_KeepsSequences(t *testing.T) {
+	handler, client := newCoalescingHandler(t, "coalesce-timer-sequences", 20*time.Millisecond, 0)
+
+	handler.BroadcastOutput("coalesce-timer-sequences", []byte("plain \x1b[3"))
+	msg := receiveMessage(t, client, time.Second)
+	if msg == nil || msg.Data != "plain " {
+		t.Fatalf("Expected the timer to flush up to the escape sequence, got %+v", msg)
+	}
+	if msg := receiveMessage(t, client, 60*time.Millisecond); msg != nil {
+		t.Fatalf("Expected the escape sequence to be held, got %+v", msg)
+	}
+	handler.BroadcastOutput("coalesce-timer-sequences", []byte("1mred"))
+	msg = receiveMessage(t, client, time.Second)
+	if msg == nil || msg.Data != "\x1b[31mred" {
+		t.Fatalf("Expected the whole escape sequence, got %+v", msg)
+	}
+
+	handler.BroadcastOutput("coalesce-timer-sequences", []byte("more \x1b]0;ti"))
+	handler.FlushOutput("coalesce-timer-sequences")
+	msg = receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Data != "more " {
+		t.Fatalf("Expected the flush to keep the escape sequence, got %+v", msg)
+	}
+	handler.StopCoalescing("coalesce-timer-sequences")
+	msg = receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Data != "\x1b]0;ti" {
+		t.Fatalf("Expected StopCoalescing to send the unfinished sequence, got %+v", msg)
+	}
+}
+
+func TestCoalesceOutput_FlushOnExit(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	service := NewService(ptyManager, driver.NewGenericDriver())
+	defer service.Close()
+	service.Handler().CoalesceWindow = time.Hour
+
+	sessionID := "coalesce-exit"
+	hub := service.HubManager().GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	session := &model.Session{ID: sessionID, UserID: "test-user", Command: "printf 'last words'"}
+	if _, err := service.AttachSession(context.Background(), session, pty.SpawnOptions{Session: session}); err != nil {
+		t.Fatalf("failed to attach session: %v", err)
+	}
+
+	stdout := receiveMessage(t, client, 2*time.Second)
+	if stdout == nil || stdout.Type != MessageTypeStdout || !strings.Contains(stdout.Data, "last words") {
+		t.Fatalf("Expected the output flushed on exit, got %+v", stdout)
+	}
+	status := receiveMessage(t, client, time.Second)
+	if status == nil || status.Type != MessageTypeStatus || status.State != string(model.SessionStatusExited) {
+		t.Fatalf("Expected exited status after the output, got %+v", status)
+	}
+}
+
+func TestCoalesceOutput_FlushOnDetach(t *testing.T) {
+	service := NewService(pty.NewManager(t.TempDir()), driver.NewGenericDriver())
+	defer service.Close()
+	service.Handler().CoalesceWindow = time.Hour
+
+	sessionID := "coalesce-detach"
+	hub := service.HubManager().GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	service.Handler().BroadcastOutput(sessionID, []byte("goodbye"))
+	service.DetachSession(sessionID)
+
+	msg := receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Type != MessageTypeStdout || msg.Data != "goodbye" {
+		t.Fatalf("Expected pending output before the hub closed, got %+v", msg)
+	}
+	service.Handler().mu.RLock()
+	_, ok := service.Handler().coalescers[sessionID]
+	service.Handler().mu.RUnlock()
+	if ok {
+		t.Error("Expected the session's coalescer to be dropped")
+	}
+}
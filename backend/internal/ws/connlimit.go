@@ -0,0 +1,114 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// DefaultMaxConnsPerUser is the default number of WebSocket connections a
+// user may have open across all sessions and the session feed.
+const DefaultMaxConnsPerUser = 50
+
+// userConns counts the open WebSocket connections of each user. The zero
+// value is ready to use.
+type userConns struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// acquire counts a connection of userID unless the user already has limit
+// connections; a limit below 1 means no limit. It returns a function that
+// releases the connection, which may be called more than once, and false
+// if the user is at the limit.
+func (u *userConns) acquire(userID string, limit int) (func(), bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if limit > 0 && u.counts[userID] >= limit {
+		return nil, false
+	}
+	if u.counts == nil {
+		u.counts = make(map[string]int)
+	}
+	u.counts[userID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { u.release(userID) })
+	}, true
+}
+
+// release uncounts a connection of userID, dropping users without any.
+func (u *userConns) release(userID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.counts[userID] <= 1 {
+		delete(u.counts, userID)
+		return
+	}
+	u.counts[userID]--
+}
+
+// count returns the number of open connections of userID.
+func (u *userConns) count(userID string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.counts[userID]
+}
+
+// snapshot returns the number of open connections of each user with any.
+func (u *userConns) snapshot() map[string]int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	counts := make(map[string]int, len(u.counts))
+	for userID, n := range u.counts {
+		counts[userID] = n
+	}
+	return counts
+}
+
+// maxConnsPerUser returns MaxConnsPerUser, or its default if unset.
+func (h *Handler) maxConnsPerUser() int {
+	if h.MaxConnsPerUser == 0 {
+		return DefaultMaxConnsPerUser
+	}
+	return h.MaxConnsPerUser
+}
+
+// acquireConn counts a new connection of userID against MaxConnsPerUser.
+// If the user is at the limit it writes a 429 response and returns false;
+// otherwise the returned function must be called once the connection is
+// closed or fails to open.
+func (h *Handler) acquireConn(w http.ResponseWriter, userID string) (func(), bool) {
+	release, ok := h.conns.acquire(userID, h.maxConnsPerUser())
+	if !ok {
+		h.logger.Warn("Rejected WebSocket connection: too many connections", "user_id", userID)
+		writeTooManyConnections(w)
+	}
+	return release, ok
+}
+
+// UserConnectionCount returns the number of open WebSocket connections of
+// userID, to sessions and the session feed.
+func (h *Handler) UserConnectionCount(userID string) int {
+	return h.conns.count(userID)
+}
+
+// UserConnectionCounts returns the number of open WebSocket connections of
+// each user that has any.
+func (h *Handler) UserConnectionCounts() map[string]int {
+	return h.conns.snapshot()
+}
+
+// writeTooManyConnections writes a 429 response with a JSON error body in
+// the format used by the HTTP API.
+func writeTooManyConnections(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"code":    ErrorCodeTooManyConnections,
+			"message": "Too many WebSocket connections for this user",
+		},
+	})
+}
@@ -0,0 +1,247 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// TestUserConnsConcurrent hammers acquiring and releasing connections of a
+// few users and checks the limit holds and the counts return to zero
+func TestUserConnsConcurrent(t *testing.T) {
+	const limit = 5
+	var conns userConns
+	users := []string{"alice", "bob", "carol"}
+
+	var over atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func(userID string) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				release, ok := conns.acquire(userID, limit)
+				if !ok {
+					continue
+				}
+				if conns.count(userID) > limit {
+					over.Add(1)
+				}
+				release()
+				release() // Releasing twice must not free another slot
+			}
+		}(users[i%len(users)])
+	}
+	wg.Wait()
+
+	if over.Load() != 0 {
+		t.Errorf("Expected at most %d connections per user, exceeded %d times", limit, over.Load())
+	}
+	if counts := conns.snapshot(); len(counts) != 0 {
+		t.Errorf("Expected no connections left, got %v", counts)
+	}
+
+	// Users are limited independently, and no limit admits any number
+	for i := 0; i < limit; i++ {
+		if _, ok := conns.acquire("alice", limit); !ok {
+			t.Fatalf("Expected connection %d of alice to be admitted", i+1)
+		}
+	}
+	if _, ok := conns.acquire("alice", limit); ok {
+		t.Error("Expected alice to be at the limit")
+	}
+	if _, ok := conns.acquire("bob", limit); !ok {
+		t.Error("Expected bob to be admitted while alice is at the limit")
+	}
+	if _, ok := conns.acquire("alice", -1); !ok {
+		t.Error("Expected a negative limit to admit alice")
+	}
+	if n := conns.count("alice"); n != limit+1 {
+		t.Errorf("Expected %d connections of alice, got %d", limit+1, n)
+	}
+}
+
+// connLimitServer serves attaching to sessionID on /attach and the session
+// feed on /feed, as the user named by the ?user= query parameter.
+func connLimitServer(t *testing.T, service *Service, sessionID string) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/attach", func(w http.ResponseWriter, r *http.Request) {
+		service.Handler().HandleConnection(w, r, sessionID, r.URL.Query().Get("user"))
+	})
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		service.HandleSessionFeed(w, r, r.URL.Query().Get("user"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// waitForConnections waits until userID has n open connections.
+func waitForConnections(t *testing.T, handler *Handler, userID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for handler.UserConnectionCount(userID) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d connections of %s, got %d", n, userID, handler.UserConnectionCount(userID))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectTooManyConnections checks that dialing url is refused with a 429
+// TOO_MANY_CONNECTIONS error.
+func expectTooManyConnections(t *testing.T, url string) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("Expected dial to fail when the user is at the limit")
+	}
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 response, got %+v", resp)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error.Code != ErrorCodeTooManyConnections {
+		t.Errorf("Expected %s error body, got %+v (%v)", ErrorCodeTooManyConnections, body, err)
+	}
+}
+
+// TestMaxConnsPerUser tests that a user's session and feed connections
+// share one limit, and that closed and failed connections free their slot
+func TestMaxConnsPerUser(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-conns-per-user"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	service := NewService(ptyManager, nil)
+	defer service.Close()
+	handler := service.Handler()
+	handler.MaxConnsPerUser = 3
+	base := "ws" + strings.TrimPrefix(connLimitServer(t, service, sessionID), "http")
+	attachURL := base + "/attach?user=test-user"
+	feedURL := base + "/feed?user=test-user"
+
+	var conns []*websocket.Conn
+	for _, url := range []string{attachURL, attachURL, feedURL} {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("failed to dial %s: %v", url, err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	waitForConnections(t, handler, "test-user", 3)
+
+	expectTooManyConnections(t, attachURL)
+	expectTooManyConnections(t, feedURL)
+
+	// Other users have their own limit
+	other, _, err := websocket.DefaultDialer.Dial(base+"/feed?user=other-user", nil)
+	if err != nil {
+		t.Fatalf("failed to dial feed of another user: %v", err)
+	}
+	defer other.Close()
+	waitForConnections(t, handler, "other-user", 1)
+	if counts := service.UserConnectionCounts(); counts["test-user"] != 3 || counts["other-user"] != 1 {
+		t.Errorf("Expected 3 and 1 connections, got %v", counts)
+	}
+
+	// Dropping a connection without a close frame ends its read pump with
+	// an error, which frees the slot
+	conns[0].Close()
+	waitForConnections(t, handler, "test-user", 2)
+	conn, _, err := websocket.DefaultDialer.Dial(attachURL, nil)
+	if err != nil {
+		t.Fatalf("failed to dial after a connection closed: %v", err)
+	}
+	defer conn.Close()
+	waitForConnections(t, handler, "test-user", 3)
+
+	// A failed upgrade does not hold a slot
+	conns[2].Close()
+	waitForConnections(t, handler, "test-user", 2)
+	resp, err := http.Get("http" + strings.TrimPrefix(attachURL, "ws"))
+	if err != nil {
+		t.Fatalf("failed to send plain request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the plain request to fail the upgrade, got %d", resp.StatusCode)
+	}
+	if n := handler.UserConnectionCount("test-user"); n != 2 {
+		t.Errorf("Expected a failed upgrade to release its slot, got %d connections", n)
+	}
+}
+
+// TestMaxConnsPerUserConcurrent hammers the session feed with concurrent
+// connections of one user and checks exactly the limit are admitted and
+// all are released once closed
+func TestMaxConnsPerUserConcurrent(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	service := NewService(ptyManager, nil)
+	defer service.Close()
+	handler := service.Handler()
+	handler.MaxConnsPerUser = 5
+	feedURL := "ws" + strings.TrimPrefix(connLimitServer(t, service, ""), "http") + "/feed?user=test-user"
+
+	for round := 0; round < 3; round++ {
+		var mu sync.Mutex
+		var admitted []*websocket.Conn
+		var refused, failed atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, resp, err := websocket.DefaultDialer.Dial(feedURL, nil)
+				switch {
+				case err == nil:
+					mu.Lock()
+					admitted = append(admitted, conn)
+					mu.Unlock()
+				case resp != nil && resp.StatusCode == http.StatusTooManyRequests:
+					refused.Add(1)
+				default:
+					failed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(admitted) != 5 || refused.Load() != 15 || failed.Load() != 0 {
+			t.Fatalf("Round %d: expected 5 admitted and 15 refused, got %d admitted, %d refused, %d failed",
+				round, len(admitted), refused.Load(), failed.Load())
+		}
+		for _, conn := range admitted {
+			conn.Close()
+		}
+		waitForConnections(t, handler, "test-user", 0)
+	}
+	if counts := service.UserConnectionCounts(); len(counts) != 0 {
+		t.Errorf("Expected no connections left, got %v", counts)
+	}
+}
@@ -0,0 +1,125 @@
+package ws
+
+import "time"
+
+// DefaultControlTimeout is how long a client keeps the input lock without
+// sending input before it is released.
+const DefaultControlTimeout = 5 * time.Minute
+
+// SetControlTimeout sets how long a client keeps the input lock without
+// sending input. Zero or less keeps the lock until it is released or its
+// holder disconnects. It applies from the next time the lock is taken.
+func (h *Hub) SetControlTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.controlTimeout = timeout
+}
+
+// Controller returns the client holding the input lock, or nil if no
+// client holds it and every interactive client may send input.
+func (h *Hub) Controller() *Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.controller
+}
+
+// RequestControl gives client the input lock, taking it from the current
+// holder, which is sent control_release. The client is sent control_grant
+// and the new holder is broadcast as a StateControl status.
+func (h *Hub) RequestControl(client *Client) {
+	h.mu.Lock()
+	if h.closed || !h.clients[client] {
+		h.mu.Unlock()
+		return
+	}
+	previous := h.controller
+	h.clearControlLocked()
+	h.controller = client
+	h.controlInputAt = time.Now()
+	if h.controlTimeout > 0 {
+		h.controlTimer = time.AfterFunc(h.controlTimeout, func() {
+			h.expireControl(client)
+		})
+	}
+	h.mu.Unlock()
+
+	if previous != nil && previous != client {
+		h.SendTo(previous, &Message{Type: MessageTypeControlRelease, Data: client.ID()})
+	}
+	h.SendTo(client, &Message{Type: MessageTypeControlGrant, Data: client.ID()})
+	h.broadcastController(client)
+}
+
+// ReleaseControl releases the input lock if client holds it.
+func (h *Hub) ReleaseControl(client *Client) {
+	h.mu.Lock()
+	if h.controller != client || client == nil {
+		h.mu.Unlock()
+		return
+	}
+	h.clearControlLocked()
+	h.mu.Unlock()
+
+	h.broadcastController(nil)
+}
+
+// expireControl releases the input lock held by client once it has sent no
+// input for the control timeout, checking again later if it has.
+func (h *Hub) expireControl(client *Client) {
+	h.mu.Lock()
+	if h.controller != client {
+		h.mu.Unlock()
+		return
+	}
+	if remaining := h.controlTimeout - time.Since(h.controlInputAt); remaining > 0 {
+		h.controlTimer = time.AfterFunc(remaining, func() {
+			h.expireControl(client)
+		})
+		h.mu.Unlock()
+		return
+	}
+	h.clearControlLocked()
+	h.mu.Unlock()
+
+	h.SendTo(client, &Message{Type: MessageTypeControlRelease})
+	h.broadcastController(nil)
+}
+
+// clearControlLocked releases the input lock without notifying clients.
+// h.mu must be held.
+func (h *Hub) clearControlLocked() {
+	if h.controlTimer != nil {
+		h.controlTimer.Stop()
+		h.controlTimer = nil
+	}
+	h.controller = nil
+}
+
+// acceptInput reports whether input from client may be written, which is
+// when no other client holds the input lock. Input from the holder extends
+// its lock; a client whose input is dropped is sent a StateControl status
+// naming the holder.
+func (h *Hub) acceptInput(client *Client) bool {
+	h.mu.Lock()
+	controller := h.controller
+	if controller == client {
+		h.controlInputAt = time.Now()
+	}
+	h.mu.Unlock()
+
+	if controller == nil || controller == client {
+		return true
+	}
+	h.SendTo(client, &Message{Type: MessageTypeStatus, State: StateControl, Data: controller.ID()})
+	return false
+}
+
+// broadcastController broadcasts a StateControl status naming the holder
+// of the input lock, or with no data when it has been released.
+func (h *Hub) broadcastController(controller *Client) {
+	msg := &Message{Type: MessageTypeStatus, State: StateControl}
+	if controller != nil {
+		msg.Data = controller.ID()
+	}
+	h.BroadcastMessage(msg)
+}
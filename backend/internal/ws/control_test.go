@@ -0,0 +1,159 @@
+package ws
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// newControlHub returns a hub with two interactive clients that records the
+// input messages passed on to the handler.
+func newControlHub(t *testing.T) (*Hub, *Client, *Client, func() []string) {
+	t.Helper()
+	hub := NewHub("control-session")
+	t.Cleanup(hub.Close)
+
+	var mu sync.Mutex
+	var inputs []string
+	hub.SetOnMessage(func(c *Client, msg *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		inputs = append(inputs, msg.Data)
+	})
+
+	a := NewClient(hub, nil, "control-session", false)
+	b := NewClient(hub, nil, "control-session", false)
+	hub.Register(a)
+	hub.Register(b)
+	return hub, a, b, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		result := inputs
+		inputs = nil
+		return result
+	}
+}
+
+// expectMessage reads the client's next message and checks its type, state and data.
+func expectMessage(t *testing.T, client *Client, msgType MessageType, state, data string) {
+	t.Helper()
+	msg := receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Type != msgType || msg.State != state || msg.Data != data {
+		t.Fatalf("Expected %s message (state %q, data %q), got %+v", msgType, state, data, msg)
+	}
+}
+
+// TestInputLock tests taking, losing and releasing the input lock
+func TestInputLock(t *testing.T) {
+	hub, a, b, inputs := newControlHub(t)
+
+	// Without a controller every client may write
+	hub.HandleMessage(a, &Message{Type: MessageTypeStdin, Data: "a1"})
+	hub.HandleMessage(b, &Message{Type: MessageTypeStdin, Data: "b1"})
+	if got := inputs(); len(got) != 2 {
+		t.Fatalf("Expected input from both clients, got %v", got)
+	}
+
+	hub.HandleMessage(a, &Message{Type: MessageTypeControlRequest})
+	expectMessage(t, a, MessageTypeControlGrant, "", a.ID())
+	expectMessage(t, a, MessageTypeStatus, StateControl, a.ID())
+	expectMessage(t, b, MessageTypeStatus, StateControl, a.ID())
+	if hub.Controller() != a {
+		t.Fatal("Expected client a to hold the input lock")
+	}
+
+	// Input from the other client is dropped and answered with the controller
+	hub.HandleMessage(b, &Message{Type: MessageTypeStdin, Data: "b2"})
+	hub.HandleMessage(b, &Message{Type: MessageTypeCommand, Data: "b3"})
+	hub.HandleMessage(a, &Message{Type: MessageTypeStdin, Data: "a2"})
+	if got := inputs(); len(got) != 1 || got[0] != "a2" {
+		t.Errorf("Expected only the controller's input, got %v", got)
+	}
+	expectMessage(t, b, MessageTypeStatus, StateControl, a.ID())
+	expectMessage(t, b, MessageTypeStatus, StateControl, a.ID())
+
+	// Pings are still answered
+	hub.HandleMessage(b, &Message{Type: MessageTypePing})
+	if got := inputs(); len(got) != 1 {
+		t.Errorf("Expected ping to reach the handler, got %v", got)
+	}
+
+	// Taking control demotes the previous controller
+	hub.HandleMessage(b, &Message{Type: MessageTypeControlRequest})
+	expectMessage(t, a, MessageTypeControlRelease, "", b.ID())
+	expectMessage(t, a, MessageTypeStatus, StateControl, b.ID())
+	expectMessage(t, b, MessageTypeControlGrant, "", b.ID())
+	expectMessage(t, b, MessageTypeStatus, StateControl, b.ID())
+
+	// Only the controller can release the lock
+	hub.HandleMessage(a, &Message{Type: MessageTypeControlRelease})
+	if hub.Controller() != b {
+		t.Fatal("Expected client b to keep the input lock")
+	}
+	hub.HandleMessage(b, &Message{Type: MessageTypeControlRelease})
+	expectMessage(t, a, MessageTypeStatus, StateControl, "")
+	expectMessage(t, b, MessageTypeStatus, StateControl, "")
+	hub.HandleMessage(a, &Message{Type: MessageTypeStdin, Data: "a3"})
+	if got := inputs(); len(got) != 1 || got[0] != "a3" {
+		t.Errorf("Expected input after release, got %v", got)
+	}
+}
+
+// TestInputLockReleasedOnDisconnect tests that a disconnecting controller
+// releases the input lock
+func TestInputLockReleasedOnDisconnect(t *testing.T) {
+	hub, a, b, _ := newControlHub(t)
+
+	hub.HandleMessage(a, &Message{Type: MessageTypeControlRequest})
+	expectMessage(t, b, MessageTypeStatus, StateControl, a.ID())
+
+	hub.Unregister(a)
+	if hub.Controller() != nil {
+		t.Error("Expected the input lock to be released")
+	}
+	expectMessage(t, b, MessageTypeStatus, StateControl, "")
+}
+
+// TestInputLockTimeout tests that the input lock expires without input
+// from its holder
+func TestInputLockTimeout(t *testing.T) {
+	hub, a, b, _ := newControlHub(t)
+	hub.SetControlTimeout(100 * time.Millisecond)
+
+	hub.HandleMessage(a, &Message{Type: MessageTypeControlRequest})
+	expectMessage(t, a, MessageTypeControlGrant, "", a.ID())
+	expectMessage(t, a, MessageTypeStatus, StateControl, a.ID())
+	expectMessage(t, b, MessageTypeStatus, StateControl, a.ID())
+
+	// Input extends the lock
+	time.Sleep(60 * time.Millisecond)
+	hub.HandleMessage(a, &Message{Type: MessageTypeStdin, Data: "a1"})
+	time.Sleep(60 * time.Millisecond)
+	if hub.Controller() != a {
+		t.Fatal("Expected input to extend the input lock")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if hub.Controller() != nil {
+		t.Fatal("Expected the input lock to expire")
+	}
+	expectMessage(t, a, MessageTypeControlRelease, "", "")
+	expectMessage(t, a, MessageTypeStatus, StateControl, "")
+	expectMessage(t, b, MessageTypeStatus, StateControl, "")
+}
+
+// TestInputLockReadOnly tests that read-only clients cannot take the input lock
+func TestInputLockReadOnly(t *testing.T) {
+	hub, _, _, _ := newControlHub(t)
+	viewer := NewClient(hub, nil, "control-session", true)
+	hub.Register(viewer)
+
+	hub.HandleMessage(viewer, &Message{Type: MessageTypeControlRequest})
+	msg := receiveMessage(t, viewer, 100*time.Millisecond)
+	if msg == nil || msg.Type != MessageTypeError {
+		t.Fatalf("Expected an error, got %+v", msg)
+	}
+	if hub.Controller() != nil {
+		t.Error("Expected a read-only client not to get the input lock")
+	}
+}
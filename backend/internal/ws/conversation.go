@@ -0,0 +1,90 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+)
+
+// DefaultConversationHistorySize is the number of conversation messages
+// kept per session for clients that attach later.
+const DefaultConversationHistorySize = 500
+
+// conversationLog keeps the latest conversation messages of a session.
+// Messages are recorded and broadcast under mu, and clients are registered
+// under it too, so an attaching client receives each message exactly once:
+// either in its conversation_history or as a live broadcast.
+type conversationLog struct {
+	mu       sync.Mutex
+	messages []driver.Message
+	limit    int
+}
+
+// record appends messages, dropping the oldest beyond the limit, and then
+// calls broadcast while holding the log.
+func (l *conversationLog) record(messages []driver.Message, broadcast func() error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.messages = append(l.messages, messages...)
+	if over := len(l.messages) - l.limit; over > 0 {
+		n := copy(l.messages, l.messages[over:])
+		clear(l.messages[n:])
+		l.messages = l.messages[:n]
+	}
+	return broadcast()
+}
+
+// register registers client with hub and returns a copy of the messages
+// recorded before it, which the client has not received.
+func (l *conversationLog) register(hub *Hub, client *Client) ([]driver.Message, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := hub.Register(client); err != nil {
+		return nil, err
+	}
+	return l.snapshotLocked(), nil
+}
+
+// snapshot returns a copy of the recorded messages, oldest first.
+func (l *conversationLog) snapshot() []driver.Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.snapshotLocked()
+}
+
+// snapshotLocked implements snapshot. l.mu must be held.
+func (l *conversationLog) snapshotLocked() []driver.Message {
+	return append([]driver.Message{}, l.messages...)
+}
+
+// ConversationHistory returns the session's latest conversation messages,
+// oldest first, including those of output produced while no client was
+// attached.
+func (h *Handler) ConversationHistory(sessionID string) []driver.Message {
+	w := h.existingParser(sessionID)
+	if w == nil {
+		return []driver.Message{}
+	}
+	return w.conversation.snapshot()
+}
+
+// sendConversationHistory sends the messages recorded before a client
+// attached, if there are any and it is subscribed to conversation messages.
+// A reconnecting client should replace the messages it shows with them.
+func (h *Handler) sendConversationHistory(client *Client, messages []driver.Message) {
+	if len(messages) == 0 || !client.Subscribed(MessageTypeConversation) {
+		return
+	}
+	payload, err := json.Marshal(messages)
+	if err != nil {
+		h.logger.Error("Failed to marshal conversation history", "session_id", client.sessionID, "error", err)
+		return
+	}
+	client.sendReply(&Message{
+		Type:    MessageTypeConversationHistory,
+		Payload: payload,
+	})
+}
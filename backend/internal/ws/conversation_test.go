@@ -0,0 +1,175 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// TestConversationLogLimit tests that only the latest messages are kept
+func TestConversationLogLimit(t *testing.T) {
+	log := conversationLog{limit: 3}
+	for i := 0; i < 5; i++ {
+		log.record([]driver.Message{{Type: "user_input", Content: fmt.Sprintf("msg-%d", i)}}, func() error { return nil })
+	}
+
+	messages := log.snapshot()
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(messages))
+	}
+	for i, msg := range messages {
+		if expected := fmt.Sprintf("msg-%d", i+2); msg.Content != expected {
+			t.Errorf("Expected message %d to be %s, got %s", i, expected, msg.Content)
+		}
+	}
+
+	// Snapshots are copies
+	messages[0].Content = "changed"
+	if log.snapshot()[0].Content != "msg-2" {
+		t.Error("Expected the snapshot not to share the log's messages")
+	}
+}
+
+// TestConversationHistoryOnReconnect parses a scripted Claude transcript
+// and checks that a reconnecting client is sent the messages the first
+// client received live, after the terminal history
+func TestConversationHistoryOnReconnect(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-conversation-history"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("Failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.SetSessionDriver(sessionID, driver.NewClaudeDriver())
+	defer handler.StopParsing(sessionID)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Wait for the client to register, so the output is parsed
+	hub := hubManager.GetOrCreate(sessionID)
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.ClientCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the client to register")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	transcript := []string{
+		"> fix the failing test\r\n",
+		"● Read(parser.go)\r\n",
+		"> run the tests\r\n",
+		"● Bash(go test ./...)\r\n",
+	}
+	for _, chunk := range transcript {
+		if err := handler.BroadcastOutput(sessionID, []byte(chunk)); err != nil {
+			t.Fatalf("BroadcastOutput failed: %v", err)
+		}
+	}
+	handler.waitParsed(sessionID)
+
+	recorded := handler.ConversationHistory(sessionID)
+	expected := []string{"fix the failing test", "Read(parser.go)", "run the tests", "Bash(go test ./...)"}
+	if len(recorded) != len(expected) {
+		t.Fatalf("Expected %d conversation messages, got %+v", len(expected), recorded)
+	}
+	for i, content := range expected {
+		if recorded[i].Content != content {
+			t.Errorf("Expected message %d to be %q, got %q", i, content, recorded[i].Content)
+		}
+	}
+
+	// The first client received every message live
+	var live []driver.Message
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(live) < len(recorded) {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read live conversation messages: %v", err)
+		}
+		if msg.Type != MessageTypeConversation {
+			continue
+		}
+		var m driver.Message
+		if err := json.Unmarshal(msg.Payload, &m); err != nil {
+			t.Fatalf("Failed to decode conversation message: %v", err)
+		}
+		live = append(live, m)
+	}
+	conn.Close()
+
+	// The reconnecting client is sent them after the terminal history
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	readStatusSnapshot(t, conn)
+	var msg Message
+	for msg.Type != MessageTypeHistoryEnd {
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read history: %v", err)
+		}
+	}
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != MessageTypeConversationHistory {
+		t.Fatalf("Expected conversation_history after history_end, got %+v (err: %v)", msg, err)
+	}
+
+	var replayed []driver.Message
+	if err := json.Unmarshal(msg.Payload, &replayed); err != nil {
+		t.Fatalf("Failed to decode conversation history: %v", err)
+	}
+	if len(replayed) != len(live) {
+		t.Fatalf("Expected %d replayed messages, got %d", len(live), len(replayed))
+	}
+	for i := range live {
+		if !replayed[i].Timestamp.Equal(live[i].Timestamp) || replayed[i].Type != live[i].Type || replayed[i].Content != live[i].Content {
+			t.Errorf("Expected replayed message %d to be %+v, got %+v", i, live[i], replayed[i])
+		}
+	}
+}
+
+// TestConversationHistoryUnsubscribed tests that clients that did not
+// subscribe to conversation messages are not sent the history
+func TestConversationHistoryUnsubscribed(t *testing.T) {
+	handler := NewHandler(NewHubManager(), nil, nil)
+	defer handler.HubManager().Close()
+
+	hub := handler.HubManager().GetOrCreate("s1")
+	client := NewClient(hub, nil, "s1", false)
+	client.SetSubscriptions([]MessageType{MessageTypeSmartEvent})
+
+	handler.sendConversationHistory(client, []driver.Message{{Type: "user_input", Content: "hello"}})
+	if msg := receiveMessage(t, client, 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no conversation history, got %+v", msg)
+	}
+}
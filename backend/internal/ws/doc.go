@@ -9,8 +9,40 @@
 //
 // Key features:
 //   - Bidirectional communication between browser and PTY (Requirement 3.1)
-//   - Hot restore: Sends Ring Buffer history on reconnect (Requirement 4.3)
+//   - Status snapshot: A status message with the session's state, exit code, terminal size, name and PID is sent on attach before the history
+//   - Hot restore: Sends Ring Buffer history on reconnect in chunks of up to 16KB, ending with a history_end message; live output is held back until then (Requirement 4.3)
+//   - Scrollback: A scrollback message fetches output older than the hot-restore history from the session's recording, a page of lines at a time, off the read pump
+//   - Incremental restore: Clients reconnecting with ?since_seq= or ?cursor= only receive the output they missed while it is still buffered
 //   - Session keepalive: PTY continues running when clients disconnect (Requirement 4.1)
 //   - ANSI sequence passthrough: Preserves terminal formatting (Requirement 3.5)
 //   - SmartEvent broadcasting: Forwards AgentDriver events to clients (Requirement 6.5)
+//   - Event responses: Clients answer SmartEvents with event_response messages, which the session driver turns into PTY input; drivers without auto-respond support refuse them
+//   - Pending events: Questions and confirms get IDs and are sent once while they wait for an answer, and again to clients attaching after the history; a smart_event_resolved message reports them answered or expired
+//   - Automatic responses: Prompts a driver answers itself, such as by ClaudeDriver.AutoRespondRules, are written to the PTY instead of being sent to clients
+//   - Input actions: Named keys and commands sent as input_action messages are formatted by the session driver
+//   - Shared geometry: Resizes are rebroadcast to the other clients, and new clients receive the current size after history
+//   - Input lock: A control_request gives a client exclusive input until it sends control_release, disconnects or is idle for the control timeout; the holder is broadcast as a control status
+//   - Focus reports: focus and blur messages write the focus in and out reports (\x1b[I, \x1b[O) of focus tracking mode to the PTY
+//   - Dismiss: A dismiss message sends Enter to close interactive output and a dismissed message is broadcast
+//   - Error codes: Failed or refused client messages are answered with an error message whose errorCode (e.g. PTY_WRITE_FAILED, RESIZE_FAILED, INVALID_MESSAGE) identifies the cause
+//   - Validation: Client messages of unknown type, stdin over 4KB, commands over 16KB and resizes outside 1..1000 are rejected with an INVALID_MESSAGE error naming the field
+//   - Acknowledged input: stdin and command messages with an id are answered with an ack, delivered or failed with an error code, once written to the PTY
+//   - Ordered input: stdin, commands, input actions, event responses, focus reports, dismisses and automatic answers are written to the PTY in arrival order off the read pump; a client's pending input is dropped when it disconnects
+//   - Markers: A marker message adds a labelled chapter marker to the session's recording; replays send recorded markers as marker messages
+//   - Binary output frames: Raw stdout/history bytes for clients attaching with ?proto=binary or ?binary=1
+//   - Output coalescing: Optionally batches rapid stdout chunks into one message, flushed before smart events, statuses, alerts and errors, on process exit and when the session is detached; only the last two send an escape sequence or UTF-8 character left unfinished
+//   - Subscriptions: Clients attaching with ?subscribe= only receive the listed driver messages (smart_event, conversation); output is parsed even while no client wants them, but the results are not broadcast
+//   - Conversation history: The latest 500 conversation messages of a session are sent in a conversation_history message after the history
+//   - Parse workers: Driver output is parsed per session off the PTY read path, so a slow driver delays smart events, never stdout
+//   - Backpressure policies: Disconnect, block briefly, or drop the oldest output for slow clients
+//   - Connection limit: A user may have 50 WebSocket connections open across sessions and the session feed by default; further upgrades are refused with 429 TOO_MANY_CONNECTIONS
+//   - Input rate limit: Optionally drops client messages other than resize and ping beyond a per-client byte rate, answering with a RATE_LIMITED error
+//   - Stalled writers: A client whose write missed its deadline is unregistered at once and counted in the hub's writeTimeouts stat
+//   - Idle clients: A client that has neither sent a message nor been delivered output for 30 minutes is sent an idle_disconnect status and closed with 1000; its session keeps running
+//   - Replay: Streams a session's asciinema recording with its original timing
+//   - Session feed: A per-user hub, not tied to a PTY, pushes session_created, session_status and session_deleted messages
+//   - Watchdog alerts: An alert message warns clients when a process stops producing output
+//   - Session TTL: A ttl_expired status is broadcast before the process of a session that exceeded its maximum duration is terminated; the session is kept with status expired
+//   - Hub cleanup: Hubs of exited sessions are removed after a grace period without clients
+//   - Graceful shutdown: A server_shutdown status and a 1001 close frame before connections close
 package ws
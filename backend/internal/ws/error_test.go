@@ -0,0 +1,188 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// failingPTY fails every write and resize with err.
+type failingPTY struct {
+	err error
+}
+
+func (p *failingPTY) Write(data []byte) error {
+	return p.err
+}
+
+func (p *failingPTY) Resize(rows, cols uint16) error {
+	return p.err
+}
+
+// expectError reads the client's next message and checks that it is an
+// error with the given code, for a message of type t.
+func expectError(t *testing.T, client *Client, code string, msgType MessageType) {
+	t.Helper()
+	msg := receiveMessage(t, client, 100*time.Millisecond)
+	if msg == nil || msg.Type != MessageTypeError || msg.ErrorCode != code {
+		t.Fatalf("Expected %s error, got %+v", code, msg)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("failed to decode error payload: %v", err)
+	}
+	if payload["code"] != code || payload["type"] != string(msgType) {
+		t.Errorf("Expected payload code %s and type %q, got %v", code, msgType, payload)
+	}
+}
+
+// TestErrorMessageSerialization tests the JSON encoding of error messages
+func TestErrorMessageSerialization(t *testing.T) {
+	tests := []struct {
+		msg      Message
+		expected string
+	}{
+		{
+			Message{Type: MessageTypeError, Error: "Failed to resize the terminal", ErrorCode: ErrorCodeResizeFailed},
+			`{"type":"error","error":"Failed to resize the terminal","errorCode":"RESIZE_FAILED"}`,
+		},
+		{
+			Message{Type: MessageTypeError, Error: "Invalid message", ErrorCode: ErrorCodeInvalidMessage},
+			`{"type":"error","error":"Invalid message","errorCode":"INVALID_MESSAGE"}`,
+		},
+		// Messages other than errors carry no code
+		{
+			Message{Type: MessageTypeStdout, Data: "hello"},
+			`{"type":"stdout","data":"hello"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.msg)
+		if err != nil {
+			t.Fatalf("failed to marshal %+v: %v", tt.msg, err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, data)
+		}
+
+		var decoded Message
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("failed to unmarshal %s: %v", data, err)
+		}
+		if decoded.ErrorCode != tt.msg.ErrorCode || decoded.Error != tt.msg.Error {
+			t.Errorf("Expected %+v after a round trip, got %+v", tt.msg, decoded)
+		}
+	}
+}
+
+// TestHandlerErrorCodes tests that failed writes and resizes are reported to
+// the client that sent the message
+func TestHandlerErrorCodes(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+
+	sessionID := "test-error-codes"
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	other := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+	hub.Register(other)
+
+	failed := &failingPTY{err: errors.New("input/output error")}
+	exited := &failingPTY{err: fmt.Errorf("failed to write: %w", pty.ErrProcessClosed)}
+
+	stdin := &Message{Type: MessageTypeStdin, Data: "ls\n"}
+	acknowledge(client, stdin, handler.handleStdin(client, stdin, failed))
+	expectError(t, client, ErrorCodePTYWriteFailed, MessageTypeStdin)
+
+	acknowledge(client, stdin, handler.handleStdin(client, stdin, exited))
+	expectError(t, client, ErrorCodeProcessExited, MessageTypeStdin)
+
+	handler.handleInputAction(client, &Message{Type: MessageTypeInputAction, Payload: json.RawMessage(`{"type":"key","content":"enter"}`)}, failed)
+	expectError(t, client, ErrorCodePTYWriteFailed, MessageTypeInputAction)
+
+	// The generic driver does not answer events
+	handler.SetSessionDriver(sessionID, driver.NewClaudeDriver())
+	handler.handleEventResponse(client, &Message{Type: MessageTypeEventResponse, Payload: json.RawMessage(`{"kind":"question","response":"y"}`)}, failed)
+	expectError(t, client, ErrorCodePTYWriteFailed, MessageTypeEventResponse)
+
+	handler.handleResize(client, &Message{Type: MessageTypeResize, Rows: 40, Cols: 120}, failed)
+	expectError(t, client, ErrorCodeResizeFailed, MessageTypeResize)
+
+	handler.handleResize(client, &Message{Type: MessageTypeResize, Rows: 40, Cols: 120}, exited)
+	expectError(t, client, ErrorCodeProcessExited, MessageTypeResize)
+
+	// Only the sender is told
+	if msg := receiveMessage(t, other, 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no message for the other client, got %+v", msg)
+	}
+}
+
+// TestInvalidMessageErrorCode tests that a message that cannot be decoded is
+// answered with an error and does not close the connection
+func TestInvalidMessageErrorCode(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-invalid-message"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	readStatusSnapshot(t, conn)
+
+	var end, size Message
+	if err := conn.ReadJSON(&end); err != nil || end.Type != MessageTypeHistoryEnd {
+		t.Fatalf("expected history_end, got %+v (err: %v)", end, err)
+	}
+	if err := conn.ReadJSON(&size); err != nil || size.Type != MessageTypeResize {
+		t.Fatalf("expected initial resize, got %+v (err: %v)", size, err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+	var reply Message
+	if err := conn.ReadJSON(&reply); err != nil || reply.Type != MessageTypeError || reply.ErrorCode != ErrorCodeInvalidMessage {
+		t.Fatalf("expected %s error, got %+v (err: %v)", ErrorCodeInvalidMessage, reply, err)
+	}
+
+	// The connection stays usable
+	if err := conn.WriteJSON(Message{Type: MessageTypePing}); err != nil {
+		t.Fatalf("failed to write ping: %v", err)
+	}
+	var pong Message
+	if err := conn.ReadJSON(&pong); err != nil || pong.Type != MessageTypePong {
+		t.Errorf("expected pong, got %+v (err: %v)", pong, err)
+	}
+}
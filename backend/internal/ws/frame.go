@@ -0,0 +1,144 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+)
+
+// FrameKind identifies the WebSocket frame type used to deliver a payload.
+type FrameKind int
+
+const (
+	// FrameText is a JSON-encoded text frame.
+	FrameText FrameKind = iota
+
+	// FrameBinary is a binary frame carrying raw terminal bytes.
+	FrameBinary
+)
+
+// Binary frame type prefixes. A binary frame is a single prefix byte
+// followed by the raw PTY bytes, with no JSON encoding:
+//
+//	+--------+----------------------------+
+//	| 1 byte | N bytes                    |
+//	| type   | raw terminal output        |
+//	+--------+----------------------------+
+//
+// Only stdout and history use binary frames. Control messages (status,
+// smart events, errors, pong) stay JSON text frames, so a client tells
+// them apart by the WebSocket frame type. Binary frames carry no seq or
+// cursor, so a binary client sees gaps in the seq of JSON messages where
+// output was sent; clients that need ordering should use the JSON protocol.
+const (
+	BinaryFrameStdout  byte = 0x01
+	BinaryFrameHistory byte = 0x02
+)
+
+// ProtocolBinary is the attach query value (?proto=binary) that enables
+// binary frames for terminal output. ?binary=1 is accepted as well.
+const ProtocolBinary = "binary"
+
+// wantsBinary reports whether the attach request negotiates binary frames.
+func wantsBinary(r *http.Request) bool {
+	query := r.URL.Query()
+	if query.Get("proto") == ProtocolBinary {
+		return true
+	}
+	binary, err := strconv.ParseBool(query.Get("binary"))
+	return err == nil && binary
+}
+
+// Frame is a payload queued for a client together with its frame kind.
+type Frame struct {
+	Kind FrameKind
+	Data []byte
+
+	// Droppable marks terminal output that BackpressureDropOldest may
+	// discard. Control messages (status, smart events, errors) are never
+	// droppable.
+	Droppable bool
+
+	// Heartbeat marks a pong, which does not count as activity for
+	// Handler.IdleTimeout.
+	Heartbeat bool
+}
+
+// wsMessageType returns the gorilla/websocket message type for the frame.
+func (f Frame) wsMessageType() int {
+	if f.Kind == FrameBinary {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// encodeMessage encodes msg for a client. Binary clients receive stdout and
+// history as binary frames; all other messages are JSON text frames.
+// Stdout frames are marked droppable.
+func encodeMessage(msg *Message, binary bool) (Frame, error) {
+	droppable := msg.Type == MessageTypeStdout
+
+	if binary {
+		switch msg.Type {
+		case MessageTypeStdout:
+			frame := newBinaryFrame(BinaryFrameStdout, msg.Data)
+			frame.Droppable = true
+			return frame, nil
+		case MessageTypeHistory:
+			return newBinaryFrame(BinaryFrameHistory, msg.Data), nil
+		}
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Kind: FrameText, Data: data, Droppable: droppable, Heartbeat: msg.Type == MessageTypePong}, nil
+}
+
+// messageFrames holds the encodings of a message, built at most once per
+// protocol so every client using that protocol shares the frame.
+type messageFrames [2]*Frame
+
+// encode returns the message encoded for a JSON or binary client.
+func (f *messageFrames) encode(msg *Message, binary bool) (Frame, error) {
+	idx := 0
+	if binary {
+		idx = 1
+	}
+	if f[idx] == nil {
+		frame, err := encodeMessage(msg, binary)
+		if err != nil {
+			return Frame{}, err
+		}
+		f[idx] = &frame
+	}
+	return *f[idx], nil
+}
+
+// newBinaryFrame builds a binary frame with the given type prefix.
+func newBinaryFrame(prefix byte, data string) Frame {
+	buf := make([]byte, 1+len(data))
+	buf[0] = prefix
+	copy(buf[1:], data)
+	return Frame{Kind: FrameBinary, Data: buf}
+}
+
+// DecodeBinaryFrame splits a binary frame into its message type and raw bytes.
+func DecodeBinaryFrame(data []byte) (MessageType, []byte, error) {
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("empty binary frame")
+	}
+
+	switch data[0] {
+	case BinaryFrameStdout:
+		return MessageTypeStdout, data[1:], nil
+	case BinaryFrameHistory:
+		return MessageTypeHistory, data[1:], nil
+	default:
+		return "", nil, fmt.Errorf("unknown binary frame type: 0x%02x", data[0])
+	}
+}
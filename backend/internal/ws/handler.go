@@ -1,14 +1,22 @@
 package ws
 
 import (
+	"compress/flate"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/auth"
 	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/logging"
 	"github.com/remote-agent-terminal/backend/internal/pty"
 )
 
@@ -22,26 +30,116 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 8192
+	// DefaultMaxMessageSize is the default largest message in bytes read
+	// from a client. It leaves room for a command of MaxCommandBytes.
+	DefaultMaxMessageSize = 32 * 1024
+
+	// Time allowed for the peer to answer a close frame with a code.
+	closeAckWait = time.Second
+
+	// DefaultCompressThreshold is the suggested minimum frame size in bytes
+	// worth compressing when CompressOutput is enabled.
+	DefaultCompressThreshold = 512
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: Implement proper origin checking in production
-		return true
-	},
+	// Only same-origin requests by default; see SetAllowedOrigins
+	CheckOrigin: NewOriginChecker(nil),
 }
 
 // Handler handles WebSocket connections for terminal sessions.
 type Handler struct {
 	hubManager     *HubManager
 	ptyManager     *pty.Manager
-	driver         driver.AgentDriver // Default driver
+	driver         driver.AgentDriver            // Default driver
 	sessionDrivers map[string]driver.AgentDriver // Session-specific drivers
+	tickets        *auth.TicketStore             // Optional; when set, a ticket is required to attach
+	logger         logging.Logger
 	mu             sync.RWMutex
+
+	// CompressOutput negotiates permessage-deflate with clients that offer it.
+	// It defaults to false for compatibility and must be set before serving.
+	CompressOutput bool
+
+	// CompressThreshold is the frame size in bytes above which frames are
+	// compressed. Small frames are sent uncompressed, since deflate overhead
+	// outweighs the savings. Only used when CompressOutput is true.
+	CompressThreshold int
+
+	// CompressionLevel is the deflate level of compressed frames, from
+	// flate.HuffmanOnly to flate.BestCompression. Zero means
+	// flate.BestSpeed, so flate.NoCompression cannot be chosen; leave
+	// CompressOutput off instead. Must be set before serving.
+	CompressionLevel int
+
+	// CoalesceWindow holds stdout chunks for up to this long and broadcasts
+	// them as a single message. Zero disables coalescing. Must be set
+	// before serving.
+	CoalesceWindow time.Duration
+
+	// CoalesceMaxBytes flushes coalesced stdout early once this many bytes
+	// are pending. Zero means no size limit.
+	CoalesceMaxBytes int
+
+	coalescers map[string]*outputCoalescer // Pending stdout per session
+
+	// ParseQueueSize is the number of output chunks that may wait for a
+	// session's driver; further chunks are not parsed until it catches up.
+	// Zero means DefaultParseQueueSize. Must be set before serving.
+	ParseQueueSize int
+
+	parsers        map[string]*parseWorker // Parse workers per session
+	stoppedParsers map[string]bool         // Sessions whose parse worker was stopped
+
+	inputs map[string]*inputQueue // Pending PTY writes per session
+
+	// ConversationHistorySize is the number of conversation messages kept
+	// per session and sent to clients when they attach. Zero means
+	// DefaultConversationHistorySize. Must be set before serving.
+	ConversationHistorySize int
+
+	// unparsed marks sessions whose output has bypassed the driver because
+	// its parse queue was full
+	unparsed map[string]bool
+
+	// WriteTimeout is the deadline for writing a frame to a client. Zero
+	// means 10 seconds. Must be set before serving.
+	WriteTimeout time.Duration
+
+	// StdinRateLimit limits the input bytes each client may send per
+	// second: stdin and commands, and every other message but resize and
+	// ping. Input beyond it is dropped and the client is sent a
+	// RATE_LIMITED error. Zero disables the limit. Must be set before
+	// serving.
+	StdinRateLimit int
+
+	// StdinBurst is how many input bytes a client may send at once under
+	// StdinRateLimit. Zero means one second of input.
+	StdinBurst int
+
+	// MaxMessageSize is the largest message in bytes read from a client;
+	// the connection is closed on a larger one. Zero means
+	// DefaultMaxMessageSize. Must be set before serving.
+	MaxMessageSize int64
+
+	// IdleTimeout closes a client that has neither sent a message nor been
+	// delivered a frame for this long, after sending it a
+	// StateIdleDisconnect status. Ping and pong messages and frames do not
+	// count. The session's process keeps running. Zero means
+	// DefaultIdleTimeout and a negative value disables it. Must be set
+	// before serving.
+	IdleTimeout time.Duration
+
+	// MaxConnsPerUser is how many WebSocket connections a user may have
+	// open across sessions and the session feed; further upgrades are
+	// refused with 429 Too Many Requests. Zero means
+	// DefaultMaxConnsPerUser and a negative value disables the limit. Must
+	// be set before serving.
+	MaxConnsPerUser int
+
+	conns userConns // Open connections per user
 }
 
 // NewHandler creates a new WebSocket handler.
@@ -54,9 +152,24 @@ func NewHandler(hubManager *HubManager, ptyManager *pty.Manager, agentDriver dri
 		ptyManager:     ptyManager,
 		driver:         agentDriver,
 		sessionDrivers: make(map[string]driver.AgentDriver),
+		logger:         logging.Nop{},
 	}
 }
 
+// SetLogger sets the logger for connection and session errors. A nil logger
+// discards them, which is the default. Must be called before serving.
+func (h *Handler) SetLogger(logger logging.Logger) {
+	if logger == nil {
+		logger = logging.Nop{}
+	}
+	h.logger = logger
+}
+
+// HubManager returns the hub manager used by the handler.
+func (h *Handler) HubManager() *HubManager {
+	return h.hubManager
+}
+
 // SetSessionDriver sets a specific driver for a session.
 func (h *Handler) SetSessionDriver(sessionID string, d driver.AgentDriver) {
 	h.mu.Lock()
@@ -74,9 +187,55 @@ func (h *Handler) GetSessionDriver(sessionID string) driver.AgentDriver {
 	return h.driver
 }
 
-// HandleConnection handles a new WebSocket connection for a session.
+// SetTicketStore enables ticket authentication for WebSocket upgrades.
+// When set, every connection must carry a valid ?ticket= query parameter.
+func (h *Handler) SetTicketStore(store *auth.TicketStore) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tickets = store
+}
+
+// TicketStore returns the ticket store, or nil if ticket authentication is disabled.
+func (h *Handler) TicketStore() *auth.TicketStore {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.tickets
+}
+
+// Attach query values (?mode=) that attach the client as a read-only viewer.
+const (
+	ModeReadOnly = "readonly"
+	ModeViewer   = "viewer"
+	ModeObserver = "observer"
+)
+
+// IsReadOnlyMode reports whether an attach mode requests a read-only client.
+func IsReadOnlyMode(mode string) bool {
+	return mode == ModeReadOnly || mode == ModeViewer || mode == ModeObserver
+}
+
+// ConnectOptions configures a client connection.
+type ConnectOptions struct {
+	// UserID is the authenticated user attaching. Clients of other users
+	// than the session's owner are refused with 403 Forbidden.
+	UserID string
+
+	// ReadOnly attaches the client as an observer that cannot write to the PTY.
+	ReadOnly bool
+}
+
+// HandleConnection handles a new WebSocket connection of userID to a session.
 // It upgrades the HTTP connection to WebSocket and manages the bidirectional communication.
-func (h *Handler) HandleConnection(w http.ResponseWriter, r *http.Request, sessionID string) error {
+func (h *Handler) HandleConnection(w http.ResponseWriter, r *http.Request, sessionID, userID string) error {
+	return h.HandleConnectionWithOptions(w, r, sessionID, ConnectOptions{UserID: userID})
+}
+
+// HandleConnectionWithOptions is like HandleConnection with per-client options.
+func (h *Handler) HandleConnectionWithOptions(w http.ResponseWriter, r *http.Request, sessionID string, opts ConnectOptions) error {
+	if !h.checkOrigin(w, r, "session_id", sessionID) {
+		return nil
+	}
+
 	// Get or verify the PTY process exists
 	ptyProcess, ok := h.ptyManager.Get(sessionID)
 	if !ok {
@@ -84,95 +243,341 @@ func (h *Handler) HandleConnection(w http.ResponseWriter, r *http.Request, sessi
 		return nil
 	}
 
+	// Only the session's owner may attach, whichever route led here
+	ownerID := ""
+	if ptyProcess.Session != nil {
+		ownerID = ptyProcess.Session.UserID
+	}
+	if ownerID != "" && ownerID != opts.UserID {
+		h.logger.Warn("Rejected WebSocket attach: session not owned by user", "session_id", sessionID, "user_id", opts.UserID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+
+	// Validate the attach ticket before upgrading so rejections are plain HTTP 401s
+	if !h.authorizeTicket(r, sessionID, ownerID) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	// Get or create hub for this session
+	hub := h.hubManager.GetOrCreate(sessionID)
+	if ptyProcess.IsClosed() {
+		// A late client of an exited session; let the hub be cleaned up
+		hub.MarkExited()
+	}
+
+	// Refuse extra clients before upgrading so they get a plain HTTP 429
+	if err := hub.CheckCapacity(); err != nil {
+		h.logger.Warn("Rejected WebSocket attach", "session_id", sessionID, "error", err)
+		writeTooManyClients(w)
+		return nil
+	}
+
+	// Count the connection against the user's limit until the read pump
+	// returns; the slot is released here if the client never gets that far
+	release, ok := h.acquireConn(w, opts.UserID)
+	if !ok {
+		return nil
+	}
+	started := false
+	defer func() {
+		if !started {
+			release()
+		}
+	}()
+
 	// Upgrade to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	u := h.upgrader()
+	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
 		return err
 	}
 
-	// Get or create hub for this session
-	hub := h.hubManager.GetOrCreate(sessionID)
+	// Compression only takes effect if the client negotiated permessage-deflate
+	if u.EnableCompression {
+		conn.EnableWriteCompression(true)
+		conn.SetCompressionLevel(h.compressionLevel())
+	}
 
-	// Create client
-	client := NewClient(hub, conn, sessionID)
+	// Create client, negotiating binary output frames if requested. Live
+	// output is held back until the history has been queued.
+	client := NewClient(hub, conn, sessionID, opts.ReadOnly)
+	client.SetBinary(wantsBinary(r))
+	client.SetSubscriptions(parseSubscriptions(r))
+	client.SetInputRateLimit(h.StdinRateLimit, h.StdinBurst)
+	client.BeginRestore()
 
-	// Register client with hub
-	hub.Register(client)
+	// Register client with hub; the hub may have filled up since the check.
+	// Conversation messages and pending smart events parsed before
+	// registering are sent below, later ones are broadcast to the client.
+	conversation, events, err := h.registerClient(hub, client)
+	if err != nil {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()),
+			time.Now().Add(writeWait))
+		conn.Close()
+		return nil
+	}
 
 	// Set up message handler for the hub
 	hub.SetOnMessage(func(c *Client, msg *Message) {
 		h.handleMessage(c, msg, ptyProcess)
 	})
 
-	// Set up output callback to broadcast PTY output to WebSocket clients
-	// This is critical for real-time terminal output (Requirement 3.3)
-	ptyProcess.OutputCallback = func(data []byte) {
-		h.BroadcastOutput(sessionID, data)
+	// Start writing so a long history drains while it is queued
+	go h.writePump(client)
+
+	// Describe the session first, so the client needs no separate status
+	// request that could race with the stream
+	if err := hub.SendTo(client, statusSnapshot(ptyProcess)); err != nil {
+		h.logger.Error("Failed to send status message", "session_id", sessionID, "error", err)
 	}
 
 	// Send history data for hot restore (Requirement 4.3)
-	h.sendHistory(client, ptyProcess)
+	h.sendHistory(client, hub, ptyProcess, resumeCursor(r, hub))
+	h.sendConversationHistory(client, conversation)
+	h.sendPendingEvents(client, events)
+	h.sendSize(client, ptyProcess)
+	client.EndRestore()
 
-	// Start read and write pumps
-	go h.writePump(client)
+	client.release = release
+	started = true
 	go h.readPump(client, hub)
 
 	return nil
 }
 
+// writeTooManyClients writes a 429 response with a JSON error body in the
+// format used by the HTTP API.
+func writeTooManyClients(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"code":    ErrorCodeTooManyClients,
+			"message": "Too many clients attached to this session",
+		},
+	})
+}
+
+// authorizeTicket redeems the request's ticket for the session, which must
+// have been issued to ownerID unless ownerID is empty.
+// It returns true when ticket authentication is disabled.
+func (h *Handler) authorizeTicket(r *http.Request, sessionID, ownerID string) bool {
+	store := h.TicketStore()
+	if store == nil {
+		return true
+	}
+
+	ticket, err := store.Redeem(r.URL.Query().Get("ticket"), sessionID)
+	if err != nil {
+		h.logger.Warn("Rejected WebSocket attach: invalid ticket", "session_id", sessionID, "error", err)
+		return false
+	}
+
+	// The ticket must have been issued to the session owner
+	if ownerID != "" && ownerID != ticket.UserID {
+		h.logger.Warn("Rejected WebSocket attach: ticket issued to another user", "session_id", sessionID)
+		return false
+	}
+
+	return true
+}
+
 // sendHistory sends the buffered history to the client for hot restore.
-func (h *Handler) sendHistory(client *Client, ptyProcess *pty.PTYProcess) {
-	history := ptyProcess.GetHistory()
-	if len(history) == 0 {
-		return
+// The history carries the hub's latest sequence number so the client knows
+// which broadcast sequence to expect next, and the ring buffer cursor so it can
+// resume from that position on its next attach.
+//
+// A client that reconnects with a cursor that is still within the buffer
+// only receives the output it missed, as stdout messages. Otherwise, or if
+// the cursor is from before the session's process was restarted, the full
+// buffer is sent as history and the client should reset its terminal.
+// The mode of the history_end message tells the client which was sent.
+//
+// The output is split into messages of at most HistoryChunkSize bytes,
+// each with the cursor after its bytes, and always followed by a
+// history_end message once the restore is complete.
+func (h *Handler) sendHistory(client *Client, hub *Hub, ptyProcess *pty.PTYProcess, cursor int) {
+	seq := hub.LastSeq()
+	data, newCursor := ptyProcess.GetHistoryFrom(cursor)
+
+	// Cursors up to the buffer's origin were issued for the output of a
+	// process since restarted, so the client's screen must be reset
+	msgType, mode := MessageTypeHistory, RestoreFull
+	if cursor > ptyProcess.RingBuffer.Origin() && newCursor-cursor == len(data) {
+		// Contiguous delta since the client's last position
+		msgType, mode = MessageTypeStdout, RestoreIncremental
 	}
 
-	msg := &Message{
-		Type: MessageTypeHistory,
-		Data: string(history),
+	start := newCursor - len(data)
+	for _, chunk := range splitHistory(data, HistoryChunkSize) {
+		start += len(chunk)
+		msg := &Message{
+			Type:   msgType,
+			Data:   string(chunk),
+			Seq:    seq,
+			Cursor: int64(start),
+		}
+		if err := hub.SendTo(client, msg); err != nil {
+			h.logger.Error("Failed to send history message", "session_id", client.sessionID, "error", err)
+			return
+		}
 	}
 
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Failed to marshal history message: %v", err)
-		return
+	payload, _ := json.Marshal(HistoryEnd{Bytes: len(data), Mode: mode})
+	if err := hub.SendTo(client, &Message{
+		Type:    MessageTypeHistoryEnd,
+		Payload: payload,
+		Seq:     seq,
+		Cursor:  int64(newCursor),
+	}); err != nil {
+		h.logger.Error("Failed to send history end message", "session_id", client.sessionID, "error", err)
 	}
+}
 
-	client.Send(data)
+// splitHistory splits data into chunks of at most size bytes. Chunks end
+// on UTF-8 character boundaries where possible, so no character is split
+// across JSON messages.
+func splitHistory(data []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(data) > size {
+		end := size
+		for end > size-utf8.UTFMax && end > 0 && !utf8.RuneStart(data[end]) {
+			end--
+		}
+		if end <= size-utf8.UTFMax || end == 0 {
+			// Not valid UTF-8 here; split at the size
+			end = size
+		}
+		chunks = append(chunks, data[:end])
+		data = data[end:]
+	}
+	if len(data) > 0 {
+		chunks = append(chunks, data)
+	}
+	return chunks
 }
 
-// handleMessage processes incoming messages from clients.
+// resumeCursor returns the ring buffer cursor a reconnecting client resumes
+// from: ?cursor=N, or else the cursor after the last stdout message up to
+// ?since_seq=N. It returns 0, requesting the full history, if neither is
+// given or the sequence number is unknown to the hub.
+func resumeCursor(r *http.Request, hub *Hub) int {
+	if cursor := parseCursor(r); cursor > 0 {
+		return cursor
+	}
+	seq, err := strconv.ParseUint(r.URL.Query().Get("since_seq"), 10, 64)
+	if err != nil || seq == 0 {
+		return 0
+	}
+	cursor, ok := hub.CursorForSeq(seq)
+	if !ok {
+		return 0
+	}
+	return int(cursor)
+}
+
+// parseCursor reads the ring buffer cursor from the attach query (?cursor=N).
+// A missing or malformed cursor requests the full history.
+func parseCursor(r *http.Request) int {
+	cursor, err := strconv.Atoi(r.URL.Query().Get("cursor"))
+	if err != nil || cursor < 0 {
+		return 0
+	}
+	return cursor
+}
+
+// outputCursor returns the ring buffer cursor of the session's PTY, or 0 if
+// the process is not known.
+func (h *Handler) outputCursor(sessionID string) int64 {
+	if h.ptyManager == nil {
+		return 0
+	}
+	ptyProcess, ok := h.ptyManager.Get(sessionID)
+	if !ok || ptyProcess.RingBuffer == nil {
+		return 0
+	}
+	return int64(ptyProcess.RingBuffer.Cursor())
+}
+
+// handleMessage processes incoming messages from clients. Messages that
+// write to the PTY are queued on the session's input queue, so they are
+// written in the order they arrived without blocking the read pump.
+// Messages beyond the client's input rate limit are dropped first.
 func (h *Handler) handleMessage(client *Client, msg *Message, ptyProcess *pty.PTYProcess) {
+	if h.limitMessage(client, msg) {
+		return
+	}
 	switch msg.Type {
 	case MessageTypeStdin:
-		h.handleStdin(msg, ptyProcess)
+		h.queueInput(client.sessionID, client, func() error {
+			acknowledge(client, msg, h.handleStdin(client, msg, ptyProcess))
+			return nil
+		})
 	case MessageTypeCommand:
-		h.handleCommand(msg, ptyProcess)
+		h.queueInput(client.sessionID, client, func() error {
+			acknowledge(client, msg, h.handleCommand(client, msg, ptyProcess))
+			return nil
+		})
 	case MessageTypeResize:
-		h.handleResize(msg, ptyProcess)
+		h.handleResize(client, msg, ptyProcess)
 	case MessageTypePing:
 		h.handlePing(client)
+	case MessageTypeEventResponse:
+		h.queueInput(client.sessionID, client, func() error {
+			h.handleEventResponse(client, msg, ptyProcess)
+			return nil
+		})
+	case MessageTypeInputAction:
+		h.queueInput(client.sessionID, client, func() error {
+			h.handleInputAction(client, msg, ptyProcess)
+			return nil
+		})
+	case MessageTypeDismiss:
+		h.queueInput(client.sessionID, client, func() error {
+			h.handleDismiss(client, ptyProcess)
+			return nil
+		})
+	case MessageTypeMarker:
+		h.handleMarker(client, msg, ptyProcess)
+	case MessageTypeScrollback:
+		// Reading the recording can take a while
+		go h.handleScrollback(client, msg, ptyProcess)
+	case MessageTypeFocus, MessageTypeBlur:
+		h.queueInput(client.sessionID, client, func() error {
+			h.handleFocus(client, msg, ptyProcess)
+			return nil
+		})
 	}
 }
 
 // handleStdin handles stdin input from the client (Terminal view - real-time input).
-func (h *Handler) handleStdin(msg *Message, ptyProcess *pty.PTYProcess) {
+// It returns the error writing to the PTY; see acknowledge.
+func (h *Handler) handleStdin(client *Client, msg *Message, w ptyWriter) error {
 	if msg.Data == "" {
-		return
+		return nil
 	}
 
 	// Write directly to PTY without any input clearing
 	// This is for real-time terminal input where each keystroke is sent immediately
-	err := ptyProcess.Write([]byte(msg.Data))
+	err := w.Write([]byte(msg.Data))
 	if err != nil {
-		log.Printf("Failed to write to PTY: %v", err)
+		h.logger.Warn("Failed to write to PTY", "session_id", client.sessionID, "error", err)
+		return err
 	}
+	h.resolveInput(client.sessionID, []byte(msg.Data))
+	return nil
 }
 
 // handleCommand handles complete command input from the client (Chat view).
-func (h *Handler) handleCommand(msg *Message, ptyProcess *pty.PTYProcess) {
+// It runs on the session's input queue and returns the error writing to the
+// PTY; see acknowledge. If the client disconnects while the command is
+// being written, its remaining steps are skipped.
+func (h *Handler) handleCommand(client *Client, msg *Message, ptyProcess *pty.PTYProcess) error {
 	if msg.Data == "" {
-		return
+		return nil
 	}
 
 	// Write data to PTY using WriteCommand for proper input handling
@@ -181,43 +586,296 @@ func (h *Handler) handleCommand(msg *Message, ptyProcess *pty.PTYProcess) {
 	// 2. Send command text
 	// 3. Send Enter
 	// This prevents commands from being appended to existing input in CLI applications like Claude
-	err := ptyProcess.WriteCommand([]byte(msg.Data))
+	written, cancel := ptyProcess.WriteCommandAsync([]byte(msg.Data))
+	var err error
+	select {
+	case err = <-written:
+	case <-client.readDone:
+		cancel()
+		err = <-written
+	}
+	if err != nil {
+		h.logger.Warn("Failed to write to PTY", "session_id", client.sessionID, "error", err)
+	}
+	return err
+}
+
+// acknowledge reports the result of writing a stdin or command message to
+// the client that sent it. A message with an ID is answered with an ack,
+// whether the write succeeded or not; otherwise only a failure is reported,
+// as an error message.
+func acknowledge(client *Client, msg *Message, err error) {
+	errMsg := "Failed to write input to the terminal"
+	if msg.Type == MessageTypeCommand {
+		errMsg = "Failed to write command to the terminal"
+	}
+	if errors.Is(err, errInputRateLimited) {
+		errMsg = "Input rate limit exceeded, input dropped"
+	}
+
+	if msg.ID == "" {
+		if err != nil {
+			rejectMessage(client, msg.Type, writeErrorCode(err), errMsg)
+		}
+		return
+	}
+
+	ack := &Message{Type: MessageTypeAck, ID: msg.ID, State: AckDelivered}
 	if err != nil {
-		log.Printf("Failed to write to PTY: %v", err)
+		ack.State = AckFailed
+		ack.Error = errMsg
+		ack.ErrorCode = writeErrorCode(err)
+	}
+	client.sendReply(ack)
+}
+
+// eventResponseKinds lists the SmartEvent kinds that clients may answer.
+var eventResponseKinds = map[string]bool{
+	"question":       true,
+	"claude_confirm": true,
+	"gemini_confirm": true,
+	"sudo_password":  true,
+	"shell_prompt":   true,
+	"password":       true,
+	"press_any_key":  true,
+}
+
+// ptyWriter writes input to a PTY.
+type ptyWriter interface {
+	Write(data []byte) error
+}
+
+// handleEventResponse answers a SmartEvent by writing the session driver's
+// input for the response to the PTY. The driver must support
+// auto-respond; otherwise clients have to send the keystrokes as stdin.
+func (h *Handler) handleEventResponse(client *Client, msg *Message, w ptyWriter) {
+	sessionDriver := h.GetSessionDriver(client.sessionID)
+	if !sessionDriver.Capabilities().SupportsAutoRespond {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidEventResponse, "Driver "+sessionDriver.Name()+" does not support event responses")
+		return
+	}
+
+	var resp EventResponse
+	if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidEventResponse, "Invalid event response payload")
+		return
+	}
+	if !eventResponseKinds[resp.Kind] {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidEventResponse, "Unknown event kind: "+resp.Kind)
+		return
+	}
+	if resp.Response == "" {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidEventResponse, "Event response is required")
+		return
+	}
+
+	event := driver.SmartEvent{Kind: resp.Kind, Options: resp.Options}
+	input := sessionDriver.RespondToEvent(event, resp.Response)
+	if err := w.Write(input); err != nil {
+		h.logger.Warn("Failed to write to PTY", "session_id", client.sessionID, "error", err)
+		rejectMessage(client, msg.Type, writeErrorCode(err), "Failed to write event response to the terminal")
+		return
+	}
+
+	// Answer the event, or any pending event of its kind if no ID was sent
+	h.resolveEvents(client.sessionID, func(pending driver.SmartEvent) bool {
+		if resp.ID != "" {
+			return pending.ID == resp.ID
+		}
+		return pending.Kind == resp.Kind
+	})
+}
+
+// inputActionTypes lists the driver.InputAction types that clients may send.
+var inputActionTypes = map[string]bool{
+	"text":      true,
+	"command":   true,
+	"key":       true,
+	"confirm":   true,
+	"cancel":    true,
+	"interrupt": true,
+}
+
+// handleInputAction writes a named input, such as a key, to the PTY using
+// the session driver's FormatInput.
+func (h *Handler) handleInputAction(client *Client, msg *Message, w ptyWriter) {
+	var action driver.InputAction
+	if err := json.Unmarshal(msg.Payload, &action); err != nil {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidInputAction, "Invalid input action payload")
+		return
+	}
+	if !inputActionTypes[action.Type] {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidInputAction, "Unknown input action type: "+action.Type)
+		return
+	}
+
+	input := h.GetSessionDriver(client.sessionID).FormatInput(action)
+	if len(input) == 0 {
+		return
+	}
+	if err := w.Write(input); err != nil {
+		h.logger.Warn("Failed to write to PTY", "session_id", client.sessionID, "error", err)
+		rejectMessage(client, msg.Type, writeErrorCode(err), "Failed to write input action to the terminal")
+		return
+	}
+	h.resolveInput(client.sessionID, input)
+}
+
+// ptyResizer resizes a PTY.
+type ptyResizer interface {
+	Resize(rows, cols uint16) error
+}
+
+// outputDismisser dismisses interactive output in a PTY.
+type outputDismisser interface {
+	DismissOutput() error
+}
+
+// handleDismiss dismisses interactive output and tells all clients, so views
+// showing the dialog can close it. It takes about a second, so it runs on
+// the session's input queue.
+func (h *Handler) handleDismiss(client *Client, d outputDismisser) {
+	if err := d.DismissOutput(); err != nil {
+		h.logger.Warn("Failed to dismiss output", "session_id", client.sessionID, "error", err)
+		rejectMessage(client, MessageTypeDismiss, writeErrorCode(err), "Cannot dismiss output: "+err.Error())
+		return
+	}
+
+	if hub := h.hubManager.Get(client.sessionID); hub != nil {
+		if err := hub.BroadcastMessage(&Message{Type: MessageTypeDismissed}); err != nil {
+			h.logger.Error("Failed to broadcast dismiss", "session_id", client.sessionID, "error", err)
+		}
+	}
+}
+
+// Focus reports written to the PTY for focus and blur messages, as sent by
+// xterm in focus tracking mode (DECSET 1004).
+var (
+	focusInReport  = []byte("\x1b[I")
+	focusOutReport = []byte("\x1b[O")
+)
+
+// handleFocus writes the focus in report for a focus message, or the focus
+// out report for a blur message, to the PTY, for applications that track
+// focus, such as vim's FocusGained autocommands. Clients should only send
+// them while the application has enabled focus tracking with \x1b[?1004h,
+// since other applications read the reports as keystrokes.
+func (h *Handler) handleFocus(client *Client, msg *Message, w ptyWriter) {
+	report := focusInReport
+	if msg.Type == MessageTypeBlur {
+		report = focusOutReport
+	}
+	if err := w.Write(report); err != nil {
+		h.logger.Warn("Failed to write focus report", "session_id", client.sessionID, "error", err)
+		rejectMessage(client, msg.Type, writeErrorCode(err), "Failed to write focus change to the terminal")
+	}
+}
+
+// markerAdder adds markers to a session's recording.
+type markerAdder interface {
+	AddMarker(label string) error
+}
+
+// handleMarker adds a marker labelled with the message's data to the
+// session's recording.
+func (h *Handler) handleMarker(client *Client, msg *Message, m markerAdder) {
+	if msg.Data == "" {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidMessage, "Marker label is required")
+		return
+	}
+	if err := m.AddMarker(msg.Data); err != nil {
+		h.logger.Warn("Failed to add marker", "session_id", client.sessionID, "error", err)
+		code := ErrorCodeMarkerFailed
+		if errors.Is(err, pty.ErrProcessClosed) {
+			code = ErrorCodeProcessExited
+		}
+		rejectMessage(client, msg.Type, code, "Failed to add marker: "+err.Error())
+	}
+}
+
+// writeErrorCode returns the error code for a failed write to a PTY.
+func writeErrorCode(err error) string {
+	if errors.Is(err, pty.ErrProcessClosed) {
+		return ErrorCodeProcessExited
+	}
+	if errors.Is(err, errInputRateLimited) {
+		return ErrorCodeRateLimited
+	}
+	return ErrorCodePTYWriteFailed
+}
+
+// rejectMessage tells a client that its message of type t failed or was
+// refused, with one of the ErrorCode* constants. t is empty if the message
+// could not be decoded.
+func rejectMessage(client *Client, t MessageType, code, errMsg string) {
+	fields := map[string]string{"code": code}
+	if t != "" {
+		fields["type"] = string(t)
 	}
+	payload, _ := json.Marshal(fields)
+	client.sendReply(&Message{
+		Type:      MessageTypeError,
+		Error:     errMsg,
+		ErrorCode: code,
+		Payload:   payload,
+	})
 }
 
 // handleResize handles terminal resize events.
-func (h *Handler) handleResize(msg *Message, ptyProcess *pty.PTYProcess) {
+func (h *Handler) handleResize(client *Client, msg *Message, r ptyResizer) {
 	if msg.Rows == 0 || msg.Cols == 0 {
 		return
 	}
 
 	// Resize PTY (Requirement 3.4)
-	err := ptyProcess.Resize(msg.Rows, msg.Cols)
+	err := r.Resize(msg.Rows, msg.Cols)
 	if err != nil {
-		log.Printf("Failed to resize PTY: %v", err)
+		h.logger.Warn("Failed to resize PTY", "session_id", client.sessionID, "error", err)
+		code := ErrorCodeResizeFailed
+		if errors.Is(err, pty.ErrProcessClosed) {
+			code = ErrorCodeProcessExited
+		}
+		rejectMessage(client, msg.Type, code, "Failed to resize the terminal")
+		return
+	}
+
+	// Let the other clients follow the new geometry
+	if hub := h.hubManager.Get(client.sessionID); hub != nil {
+		resize := &Message{Type: MessageTypeResize, Rows: msg.Rows, Cols: msg.Cols}
+		if err := hub.BroadcastExcept(client, resize); err != nil {
+			h.logger.Error("Failed to broadcast resize", "session_id", client.sessionID, "error", err)
+		}
 	}
 }
 
-// handlePing handles ping messages from the client.
-func (h *Handler) handlePing(client *Client) {
-	msg := &Message{Type: MessageTypePong}
-	data, err := json.Marshal(msg)
-	if err != nil {
+// sendSize sends the current PTY size to a newly attached client.
+func (h *Handler) sendSize(client *Client, ptyProcess *pty.PTYProcess) {
+	rows, cols := ptyProcess.Size()
+	if rows == 0 || cols == 0 {
 		return
 	}
-	client.Send(data)
+	if err := client.sendReply(&Message{Type: MessageTypeResize, Rows: rows, Cols: cols}); err != nil {
+		h.logger.Error("Failed to send resize message", "session_id", client.sessionID, "error", err)
+	}
+}
+
+// handlePing handles ping messages from the client.
+func (h *Handler) handlePing(client *Client) {
+	client.sendReply(&Message{Type: MessageTypePong})
 }
 
 // readPump pumps messages from the WebSocket connection to the hub.
 func (h *Handler) readPump(client *Client, hub *Hub) {
 	defer func() {
+		close(client.readDone)
 		hub.Unregister(client)
 		client.Conn().Close()
+		if client.release != nil {
+			client.release()
+		}
 	}()
 
-	client.Conn().SetReadLimit(maxMessageSize)
+	client.Conn().SetReadLimit(h.maxMessageSize())
 	client.Conn().SetReadDeadline(time.Now().Add(pongWait))
 	client.Conn().SetPongHandler(func(string) error {
 		client.Conn().SetReadDeadline(time.Now().Add(pongWait))
@@ -228,14 +886,25 @@ func (h *Handler) readPump(client *Client, hub *Hub) {
 		_, message, err := client.Conn().ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				h.logger.Warn("WebSocket error", "session_id", client.sessionID, "error", err)
 			}
 			break
 		}
 
 		var msg Message
 		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
+			h.logger.Debug("Failed to unmarshal message", "session_id", client.sessionID, "error", err)
+			rejectMessage(client, "", ErrorCodeInvalidMessage, "Invalid message: "+err.Error())
+			continue
+		}
+
+		// Heartbeats keep the connection open, not the client active
+		if msg.Type != MessageTypePing {
+			client.touch()
+		}
+		if err := validateMessage(&msg); err != nil {
+			h.logger.Debug("Rejected invalid message", "session_id", client.sessionID, "error", err)
+			rejectInvalid(client, &msg, err)
 			continue
 		}
 
@@ -246,102 +915,301 @@ func (h *Handler) readPump(client *Client, hub *Hub) {
 // writePump pumps messages from the hub to the WebSocket connection.
 func (h *Handler) writePump(client *Client) {
 	ticker := time.NewTicker(pingPeriod)
+
+	// Checks for inactivity run here rather than in a goroutine per client
+	idleTimeout := h.idleTimeout()
+	var idleTimer *time.Timer
+	var idle <-chan time.Time
+	if idleTimeout > 0 {
+		idleTimer = time.NewTimer(idleTimeout)
+		idle = idleTimer.C
+	}
+
 	defer func() {
 		ticker.Stop()
+		if idleTimer != nil {
+			idleTimer.Stop()
+		}
 		client.Conn().Close()
+		close(client.writeDone)
 	}()
 
+	// Once the client is closing, queued pongs are dropped so the close
+	// frame directly follows the messages that matter, such as the
+	// idle_disconnect status
+	closing := false
+	done := client.done
 	for {
 		select {
-		case message, ok := <-client.SendChan():
-			client.Conn().SetWriteDeadline(time.Now().Add(writeWait))
+		case <-done:
+			// The client is closing; stop pinging and write what is
+			// queued until the send channel is closed
+			ticker.Stop()
+			done = nil
+			idle = nil
+			closing = true
+		case <-idle:
+			if remaining := idleTimeout - client.idleFor(); remaining > 0 {
+				idleTimer.Reset(remaining)
+				continue
+			}
+			idle = nil
+			if !h.closeIdle(client, idleTimeout) {
+				return
+			}
+			closing = true
+		case frame, ok := <-client.SendChan():
 			if !ok {
 				// The hub closed the channel
-				client.Conn().WriteMessage(websocket.CloseMessage, []byte{})
+				data, hasCode := client.closeMessage()
+				client.Conn().SetWriteDeadline(time.Now().Add(h.writeTimeout()))
+				if err := client.Conn().WriteMessage(websocket.CloseMessage, data); err != nil || !hasCode {
+					return
+				}
+
+				// Give the peer a moment to answer, which ends readPump
+				select {
+				case <-client.readDone:
+				case <-time.After(closeAckWait):
+				}
 				return
 			}
 
 			// Send each message in a separate WebSocket frame
 			// This ensures JSON.parse() works correctly on the frontend
-			if err := client.Conn().WriteMessage(websocket.TextMessage, message); err != nil {
+			if !(closing && frame.Heartbeat) && !h.checkWrite(client, h.writeFrame(client, frame)) {
 				return
 			}
+			active := !frame.Heartbeat
 
 			// Process any queued messages, sending each in its own frame
 			n := len(client.SendChan())
 			for i := 0; i < n; i++ {
-				queuedMsg := <-client.SendChan()
-				client.Conn().SetWriteDeadline(time.Now().Add(writeWait))
-				if err := client.Conn().WriteMessage(websocket.TextMessage, queuedMsg); err != nil {
+				next := <-client.SendChan()
+				if closing && next.Heartbeat {
+					continue
+				}
+				if !h.checkWrite(client, h.writeFrame(client, next)) {
 					return
 				}
+				active = active || !next.Heartbeat
+			}
+			if active {
+				client.touch()
+			}
+
+			// Tell the client if output was dropped to keep up
+			if !h.checkWrite(client, h.reportDrops(client)) {
+				return
 			}
 		case <-ticker.C:
-			client.Conn().SetWriteDeadline(time.Now().Add(writeWait))
-			if err := client.Conn().WriteMessage(websocket.PingMessage, nil); err != nil {
+			client.Conn().SetWriteDeadline(time.Now().Add(h.writeTimeout()))
+			if !h.checkWrite(client, client.Conn().WriteMessage(websocket.PingMessage, nil)) {
 				return
 			}
 		}
 	}
 }
 
-// BroadcastOutput broadcasts PTY output to all connected clients.
-// This should be called from the PTY output callback.
-func (h *Handler) BroadcastOutput(sessionID string, data []byte) {
-	hub := h.hubManager.Get(sessionID)
-	if hub == nil {
-		return
+// checkWrite reports whether the write pump should go on after a write to
+// the client's connection; any error ends it. A write that missed its
+// deadline may have left a partial frame on the connection, and every later
+// write fails the same way, so the client is counted in the hub's stats and
+// unregistered at once rather than kept as a live client.
+func (h *Handler) checkWrite(client *Client, err error) bool {
+	if err == nil {
+		return true
 	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return false
+	}
+
+	h.logger.Warn("WebSocket write timed out, unregistering client", "session_id", client.sessionID, "remote_addr", client.remoteAddr)
+	if client.hub != nil {
+		client.hub.stats.writeTimeouts.Add(1)
+		client.hub.Unregister(client)
+	}
+	return false
+}
 
-	// Get session-specific driver (Requirement 6.1)
-	sessionDriver := h.GetSessionDriver(sessionID)
+// compressionLevel returns CompressionLevel, or flate.BestSpeed if unset.
+func (h *Handler) compressionLevel() int {
+	if h.CompressionLevel != 0 {
+		return h.CompressionLevel
+	}
+	return flate.BestSpeed
+}
 
-	// Parse output through driver for smart events
-	result, err := sessionDriver.Parse(data)
+// writeTimeout returns WriteTimeout, or the default write deadline.
+func (h *Handler) writeTimeout() time.Duration {
+	if h.WriteTimeout > 0 {
+		return h.WriteTimeout
+	}
+	return writeWait
+}
+
+// maxMessageSize returns the read limit for client messages.
+func (h *Handler) maxMessageSize() int64 {
+	if h.MaxMessageSize > 0 {
+		return h.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
+}
+
+// writeFrame writes a single frame to the client's connection, compressing
+// it if compression was negotiated and the frame exceeds CompressThreshold.
+func (h *Handler) writeFrame(client *Client, frame Frame) error {
+	conn := client.Conn()
+	conn.SetWriteDeadline(time.Now().Add(h.writeTimeout()))
+	if h.CompressOutput {
+		conn.EnableWriteCompression(len(frame.Data) > h.CompressThreshold)
+	}
+	return conn.WriteMessage(frame.wsMessageType(), frame.Data)
+}
+
+// reportDrops sends an error message to the client if frames were dropped
+// by BackpressureDropOldest since the last report.
+func (h *Handler) reportDrops(client *Client) error {
+	n := client.takeUnreportedDrops()
+	if n == 0 {
+		return nil
+	}
+
+	frame, err := encodeMessage(&Message{
+		Type:      MessageTypeError,
+		Error:     fmt.Sprintf("Dropped %d output messages: client is not keeping up", n),
+		ErrorCode: ErrorCodeOutputDropped,
+	}, false)
 	if err != nil {
-		log.Printf("Driver parse error: %v", err)
-		result = &driver.ParseResult{RawData: data}
+		return err
 	}
+	return h.writeFrame(client, frame)
+}
 
-	// Send stdout message (Requirement 3.3, 3.5 - ANSI sequences preserved)
-	stdoutMsg := &Message{
-		Type: MessageTypeStdout,
-		Data: string(result.RawData),
+// upgrader returns the upgrader for this handler, with compression
+// negotiation enabled when CompressOutput is set.
+func (h *Handler) upgrader() *websocket.Upgrader {
+	if !h.CompressOutput {
+		return &upgrader
 	}
-	hub.BroadcastMessage(stdoutMsg)
+	u := upgrader
+	u.EnableCompression = true
+	return &u
+}
 
-	// Send smart events if any (Requirement 6.2, 6.5)
-	for _, event := range result.SmartEvents {
-		payload, err := json.Marshal(event)
-		if err != nil {
-			continue
+// BroadcastOutput broadcasts PTY output to all connected clients.
+// This should be called from the PTY output callback.
+// It returns ErrHubClosed if the session's hub was closed during teardown.
+// The output is parsed for smart events by the session's parse worker, so a
+// slow driver does not delay stdout; see queueParse.
+func (h *Handler) BroadcastOutput(sessionID string, data []byte) error {
+	// Send stdout message (Requirement 3.3, 3.5 - ANSI sequences preserved)
+	// The output has already been written to the ring buffer, so the
+	// current cursor marks the end of this chunk.
+	cursor := h.outputCursor(sessionID)
+	hub := h.hubManager.Get(sessionID)
+	if hub != nil && h.CoalesceWindow > 0 {
+		// The parse worker flushes pending output before broadcasting
+		// events, so they follow the output they refer to
+		if err := h.queueOutput(hub, sessionID, data, cursor, false); err != nil {
+			return err
+		}
+	} else if hub != nil {
+		stdoutMsg := &Message{
+			Type:   MessageTypeStdout,
+			Data:   string(data),
+			Cursor: cursor,
 		}
-		eventMsg := &Message{
-			Type:    MessageTypeSmartEvent,
-			Payload: payload,
+		if err := hub.BroadcastMessage(stdoutMsg); err != nil {
+			return err
 		}
-		hub.BroadcastMessage(eventMsg)
 	}
 
-	// Send parsed conversation messages if any
-	for _, msg := range result.Messages {
-		payload, err := json.Marshal(msg)
-		if err != nil {
-			continue
-		}
-		conversationMsg := &Message{
-			Type:    MessageTypeConversation,
-			Payload: payload,
-		}
-		hub.BroadcastMessage(conversationMsg)
+	// Parse output through the driver even while no client receives the
+	// results, so automatic responses, pending events and the conversation
+	// history keep up with it
+	h.queueParse(hub, sessionID, data, cursor)
+	return nil
+}
+
+// parseReplayBytes is how much of the output preceding a chunk is replayed
+// through the session's driver when parsing resumes, so stateful drivers see
+// the context of the chunk.
+const parseReplayBytes = 4 * 1024
+
+// skipParsing records that output of the session bypassed its driver.
+func (h *Handler) skipParsing(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.unparsed == nil {
+		h.unparsed = make(map[string]bool)
 	}
+	h.unparsed[sessionID] = true
+}
+
+// resumeParsing reports whether output of the session bypassed its driver
+// since it was last parsed, and clears the mark.
+func (h *Handler) resumeParsing(sessionID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	skipped := h.unparsed[sessionID]
+	delete(h.unparsed, sessionID)
+	return skipped
+}
+
+// replayToDriver resets a driver that has missed output and feeds it up to
+// parseReplayBytes of the buffered output before the ring buffer cursor
+// start, discarding the results. The driver's state then reflects
+// recent output rather than whatever it last parsed.
+func (h *Handler) replayToDriver(ctx context.Context, sessionID string, d driver.AgentDriver, start int64) {
+	d.Reset()
+	if h.ptyManager == nil {
+		return
+	}
+	ptyProcess, ok := h.ptyManager.Get(sessionID)
+	if !ok || ptyProcess.RingBuffer == nil {
+		return
+	}
+
+	end := int(start)
+	data, cursor := ptyProcess.RingBuffer.ReadFrom(max(end-parseReplayBytes, 0))
+	after := cursor - end
+	if after < 0 || after > len(data) {
+		return
+	}
+	tail := data[:len(data)-after]
+	if len(tail) > parseReplayBytes {
+		tail = tail[len(tail)-parseReplayBytes:]
+	}
+	if len(tail) > 0 {
+		d.Parse(ctx, tail)
+	}
+}
+
+// WatchOutput broadcasts the output of ptyProcess to the session's clients
+// until the returned function is called. Output reaches clients only while a
+// listener is registered, so register it once per process, when it is
+// spawned, rather than per connection (Requirement 3.3).
+func (h *Handler) WatchOutput(sessionID string, ptyProcess *pty.PTYProcess) (remove func()) {
+	return ptyProcess.AddOutputListener(func(data []byte) {
+		if err := h.BroadcastOutput(sessionID, data); err != nil {
+			h.logger.Error("Failed to broadcast output", "session_id", sessionID, "error", err)
+		}
+	})
 }
 
 // BroadcastStatus broadcasts session status changes to all connected clients.
-func (h *Handler) BroadcastStatus(sessionID string, state string, exitCode *int) {
+// It returns ErrHubClosed if the session's hub has been closed.
+func (h *Handler) BroadcastStatus(sessionID string, state string, exitCode *int) error {
 	hub := h.hubManager.Get(sessionID)
 	if hub == nil {
-		return
+		return nil
+	}
+
+	// Deliver any coalesced output before the status change
+	if err := h.FlushOutput(sessionID); err != nil {
+		return err
 	}
 
 	msg := &Message{
@@ -349,21 +1217,51 @@ func (h *Handler) BroadcastStatus(sessionID string, state string, exitCode *int)
 		State: state,
 		Code:  exitCode,
 	}
-	hub.BroadcastMessage(msg)
+	return hub.BroadcastMessage(msg)
 }
 
-// BroadcastError broadcasts an error message to all connected clients.
-func (h *Handler) BroadcastError(sessionID string, errMsg string) {
+// BroadcastAlert broadcasts an alert, such as AlertWatchdog, with a
+// human-readable message to all connected clients.
+// It returns ErrHubClosed if the session's hub has been closed.
+func (h *Handler) BroadcastAlert(sessionID string, alert string, message string) error {
 	hub := h.hubManager.Get(sessionID)
 	if hub == nil {
-		return
+		return nil
+	}
+
+	// Deliver any coalesced output before the alert
+	if err := h.FlushOutput(sessionID); err != nil {
+		return err
+	}
+
+	msg := &Message{
+		Type:  MessageTypeAlert,
+		State: alert,
+		Data:  message,
+	}
+	return hub.BroadcastMessage(msg)
+}
+
+// BroadcastError broadcasts an error message with one of the ErrorCode*
+// constants to all connected clients.
+// It returns ErrHubClosed if the session's hub has been closed.
+func (h *Handler) BroadcastError(sessionID string, code, errMsg string) error {
+	hub := h.hubManager.Get(sessionID)
+	if hub == nil {
+		return nil
+	}
+
+	// Deliver any coalesced output before the error
+	if err := h.FlushOutput(sessionID); err != nil {
+		return err
 	}
 
 	msg := &Message{
-		Type:  MessageTypeError,
-		Error: errMsg,
+		Type:      MessageTypeError,
+		Error:     errMsg,
+		ErrorCode: code,
 	}
-	hub.BroadcastMessage(msg)
+	return hub.BroadcastMessage(msg)
 }
 
 // GetUpgrader returns the WebSocket upgrader for custom configuration.
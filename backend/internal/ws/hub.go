@@ -2,10 +2,17 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/metrics"
 )
 
 // MessageType represents the type of WebSocket message.
@@ -18,6 +25,30 @@ const (
 	MessageTypeResize  MessageType = "resize"
 	MessageTypePing    MessageType = "ping"
 
+	// MessageTypeEventResponse answers a SmartEvent; its payload is an
+	// EventResponse
+	MessageTypeEventResponse MessageType = "event_response"
+
+	// MessageTypeInputAction sends a named input such as a key; its payload
+	// is a driver.InputAction
+	MessageTypeInputAction MessageType = "input_action"
+
+	// MessageTypeDismiss presses Enter to dismiss interactive output, such
+	// as the screen shown by /doctor
+	MessageTypeDismiss MessageType = "dismiss"
+
+	// MessageTypeScrollback requests up to lines lines of output from
+	// before cursor, or before the hot-restore history if it has none,
+	// from the session's recording. They are sent as history messages
+	// followed by a history_end message in RestoreScrollback mode.
+	MessageTypeScrollback MessageType = "scrollback"
+
+	// MessageTypeFocus and MessageTypeBlur report that the client's
+	// terminal gained or lost focus; they are written to the PTY as the
+	// focus in and focus out reports of xterm's focus tracking mode
+	MessageTypeFocus MessageType = "focus"
+	MessageTypeBlur  MessageType = "blur"
+
 	// Server -> Client message types
 	MessageTypeStdout       MessageType = "stdout"
 	MessageTypeSmartEvent   MessageType = "smart_event"
@@ -26,65 +57,570 @@ const (
 	MessageTypePong         MessageType = "pong"
 	MessageTypeError        MessageType = "error"
 	MessageTypeConversation MessageType = "conversation"
+
+	// MessageTypeDismissed tells clients that interactive output was
+	// dismissed by a dismiss message
+	MessageTypeDismissed MessageType = "dismissed"
+
+	// MessageTypeAlert warns clients about a problem with the session,
+	// such as a process that has stopped producing output
+	MessageTypeAlert MessageType = "alert"
+
+	// MessageTypeSmartEventResolved tells clients that a smart event they
+	// were sent no longer waits for an answer; its payload is a
+	// SmartEventResolved
+	MessageTypeSmartEventResolved MessageType = "smart_event_resolved"
+
+	// MessageTypeConversationHistory follows the history sent on attach to
+	// clients subscribed to conversation messages; its payload is the
+	// session's latest driver.Message values, oldest first
+	MessageTypeConversationHistory MessageType = "conversation_history"
+
+	// MessageTypeHistoryEnd follows the history sent on attach, including
+	// an empty one, once the restore is complete; its payload is a
+	// HistoryEnd and its seq the latest broadcast sequence number
+	MessageTypeHistoryEnd MessageType = "history_end"
+
+	// MessageTypeControlRequest asks for the session's input lock. The
+	// requesting client is sent control_grant and takes the lock from any
+	// current holder.
+	MessageTypeControlRequest MessageType = "control_request"
+
+	// MessageTypeControlGrant tells a client it holds the input lock; its
+	// data is the client's ID
+	MessageTypeControlGrant MessageType = "control_grant"
+
+	// MessageTypeControlRelease gives up the input lock. The server sends it
+	// to a client that has lost the lock, with the new holder's ID as data.
+	MessageTypeControlRelease MessageType = "control_release"
+
+	// MessageTypeAck answers a stdin or command message that carried an id,
+	// once its input has been written to the PTY. Its id is the message's,
+	// its state AckDelivered or AckFailed, and a failure has an error code.
+	MessageTypeAck MessageType = "ack"
+
+	// MessageTypeMarker adds a marker labelled with its data to the
+	// session's recording. Replays send recorded markers as marker messages.
+	MessageTypeMarker MessageType = "marker"
+
+	// Session feed message types, sent on a user's session feed rather
+	// than a session's hub. Their payload describes the session; see
+	// Service.PublishSessionEvent.
+	MessageTypeSessionCreated MessageType = "session_created"
+	MessageTypeSessionStatus  MessageType = "session_status"
+	MessageTypeSessionDeleted MessageType = "session_deleted"
+)
+
+// Ack states.
+const (
+	AckDelivered = "delivered"
+	AckFailed    = "failed"
+)
+
+// HistoryChunkSize is the maximum number of history bytes sent in one
+// history message.
+const HistoryChunkSize = 16 * 1024
+
+// AlertWatchdog is the alert state sent when a process has produced no
+// output for its watchdog timeout and may be stuck.
+const AlertWatchdog = "watchdog"
+
+// ErrHubClosed is returned when broadcasting on a hub that has been closed.
+var ErrHubClosed = errors.New("hub is closed")
+
+// ErrClientClosed is returned when sending to a client that has been closed.
+var ErrClientClosed = errors.New("client is closed")
+
+// ErrHubFull is returned when registering a client on a hub that already
+// has MaxClients clients besides its owner.
+var ErrHubFull = errors.New("hub has reached its client limit")
+
+// Error codes identify the cause of an error message, so clients can react
+// without matching its text. They are sent in the message's errorCode field
+// and, for compatibility, as the code of its payload.
+const (
+	// ErrorCodeReadOnly is sent when a read-only client tries to send input.
+	ErrorCodeReadOnly = "READ_ONLY"
+
+	// ErrorCodeTooManyClients is the HTTP error code returned when a
+	// session has reached its client limit.
+	ErrorCodeTooManyClients = "TOO_MANY_CLIENTS"
+
+	// ErrorCodeTooManyConnections is the HTTP error code returned when a
+	// user has reached the handler's MaxConnsPerUser.
+	ErrorCodeTooManyConnections = "TOO_MANY_CONNECTIONS"
+
+	// ErrorCodeInvalidEventResponse is sent when an event_response message
+	// cannot be answered, including when the session driver does not
+	// support event responses.
+	ErrorCodeInvalidEventResponse = "INVALID_EVENT_RESPONSE"
+
+	// ErrorCodeInvalidInputAction is sent when an input_action message
+	// cannot be formatted.
+	ErrorCodeInvalidInputAction = "INVALID_INPUT_ACTION"
+
+	// ErrorCodeProcessExited is sent when a message needs a running process
+	// but the session's process has exited.
+	ErrorCodeProcessExited = "PROCESS_EXITED"
+
+	// ErrorCodeInvalidMessage is sent when a client's message cannot be
+	// decoded.
+	ErrorCodeInvalidMessage = "INVALID_MESSAGE"
+
+	// ErrorCodePTYWriteFailed is sent when a client's input could not be
+	// written to the terminal. Retrying may succeed.
+	ErrorCodePTYWriteFailed = "PTY_WRITE_FAILED"
+
+	// ErrorCodeResizeFailed is sent when the terminal could not be resized.
+	ErrorCodeResizeFailed = "RESIZE_FAILED"
+
+	// ErrorCodeOutputDropped is sent when output was dropped because the
+	// client is not keeping up; see BackpressureDropOldest.
+	ErrorCodeOutputDropped = "OUTPUT_DROPPED"
+
+	// ErrorCodeMarkerFailed is sent when a marker could not be added to the
+	// session's recording, e.g. because it is not recorded.
+	ErrorCodeMarkerFailed = "MARKER_FAILED"
+
+	// ErrorCodeRateLimited is sent when a client message was dropped
+	// because the client exceeded its input rate limit.
+	ErrorCodeRateLimited = "RATE_LIMITED"
+
+	// ErrorCodeScrollbackFailed is sent when scrollback could not be read
+	// from the session's recording, e.g. because it is not recorded.
+	ErrorCodeScrollbackFailed = "SCROLLBACK_FAILED"
 )
 
+// StateServerShutdown is the status state broadcast before the server
+// closes client connections on shutdown.
+const StateServerShutdown = "server_shutdown"
+
+// StateTTLExpired is the status state broadcast when a session is
+// terminated for exceeding its maximum duration.
+const StateTTLExpired = "ttl_expired"
+
+// StateControl is the status state broadcast when the input lock changes
+// hands, with the ID of the client holding it as data, or no data once it
+// is released. It is also sent to a client whose input was dropped because
+// another client holds the lock.
+const StateControl = "control"
+
+// StateRestarted is the status state broadcast when a session's process is
+// replaced, before any output of the new process.
+const StateRestarted = "restarted"
+
+// StateIdleDisconnect is the status state sent to a client that has been
+// idle for the handler's IdleTimeout, before its connection is closed.
+const StateIdleDisconnect = "idle_disconnect"
+
+// DefaultDrainTimeout is how long Service.Close waits for clients to
+// acknowledge the close frame sent on shutdown.
+const DefaultDrainTimeout = 5 * time.Second
+
 // Message represents a WebSocket message.
 type Message struct {
-	Type    MessageType     `json:"type"`
-	Data    string          `json:"data,omitempty"`
-	Rows    uint16          `json:"rows,omitempty"`
-	Cols    uint16          `json:"cols,omitempty"`
-	Payload json.RawMessage `json:"payload,omitempty"`
-	State   string          `json:"state,omitempty"`
-	Code    *int            `json:"code,omitempty"`
-	Error   string          `json:"error,omitempty"`
+	Type      MessageType     `json:"type"`
+	Data      string          `json:"data,omitempty"`
+	Rows      uint16          `json:"rows,omitempty"`
+	Cols      uint16          `json:"cols,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	State     string          `json:"state,omitempty"`
+	Code      *int            `json:"code,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode string          `json:"errorCode,omitempty"` // ErrorCode* constant of an error message
+	Seq       uint64          `json:"seq,omitempty"`       // Hub broadcast sequence number
+	Cursor    int64           `json:"cursor,omitempty"`    // Ring buffer position after this output
+	ID        string          `json:"id,omitempty"`        // Client-chosen ID of a stdin, command or scrollback message, echoed in its reply
+	Lines     int             `json:"lines,omitempty"`     // Lines requested by a scrollback message
+}
+
+// EventResponse is the payload of an event_response message: the user's
+// answer to a SmartEvent of the given kind.
+type EventResponse struct {
+	ID       string   `json:"id,omitempty"` // ID of the answered event, if known
+	Kind     string   `json:"kind"`
+	Response string   `json:"response"`
+	Options  []string `json:"options,omitempty"` // Options of the event, if known
+}
+
+// Restore modes reported in a history_end message.
+const (
+	// RestoreFull means the whole ring buffer was sent as history and the
+	// client should reset its terminal first.
+	RestoreFull = "full"
+
+	// RestoreIncremental means only the output after the client's cursor
+	// or sequence number was sent, as stdout.
+	RestoreIncremental = "incremental"
+
+	// RestoreScrollback means older output requested by a scrollback
+	// message was sent as history, to be prepended to the terminal's
+	// scrollback.
+	RestoreScrollback = "scrollback"
+)
+
+// HistoryEnd is the payload of a history_end message.
+type HistoryEnd struct {
+	Bytes    int    `json:"bytes"`              // Total history bytes sent before it
+	Mode     string `json:"mode"`               // RestoreFull, RestoreIncremental or RestoreScrollback
+	Complete bool   `json:"complete,omitempty"` // Scrollback reached the start of the recording
+}
+
+// outputIndexSize is how many recent stdout messages a hub remembers the
+// ring buffer cursor of, for clients resuming with ?since_seq=.
+const outputIndexSize = 1024
+
+// outputMark is the ring buffer cursor after a broadcast stdout message.
+type outputMark struct {
+	seq    uint64
+	cursor int64
 }
 
 // Client represents a WebSocket client connection.
 type Client struct {
+	id        string
 	hub       *Hub
 	conn      *websocket.Conn
 	sessionID string
-	send      chan []byte
+	send      chan Frame
+	binary    bool // Receive stdout/history as binary frames
+	readOnly  bool // Observer client; input messages are dropped
 	mu        sync.Mutex
 	closed    bool
+
+	// Driver-produced message types the client receives; nil means all.
+	// Guarded by subMu rather than mu, which a blocked sender holds.
+	subscriptions map[MessageType]bool
+	subMu         sync.RWMutex
+
+	// While restoring, broadcasts are held in pending and queued after the
+	// history so live output cannot overtake it
+	restoring bool
+	pending   []Frame
+
+	// Closed once when the client shuts down, before send is closed, so a
+	// sender blocked on a full queue and the write pump can both see it
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Close frame sent when the send channel is closed; code 0 sends an
+	// empty close frame
+	closeCode   int
+	closeReason string
+
+	// Closed when the connection's read and write pumps return
+	readDone  chan struct{}
+	writeDone chan struct{}
+
+	// release frees the connection's slot in its user's connection count
+	// when the read pump returns; nil if it is not counted
+	release func()
+
+	// Backpressure handling for a full send queue
+	policy       BackpressurePolicy
+	blockTimeout time.Duration
+	dropped      uint64 // Frames discarded by BackpressureDropOldest
+	droppedBytes uint64 // Payload bytes discarded by BackpressureDropOldest
+	reported     uint64 // Drops already reported to the client
+
+	// Connection statistics, readable without holding mu
+	remoteAddr   string
+	connectedAt  time.Time
+	messagesSent atomic.Uint64 // Frames queued for sending
+	bytesSent    atomic.Uint64 // Payload bytes queued for sending
+
+	// limiter limits the input bytes the client may send; nil
+	// means no limit. Atomic, since a blocked sender may hold mu.
+	limiter atomic.Pointer[inputLimiter]
+
+	// lastActivity is when, in Unix nanoseconds, the client last sent a
+	// message or was delivered a frame; see Handler.IdleTimeout
+	lastActivity atomic.Int64
+
+	// scrollbackMu keeps the replies to the client's scrollback requests,
+	// which are read off the read pump, from interleaving
+	scrollbackMu sync.Mutex
 }
 
 // NewClient creates a new WebSocket client.
-func NewClient(hub *Hub, conn *websocket.Conn, sessionID string) *Client {
-	return &Client{
-		hub:       hub,
-		conn:      conn,
-		sessionID: sessionID,
-		send:      make(chan []byte, 256),
+// A read-only client receives output but cannot write to the PTY.
+// The client uses the hub's backpressure policy.
+func NewClient(hub *Hub, conn *websocket.Conn, sessionID string, readOnly bool) *Client {
+	client := &Client{
+		id:           uuid.NewString(),
+		hub:          hub,
+		conn:         conn,
+		sessionID:    sessionID,
+		send:         make(chan Frame, 256),
+		done:         make(chan struct{}),
+		readOnly:     readOnly,
+		blockTimeout: DefaultBlockTimeout,
+		connectedAt:  time.Now(),
+	}
+	if hub != nil {
+		client.policy, client.blockTimeout = hub.Backpressure()
 	}
+	if conn != nil {
+		client.remoteAddr = conn.RemoteAddr().String()
+		client.readDone = make(chan struct{})
+		client.writeDone = make(chan struct{})
+	}
+	client.lastActivity.Store(client.connectedAt.UnixNano())
+	return client
+}
+
+// ID returns the client's unique ID.
+func (c *Client) ID() string {
+	return c.id
 }
 
-// Send queues a message to be sent to the client.
-func (c *Client) Send(data []byte) {
+// IsReadOnly returns true if the client is an observer that cannot send input.
+func (c *Client) IsReadOnly() bool {
+	return c.readOnly
+}
+
+// isInputMessage reports whether a message type writes to or resizes the PTY.
+func isInputMessage(t MessageType) bool {
+	return t == MessageTypeStdin || t == MessageTypeCommand || t == MessageTypeResize ||
+		t == MessageTypeEventResponse || t == MessageTypeInputAction || t == MessageTypeDismiss ||
+		t == MessageTypeFocus || t == MessageTypeBlur
+}
+
+// rejectReadOnly tells a read-only client that its input was refused.
+func rejectReadOnly(client *Client, t MessageType) {
+	rejectMessage(client, t, ErrorCodeReadOnly, "Read-only client cannot send "+string(t))
+}
+
+// SetBinary enables or disables binary frames for terminal output.
+// It should be called before the client is registered with a hub.
+func (c *Client) SetBinary(binary bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.binary = binary
+}
+
+// IsBinary returns true if the client receives terminal output as binary frames.
+func (c *Client) IsBinary() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.binary
+}
+
+// Send queues a text message to be sent to the client.
+// It returns false if the message was not queued, e.g. because the client
+// has been closed.
+func (c *Client) Send(data []byte) bool {
+	return c.SendFrame(Frame{Kind: FrameText, Data: data})
+}
+
+// SendFrame queues a frame to be sent to the client.
+// It returns false if the frame was not queued: the client is closed, the
+// frame was dropped by the backpressure policy, or the full queue caused
+// the client to be closed. Sending to a closed client is a no-op.
+func (c *Client) SendFrame(frame Frame) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.sendFrameLocked(frame)
+}
 
+// sendFrameLocked implements SendFrame. c.mu must be held.
+func (c *Client) sendFrameLocked(frame Frame) bool {
 	if c.closed {
-		return
+		return false
 	}
 
 	select {
-	case c.send <- data:
+	case c.send <- frame:
+		c.countSent(frame)
+		return true
 	default:
-		// Buffer full, close the client
-		c.closeLocked()
 	}
+
+	switch c.policy {
+	case BackpressureDropOldest:
+		if queued, ok := c.dropOldestLocked(frame); ok {
+			return queued
+		}
+	case BackpressureBlock:
+		timer := time.NewTimer(c.blockTimeout)
+		defer timer.Stop()
+		select {
+		case c.send <- frame:
+			c.countSent(frame)
+			return true
+		case <-c.done:
+			// Closing; Close is waiting for c.mu to close the queue
+			return false
+		case <-timer.C:
+		}
+	}
+
+	// Buffer full, close the client
+	c.closeLocked()
+	return false
 }
 
-// Close closes the client connection.
+// deliver queues a broadcast frame, holding it back while the client is
+// restoring history.
+func (c *Client) deliver(frame Frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.restoring {
+		c.pending = append(c.pending, frame)
+		return
+	}
+	c.sendFrameLocked(frame)
+}
+
+// BeginRestore holds back broadcasts to the client until EndRestore, so
+// messages sent directly in between, such as the history, arrive first.
+// It should be called before the client is registered with a hub.
+func (c *Client) BeginRestore() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.restoring = true
+}
+
+// EndRestore queues the broadcasts held back since BeginRestore, in order,
+// and resumes delivering broadcasts directly.
+func (c *Client) EndRestore() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.restoring = false
+	pending := c.pending
+	c.pending = nil
+	for _, frame := range pending {
+		c.sendFrameLocked(frame)
+	}
+}
+
+// dropOldestLocked makes room for frame by discarding the oldest queued
+// droppable frame, or discards frame itself if nothing queued can be
+// dropped. It reports whether frame was queued, and ok is false if frame
+// is a control message that cannot be queued. c.mu must be held.
+func (c *Client) dropOldestLocked(frame Frame) (sent, ok bool) {
+	// Take the queue apart; the write pump may drain concurrently, but
+	// only this method sends while c.mu is held
+	n := len(c.send)
+	queued := make([]Frame, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case f := <-c.send:
+			queued = append(queued, f)
+		default:
+		}
+	}
+
+	dropped := false
+	for _, f := range queued {
+		if !dropped && f.Droppable {
+			c.countDropLocked(f)
+			dropped = true
+			continue
+		}
+		c.send <- f
+	}
+
+	if dropped {
+		c.send <- frame
+		c.countSent(frame)
+		return true, true
+	}
+	if frame.Droppable {
+		c.countDropLocked(frame)
+		return false, true
+	}
+	return false, false
+}
+
+// countSent records a frame queued for sending.
+func (c *Client) countSent(frame Frame) {
+	c.messagesSent.Add(1)
+	c.bytesSent.Add(uint64(len(frame.Data)))
+}
+
+// countDropLocked records a dropped frame. c.mu must be held.
+func (c *Client) countDropLocked(frame Frame) {
+	c.dropped++
+	c.droppedBytes += uint64(len(frame.Data))
+	if c.hub != nil {
+		c.hub.stats.dropped.Add(1)
+	}
+}
+
+// DroppedBytes returns the total payload bytes dropped for this client.
+func (c *Client) DroppedBytes() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.droppedBytes
+}
+
+// Stats returns a snapshot of the client's send queue.
+func (c *Client) Stats() ClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientStats{
+		Queued:       len(c.send),
+		Dropped:      c.dropped,
+		DroppedBytes: c.droppedBytes,
+	}
+}
+
+// takeUnreportedDrops returns the number of frames dropped since the last
+// call and marks them as reported.
+func (c *Client) takeUnreportedDrops() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.dropped - c.reported
+	c.reported = c.dropped
+	return n
+}
+
+// SendMessage encodes a Message for the client's protocol and queues it.
+func (c *Client) SendMessage(msg *Message) error {
+	frame, err := encodeMessage(msg, c.IsBinary())
+	if err != nil {
+		return err
+	}
+	c.SendFrame(frame)
+	return nil
+}
+
+// sendReply sends msg to the client through its hub (see Hub.SendTo), or
+// directly if the client has no hub.
+func (c *Client) sendReply(msg *Message) error {
+	if c.hub == nil {
+		return c.SendMessage(msg)
+	}
+	return c.hub.SendTo(c, msg)
+}
+
+// Close closes the client connection. It is safe to call more than once
+// and concurrently with Send; the send queue is closed exactly once.
 func (c *Client) Close() {
+	// Wake a sender blocked on a full queue so it releases c.mu
+	c.signalDone()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.closeLocked()
 }
 
+// signalDone closes the done channel once. Clients not built with
+// NewClient have no done channel.
+func (c *Client) signalDone() {
+	if c.done == nil {
+		return
+	}
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// closeLocked marks the client closed and closes its send queue. c.mu must
+// be held.
 func (c *Client) closeLocked() {
+	c.signalDone()
 	if c.closed {
 		return
 	}
@@ -92,6 +628,38 @@ func (c *Client) closeLocked() {
 	close(c.send)
 }
 
+// CloseWithCode closes the client like Close, but the write pump sends a
+// close frame with the given code and reason once queued messages are
+// written, and waits briefly for the peer to acknowledge it.
+func (c *Client) CloseWithCode(code int, reason string) {
+	c.signalDone()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closeCode = code
+	c.closeReason = reason
+	c.closeLocked()
+}
+
+// closeMessage returns the payload of the close frame to send.
+func (c *Client) closeMessage() (data []byte, hasCode bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeCode == 0 {
+		return []byte{}, false
+	}
+	return websocket.FormatCloseMessage(c.closeCode, c.closeReason), true
+}
+
+// Done returns a channel that is closed when the client's write pump has
+// finished. It is nil for clients without a connection.
+func (c *Client) Done() <-chan struct{} {
+	return c.writeDone
+}
+
 // IsClosed returns true if the client is closed.
 func (c *Client) IsClosed() bool {
 	c.mu.Lock()
@@ -110,7 +678,7 @@ func (c *Client) Conn() *websocket.Conn {
 }
 
 // SendChan returns the send channel for the client.
-func (c *Client) SendChan() <-chan []byte {
+func (c *Client) SendChan() <-chan Frame {
 	return c.send
 }
 
@@ -120,6 +688,56 @@ type Hub struct {
 	clients   map[*Client]bool
 	mu        sync.RWMutex
 
+	// parsedClients counts the clients subscribed to any driver-produced
+	// message type. Guarded by mu.
+	parsedClients int
+
+	// controller holds the input lock; while it is set, other clients are
+	// treated as observers. It is released after controlTimeout without
+	// input from it, tracked by controlTimer and controlInputAt. Guarded
+	// by mu.
+	controller     *Client
+	controlTimeout time.Duration
+	controlTimer   *time.Timer
+	controlInputAt time.Time
+
+	// outSeq is the sequence number of the latest broadcast message.
+	// broadcastMu serializes numbering and queuing so every client
+	// receives messages in sequence order.
+	outSeq      atomic.Uint64
+	broadcastMu sync.Mutex
+
+	// outputMarks maps the sequence numbers of recent stdout messages to
+	// ring buffer cursors, oldest first. Guarded by broadcastMu.
+	outputMarks []outputMark
+
+	// Backpressure policy for newly registered clients
+	policy       BackpressurePolicy
+	blockTimeout time.Duration
+
+	// maxClients caps the clients registered besides the owner, the first
+	// client to register on an empty hub. Zero means no limit.
+	maxClients int
+	owner      *Client
+
+	// closed is set by Close; broadcasts then fail with ErrHubClosed
+	closed bool
+
+	// Broadcast counters, updated atomically
+	stats hubCounters
+
+	// metrics records broadcast messages; see SetMetrics. Guarded by mu.
+	metrics metrics.Recorder
+
+	// lastClientDisconnect is when the last client left. It is also reset
+	// when the hub is created or returned by GetOrCreate, so a hub that is
+	// about to get a client is not cleaned up as idle.
+	lastClientDisconnect time.Time
+
+	// exitedAt is when the session's process exited, or zero while it runs.
+	// CleanupExited removes hubs of exited sessions once they are idle.
+	exitedAt time.Time
+
 	// Callbacks
 	onMessage func(client *Client, msg *Message)
 	onClose   func()
@@ -128,9 +746,43 @@ type Hub struct {
 // NewHub creates a new Hub for the given session.
 func NewHub(sessionID string) *Hub {
 	return &Hub{
-		sessionID: sessionID,
-		clients:   make(map[*Client]bool),
+		sessionID:            sessionID,
+		clients:              make(map[*Client]bool),
+		blockTimeout:         DefaultBlockTimeout,
+		controlTimeout:       DefaultControlTimeout,
+		lastClientDisconnect: time.Now(),
+		metrics:              metrics.Nop{},
+	}
+}
+
+// SetMetrics sets the recorder for the hub's broadcasts. A nil recorder
+// disables instrumentation.
+func (h *Hub) SetMetrics(recorder metrics.Recorder) {
+	if recorder == nil {
+		recorder = metrics.Nop{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.metrics = recorder
+}
+
+// SetBackpressure sets the backpressure policy for clients created after the
+// call. A blockTimeout <= 0 uses DefaultBlockTimeout.
+func (h *Hub) SetBackpressure(policy BackpressurePolicy, blockTimeout time.Duration) {
+	if blockTimeout <= 0 {
+		blockTimeout = DefaultBlockTimeout
 	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = policy
+	h.blockTimeout = blockTimeout
+}
+
+// Backpressure returns the hub's backpressure policy and block timeout.
+func (h *Hub) Backpressure() (BackpressurePolicy, time.Duration) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.policy, h.blockTimeout
 }
 
 // SessionID returns the session ID for this hub.
@@ -152,50 +804,256 @@ func (h *Hub) SetOnClose(callback func()) {
 	h.onClose = callback
 }
 
-// Register adds a client to the hub.
-func (h *Hub) Register(client *Client) {
+// SetMaxClients limits the number of clients besides the owner. Clients
+// that are already registered are not affected. Zero means no limit.
+func (h *Hub) SetMaxClients(n int) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	h.maxClients = n
+}
+
+// MaxClients returns the client limit, or 0 if there is none.
+func (h *Hub) MaxClients() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.maxClients
+}
+
+// Register adds a client to the hub. It returns ErrHubFull if the hub has
+// reached its client limit. The owner connection is always accepted: a
+// client registering while no owner is connected becomes the owner and
+// does not count towards the limit.
+func (h *Hub) Register(client *Client) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.checkCapacityLocked(); err != nil {
+		return err
+	}
+	if h.owner == nil {
+		h.owner = client
+	}
+	if _, ok := h.clients[client]; !ok && client.wantsParsedOutput() {
+		h.parsedClients++
+	}
 	h.clients[client] = true
+	return nil
+}
+
+// CheckCapacity returns ErrHubFull if a new client would be rejected by
+// Register. It lets callers refuse a connection before accepting it.
+func (h *Hub) CheckCapacity() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.checkCapacityLocked()
 }
 
-// Unregister removes a client from the hub.
+// checkCapacityLocked implements CheckCapacity. h.mu must be held.
+func (h *Hub) checkCapacityLocked() error {
+	if h.maxClients <= 0 || h.owner == nil {
+		return nil
+	}
+	if len(h.clients)-1 >= h.maxClients {
+		return ErrHubFull
+	}
+	return nil
+}
+
+// Unregister removes a client from the hub and closes it. Unregistering a
+// client that is not registered, e.g. a second time, only closes it.
 func (h *Hub) Unregister(client *Client) {
 	h.mu.Lock()
-	h.clients[client] = false
+	if _, ok := h.clients[client]; !ok {
+		h.mu.Unlock()
+		client.Close()
+		return
+	}
+	if client.wantsParsedOutput() {
+		h.parsedClients--
+	}
 	delete(h.clients, client)
+	if h.owner == client {
+		h.owner = nil
+	}
+	controlled := h.controller == client
+	if controlled {
+		h.clearControlLocked()
+	}
 	clientCount := len(h.clients)
+	if clientCount == 0 {
+		h.lastClientDisconnect = time.Now()
+	}
 	onClose := h.onClose
 	h.mu.Unlock()
 
 	client.Close()
 
+	// A disconnected controller releases the input lock
+	if controlled {
+		h.broadcastController(nil)
+	}
+
 	// Call onClose callback if no clients remain
 	if clientCount == 0 && onClose != nil {
 		onClose()
 	}
 }
 
-// Broadcast sends a message to all connected clients.
-func (h *Hub) Broadcast(data []byte) {
+// Broadcast sends a text message to all connected clients.
+// It returns ErrHubClosed if the hub has been closed.
+func (h *Hub) Broadcast(data []byte) error {
+	return h.BroadcastFrame(Frame{Kind: FrameText, Data: data})
+}
+
+// BroadcastFrame sends a frame to all connected clients.
+// It returns ErrHubClosed if the hub has been closed.
+func (h *Hub) BroadcastFrame(frame Frame) error {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	if h.closed {
+		h.mu.RUnlock()
+		return ErrHubClosed
+	}
+	h.stats.bytes.Add(uint64(len(frame.Data)))
+	clients := h.clientsLocked()
+	h.mu.RUnlock()
 
-	for client := range h.clients {
-		client.Send(data)
+	// Queue outside h.mu, since BackpressureBlock may wait for a client
+	for _, client := range clients {
+		client.deliver(frame)
 	}
+	return nil
 }
 
 // BroadcastMessage sends a Message to all connected clients.
+// The hub stamps msg.Seq with the next sequence number before queuing, so
+// clients can detect gaps and reorder. Each encoding (JSON or binary) is
+// built at most once and shared by all clients using that protocol.
+// It returns ErrHubClosed if the hub has been closed.
 func (h *Hub) BroadcastMessage(msg *Message) error {
-	data, err := json.Marshal(msg)
+	return h.BroadcastExcept(nil, msg)
+}
+
+// BroadcastExcept sends a Message to all connected clients except sender,
+// like BroadcastMessage. A nil sender sends to every client.
+func (h *Hub) BroadcastExcept(sender *Client, msg *Message) error {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+
+	h.mu.RLock()
+	if h.closed {
+		h.mu.RUnlock()
+		return ErrHubClosed
+	}
+
+	msg.Seq = h.NextSeq()
+	h.stats.countMessage(msg)
+	h.metrics.MessageBroadcast(string(msg.Type))
+	if msg.Type == MessageTypeStdout && msg.Cursor > 0 {
+		h.markOutputLocked(msg.Seq, msg.Cursor)
+	}
+	clients := h.clientsLocked()
+	h.mu.RUnlock()
+
+	// Queue outside h.mu, since BackpressureBlock may wait for a client;
+	// broadcastMu still keeps every client's messages in sequence order
+	var frames messageFrames
+	for _, client := range clients {
+		if client == sender || !client.Subscribed(msg.Type) {
+			continue
+		}
+		frame, err := frames.encode(msg, client.IsBinary())
+		if err != nil {
+			return err
+		}
+		client.deliver(frame)
+	}
+	return nil
+}
+
+// clientsLocked returns the connected clients. h.mu must be held.
+func (h *Hub) clientsLocked() []*Client {
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// SendTo sends a Message to a single client, encoded for its protocol, and
+// counts it in the hub's stats. Unlike a broadcast it has no sequence
+// number and is queued right away, even while the client is restoring
+// history, so replies and the history itself go through it.
+// It returns ErrHubClosed if the hub has been closed, and ErrClientClosed
+// if the client has been closed or was closed because its queue was full.
+func (h *Hub) SendTo(client *Client, msg *Message) error {
+	if h.IsClosed() {
+		return ErrHubClosed
+	}
+
+	var frames messageFrames
+	frame, err := frames.encode(msg, client.IsBinary())
 	if err != nil {
 		return err
 	}
-	h.Broadcast(data)
+	if !client.SendFrame(frame) {
+		if client.IsClosed() {
+			return ErrClientClosed
+		}
+		// Dropped by the backpressure policy, which counted it
+		return nil
+	}
+	h.stats.countUnicast(msg)
 	return nil
 }
 
+// markOutputLocked remembers the ring buffer cursor after a stdout message.
+// h.broadcastMu must be held.
+func (h *Hub) markOutputLocked(seq uint64, cursor int64) {
+	if len(h.outputMarks) >= outputIndexSize {
+		h.outputMarks = append(h.outputMarks[:0], h.outputMarks[1:]...)
+	}
+	h.outputMarks = append(h.outputMarks, outputMark{seq: seq, cursor: cursor})
+}
+
+// CursorForSeq returns the ring buffer cursor reached by a client that has
+// received every broadcast up to seq: the cursor after the last stdout
+// message numbered seq or lower. It returns false if seq is ahead of the
+// hub or older than the stdout messages the hub remembers.
+func (h *Hub) CursorForSeq(seq uint64) (int64, bool) {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+
+	marks := h.outputMarks
+	if seq > h.LastSeq() || len(marks) == 0 || seq < marks[0].seq {
+		return 0, false
+	}
+	i := sort.Search(len(marks), func(i int) bool { return marks[i].seq > seq })
+	return marks[i-1].cursor, true
+}
+
+// ResetOutputIndex forgets the cursors of earlier stdout messages, e.g.
+// when the session's process and ring buffer are replaced.
+func (h *Hub) ResetOutputIndex() {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+	h.outputMarks = nil
+}
+
+// NextSeq increments and returns the hub's broadcast sequence number.
+// The sequence starts at 1 when the hub is created.
+func (h *Hub) NextSeq() uint64 {
+	return h.outSeq.Add(1)
+}
+
+// LastSeq returns the sequence number of the latest broadcast message,
+// or 0 if nothing has been broadcast yet.
+func (h *Hub) LastSeq() uint64 {
+	return h.outSeq.Load()
+}
+
 // ClientCount returns the number of connected clients.
 func (h *Hub) ClientCount() int {
 	h.mu.RLock()
@@ -203,13 +1061,103 @@ func (h *Hub) ClientCount() int {
 	return len(h.clients)
 }
 
+// WriterCount returns the number of connected clients that may send input.
+func (h *Hub) WriterCount() int {
+	return h.ClientCount() - h.ViewerCount()
+}
+
+// ViewerCount returns the number of connected read-only clients.
+func (h *Hub) ViewerCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	count := 0
+	for client := range h.clients {
+		if client.IsReadOnly() {
+			count++
+		}
+	}
+	return count
+}
+
+// IsClosed returns true if the hub has been closed.
+func (h *Hub) IsClosed() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.closed
+}
+
+// IdleSince returns when the hub last had no clients. The result is only
+// meaningful while ClientCount is 0.
+func (h *Hub) IdleSince() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.lastClientDisconnect
+}
+
+// MarkExited records that the session's process has exited, making the
+// hub eligible for CleanupExited. Later calls keep the first exit time.
+func (h *Hub) MarkExited() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.exitedAt.IsZero() {
+		h.exitedAt = time.Now()
+	}
+}
+
+// MarkRunning records that the session has a running process again, e.g.
+// after a restart.
+func (h *Hub) MarkRunning() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.exitedAt = time.Time{}
+}
+
+// ExitedAt returns when the session's process exited, or the zero time if
+// it is running.
+func (h *Hub) ExitedAt() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.exitedAt
+}
+
+// touch resets the idle clock.
+func (h *Hub) touch() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastClientDisconnect = time.Now()
+}
+
 // HasClients returns true if there are connected clients.
 func (h *Hub) HasClients() bool {
 	return h.ClientCount() > 0
 }
 
 // HandleMessage processes an incoming message from a client.
+// Messages from read-only clients never reach the message callback, except
+// pings so that viewers still get keepalive responses. Input messages
+// (stdin, command, resize) are rejected with an error reply.
+// Input lock messages are handled by the hub itself, and input from clients
+// other than the lock holder is dropped.
 func (h *Hub) HandleMessage(client *Client, msg *Message) {
+	if client.IsReadOnly() && msg.Type != MessageTypePing {
+		if isInputMessage(msg.Type) || msg.Type == MessageTypeControlRequest || msg.Type == MessageTypeMarker {
+			rejectReadOnly(client, msg.Type)
+		}
+		return
+	}
+
+	switch msg.Type {
+	case MessageTypeControlRequest:
+		h.RequestControl(client)
+		return
+	case MessageTypeControlRelease:
+		h.ReleaseControl(client)
+		return
+	}
+	if isInputMessage(msg.Type) && !h.acceptInput(client) {
+		return
+	}
+
 	h.mu.RLock()
 	callback := h.onMessage
 	h.mu.RUnlock()
@@ -222,11 +1170,12 @@ func (h *Hub) HandleMessage(client *Client, msg *Message) {
 // Close closes all client connections and the hub.
 func (h *Hub) Close() {
 	h.mu.Lock()
-	clients := make([]*Client, 0, len(h.clients))
-	for client := range h.clients {
-		clients = append(clients, client)
-	}
+	h.closed = true
+	clients := h.clientsLocked()
 	h.clients = make(map[*Client]bool)
+	h.parsedClients = 0
+	h.owner = nil
+	h.clearControlLocked()
 	h.mu.Unlock()
 
 	for _, client := range clients {
@@ -234,16 +1183,207 @@ func (h *Hub) Close() {
 	}
 }
 
+// Drain shuts the hub down gracefully. It broadcasts a StateServerShutdown
+// status, closes every client with a 1001 (going away) close frame and the
+// given reason, and waits for their connections to finish until ctx is
+// done. Connections still open then are closed abruptly and ctx.Err() is
+// returned. The hub is closed in either case.
+func (h *Hub) Drain(ctx context.Context, reason string) error {
+	h.BroadcastMessage(&Message{Type: MessageTypeStatus, State: StateServerShutdown})
+
+	h.mu.RLock()
+	clients := h.clientsLocked()
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.CloseWithCode(websocket.CloseGoingAway, reason)
+	}
+
+	var err error
+	for _, client := range clients {
+		if client.Done() == nil {
+			continue
+		}
+		select {
+		case <-client.Done():
+		case <-ctx.Done():
+			err = ctx.Err()
+			client.Conn().Close()
+		}
+	}
+
+	h.Close()
+	return err
+}
+
+// idleCheckInterval is how often HubManager looks for idle hubs.
+const idleCheckInterval = 30 * time.Second
+
+// DefaultExitedGracePeriod is how long the hub of an exited session is kept
+// without clients, so reconnecting clients still see the exit status.
+const DefaultExitedGracePeriod = 5 * time.Minute
+
 // HubManager manages multiple hubs for different sessions.
 type HubManager struct {
 	hubs map[string]*Hub
 	mu   sync.RWMutex
+
+	// Backpressure policy applied to hubs
+	policy       BackpressurePolicy
+	blockTimeout time.Duration
+
+	// maxClients is the client limit applied to hubs
+	maxClients int
+
+	// metrics is the recorder applied to hubs
+	metrics metrics.Recorder
+
+	// IdleTimeout is how long a hub may have no clients before CleanupIdle
+	// removes it. Zero disables idle cleanup. Use SetIdleTimeout to change
+	// it once the manager is in use.
+	IdleTimeout time.Duration
+
+	// ExitedGracePeriod is how long the hub of an exited session may have
+	// no clients before CleanupExited removes it. Zero disables it. Use
+	// SetExitedGracePeriod to change it once the manager is in use.
+	ExitedGracePeriod time.Duration
+
+	stopCh    chan struct{}
+	closeOnce sync.Once
 }
 
-// NewHubManager creates a new HubManager.
+// NewHubManager creates a new HubManager and starts its idle cleanup loop.
 func NewHubManager() *HubManager {
-	return &HubManager{
-		hubs: make(map[string]*Hub),
+	m := &HubManager{
+		hubs:              make(map[string]*Hub),
+		blockTimeout:      DefaultBlockTimeout,
+		ExitedGracePeriod: DefaultExitedGracePeriod,
+		stopCh:            make(chan struct{}),
+	}
+	go m.cleanupLoop()
+	return m
+}
+
+// SetIdleTimeout sets how long a hub may have no clients before it is
+// removed. Zero disables idle cleanup.
+func (m *HubManager) SetIdleTimeout(timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.IdleTimeout = timeout
+}
+
+// SetExitedGracePeriod sets how long the hub of an exited session may have
+// no clients before it is removed. Zero disables exited cleanup.
+func (m *HubManager) SetExitedGracePeriod(grace time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ExitedGracePeriod = grace
+}
+
+// cleanupLoop periodically removes idle hubs until the manager is closed.
+func (m *HubManager) cleanupLoop() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.CleanupIdle()
+			m.CleanupExited()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// CleanupIdle removes hubs that have had no clients for longer than
+// IdleTimeout and returns how many were removed. It does nothing when
+// IdleTimeout is zero.
+func (m *HubManager) CleanupIdle() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.IdleTimeout <= 0 {
+		return 0
+	}
+
+	removed := 0
+	for sessionID, hub := range m.hubs {
+		if hub.ClientCount() == 0 && time.Since(hub.IdleSince()) > m.IdleTimeout {
+			hub.Close()
+			delete(m.hubs, sessionID)
+			removed++
+		}
+	}
+	return removed
+}
+
+// CleanupExited removes hubs whose session process has exited (see
+// Hub.MarkExited) and that have had no clients for ExitedGracePeriod since
+// the exit, and returns how many were removed. It does nothing when
+// ExitedGracePeriod is zero. A client attaching later gets a new hub from
+// GetOrCreate.
+func (m *HubManager) CleanupExited() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ExitedGracePeriod <= 0 {
+		return 0
+	}
+
+	removed := 0
+	for sessionID, hub := range m.hubs {
+		exitedAt := hub.ExitedAt()
+		if exitedAt.IsZero() || hub.ClientCount() > 0 {
+			continue
+		}
+		idleSince := hub.IdleSince()
+		if idleSince.After(exitedAt) {
+			exitedAt = idleSince
+		}
+		if time.Since(exitedAt) > m.ExitedGracePeriod {
+			hub.Close()
+			delete(m.hubs, sessionID)
+			removed++
+		}
+	}
+	return removed
+}
+
+// SetBackpressure sets the backpressure policy for all current and future
+// hubs. Clients that are already connected keep their policy.
+func (m *HubManager) SetBackpressure(policy BackpressurePolicy, blockTimeout time.Duration) {
+	if blockTimeout <= 0 {
+		blockTimeout = DefaultBlockTimeout
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+	m.blockTimeout = blockTimeout
+	for _, hub := range m.hubs {
+		hub.SetBackpressure(policy, blockTimeout)
+	}
+}
+
+// SetMaxClients sets the client limit for all current and future hubs.
+// See Hub.SetMaxClients.
+func (m *HubManager) SetMaxClients(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxClients = n
+	for _, hub := range m.hubs {
+		hub.SetMaxClients(n)
+	}
+}
+
+// SetMetrics sets the metrics recorder for all current and future hubs.
+// A nil recorder disables instrumentation.
+func (m *HubManager) SetMetrics(recorder metrics.Recorder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics = recorder
+	for _, hub := range m.hubs {
+		hub.SetMetrics(recorder)
 	}
 }
 
@@ -253,10 +1393,14 @@ func (m *HubManager) GetOrCreate(sessionID string) *Hub {
 	defer m.mu.Unlock()
 
 	if hub, ok := m.hubs[sessionID]; ok {
+		hub.touch()
 		return hub
 	}
 
 	hub := NewHub(sessionID)
+	hub.SetBackpressure(m.policy, m.blockTimeout)
+	hub.SetMaxClients(m.maxClients)
+	hub.SetMetrics(m.metrics)
 	m.hubs[sessionID] = hub
 	return hub
 }
@@ -279,8 +1423,40 @@ func (m *HubManager) Remove(sessionID string) {
 	}
 }
 
-// Close closes all hubs.
+// Shutdown drains all hubs concurrently (see Hub.Drain) and then closes
+// the manager. It returns ctx.Err() if some clients did not finish in time.
+func (m *HubManager) Shutdown(ctx context.Context, reason string) error {
+	m.mu.RLock()
+	hubs := make([]*Hub, 0, len(m.hubs))
+	for _, hub := range m.hubs {
+		hubs = append(hubs, hub)
+	}
+	m.mu.RUnlock()
+
+	errs := make([]error, len(hubs))
+	var wg sync.WaitGroup
+	for i, hub := range hubs {
+		wg.Add(1)
+		go func(i int, hub *Hub) {
+			defer wg.Done()
+			errs[i] = hub.Drain(ctx, reason)
+		}(i, hub)
+	}
+	wg.Wait()
+
+	m.Close()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops idle cleanup and closes all hubs.
 func (m *HubManager) Close() {
+	m.closeOnce.Do(func() { close(m.stopCh) })
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
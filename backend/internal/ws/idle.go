@@ -0,0 +1,57 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultIdleTimeout is how long a client may go without sending a message
+// or being delivered a frame, other than pings and pongs, before its
+// connection is closed.
+const DefaultIdleTimeout = 30 * time.Minute
+
+// idleTimeout returns IdleTimeout, or its default if unset; 0 if disabled.
+func (h *Handler) idleTimeout() time.Duration {
+	switch {
+	case h.IdleTimeout < 0:
+		return 0
+	case h.IdleTimeout == 0:
+		return DefaultIdleTimeout
+	}
+	return h.IdleTimeout
+}
+
+// touch records activity on the client's connection.
+func (c *Client) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long the client has been without activity.
+func (c *Client) idleFor() time.Duration {
+	return time.Since(time.Unix(0, c.lastActivity.Load()))
+}
+
+// closeIdle sends an idle client a StateIdleDisconnect status and closes it
+// with a 1000 (normal closure) close frame, which the write pump sends once
+// anything still queued is written; queued pongs are dropped instead. The client is unregistered when its
+// read pump returns; the session's process is not affected. It must be
+// called from the write pump and reports whether the status was written.
+func (h *Handler) closeIdle(client *Client, timeout time.Duration) bool {
+	h.logger.Info("Closing idle WebSocket connection", "session_id", client.sessionID, "remote_addr", client.remoteAddr, "idle_timeout", timeout)
+
+	frame, err := encodeMessage(&Message{
+		Type:  MessageTypeStatus,
+		State: StateIdleDisconnect,
+		Data:  fmt.Sprintf("No activity for %v", timeout),
+	}, false)
+	if err != nil {
+		return false
+	}
+	if !h.checkWrite(client, h.writeFrame(client, frame)) {
+		return false
+	}
+	client.CloseWithCode(websocket.CloseNormalClosure, StateIdleDisconnect)
+	return true
+}
@@ -0,0 +1,169 @@
+package ws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// expectIdleDisconnect reads the idle_disconnect status and the 1000 close
+// frame that follows it, skipping other messages.
+func expectIdleDisconnect(t *testing.T, conn *websocket.Conn, within time.Duration) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(within))
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("expected idle_disconnect status, got %v", err)
+		}
+		if msg.Type == MessageTypeStatus && msg.State == StateIdleDisconnect {
+			break
+		}
+	}
+
+	var msg Message
+	err := conn.ReadJSON(&msg)
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expected the connection to close with %d, got %+v (err: %v)", websocket.CloseNormalClosure, msg, err)
+	}
+}
+
+// TestIdleDisconnect tests that a client without activity is sent an
+// idle_disconnect status and closed, while the session keeps running
+func TestIdleDisconnect(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-idle-disconnect"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.IdleTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	conn := dialValidationSession(t, handler, sessionID)
+	expectIdleDisconnect(t, conn, 2*time.Second)
+	if elapsed := time.Since(start); elapsed < handler.IdleTimeout {
+		t.Errorf("Expected the client to be closed after %v, closed after %v", handler.IdleTimeout, elapsed)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hubManager.Get(sessionID).ClientCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the idle client to be unregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ptyProcess.IsClosed() {
+		t.Error("Expected the session's process to keep running")
+	}
+}
+
+// TestIdleDisconnectActivity tests that client messages and delivered
+// output each keep a client connected
+func TestIdleDisconnectActivity(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-idle-activity"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.IdleTimeout = 200 * time.Millisecond
+	conn := dialValidationSession(t, handler, sessionID)
+
+	// Messages sent by the client; releasing control it does not hold is
+	// not answered
+	for i := 0; i < 6; i++ {
+		time.Sleep(80 * time.Millisecond)
+		if err := conn.WriteJSON(Message{Type: MessageTypeControlRelease}); err != nil {
+			t.Fatalf("failed to write control_release: %v", err)
+		}
+	}
+	if hubManager.Get(sessionID).ClientCount() != 1 {
+		t.Fatal("Expected the client to stay connected while sending messages")
+	}
+
+	// Output delivered to a client that sends nothing
+	for i := 0; i < 6; i++ {
+		time.Sleep(80 * time.Millisecond)
+		handler.BroadcastOutput(sessionID, []byte("tick"))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != MessageTypeStdout {
+			t.Fatalf("expected stdout while active, got %+v (err: %v)", msg, err)
+		}
+	}
+
+	expectIdleDisconnect(t, conn, 2*time.Second)
+}
+
+// TestIdleDisconnectIgnoresPings tests that a client sending only pings,
+// and delivered only their pongs, is still closed once idle
+func TestIdleDisconnectIgnoresPings(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-idle-pings"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.IdleTimeout = 200 * time.Millisecond
+	conn := dialValidationSession(t, handler, sessionID)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteJSON(Message{Type: MessageTypePing}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	expectIdleDisconnect(t, conn, 2*time.Second)
+}
+
+// TestIdleTimeoutDisabled tests that a negative IdleTimeout disables the
+// check
+func TestIdleTimeoutDisabled(t *testing.T) {
+	handler := &Handler{}
+	if timeout := handler.idleTimeout(); timeout != DefaultIdleTimeout {
+		t.Errorf("Expected the default idle timeout, got %v", timeout)
+	}
+	handler.IdleTimeout = -1
+	if timeout := handler.idleTimeout(); timeout != 0 {
+		t.Errorf("Expected a negative IdleTimeout to disable the check, got %v", timeout)
+	}
+}
@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+)
+
+// errClientDisconnected is the result of input skipped because the client
+// that sent it disconnected before it was written.
+var errClientDisconnected = errors.New("client disconnected")
+
+// inputJob is a write to a session's PTY waiting for the writes before it.
+type inputJob struct {
+	write  func() error
+	done   <-chan struct{} // Closed when the client that sent it disconnects; nil if none did
+	result chan error
+}
+
+// inputQueue writes one session's input to its PTY in the order it was
+// queued, off the read pump. A command takes about a second to write, so
+// keystrokes, input actions, event responses, focus reports, dismisses and
+// automatic answers queued after it wait for it instead of landing in the middle of
+// its clearing sequence. The worker goroutine runs only while writes are
+// pending.
+type inputQueue struct {
+	mu      sync.Mutex
+	jobs    []inputJob
+	running bool
+}
+
+// push queues a job, starting the worker if it is not running.
+func (q *inputQueue) push(job inputJob) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	if q.running {
+		q.mu.Unlock()
+		return
+	}
+	q.running = true
+	q.mu.Unlock()
+	go q.run()
+}
+
+// run writes the queued jobs in order until the queue is empty. Jobs of
+// clients that have disconnected are skipped.
+func (q *inputQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs[0] = inputJob{}
+		q.jobs = q.jobs[1:]
+		q.mu.Unlock()
+
+		select {
+		case <-job.done:
+			job.result <- errClientDisconnected
+			continue
+		default:
+		}
+		job.result <- job.write()
+	}
+}
+
+// inputQueue returns the session's input queue, creating it if needed.
+func (h *Handler) inputQueue(sessionID string) *inputQueue {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.inputs == nil {
+		h.inputs = make(map[string]*inputQueue)
+	}
+	q, ok := h.inputs[sessionID]
+	if !ok {
+		q = &inputQueue{}
+		h.inputs[sessionID] = q
+	}
+	return q
+}
+
+// queueInput queues write on the session's input queue and returns a
+// channel that receives its error once it has run. Writes queued for client
+// are skipped if it disconnects first; client may be nil for writes the
+// server makes itself.
+func (h *Handler) queueInput(sessionID string, client *Client, write func() error) <-chan error {
+	job := inputJob{write: write, result: make(chan error, 1)}
+	if client != nil {
+		job.done = client.readDone
+	}
+	h.inputQueue(sessionID).push(job)
+	return job.result
+}
+
+// StopInput drops the session's input queue, e.g. when the session is
+// deleted. Writes already queued are still attempted.
+func (h *Handler) StopInput(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.inputs, sessionID)
+}
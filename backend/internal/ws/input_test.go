@@ -0,0 +1,110 @@
+package ws
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// TestInputQueueOrder tests that input sent while a command is being
+// written waits for the command instead of landing in the middle of it
+func TestInputQueueOrder(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-input-order"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:     &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		InputDelays: pty.InputDelays{Clear: 50 * time.Millisecond, Text: 50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	start := time.Now()
+	handler.handleMessage(client, &Message{Type: MessageTypeCommand, Data: "first\r", ID: "c1"}, ptyProcess)
+	handler.handleMessage(client, &Message{Type: MessageTypeStdin, Data: "second", ID: "s1"}, ptyProcess)
+	handler.handleMessage(client, &Message{Type: MessageTypeFocus}, ptyProcess)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected queuing input not to block, took %v", elapsed)
+	}
+	expectAck(t, client, "c1", AckDelivered, "")
+	expectAck(t, client, "s1", AckDelivered, "")
+
+	// cat echoes input as typed; the focus report is echoed as ^[[I
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(string(ptyProcess.GetHistory()), "^[[I") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	history := string(ptyProcess.GetHistory())
+	first, second, focus := strings.Index(history, "first"), strings.Index(history, "second"), strings.Index(history, "^[[I")
+	if first < 0 || second < first || focus < second {
+		t.Errorf("Expected the command, stdin and focus report in order, got %q", history)
+	}
+}
+
+// TestInputQueueClientDisconnect tests that a client's pending input is
+// dropped, and its command abandoned between steps, once it disconnects
+func TestInputQueueClientDisconnect(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-input-disconnect"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:     &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		InputDelays: pty.InputDelays{Clear: 10 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	client.readDone = make(chan struct{})
+	hub.Register(client)
+
+	handler.handleMessage(client, &Message{Type: MessageTypeCommand, Data: "abandoned\r"}, ptyProcess)
+	handler.handleMessage(client, &Message{Type: MessageTypeStdin, Data: "dropped"}, ptyProcess)
+	time.Sleep(50 * time.Millisecond)
+	close(client.readDone)
+
+	// Input queued by the server itself is still written
+	written := handler.queueInput(sessionID, nil, func() error {
+		return ptyProcess.Write([]byte("after"))
+	})
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("Expected the server's input to be written, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the disconnected client's input to be dropped")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(string(ptyProcess.GetHistory()), "after") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	history := string(ptyProcess.GetHistory())
+	if !strings.Contains(history, "after") {
+		t.Errorf("Expected the server's input in the output, got %q", history)
+	}
+	if strings.Contains(history, "abandoned") || strings.Contains(history, "dropped") {
+		t.Errorf("Expected the disconnected client's input not to be written, got %q", history)
+	}
+}
@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SetAllowedOrigins restricts WebSocket upgrades to the server's own origin
+// and the given origins. See NewOriginChecker for the matching rules.
+func SetAllowedOrigins(origins []string) {
+	upgrader.CheckOrigin = NewOriginChecker(origins)
+}
+
+// NewOriginChecker returns a CheckOrigin function that accepts same-origin
+// requests, whose Origin host equals the request's Host header, and requests
+// whose Origin header matches one of the allowed origins.
+//
+// Entries are either full origins ("https://app.example.com") or bare hosts
+// ("app.example.com", "localhost:5173"), which match any scheme. A leading
+// "*." matches any subdomain: "*.example.com" accepts "a.example.com" and
+// "a.b.example.com" but not "example.com". Matching is case-insensitive.
+//
+// Requests without an Origin header are not from browsers and are always
+// accepted.
+func NewOriginChecker(origins []string) func(r *http.Request) bool {
+	allowed := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		if origin != "" {
+			allowed = append(allowed, origin)
+		}
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		scheme := strings.ToLower(u.Scheme)
+		host := strings.ToLower(u.Host)
+
+		if host == strings.ToLower(r.Host) {
+			return true
+		}
+
+		for _, pattern := range allowed {
+			if matchOrigin(pattern, scheme, host) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchOrigin reports whether a lower-cased origin matches an allow-list entry.
+func matchOrigin(pattern, scheme, host string) bool {
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if pattern[:i] != scheme {
+			return false
+		}
+		pattern = pattern[i+3:]
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// checkOrigin refuses requests from disallowed origins with a plain 403
+// before anything is set up for them, logging keysAndValues to identify the
+// connection. It reports whether the request may proceed.
+func (h *Handler) checkOrigin(w http.ResponseWriter, r *http.Request, keysAndValues ...any) bool {
+	check := h.upgrader().CheckOrigin
+	if check == nil {
+		// The upgrader's own default is also same-origin
+		check = NewOriginChecker(nil)
+	}
+	if check(r) {
+		return true
+	}
+	h.logger.Warn("Rejected WebSocket connection: origin not allowed",
+		append(keysAndValues, "origin", r.Header.Get("Origin"))...)
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
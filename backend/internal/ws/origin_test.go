@@ -0,0 +1,162 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/logging"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+func TestOriginChecker(t *testing.T) {
+	allowList := []string{"https://app.example.com", "*.corp.example.com", "localhost:5173"}
+
+	tests := []struct {
+		name     string
+		allowed  []string
+		origin   string
+		host     string
+		expected bool
+	}{
+		// Allow-list
+		{"exact match", allowList, "https://app.example.com", "api.example.com", true},
+		{"exact match is case-insensitive", allowList, "HTTPS://App.Example.com", "api.example.com", true},
+		{"scheme mismatch", allowList, "http://app.example.com", "api.example.com", false},
+		{"port mismatch", allowList, "https://app.example.com:8443", "api.example.com", false},
+		{"unlisted origin", allowList, "https://evil.com", "api.example.com", false},
+		{"lookalike suffix", allowList, "https://app.example.com.evil.com", "api.example.com", false},
+		{"wildcard subdomain", allowList, "https://dev.corp.example.com", "api.example.com", true},
+		{"wildcard nested subdomain", allowList, "http://a.b.corp.example.com", "api.example.com", true},
+		{"wildcard excludes apex", allowList, "https://corp.example.com", "api.example.com", false},
+		{"wildcard excludes lookalike", allowList, "https://evilcorp.example.com", "api.example.com", false},
+		{"bare host matches any scheme", allowList, "http://localhost:5173", "localhost:8080", true},
+		{"missing origin", allowList, "", "api.example.com", true},
+		{"malformed origin", allowList, "://bad", "api.example.com", false},
+		{"null origin", allowList, "null", "api.example.com", false},
+		{"same origin with allow-list", allowList, "https://api.example.com", "api.example.com", true},
+
+		// Same origin only
+		{"same origin", nil, "http://localhost:8080", "localhost:8080", true},
+		{"same origin is case-insensitive", []string{}, "http://LocalHost:8080", "localhost:8080", true},
+		{"cross origin", nil, "http://localhost:5173", "localhost:8080", false},
+		{"same origin missing origin", nil, "", "localhost:8080", true},
+		{"blank entries fall back to same origin", []string{" ", ""}, "http://evil.com", "localhost:8080", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewOriginChecker(tt.allowed)
+			r := httptest.NewRequest("GET", "/api/sessions/s1/attach", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			if got := checker(r); got != tt.expected {
+				t.Errorf("Expected %v for origin %q and host %q, got %v", tt.expected, tt.origin, tt.host, got)
+			}
+		})
+	}
+}
+
+// TestHandleConnectionOrigin tests that attaches from disallowed origins are
+// refused with 403 before upgrading, and allowed ones are upgraded
+func TestHandleConnectionOrigin(t *testing.T) {
+	defer SetCheckOrigin(upgrader.CheckOrigin)
+
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-origin"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		name     string
+		allowed  []string
+		origin   string
+		expected int
+	}{
+		{"same origin by default", nil, server.URL, http.StatusSwitchingProtocols},
+		{"cross origin by default", nil, "http://evil.com", http.StatusForbidden},
+		{"allowed origin", []string{"https://app.example.com"}, "https://app.example.com", http.StatusSwitchingProtocols},
+		{"disallowed origin", []string{"https://app.example.com"}, "https://evil.com", http.StatusForbidden},
+		{"same origin with allow-list", []string{"https://app.example.com"}, server.URL, http.StatusSwitchingProtocols},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetAllowedOrigins(tt.allowed)
+
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {tt.origin}})
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			if resp.StatusCode != tt.expected {
+				t.Errorf("Expected status %d, got %d (err: %v)", tt.expected, resp.StatusCode, err)
+			}
+		})
+	}
+
+	// Only the upgraded clients created the hub
+	if hubManager.Get(sessionID) == nil {
+		t.Error("Expected a hub for the allowed clients")
+	}
+
+	// A rejected client never gets as far as the hub
+	other := NewHubManager()
+	defer other.Close()
+	rejecting := NewHandler(other, ptyManager, driver.NewGenericDriver())
+	logger := &recordingLogger{}
+	rejecting.SetLogger(logger)
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/sessions/"+sessionID+"/attach", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	rejecting.HandleConnection(rec, r, sessionID, "test-user")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	if other.Get(sessionID) != nil {
+		t.Error("Expected no hub for a rejected client")
+	}
+	if len(logger.warnings) != 1 || !strings.Contains(logger.warnings[0], "session_id "+sessionID) {
+		t.Errorf("Expected a warning with the session ID, got %q", logger.warnings)
+	}
+}
+
+// recordingLogger records the messages logged at warn level with their fields.
+type recordingLogger struct {
+	logging.Nop
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf("%s %v", msg, keysAndValues))
+}
@@ -0,0 +1,307 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+)
+
+// DefaultParseQueueSize is the number of output chunks that may wait for the
+// session's driver before further chunks are not parsed.
+const DefaultParseQueueSize = 256
+
+// parseJob is a chunk of output waiting for the session's driver.
+type parseJob struct {
+	data   []byte
+	cursor int64 // Ring buffer cursor after the chunk
+	reset  bool  // Output before the chunk was not parsed
+
+	// done, if set, marks a barrier: it is closed once every earlier
+	// chunk has been parsed, and the job carries no output
+	done chan struct{}
+}
+
+// parseWorker parses one session's output in order, off the PTY read path.
+// It also keeps the session's conversation messages and pending smart
+// events, which are dropped along with the worker when the session is
+// deleted.
+type parseWorker struct {
+	jobs         chan parseJob
+	conversation conversationLog
+	events       pendingEvents
+
+	// stop is closed by StopParsing, which also cancels ctx; the worker
+	// then drains the jobs already queued and closes exited. jobs is never
+	// closed, so sending on it cannot race with stopping the worker.
+	stop   chan struct{}
+	exited chan struct{}
+
+	// ctx is passed to the driver, so StopParsing also abandons a chunk
+	// still being parsed
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// parser returns the session's parse worker, starting it if needed, or nil
+// if its worker has been stopped.
+func (h *Handler) parser(sessionID string) *parseWorker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stoppedParsers[sessionID] {
+		return nil
+	}
+	if h.parsers == nil {
+		h.parsers = make(map[string]*parseWorker)
+	}
+	w, ok := h.parsers[sessionID]
+	if !ok {
+		size := h.ParseQueueSize
+		if size <= 0 {
+			size = DefaultParseQueueSize
+		}
+		limit := h.ConversationHistorySize
+		if limit <= 0 {
+			limit = DefaultConversationHistorySize
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		w = &parseWorker{
+			jobs:         make(chan parseJob, size),
+			conversation: conversationLog{limit: limit},
+			stop:         make(chan struct{}),
+			exited:       make(chan struct{}),
+			ctx:          ctx,
+			cancel:       cancel,
+		}
+		h.parsers[sessionID] = w
+		go h.runParser(sessionID, w)
+	}
+	return w
+}
+
+// existingParser returns the session's parse worker, or nil if it has none.
+func (h *Handler) existingParser(sessionID string) *parseWorker {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.parsers[sessionID]
+}
+
+// queueParse hands a chunk of output to the session's parse worker. When the
+// queue is full the chunk is not parsed and counted in the hub's stats, so a
+// slow driver never holds up output; the driver is reset before the next
+// chunk it parses. Output of a session whose worker was stopped is not
+// parsed.
+func (h *Handler) queueParse(hub *Hub, sessionID string, data []byte, cursor int64) {
+	w := h.parser(sessionID)
+	if w == nil {
+		return
+	}
+	job := parseJob{
+		data:   bytes.Clone(data), // data is only valid during the output callback
+		cursor: cursor,
+		reset:  h.resumeParsing(sessionID),
+	}
+	select {
+	case <-w.stop:
+	case w.jobs <- job:
+	default:
+		if hub != nil {
+			hub.stats.parseDropped.Add(1)
+		}
+		h.skipParsing(sessionID)
+	}
+}
+
+// waitParsed blocks until the output queued for the session so far has been
+// parsed and its messages broadcast, or its worker has stopped.
+func (h *Handler) waitParsed(sessionID string) {
+	w := h.parser(sessionID)
+	if w == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case w.jobs <- parseJob{done: done}:
+	case <-w.exited:
+		return
+	}
+	select {
+	case <-done:
+	case <-w.exited:
+	}
+}
+
+// StopParsing stops the session's parse worker, e.g. when the session is
+// deleted. The chunk being parsed and the output still queued are abandoned,
+// and waiters on them released. No new worker is started for the session
+// afterwards.
+func (h *Handler) StopParsing(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stoppedParsers == nil {
+		h.stoppedParsers = make(map[string]bool)
+	}
+	h.stoppedParsers[sessionID] = true
+	if w, ok := h.parsers[sessionID]; ok {
+		close(w.stop)
+		w.cancel()
+		delete(h.parsers, sessionID)
+	}
+}
+
+// runParser parses the worker's jobs in order until it is stopped, and then
+// drains the jobs queued before that with its cancelled context.
+func (h *Handler) runParser(sessionID string, w *parseWorker) {
+	defer close(w.exited)
+	ctx := w.ctx
+	for {
+		select {
+		case job := <-w.jobs:
+			h.runParseJob(ctx, sessionID, w, job)
+		case <-w.stop:
+			for {
+				select {
+				case job := <-w.jobs:
+					h.runParseJob(ctx, sessionID, w, job)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// runParseJob parses a job's output, or releases the waiter of a barrier.
+// Output is skipped once ctx is cancelled.
+func (h *Handler) runParseJob(ctx context.Context, sessionID string, w *parseWorker, job parseJob) {
+	if job.done != nil {
+		close(job.done)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	h.parseOutput(ctx, sessionID, w, job)
+}
+
+// parseOutput runs a chunk of output through the session's driver and
+// broadcasts the smart events and conversation messages it produces. The
+// events are tracked by the worker until answered or expired, and the
+// messages recorded in its conversation log, even while no client receives
+// them. Parsing stops early if ctx is cancelled.
+func (h *Handler) parseOutput(ctx context.Context, sessionID string, w *parseWorker, job parseJob) {
+	hub := h.hubManager.Get(sessionID)
+
+	// Get session-specific driver (Requirement 6.1)
+	sessionDriver := h.GetSessionDriver(sessionID)
+	if job.reset {
+		h.replayToDriver(ctx, sessionID, sessionDriver, job.cursor-int64(len(job.data)))
+	}
+
+	result, err := sessionDriver.Parse(ctx, job.data)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Warn("Driver parse error", "session_id", sessionID, "driver", sessionDriver.Name(), "error", err)
+		return
+	}
+
+	// Drivers without smart event support, such as the generic driver,
+	// skip the smart event path entirely
+	if !sessionDriver.Capabilities().SupportsSmartEvents {
+		result.SmartEvents = nil
+	}
+
+	// A prompt the driver answered itself is not shown to clients, unless
+	// the answer could not be written
+	if result.AutoResponse != nil && h.autoRespond(sessionID, *result.AutoResponse) {
+		result.SmartEvents = slices.DeleteFunc(result.SmartEvents, func(e driver.SmartEvent) bool {
+			return e.Kind == "claude_confirm"
+		})
+	}
+
+	err = w.events.update(result, func(expired []string) error {
+		if len(result.SmartEvents) == 0 && len(result.Messages) == 0 && len(expired) == 0 {
+			return nil
+		}
+
+		// Without subscribers the results are only kept for clients that
+		// attach later
+		if hub == nil || !hub.WantsParsedOutput() {
+			return w.conversation.record(result.Messages, func() error { return nil })
+		}
+
+		// Events follow the output they refer to, even if it is coalesced
+		if err := h.FlushOutput(sessionID); err != nil {
+			return err
+		}
+		if err := broadcastResolved(hub, expired, ResolvedExpired); err != nil {
+			return err
+		}
+		return w.conversation.record(result.Messages, func() error {
+			return broadcastParsed(hub, result)
+		})
+	})
+	if err != nil && err != ErrHubClosed {
+		h.logger.Error("Failed to broadcast parsed output", "session_id", sessionID, "error", err)
+	}
+}
+
+// autoRespond writes a driver's automatic answer to the session's PTY,
+// after the input already queued, and reports whether it was written.
+func (h *Handler) autoRespond(sessionID string, input []byte) bool {
+	if h.ptyManager == nil {
+		return false
+	}
+	ptyProcess, ok := h.ptyManager.Get(sessionID)
+	if !ok {
+		return false
+	}
+	written := h.queueInput(sessionID, nil, func() error {
+		return ptyProcess.Write(input)
+	})
+	if err := <-written; err != nil {
+		h.logger.Warn("Failed to write automatic response to PTY", "session_id", sessionID, "error", err)
+		return false
+	}
+	h.logger.Info("Answered prompt automatically", "session_id", sessionID, "input", string(input))
+	return true
+}
+
+// broadcastParsed broadcasts the smart events and conversation messages of
+// a parse result, in that order.
+func broadcastParsed(hub *Hub, result *driver.ParseResult) error {
+	// Send smart events if any (Requirement 6.2, 6.5)
+	for _, event := range result.SmartEvents {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		eventMsg := &Message{
+			Type:    MessageTypeSmartEvent,
+			Payload: payload,
+		}
+		if err := hub.BroadcastMessage(eventMsg); err != nil {
+			return err
+		}
+	}
+
+	// Send parsed conversation messages if any
+	for _, msg := range result.Messages {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		conversationMsg := &Message{
+			Type:    MessageTypeConversation,
+			Payload: payload,
+		}
+		if err := hub.BroadcastMessage(conversationMsg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+)
+
+// slowDriver takes delay to parse each chunk and reports every chunk as a
+// smart event whose prompt is the chunk.
+type slowDriver struct {
+	driver.AgentDriver
+	delay  time.Duration
+	resets int
+}
+
+func (d *slowDriver) Parse(ctx context.Context, chunk []byte) (*driver.ParseResult, error) {
+	time.Sleep(d.delay)
+	return &driver.ParseResult{
+		RawData:     chunk,
+		SmartEvents: []driver.SmartEvent{{Kind: "progress", Prompt: string(chunk)}},
+	}, nil
+}
+
+func (d *slowDriver) Reset() {
+	d.resets++
+}
+
+// newSlowParseHandler returns a handler whose session parses with a slow
+// driver, and a client subscribed to every message.
+func newSlowParseHandler(t *testing.T, sessionID string, queueSize int) (*Handler, *Hub, *Client, *slowDriver) {
+	t.Helper()
+	hubManager := NewHubManager()
+	t.Cleanup(hubManager.Close)
+	handler := NewHandler(hubManager, nil, nil)
+	handler.ParseQueueSize = queueSize
+	t.Cleanup(func() { handler.StopParsing(sessionID) })
+	slow := &slowDriver{AgentDriver: driver.NewClaudeDriver(), delay: 50 * time.Millisecond}
+	handler.SetSessionDriver(sessionID, slow)
+
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+	return handler, hub, client, slow
+}
+
+// TestBroadcastOutputSlowDriver tests that a slow driver does not delay
+// stdout, and that smart events follow in order once parsed
+func TestBroadcastOutputSlowDriver(t *testing.T) {
+	sessionID := "test-slow-parse-session"
+	handler, _, client, _ := newSlowParseHandler(t, sessionID, 0)
+
+	const chunks = 5
+	for i := 0; i < chunks; i++ {
+		start := time.Now()
+		if err := handler.BroadcastOutput(sessionID, []byte(fmt.Sprintf("chunk-%d", i))); err != nil {
+			t.Fatalf("BroadcastOutput failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+			t.Errorf("Expected BroadcastOutput not to wait for the driver, took %v", elapsed)
+		}
+	}
+
+	// Every chunk is broadcast before the driver has parsed the first
+	for i := 0; i < chunks; i++ {
+		msg := receiveMessage(t, client, 20*time.Millisecond)
+		if msg == nil || msg.Type != MessageTypeStdout || msg.Data != fmt.Sprintf("chunk-%d", i) {
+			t.Fatalf("Expected stdout chunk-%d, got %+v", i, msg)
+		}
+	}
+
+	for i := 0; i < chunks; i++ {
+		msg := receiveMessage(t, client, time.Second)
+		if msg == nil || msg.Type != MessageTypeSmartEvent {
+			t.Fatalf("Expected smart event, got %+v", msg)
+		}
+		var event driver.SmartEvent
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatalf("failed to decode smart event: %v", err)
+		}
+		if event.Prompt != fmt.Sprintf("chunk-%d", i) {
+			t.Errorf("Expected smart event for chunk-%d, got %q", i, event.Prompt)
+		}
+	}
+}
+
+// TestBroadcastOutputParseQueueFull tests that parse work, never stdout, is
+// dropped when the parse queue is full, and that the driver is reset before
+// parsing resumes
+func TestBroadcastOutputParseQueueFull(t *testing.T) {
+	sessionID := "test-parse-queue-session"
+	handler, hub, client, slow := newSlowParseHandler(t, sessionID, 1)
+
+	const chunks = 5
+	for i := 0; i < chunks; i++ {
+		if err := handler.BroadcastOutput(sessionID, []byte(fmt.Sprintf("chunk-%d", i))); err != nil {
+			t.Fatalf("BroadcastOutput failed: %v", err)
+		}
+	}
+	handler.waitParsed(sessionID)
+
+	dropped := hub.Stats().ParseDropped
+	if dropped == 0 || dropped > chunks-1 {
+		t.Errorf("Expected between 1 and %d chunks not to be parsed, got %d", chunks-1, dropped)
+	}
+
+	stdout, events := 0, 0
+	for msg := receiveMessage(t, client, 50*time.Millisecond); msg != nil; msg = receiveMessage(t, client, 50*time.Millisecond) {
+		switch msg.Type {
+		case MessageTypeStdout:
+			stdout++
+		case MessageTypeSmartEvent:
+			events++
+		}
+	}
+	if stdout != chunks {
+		t.Errorf("Expected all %d stdout chunks, got %d", chunks, stdout)
+	}
+	if events != chunks-int(dropped) {
+		t.Errorf("Expected %d smart events, got %d", chunks-int(dropped), events)
+	}
+
+	// The driver missed output, so it starts over with the next chunk
+	if err := handler.BroadcastOutput(sessionID, []byte("after")); err != nil {
+		t.Fatalf("BroadcastOutput failed: %v", err)
+	}
+	handler.waitParsed(sessionID)
+	if slow.resets != 1 {
+		t.Errorf("Expected the driver to be reset once, got %d", slow.resets)
+	}
+}
+
+// TestStopParsingConcurrent tests that stopping a session's parse worker
+// while output is queued and waited for neither panics, hangs nor starts
+// another worker
+func TestStopParsingConcurrent(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		sessionID := fmt.Sprintf("test-stop-parsing-%d", round)
+		hubManager := NewHubManager()
+		handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+		handler.ParseQueueSize = 4
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					handler.BroadcastOutput(sessionID, []byte("output"))
+					if j%10 == 0 {
+						handler.waitParsed(sessionID)
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		handler.StopParsing(sessionID)
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for output queued around StopParsing")
+		}
+
+		if w := handler.parser(sessionID); w != nil {
+			t.Fatal("Expected no parse worker to be started after StopParsing")
+		}
+		hubManager.Close()
+	}
+}
+
+// blockingDriver parses until its context is cancelled.
+type blockingDriver struct {
+	driver.AgentDriver
+	started chan struct{}
+}
+
+func (d *blockingDriver) Parse(ctx context.Context, chunk []byte) (*driver.ParseResult, error) {
+	close(d.started)
+	<-ctx.Done()
+	return &driver.ParseResult{RawData: chunk}, ctx.Err()
+}
+
+// TestStopParsingCancelsParse tests that StopParsing cancels the context of
+// the chunk being parsed, so the worker exits
+func TestStopParsingCancelsParse(t *testing.T) {
+	sessionID := "test-stop-parsing-cancel"
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, nil)
+	blocking := &blockingDriver{AgentDriver: driver.NewGenericDriver(), started: make(chan struct{})}
+	handler.SetSessionDriver(sessionID, blocking)
+
+	if err := handler.BroadcastOutput(sessionID, []byte("output")); err != nil {
+		t.Fatalf("BroadcastOutput failed: %v", err)
+	}
+	select {
+	case <-blocking.started:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the driver to parse")
+	}
+
+	w := handler.existingParser(sessionID)
+	handler.StopParsing(sessionID)
+	select {
+	case <-w.exited:
+	case <-time.After(time.Second):
+		t.Fatal("Expected StopParsing to cancel the chunk being parsed")
+	}
+}
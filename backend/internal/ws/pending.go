@@ -0,0 +1,243 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/remote-agent-terminal/backend/internal/driver"
+)
+
+// Reasons reported in a smart_event_resolved message.
+const (
+	// ResolvedAnswered means the event was answered, by an event_response
+	// message or by input matching one of its options.
+	ResolvedAnswered = "answered"
+
+	// ResolvedExpired means newer output replaced the prompt.
+	ResolvedExpired = "expired"
+)
+
+// SmartEventResolved is the payload of a smart_event_resolved message.
+type SmartEventResolved struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"` // ResolvedAnswered or ResolvedExpired
+}
+
+// pendingEvents tracks the session's smart events that wait for an answer,
+// those of eventResponseKinds. Drivers detect prompts in the output they
+// have buffered, so the same prompt is detected again on later chunks and
+// after a reconnect replays the output; tracking it by its signature keeps
+// it a single event with a single ID.
+type pendingEvents struct {
+	mu      sync.Mutex
+	pending map[string]driver.SmartEvent // Unanswered events by signature
+
+	// settled holds the signatures of answered or expired events that the
+	// driver still detects, so they are not raised again
+	settled map[string]bool
+}
+
+// eventSignature identifies a prompt across parse results.
+func eventSignature(event driver.SmartEvent) string {
+	return event.Kind + "\x00" + event.Prompt + "\x00" + strings.Join(event.Options, "\x00")
+}
+
+// update gives the events of result IDs, drops those already pending or
+// settled, and expires pending events replaced by a new prompt. It then
+// calls broadcast with the IDs of the expired events while holding the
+// tracker, so resolutions cannot overtake the events they resolve.
+//
+// A pending event expires when a result raises a new prompt, or when a
+// result that no longer detects it reports the CLI as idle or busy.
+func (p *pendingEvents) update(result *driver.ParseResult, broadcast func(expired []string) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending == nil {
+		p.pending = make(map[string]driver.SmartEvent)
+		p.settled = make(map[string]bool)
+	}
+
+	detected := make(map[string]bool)
+	raised, active := false, false
+	events := result.SmartEvents[:0]
+	for _, event := range result.SmartEvents {
+		if !eventResponseKinds[event.Kind] {
+			active = active || event.Kind == "idle" || event.Kind == "busy"
+			event.ID = uuid.NewString()
+			events = append(events, event)
+			continue
+		}
+
+		sig := eventSignature(event)
+		detected[sig] = true
+		if _, ok := p.pending[sig]; ok || p.settled[sig] {
+			continue
+		}
+		raised = true
+		event.ID = uuid.NewString()
+		events = append(events, event)
+	}
+	result.SmartEvents = events
+
+	// A terminal shows one prompt at a time
+	var expired []string
+	for sig, event := range p.pending {
+		if raised || active && !detected[sig] {
+			expired = append(expired, event.ID)
+			delete(p.pending, sig)
+			p.settled[sig] = true
+		}
+	}
+	for _, event := range events {
+		if eventResponseKinds[event.Kind] {
+			p.pending[eventSignature(event)] = event
+		}
+	}
+
+	// Settled prompts can be raised again once the driver stops detecting them
+	for sig := range p.settled {
+		if !detected[sig] {
+			delete(p.settled, sig)
+		}
+	}
+
+	return broadcast(expired)
+}
+
+// resolve marks the pending events matching match as answered and calls
+// broadcast with their IDs while holding the tracker. Nothing is broadcast
+// if no event matches.
+func (p *pendingEvents) resolve(match func(driver.SmartEvent) bool, broadcast func(answered []string) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var answered []string
+	for sig, event := range p.pending {
+		if match(event) {
+			answered = append(answered, event.ID)
+			delete(p.pending, sig)
+			p.settled[sig] = true
+		}
+	}
+	if len(answered) == 0 {
+		return nil
+	}
+	return broadcast(answered)
+}
+
+// snapshotLocked returns a copy of the pending events. p.mu must be held.
+func (p *pendingEvents) snapshotLocked() []driver.SmartEvent {
+	events := make([]driver.SmartEvent, 0, len(p.pending))
+	for _, event := range p.pending {
+		events = append(events, event)
+	}
+	return events
+}
+
+// register registers client with hub and returns copies of the conversation
+// messages recorded and the smart events pending before it, which the
+// client has not received. Events are broadcast while holding the tracker,
+// so holding it here too means each event reaches the client exactly once.
+func (w *parseWorker) register(hub *Hub, client *Client) ([]driver.Message, []driver.SmartEvent, error) {
+	w.events.mu.Lock()
+	defer w.events.mu.Unlock()
+
+	messages, err := w.conversation.register(hub, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return messages, w.events.snapshotLocked(), nil
+}
+
+// registerClient registers client with hub through the session's parse
+// worker; see parseWorker.register. It fails with ErrHubClosed if the
+// worker was stopped because the session is being deleted.
+func (h *Handler) registerClient(hub *Hub, client *Client) ([]driver.Message, []driver.SmartEvent, error) {
+	w := h.parser(client.sessionID)
+	if w == nil {
+		return nil, nil, ErrHubClosed
+	}
+	return w.register(hub, client)
+}
+
+// PendingEvents returns the session's smart events waiting for an answer.
+func (h *Handler) PendingEvents(sessionID string) []driver.SmartEvent {
+	w := h.existingParser(sessionID)
+	if w == nil {
+		return []driver.SmartEvent{}
+	}
+
+	w.events.mu.Lock()
+	defer w.events.mu.Unlock()
+	return w.events.snapshotLocked()
+}
+
+// sendPendingEvents sends the smart events that were waiting for an answer
+// when a client attached, with the IDs they were broadcast with, if it is
+// subscribed to smart events. A reconnecting client should show them in
+// place of the prompts it showed before.
+func (h *Handler) sendPendingEvents(client *Client, events []driver.SmartEvent) {
+	if !client.Subscribed(MessageTypeSmartEvent) {
+		return
+	}
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			h.logger.Error("Failed to marshal smart event", "session_id", client.sessionID, "error", err)
+			continue
+		}
+		client.sendReply(&Message{
+			Type:    MessageTypeSmartEvent,
+			Payload: payload,
+		})
+	}
+}
+
+// resolveEvents answers the session's pending events matching match and
+// tells the clients.
+func (h *Handler) resolveEvents(sessionID string, match func(driver.SmartEvent) bool) {
+	w := h.existingParser(sessionID)
+	hub := h.hubManager.Get(sessionID)
+	if w == nil || hub == nil {
+		return
+	}
+	err := w.events.resolve(match, func(answered []string) error {
+		return broadcastResolved(hub, answered, ResolvedAnswered)
+	})
+	if err != nil && err != ErrHubClosed {
+		h.logger.Error("Failed to broadcast resolved smart events", "session_id", sessionID, "error", err)
+	}
+}
+
+// resolveInput answers the session's pending events for which input is
+// the driver's response to one of their options, e.g. "1" for a
+// claude_confirm typed into the terminal.
+func (h *Handler) resolveInput(sessionID string, input []byte) {
+	sessionDriver := h.GetSessionDriver(sessionID)
+	h.resolveEvents(sessionID, func(event driver.SmartEvent) bool {
+		for _, option := range event.Options {
+			if bytes.Equal(sessionDriver.RespondToEvent(event, option), input) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// broadcastResolved broadcasts a smart_event_resolved message for each ID.
+func broadcastResolved(hub *Hub, ids []string, reason string) error {
+	for _, id := range ids {
+		payload, err := json.Marshal(SmartEventResolved{ID: id, Reason: reason})
+		if err != nil {
+			continue
+		}
+		if err := hub.BroadcastMessage(&Message{Type: MessageTypeSmartEventResolved, Payload: payload}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// parsedMessages feeds output to the session's driver and returns the
+// interactive smart events and resolutions the client is sent for it
+func parsedMessages(t *testing.T, handler *Handler, client *Client, sessionID, output string) ([]driver.SmartEvent, []SmartEventResolved) {
+	t.Helper()
+	if output != "" {
+		if err := handler.BroadcastOutput(sessionID, []byte(output)); err != nil {
+			t.Fatalf("BroadcastOutput failed: %v", err)
+		}
+		handler.waitParsed(sessionID)
+	}
+
+	var events []driver.SmartEvent
+	var resolved []SmartEventResolved
+	for msg := receiveMessage(t, client, 50*time.Millisecond); msg != nil; msg = receiveMessage(t, client, 50*time.Millisecond) {
+		switch msg.Type {
+		case MessageTypeSmartEvent:
+			var event driver.SmartEvent
+			if err := json.Unmarshal(msg.Payload, &event); err != nil {
+				t.Fatalf("Failed to decode smart event: %v", err)
+			}
+			if eventResponseKinds[event.Kind] {
+				events = append(events, event)
+			}
+		case MessageTypeSmartEventResolved:
+			var r SmartEventResolved
+			if err := json.Unmarshal(msg.Payload, &r); err != nil {
+				t.Fatalf("Failed to decode resolution: %v", err)
+			}
+			resolved = append(resolved, r)
+		}
+	}
+	return events, resolved
+}
+
+// TestSmartEventLifecycle tests a replayed confirm, its answer and the
+// next prompt
+func TestSmartEventLifecycle(t *testing.T) {
+	sessionID := "event-lifecycle"
+	handler, client := newCoalescingHandler(t, sessionID, 0, 0)
+	handler.SetSessionDriver(sessionID, driver.NewClaudeDriver())
+	defer handler.StopParsing(sessionID)
+
+	confirm := "Do you want to create hello.txt?\n❯ 1. Yes\n  2. Yes, allow all edits\n"
+	events, _ := parsedMessages(t, handler, client, sessionID, confirm)
+	if len(events) != 1 || events[0].Kind != "claude_confirm" || events[0].ID == "" {
+		t.Fatalf("Expected a claude_confirm event with an ID, got %+v", events)
+	}
+	id := events[0].ID
+
+	// The prompt is detected again when the output is redrawn or replayed
+	if events, _ := parsedMessages(t, handler, client, sessionID, confirm); len(events) != 0 {
+		t.Errorf("Expected the pending confirm not to be sent again, got %+v", events)
+	}
+	if pending := handler.PendingEvents(sessionID); len(pending) != 1 || pending[0].ID != id {
+		t.Errorf("Expected the confirm to be pending, got %+v", pending)
+	}
+
+	// Answering it resolves it for every client
+	payload, _ := json.Marshal(EventResponse{ID: id, Kind: "claude_confirm", Response: "yes"})
+	w := &fakePTYWriter{}
+	handler.handleEventResponse(client, &Message{Type: MessageTypeEventResponse, Payload: payload}, w)
+	if string(w.written) != "1" {
+		t.Errorf("Expected \"1\" written to the PTY, got %q", w.written)
+	}
+	_, resolved := parsedMessages(t, handler, client, sessionID, "")
+	if len(resolved) != 1 || resolved[0] != (SmartEventResolved{ID: id, Reason: ResolvedAnswered}) {
+		t.Errorf("Expected the confirm to be answered, got %+v", resolved)
+	}
+
+	// The answered prompt is still in the driver's buffer but not raised again
+	if events, _ := parsedMessages(t, handler, client, sessionID, "● Write(hello.txt)\r\n"); len(events) != 0 {
+		t.Errorf("Expected the answered confirm not to be sent again, got %+v", events)
+	}
+
+	// The next prompt is a new event, answered by typing into the terminal
+	events, _ = parsedMessages(t, handler, client, sessionID, "Run the tests now? (y/n) ")
+	if len(events) != 1 || events[0].Kind != "question" || events[0].ID == "" || events[0].ID == id {
+		t.Fatalf("Expected a new question event, got %+v", events)
+	}
+	if err := handler.handleStdin(client, &Message{Type: MessageTypeStdin, Data: "y\r"}, &fakePTYWriter{}); err != nil {
+		t.Fatalf("handleStdin failed: %v", err)
+	}
+	_, resolved = parsedMessages(t, handler, client, sessionID, "")
+	if len(resolved) != 1 || resolved[0] != (SmartEventResolved{ID: events[0].ID, Reason: ResolvedAnswered}) {
+		t.Errorf("Expected the question to be answered by the input, got %+v", resolved)
+	}
+	if pending := handler.PendingEvents(sessionID); len(pending) != 0 {
+		t.Errorf("Expected no pending events, got %+v", pending)
+	}
+}
+
+// TestSmartEventExpiry tests that a new prompt expires an unanswered one
+// and that unrelated input does not answer it
+func TestSmartEventExpiry(t *testing.T) {
+	sessionID := "event-expiry"
+	handler, client := newCoalescingHandler(t, sessionID, 0, 0)
+	handler.SetSessionDriver(sessionID, driver.NewClaudeDriver())
+	defer handler.StopParsing(sessionID)
+
+	events, _ := parsedMessages(t, handler, client, sessionID, "Do you want to delete old.txt?\n❯ 1. Yes\n")
+	if len(events) != 1 {
+		t.Fatalf("Expected a claude_confirm event, got %+v", events)
+	}
+	first := events[0].ID
+
+	handler.handleStdin(client, &Message{Type: MessageTypeStdin, Data: "x"}, &fakePTYWriter{})
+	if _, resolved := parsedMessages(t, handler, client, sessionID, ""); len(resolved) != 0 {
+		t.Errorf("Expected unrelated input not to answer the confirm, got %+v", resolved)
+	}
+
+	events, resolved := parsedMessages(t, handler, client, sessionID, "Continue anyway? (yes/no) ")
+	if len(resolved) != 1 || resolved[0] != (SmartEventResolved{ID: first, Reason: ResolvedExpired}) {
+		t.Errorf("Expected the confirm to expire, got %+v", resolved)
+	}
+	if len(events) != 1 || events[0].Kind != "question" {
+		t.Errorf("Expected the new question event, got %+v", events)
+	}
+}
+
+// TestPendingEventsOnAttach tests that a client attaching while a prompt
+// waits for an answer is sent it, with its ID, after the history
+func TestPendingEventsOnAttach(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "event-attach"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("Failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.SetSessionDriver(sessionID, driver.NewClaudeDriver())
+	defer handler.StopParsing(sessionID)
+
+	// The prompt is raised while no client is attached
+	if err := handler.BroadcastOutput(sessionID, []byte("Do you want to create hello.txt?\n❯ 1. Yes\n  2. No\n")); err != nil {
+		t.Fatalf("BroadcastOutput failed: %v", err)
+	}
+	handler.waitParsed(sessionID)
+	pending := handler.PendingEvents(sessionID)
+	if len(pending) != 1 || pending[0].ID == "" {
+		t.Fatalf("Expected a pending confirm, got %+v", pending)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	attach := func(query string) []driver.SmartEvent {
+		conn, _, err := websocket.DefaultDialer.Dial(url+query, nil)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		readStatusSnapshot(t, conn)
+		var msg Message
+		for msg.Type != MessageTypeHistoryEnd {
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("Failed to read history: %v", err)
+			}
+		}
+
+		// Pending events precede the size, which ends the restore
+		var events []driver.SmartEvent
+		for msg.Type != MessageTypeResize {
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("Failed to read restore: %v", err)
+			}
+			if msg.Type == MessageTypeSmartEvent {
+				var event driver.SmartEvent
+				if err := json.Unmarshal(msg.Payload, &event); err != nil {
+					t.Fatalf("Failed to decode smart event: %v", err)
+				}
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	if events := attach(""); len(events) != 1 || events[0].ID != pending[0].ID || events[0].Kind != "claude_confirm" {
+		t.Errorf("Expected the pending confirm with ID %s, got %+v", pending[0].ID, events)
+	}
+	if events := attach("?subscribe=conversation"); len(events) != 0 {
+		t.Errorf("Expected no smart events without a subscription, got %+v", events)
+	}
+}
+
+// TestSmartEventResolvedSubscription tests that resolutions follow the
+// smart_event subscription
+func TestSmartEventResolvedSubscription(t *testing.T) {
+	client := NewClient(nil, nil, "s1", false)
+	client.SetSubscriptions([]MessageType{MessageTypeConversation})
+	if client.Subscribed(MessageTypeSmartEventResolved) {
+		t.Error("Expected a client without smart events not to receive resolutions")
+	}
+
+	client.SetSubscriptions([]MessageType{MessageTypeSmartEvent})
+	if !client.Subscribed(MessageTypeSmartEventResolved) {
+		t.Error("Expected a client with smart events to receive resolutions")
+	}
+}
+
+// TestAutoRespond tests that a prompt answered by the driver's rules is
+// written to the PTY instead of being sent to clients
+func TestAutoRespond(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "auto-respond"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, nil)
+	defer handler.StopParsing(sessionID)
+	claude := driver.NewClaudeDriver()
+	claude.AutoRespondRules = driver.NewSafeAutoResponder()
+	handler.SetSessionDriver(sessionID, claude)
+
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	events, _ := parsedMessages(t, handler, client, sessionID, "Do you want to create hello.txt?\n❯ 1. Yes\n")
+	if len(events) != 0 {
+		t.Errorf("Expected the answered prompt not to be sent, got %+v", events)
+	}
+
+	// cat echoes the answer back
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(string(ptyProcess.GetHistory()), "1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected \"1\" written to the PTY, got output %q", ptyProcess.GetHistory())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Prompts the rules do not cover are left to the user
+	events, _ = parsedMessages(t, handler, client, sessionID, "Do you want to delete hello.txt?\n")
+	if len(events) != 1 || events[0].Kind != "claude_confirm" {
+		t.Errorf("Expected the delete prompt to be sent, got %+v", events)
+	}
+}
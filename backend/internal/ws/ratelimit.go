@@ -0,0 +1,118 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errInputRateLimited is returned for input refused by a client's input
+// rate limit; see Handler.StdinRateLimit.
+var errInputRateLimited = errors.New("input rate limit exceeded")
+
+// inputLimiter is a token bucket limiting the input bytes a client may send
+// per second.
+type inputLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Bytes added to the bucket per second
+	burst     float64 // Bucket size
+	tokens    float64
+	last      time.Time
+	throttled bool // The last input was refused
+}
+
+// newInputLimiter creates a full bucket of burst bytes refilled at rate
+// bytes per second. A burst <= 0 holds one second of input.
+func newInputLimiter(rate, burst int) *inputLimiter {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &inputLimiter{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow takes n bytes from the bucket if they are available. It reports
+// whether the input may be written, and, if not, whether this is the first
+// input refused since the last one allowed.
+func (l *inputLimiter) allow(n int) (ok, first bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if float64(n) <= l.tokens {
+		l.tokens -= float64(n)
+		l.throttled = false
+		return true, false
+	}
+	first = !l.throttled
+	l.throttled = true
+	return false, first
+}
+
+// SetInputRateLimit limits the input the client may send to rate bytes per
+// second, with bursts of up to burst bytes. Every message but resize and
+// ping counts as its data and payload bytes, and at least one byte. Input
+// beyond the limit is dropped; a single message larger than burst is always
+// dropped. A rate <= 0 removes the limit. It should be called before the
+// client's read pump starts.
+func (c *Client) SetInputRateLimit(rate, burst int) {
+	if rate <= 0 {
+		c.limiter.Store(nil)
+		return
+	}
+	c.limiter.Store(newInputLimiter(rate, burst))
+}
+
+// limitInput takes the size of an input message from the client's rate
+// limit and reports whether the message must be dropped. err is
+// errInputRateLimited if the client should be told: for every dropped
+// message with an ID, which expects an ack, but only for the first of a run
+// of dropped messages without one, so a flooding client is not flooded with
+// errors in turn.
+func (c *Client) limitInput(msg *Message) (dropped bool, err error) {
+	limiter := c.limiter.Load()
+	if limiter == nil {
+		return false, nil
+	}
+
+	ok, first := limiter.allow(max(len(msg.Data)+len(msg.Payload), 1))
+	if ok {
+		return false, nil
+	}
+	if first || msg.ID != "" {
+		return true, errInputRateLimited
+	}
+	return true, nil
+}
+
+// limitMessage drops a client message beyond the client's input rate limit,
+// telling the client as limitInput directs: stdin and command messages are
+// acknowledged, others answered with a RATE_LIMITED error. Resize and ping
+// messages are never limited. It reports whether the message was dropped.
+func (h *Handler) limitMessage(client *Client, msg *Message) bool {
+	if msg.Type == MessageTypeResize || msg.Type == MessageTypePing {
+		return false
+	}
+	dropped, err := client.limitInput(msg)
+	if !dropped {
+		return false
+	}
+	if err != nil {
+		if msg.Type == MessageTypeStdin || msg.Type == MessageTypeCommand {
+			acknowledge(client, msg, err)
+		} else {
+			rejectMessage(client, msg.Type, ErrorCodeRateLimited, "Input rate limit exceeded, message dropped")
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package ws
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// recordingPTY records the input written to it.
+type recordingPTY struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (p *recordingPTY) Write(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data = append(p.data, data...)
+	return nil
+}
+
+func (p *recordingPTY) written() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return string(p.data)
+}
+
+// TestStdinRateLimit tests that a burst of stdin beyond the limit is
+// dropped, reported once, and accepted again once the bucket refills
+func TestStdinRateLimit(t *testing.T) {
+	hub := NewHub("rate-session")
+	defer hub.Close()
+	handler := NewHandler(NewHubManager(), nil, nil)
+
+	client := NewClient(hub, nil, "rate-session", false)
+	hub.Register(client)
+	client.SetInputRateLimit(100, 10)
+
+	w := &recordingPTY{}
+	stdin := func(msg *Message) {
+		if !handler.limitMessage(client, msg) {
+			acknowledge(client, msg, handler.handleStdin(client, msg, w))
+		}
+	}
+	for i := 0; i < 20; i++ {
+		stdin(&Message{Type: MessageTypeStdin, Data: "x"})
+	}
+	if got := w.written(); got != "xxxxxxxxxx" {
+		t.Fatalf("Expected the burst of 10 bytes to be written, got %q", got)
+	}
+
+	// Only the first dropped message without an ID is reported
+	expectError(t, client, ErrorCodeRateLimited, MessageTypeStdin)
+	if msg := receiveMessage(t, client, 50*time.Millisecond); msg != nil {
+		t.Fatalf("Expected a single rate limit error, got %+v", msg)
+	}
+
+	// A dropped message with an ID is always acknowledged as failed
+	stdin(&Message{Type: MessageTypeStdin, Data: "0123456789", ID: "s1"})
+	expectAck(t, client, "s1", AckFailed, ErrorCodeRateLimited)
+
+	time.Sleep(50 * time.Millisecond)
+	stdin(&Message{Type: MessageTypeStdin, Data: "y", ID: "s2"})
+	expectAck(t, client, "s2", AckDelivered, "")
+	if got := w.written(); got != "xxxxxxxxxxy" {
+		t.Errorf("Expected input to be accepted after refilling, got %q", got)
+	}
+}
+
+// TestStdinRateLimitExemptions tests that resize and ping messages are
+// handled while a client's input is throttled, and that clients attached
+// without a limit are not throttled
+func TestStdinRateLimitExemptions(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "rate-exempt"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	hub := hubManager.GetOrCreate(sessionID)
+	limited := NewClient(hub, nil, sessionID, false)
+	unlimited := NewClient(hub, nil, sessionID, false)
+	hub.Register(limited)
+	hub.Register(unlimited)
+	limited.SetInputRateLimit(1, 4)
+
+	handler.handleMessage(limited, &Message{Type: MessageTypeStdin, Data: "0123456789", ID: "s1"}, ptyProcess)
+	expectAck(t, limited, "s1", AckFailed, ErrorCodeRateLimited)
+
+	handler.handleMessage(limited, &Message{Type: MessageTypePing}, ptyProcess)
+	if msg := receiveMessage(t, limited, time.Second); msg == nil || msg.Type != MessageTypePong {
+		t.Fatalf("Expected pong from a throttled client's ping, got %+v", msg)
+	}
+
+	handler.handleMessage(limited, &Message{Type: MessageTypeResize, Rows: 40, Cols: 100}, ptyProcess)
+	if rows, cols := ptyProcess.Size(); rows != 40 || cols != 100 {
+		t.Errorf("Expected a throttled client's resize to apply, got %dx%d", rows, cols)
+	}
+	if msg := receiveMessage(t, unlimited, time.Second); msg == nil || msg.Type != MessageTypeResize {
+		t.Fatalf("Expected the resize to be broadcast, got %+v", msg)
+	}
+
+	handler.handleMessage(unlimited, &Message{Type: MessageTypeStdin, Data: "0123456789", ID: "s2"}, ptyProcess)
+	expectAck(t, unlimited, "s2", AckDelivered, "")
+}
+
+// TestInputRateLimitOtherMessages tests that input actions and other
+// messages count towards the limit, and are refused with a RATE_LIMITED
+// error once it is exceeded
+func TestInputRateLimitOtherMessages(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "rate-actions"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+	client.SetInputRateLimit(1, 16)
+
+	// Text sent as an input action is limited like stdin
+	action := &Message{Type: MessageTypeInputAction, Payload: []byte(`{"type":"text","content":"0123456789abcdef"}`)}
+	handler.handleMessage(client, action, ptyProcess)
+	expectError(t, client, ErrorCodeRateLimited, MessageTypeInputAction)
+
+	// Messages without data still count
+	for i := 0; i < 16; i++ {
+		handler.handleMessage(client, &Message{Type: MessageTypeFocus}, ptyProcess)
+	}
+	handler.handleMessage(client, &Message{Type: MessageTypeBlur}, ptyProcess)
+	expectError(t, client, ErrorCodeRateLimited, MessageTypeBlur)
+}
@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/logger"
+)
+
+// StateReplayComplete is the status state sent after the last event of a
+// replayed recording.
+const StateReplayComplete = "replay_complete"
+
+// ReplayOptions configures how a recording is replayed.
+type ReplayOptions struct {
+	// Speed multiplies the recorded playback speed; 2 plays twice as fast.
+	// Zero or less plays at the recorded speed.
+	Speed float64
+
+	// From is the offset in seconds to start from. Earlier output is sent
+	// at once so the terminal catches up.
+	From float64
+
+	// OwnerID is the user the session belongs to. Attach tickets must have
+	// been issued to this user when ticket authentication is enabled.
+	OwnerID string
+}
+
+// HandleReplay streams the asciinema recording at logPath to a new WebSocket
+// client with its original timing. Output events are sent as stdout messages
+// and resize events as resize messages, starting with the recorded terminal
+// size. Replay needs only the recording, so it works for exited sessions.
+//
+// The replay stops early if the client disconnects. It ends with a
+// StateReplayComplete status message and a normal close frame.
+func (h *Handler) HandleReplay(w http.ResponseWriter, r *http.Request, sessionID, logPath string, opts ReplayOptions) error {
+	if !h.checkOrigin(w, r, "session_id", sessionID) {
+		return nil
+	}
+
+	// Validate the attach ticket before upgrading so rejections are plain HTTP 401s
+	if !h.authorizeTicket(r, sessionID, opts.OwnerID) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	reader, err := logger.Open(logPath)
+	if err != nil {
+		h.logger.Warn("Failed to open recording", "session_id", sessionID, "error", err)
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return nil
+	}
+	defer reader.Close()
+
+	conn, err := h.upgrader().Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Read until the client goes away; replies to pings and close frames
+	// are handled by the connection
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	player := logger.NewPlayer(reader, logger.PlayerOptions{Speed: opts.Speed, From: opts.From})
+	header := player.Header()
+	if err := writeReplayMessage(conn, &Message{
+		Type: MessageTypeResize,
+		Rows: uint16(header.Height),
+		Cols: uint16(header.Width),
+	}); err != nil {
+		return nil
+	}
+
+	err = player.Play(ctx, func(event logger.AsciinemaEvent) error {
+		var msg *Message
+		switch event.EventType {
+		case "o":
+			msg = &Message{Type: MessageTypeStdout, Data: event.Data}
+		case "r":
+			cols, rows, ok := event.Size()
+			if !ok {
+				return nil
+			}
+			msg = &Message{Type: MessageTypeResize, Rows: uint16(rows), Cols: uint16(cols)}
+		case "m":
+			msg = &Message{Type: MessageTypeMarker, Data: event.Data}
+		default:
+			// Input is already echoed in the output
+			return nil
+		}
+		return writeReplayMessage(conn, msg)
+	})
+	if ctx.Err() != nil {
+		// The client went away
+		return nil
+	}
+	if err != nil {
+		if reader.Err() == nil {
+			// Writing to the client failed
+			return nil
+		}
+		h.logger.Error("Failed to read recording", "session_id", sessionID, "error", err)
+	}
+	if n := reader.Skipped(); n > 0 {
+		h.logger.Warn("Skipped malformed events in recording", "session_id", sessionID, "events", n)
+	}
+
+	if err := writeReplayMessage(conn, &Message{Type: MessageTypeStatus, State: StateReplayComplete}); err != nil {
+		return nil
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay complete"),
+		time.Now().Add(writeWait))
+
+	// Give the client a moment to answer the close frame
+	select {
+	case <-done:
+	case <-time.After(closeAckWait):
+	}
+	return nil
+}
+
+// writeReplayMessage writes msg to conn as a JSON text frame.
+func writeReplayMessage(conn *websocket.Conn, msg *Message) error {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return conn.WriteJSON(msg)
+}
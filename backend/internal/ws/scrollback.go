@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/remote-agent-terminal/backend/internal/logger"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// MaxScrollbackLines is the most lines a scrollback message may request.
+const MaxScrollbackLines = 10000
+
+// scrollbackBatch is how many events are first read from the end of a
+// recording for a scrollback request. It doubles until enough output has
+// been read.
+const scrollbackBatch = 256
+
+// handleScrollback sends the client up to msg.Lines lines of output from
+// before msg.Cursor, or before the start of the ring buffer if it has no
+// cursor, read from the session's recording. The output is sent as history
+// messages with the cursor after their bytes, followed by a history_end
+// message in RestoreScrollback mode with the cursor at the end of the
+// output and the request's ID. Clients page further back by requesting
+// the lines before the cursor minus the bytes sent.
+//
+// Cursors count the output of the process, so positions in a recording
+// whose output was redacted may be off by the bytes redaction changed.
+//
+// It runs off the read pump; a client's requests are answered one at a
+// time, so the history of one is not interleaved with another's.
+func (h *Handler) handleScrollback(client *Client, msg *Message, ptyProcess *pty.PTYProcess) {
+	client.scrollbackMu.Lock()
+	defer client.scrollbackMu.Unlock()
+
+	if msg.Lines <= 0 || msg.Lines > MaxScrollbackLines {
+		rejectMessage(client, msg.Type, ErrorCodeInvalidMessage,
+			fmt.Sprintf("Scrollback lines must be between 1 and %d", MaxScrollbackLines))
+		return
+	}
+	if ptyProcess.Logger == nil || ptyProcess.Session == nil || ptyProcess.Session.LogFilePath == "" {
+		rejectMessage(client, msg.Type, ErrorCodeScrollbackFailed, "Session is not recorded")
+		return
+	}
+
+	total := int64(ptyProcess.RingBuffer.Cursor())
+	end := int64(ptyProcess.RingBuffer.Start())
+	if msg.Cursor > 0 {
+		end = min(msg.Cursor, total)
+	}
+
+	data, complete, err := readScrollback(ptyProcess.Session.LogFilePath, total-end, msg.Lines)
+	if err != nil {
+		h.logger.Warn("Failed to read scrollback", "session_id", client.sessionID, "error", err)
+		rejectMessage(client, msg.Type, ErrorCodeScrollbackFailed, "Failed to read scrollback: "+err.Error())
+		return
+	}
+
+	start := end - int64(len(data))
+	for _, chunk := range splitHistory(data, HistoryChunkSize) {
+		start += int64(len(chunk))
+		if err := client.sendReply(&Message{
+			Type:   MessageTypeHistory,
+			Data:   string(chunk),
+			Cursor: start,
+		}); err != nil {
+			return
+		}
+	}
+
+	payload, _ := json.Marshal(HistoryEnd{Bytes: len(data), Mode: RestoreScrollback, Complete: complete})
+	client.sendReply(&Message{
+		Type:    MessageTypeHistoryEnd,
+		Payload: payload,
+		Cursor:  end,
+		ID:      msg.ID,
+	})
+}
+
+// readScrollback returns up to lines lines of the output recorded at
+// filePath, ending skip bytes before the end of the recorded output. The
+// first line may be partial only if the recording starts with it, in which
+// case complete is true: there is no older output.
+//
+// The recording is read backwards, in batches of events that double in
+// size until they hold enough output.
+func readScrollback(filePath string, skip int64, lines int) (data []byte, complete bool, err error) {
+	for n := scrollbackBatch; ; n *= 2 {
+		events, err := logger.ReadLastNEvents(filePath, n)
+		if err != nil {
+			return nil, false, err
+		}
+		all := len(events) < n
+
+		var output []byte
+		for _, event := range events {
+			if event.EventType == "o" {
+				output = append(output, event.Data...)
+			}
+		}
+		if int64(len(output)) <= skip {
+			if all {
+				return nil, true, nil
+			}
+			continue
+		}
+
+		output = output[:int64(len(output))-skip]
+		start, ok := lastLines(output, lines)
+		if ok || all {
+			return output[start:], all && start == 0, nil
+		}
+	}
+}
+
+// lastLines returns the offset in data of its last n lines. A trailing
+// newline does not start another line. It reports false if data has fewer
+// than n complete lines, in which case the offset is 0.
+func lastLines(data []byte, n int) (int, bool) {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := end - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			n--
+			if n == 0 {
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
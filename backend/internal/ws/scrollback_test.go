@@ -0,0 +1,129 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// requestScrollback sends a scrollback message and collects the history it
+// is answered with, up to the history_end message.
+func requestScrollback(t *testing.T, handler *Handler, client *Client, ptyProcess *pty.PTYProcess, lines int, cursor int64) (string, *Message, HistoryEnd) {
+	t.Helper()
+	handler.handleMessage(client, &Message{Type: MessageTypeScrollback, Lines: lines, Cursor: cursor, ID: "sb"}, ptyProcess)
+
+	var data strings.Builder
+	for {
+		msg := receiveMessage(t, client, time.Second)
+		if msg == nil {
+			t.Fatal("Expected scrollback history, got nothing")
+		}
+		switch msg.Type {
+		case MessageTypeHistory:
+			data.WriteString(msg.Data)
+		case MessageTypeHistoryEnd:
+			var end HistoryEnd
+			if err := json.Unmarshal(msg.Payload, &end); err != nil {
+				t.Fatalf("Invalid history_end payload: %v", err)
+			}
+			return data.String(), msg, end
+		default:
+			t.Fatalf("Unexpected message %+v", msg)
+		}
+	}
+}
+
+// TestScrollback tests paging back through a session's recording from the
+// start of the ring buffer to the start of the session
+func TestScrollback(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{
+			ID:          "scrollback-session",
+			Command:     "seq 1 300",
+			LogFilePath: filepath.Join(t.TempDir(), "scrollback.cast"),
+		},
+		RingBufferSize: 256,
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(ptyProcess.GetHistory()), "300\r\n") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for output")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	hub := NewHub("scrollback-session")
+	defer hub.Close()
+	handler := NewHandler(NewHubManager(), ptyManager, nil)
+	client := NewClient(hub, nil, "scrollback-session", false)
+	hub.Register(client)
+
+	// The lines before the hot-restore history
+	ringStart := int64(ptyProcess.RingBuffer.Start())
+	data, msg, end := requestScrollback(t, handler, client, ptyProcess, 5, 0)
+	if msg.Cursor != ringStart || msg.ID != "sb" {
+		t.Errorf("Expected history_end at cursor %d with the request's ID, got %+v", ringStart, msg)
+	}
+	if end.Mode != RestoreScrollback || end.Bytes != len(data) || end.Complete {
+		t.Errorf("Expected %d bytes of incomplete scrollback, got %+v", len(data), end)
+	}
+	if lines := strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n"); len(lines) != 5 {
+		t.Errorf("Expected 5 lines, got %q", data)
+	}
+
+	// Paging back continues where the last page started, and the pages
+	// join up with the ring buffer
+	cursor := msg.Cursor - int64(end.Bytes)
+	older, msg, end := requestScrollback(t, handler, client, ptyProcess, MaxScrollbackLines, cursor)
+	if msg.Cursor != cursor || !end.Complete {
+		t.Errorf("Expected the rest of the recording before cursor %d, got %+v %+v", cursor, msg, end)
+	}
+	var want strings.Builder
+	for i := 1; i <= 300; i++ {
+		want.WriteString(strconv.Itoa(i) + "\r\n")
+	}
+	if got := older + data + string(ptyProcess.GetHistory()); got != want.String() {
+		t.Errorf("Expected the pages and history to hold all output, got %q", got)
+	}
+}
+
+// TestScrollbackRejected tests the errors for invalid and unrecorded
+// scrollback requests
+func TestScrollbackRejected(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: "unrecorded-scrollback", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hub := NewHub("unrecorded-scrollback")
+	defer hub.Close()
+	handler := NewHandler(NewHubManager(), ptyManager, nil)
+	client := NewClient(hub, nil, "unrecorded-scrollback", false)
+	hub.Register(client)
+
+	for _, lines := range []int{0, -1, MaxScrollbackLines + 1} {
+		handler.handleMessage(client, &Message{Type: MessageTypeScrollback, Lines: lines}, ptyProcess)
+		expectError(t, client, ErrorCodeInvalidMessage, MessageTypeScrollback)
+	}
+
+	handler.handleMessage(client, &Message{Type: MessageTypeScrollback, Lines: 10}, ptyProcess)
+	expectError(t, client, ErrorCodeScrollbackFailed, MessageTypeScrollback)
+}
@@ -2,10 +2,12 @@ package ws
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/logging"
 	"github.com/remote-agent-terminal/backend/internal/model"
 	"github.com/remote-agent-terminal/backend/internal/pty"
 )
@@ -17,9 +19,22 @@ type Service struct {
 	ptyManager *pty.Manager
 	handler    *Handler
 
+	// userHubs holds the hub of each user's session feed, keyed by user ID
+	userHubs *HubManager
+
 	// Session status callbacks
 	onStatusChange func(sessionID string, status model.SessionStatus, exitCode *int)
 
+	// stopOutput removes each session's output listener
+	stopOutput map[string]func()
+
+	// attached is the process each session's output comes from
+	attached map[string]*pty.PTYProcess
+
+	startedAt time.Time
+
+	logger logging.Logger
+
 	mu sync.RWMutex
 }
 
@@ -31,8 +46,23 @@ func NewService(ptyManager *pty.Manager, agentDriver driver.AgentDriver) *Servic
 	return &Service{
 		hubManager: hubManager,
 		ptyManager: ptyManager,
+		userHubs:   NewHubManager(),
 		handler:    handler,
+		stopOutput: make(map[string]func()),
+		attached:   make(map[string]*pty.PTYProcess),
+		startedAt:  time.Now(),
+		logger:     logging.Nop{},
+	}
+}
+
+// SetLogger sets the logger for the service and its handler. A nil logger
+// discards messages, which is the default. Must be called before serving.
+func (s *Service) SetLogger(logger logging.Logger) {
+	if logger == nil {
+		logger = logging.Nop{}
 	}
+	s.logger = logger
+	s.handler.SetLogger(logger)
 }
 
 // SetOnStatusChange sets the callback for session status changes.
@@ -52,28 +82,52 @@ func (s *Service) HubManager() *HubManager {
 	return s.hubManager
 }
 
-// AttachSession attaches WebSocket handling to a PTY session.
-// This sets up the output callback for broadcasting and the exit callback for status updates.
+// UserConnectionCounts returns the number of open WebSocket connections,
+// to sessions and session feeds, of each user that has any.
+func (s *Service) UserConnectionCounts() map[string]int {
+	return s.handler.UserConnectionCounts()
+}
+
+// AttachSession spawns a PTY process for a session and attaches WebSocket
+// handling to it with AttachProcess. It also sets up the exit callback for status updates.
 // The PTY process continues running even when no WebSocket clients are connected (Requirement 4.1).
 func (s *Service) AttachSession(ctx context.Context, session *model.Session, opts pty.SpawnOptions) (*pty.PTYProcess, error) {
 	sessionID := session.ID
 
-	// Set up output callback to broadcast to WebSocket clients
-	opts.OutputCallback = func(data []byte) {
-		s.handler.BroadcastOutput(sessionID, data)
-	}
-
 	// Set up exit callback to update status and notify clients
 	opts.ExitCallback = func(exitCode int, err error) {
 		s.handleProcessExit(sessionID, exitCode, err)
 	}
 
+	// Warn clients when the process stops producing output
+	if opts.WatchdogTimeout > 0 {
+		timeout := opts.WatchdogTimeout
+		opts.WatchdogCallback = func(sessionID string) {
+			s.HandleWatchdog(sessionID, timeout)
+		}
+	}
+
 	// Spawn the PTY process
 	ptyProcess, err := s.ptyManager.Spawn(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	s.AttachProcess(sessionID, ptyProcess, nil)
+	return ptyProcess, nil
+}
+
+// AttachProcess broadcasts the output of a session's PTY process to its
+// WebSocket clients, parsed by agentDriver if it is not nil. Call it once
+// when the process is spawned; attaching a new process for the session, such
+// as after a restart, replaces the previous one and broadcasts a
+// StateRestarted status to mark the boundary between their outputs.
+func (s *Service) AttachProcess(sessionID string, ptyProcess *pty.PTYProcess, agentDriver driver.AgentDriver) {
+	// Set the driver before any output is parsed
+	if agentDriver != nil {
+		s.handler.SetSessionDriver(sessionID, agentDriver)
+	}
+
 	// Create hub for this session (even if no clients yet)
 	hub := s.hubManager.GetOrCreate(sessionID)
 
@@ -81,10 +135,58 @@ func (s *Service) AttachSession(ctx context.Context, session *model.Session, opt
 	hub.SetOnClose(func() {
 		// Process keeps running when all clients disconnect
 		// This is the key to session keepalive
-		log.Printf("All clients disconnected from session %s, process continues running", sessionID)
+		s.logger.Info("All clients disconnected, process continues running", "session_id", sessionID)
 	})
 
-	return ptyProcess, nil
+	// Stop broadcasting the previous process's output
+	s.mu.Lock()
+	previous, restarted := s.stopOutput[sessionID]
+	if restarted {
+		previous()
+		delete(s.stopOutput, sessionID)
+	}
+	s.mu.Unlock()
+
+	if restarted {
+		if err := s.handler.BroadcastStatus(sessionID, StateRestarted, nil); err != nil {
+			s.logger.Error("Failed to broadcast status", "session_id", sessionID, "error", err)
+		}
+	}
+
+	// Clients resuming from the previous process's output get the new
+	// process's output in full
+	hub.ResetOutputIndex()
+
+	// Broadcast output to WebSocket clients (Requirement 3.3)
+	stop := s.handler.WatchOutput(sessionID, ptyProcess)
+	s.mu.Lock()
+	if previous, ok := s.stopOutput[sessionID]; ok {
+		previous()
+	}
+	s.stopOutput[sessionID] = stop
+	s.attached[sessionID] = ptyProcess
+	s.mu.Unlock()
+
+	// Let the hub be cleaned up once the process exits and clients leave
+	hub.MarkRunning()
+	go s.watchExit(sessionID, ptyProcess)
+}
+
+// watchExit marks the session's hub exited when ptyProcess closes, unless
+// another process has been attached since.
+func (s *Service) watchExit(sessionID string, ptyProcess *pty.PTYProcess) {
+	<-ptyProcess.ClosedChan()
+
+	s.mu.RLock()
+	current := s.attached[sessionID] == ptyProcess
+	s.mu.RUnlock()
+	if !current {
+		return
+	}
+
+	if hub := s.hubManager.Get(sessionID); hub != nil {
+		hub.MarkExited()
+	}
 }
 
 // handleProcessExit handles PTY process exit.
@@ -94,15 +196,23 @@ func (s *Service) handleProcessExit(sessionID string, exitCode int, err error) {
 
 	if err != nil {
 		status = model.SessionStatusFailed
-		log.Printf("Session %s failed: %v", sessionID, err)
+		s.logger.Warn("Session failed", "session_id", sessionID, "error", err)
 	} else {
 		status = model.SessionStatusExited
 		code = &exitCode
-		log.Printf("Session %s exited with code %d", sessionID, exitCode)
+		s.logger.Info("Session exited", "session_id", sessionID, "exit_code", exitCode)
+	}
+
+	// The process's output has ended, so nothing completes a held-back
+	// escape sequence; send it all before the status
+	if err := s.handler.StopCoalescing(sessionID); err != nil && err != ErrHubClosed {
+		s.logger.Error("Failed to flush output", "session_id", sessionID, "error", err)
 	}
 
 	// Broadcast status to connected clients
-	s.handler.BroadcastStatus(sessionID, string(status), code)
+	if err := s.handler.BroadcastStatus(sessionID, string(status), code); err != nil {
+		s.logger.Error("Failed to broadcast status", "session_id", sessionID, "error", err)
+	}
 
 	// Call status change callback
 	s.mu.RLock()
@@ -114,9 +224,45 @@ func (s *Service) handleProcessExit(sessionID string, exitCode int, err error) {
 	}
 }
 
+// HandleWatchdog warns the clients of a session whose process has produced
+// no output for timeout. The process is left running.
+func (s *Service) HandleWatchdog(sessionID string, timeout time.Duration) {
+	s.logger.Warn("Session produced no output, it may be stuck", "session_id", sessionID, "timeout", timeout)
+
+	message := fmt.Sprintf("No output for %v; the process may be stuck", timeout)
+	if err := s.handler.BroadcastAlert(sessionID, AlertWatchdog, message); err != nil {
+		s.logger.Error("Failed to broadcast alert", "session_id", sessionID, "error", err)
+	}
+}
+
+// HandleExpired tells the clients of a session that it is being terminated
+// for exceeding maxDuration.
+func (s *Service) HandleExpired(sessionID string, maxDuration time.Duration) {
+	s.logger.Info("Session exceeded its maximum duration, terminating", "session_id", sessionID, "max_duration", maxDuration)
+
+	if err := s.handler.BroadcastStatus(sessionID, StateTTLExpired, nil); err != nil {
+		s.logger.Error("Failed to broadcast status", "session_id", sessionID, "error", err)
+	}
+}
+
 // DetachSession removes WebSocket handling from a session.
 // This should be called when a session is deleted.
 func (s *Service) DetachSession(sessionID string) {
+	s.mu.Lock()
+	if stop, ok := s.stopOutput[sessionID]; ok {
+		stop()
+		delete(s.stopOutput, sessionID)
+	}
+	delete(s.attached, sessionID)
+	s.mu.Unlock()
+	s.handler.StopParsing(sessionID)
+	s.handler.StopInput(sessionID)
+
+	// Deliver output held back by coalescing before the clients are closed
+	if err := s.handler.StopCoalescing(sessionID); err != nil && err != ErrHubClosed {
+		s.logger.Error("Failed to flush output", "session_id", sessionID, "error", err)
+	}
+
 	// Close all WebSocket connections for this session
 	s.hubManager.Remove(sessionID)
 }
@@ -136,6 +282,15 @@ func (s *Service) IsSessionConnected(sessionID string) bool {
 }
 
 // Close closes all WebSocket connections and cleans up resources.
+// Clients are told the server is going away and given up to
+// DefaultDrainTimeout to close their connections.
 func (s *Service) Close() {
-	s.hubManager.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+	defer cancel()
+	if err := s.hubManager.Shutdown(ctx, "server shutting down"); err != nil {
+		s.logger.Warn("WebSocket clients did not close in time", "error", err)
+	}
+	if err := s.userHubs.Shutdown(ctx, "server shutting down"); err != nil {
+		s.logger.Warn("Session feed clients did not close in time", "error", err)
+	}
 }
@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// HandleSessionFeed upgrades a connection of userID to the user's session
+// feed, on which PublishSessionEvent pushes changes to the user's sessions.
+// Feed connections count against the handler's MaxConnsPerUser.
+// The feed has a hub per user that, unlike a session's hub, is not tied to
+// a PTY; its clients are read-only and may only send pings.
+func (s *Service) HandleSessionFeed(w http.ResponseWriter, r *http.Request, userID string) error {
+	h := s.handler
+	if !h.checkOrigin(w, r, "user_id", userID) {
+		return nil
+	}
+
+	release, ok := h.acquireConn(w, userID)
+	if !ok {
+		return nil
+	}
+
+	hub := s.userHubs.GetOrCreate(userID)
+
+	u := h.upgrader()
+	conn, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		release()
+		return err
+	}
+	if u.EnableCompression {
+		conn.EnableWriteCompression(true)
+		conn.SetCompressionLevel(h.compressionLevel())
+	}
+
+	client := NewClient(hub, conn, "", true)
+	if err := hub.Register(client); err != nil {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()),
+			time.Now().Add(writeWait))
+		conn.Close()
+		release()
+		return nil
+	}
+	hub.SetOnMessage(func(c *Client, msg *Message) {
+		if msg.Type == MessageTypePing {
+			h.handlePing(c)
+		}
+	})
+
+	client.release = release
+	go h.writePump(client)
+	go h.readPump(client, hub)
+
+	return nil
+}
+
+// PublishSessionEvent sends a session feed message of type msgType, with
+// payload encoded as JSON, to the feed clients of userID. It does nothing
+// if the user has no feed.
+func (s *Service) PublishSessionEvent(userID string, msgType MessageType, payload any) error {
+	hub := s.userHubs.Get(userID)
+	if hub == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session event: %w", err)
+	}
+	return hub.BroadcastMessage(&Message{Type: msgType, Payload: data})
+}
+
+// SessionFeedClientCount returns the number of session feed clients of a user.
+func (s *Service) SessionFeedClientCount(userID string) int {
+	hub := s.userHubs.Get(userID)
+	if hub == nil {
+		return 0
+	}
+	return hub.ClientCount()
+}
@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// hijackWriter is an http.ResponseWriter that hands its connection to a
+// WebSocket upgrade.
+type hijackWriter struct {
+	conn   net.Conn
+	header http.Header
+}
+
+func (w *hijackWriter) Header() http.Header         { return w.header }
+func (w *hijackWriter) Write(p []byte) (int, error) { return w.conn.Write(p) }
+func (w *hijackWriter) WriteHeader(int)             {}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+// newPipeConn returns the server side of a WebSocket connection over
+// net.Pipe, and the peer's raw connection. A pipe has no buffer, so writes
+// block until the peer reads.
+func newPipeConn(t *testing.T) (*websocket.Conn, net.Conn) {
+	t.Helper()
+	serverEnd, peerEnd := net.Pipe()
+
+	type result struct {
+		conn *websocket.Conn
+		err  error
+	}
+	upgraded := make(chan result, 1)
+	go func() {
+		req, err := http.ReadRequest(bufio.NewReader(serverEnd))
+		if err != nil {
+			upgraded <- result{err: err}
+			return
+		}
+		u := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+		conn, err := u.Upgrade(&hijackWriter{conn: serverEnd, header: http.Header{}}, req, nil)
+		upgraded <- result{conn, err}
+	}()
+
+	u, _ := url.Parse("ws://pipe/ws")
+	if _, _, err := websocket.NewClient(peerEnd, u, nil, 1024, 1024); err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	r := <-upgraded
+	if r.err != nil {
+		t.Fatalf("upgrade failed: %v", r.err)
+	}
+	t.Cleanup(func() {
+		r.conn.Close()
+		peerEnd.Close()
+	})
+	return r.conn, peerEnd
+}
+
+// TestStalledClientUnregistered tests that a client whose peer stops reading
+// is unregistered on its first write timeout, without holding up the other
+// clients
+func TestStalledClientUnregistered(t *testing.T) {
+	sessionID := "stalled-session"
+	hub := NewHub(sessionID)
+	defer hub.Close()
+
+	logger := &recordingLogger{}
+	handler := NewHandler(NewHubManager(), nil, nil)
+	handler.SetLogger(logger)
+	handler.WriteTimeout = 20 * time.Millisecond
+
+	healthy := NewClient(hub, nil, sessionID, false)
+	hub.Register(healthy)
+
+	// The peer never reads, so the first write blocks until its deadline
+	conn, _ := newPipeConn(t)
+	stalled := NewClient(hub, conn, sessionID, false)
+	hub.Register(stalled)
+	go handler.writePump(stalled)
+	go handler.readPump(stalled, hub)
+
+	for i := 0; i < 5; i++ {
+		if err := hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "output"}); err != nil {
+			t.Fatalf("BroadcastMessage failed: %v", err)
+		}
+	}
+
+	select {
+	case <-stalled.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("write pump of the stalled client did not stop")
+	}
+
+	if count := hub.ClientCount(); count != 1 {
+		t.Errorf("expected the stalled client to be unregistered, got %d clients", count)
+	}
+	if stats := hub.Stats(); stats.WriteTimeouts != 1 {
+		t.Errorf("expected 1 write timeout in the hub stats, got %d", stats.WriteTimeouts)
+	}
+	if n := len(healthy.SendChan()); n != 5 {
+		t.Errorf("expected the healthy client to receive 5 messages, got %d", n)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	timeouts := 0
+	for _, warning := range logger.warnings {
+		if strings.HasPrefix(warning, "WebSocket write timed out") {
+			timeouts++
+			if !strings.Contains(warning, "session_id "+sessionID) || !strings.Contains(warning, "remote_addr pipe") {
+				t.Errorf("expected session ID and remote address in warning, got %q", warning)
+			}
+		}
+	}
+	if timeouts != 1 {
+		t.Errorf("expected 1 write timeout warning, got %q", logger.warnings)
+	}
+}
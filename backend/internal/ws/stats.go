@@ -0,0 +1,245 @@
+package ws
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientInfo describes a connected client for introspection.
+type ClientInfo struct {
+	ID           string    `json:"id"`
+	SessionID    string    `json:"sessionId"`
+	RemoteAddr   string    `json:"remoteAddr,omitempty"`
+	ReadOnly     bool      `json:"readOnly"`
+	Controller   bool      `json:"controller"` // Holds the input lock
+	ConnectedAt  time.Time `json:"connectedAt"`
+	MessagesSent uint64    `json:"messagesSent"`
+	BytesSent    uint64    `json:"bytesSent"`
+	Dropped      uint64    `json:"dropped"`
+}
+
+// HubStats is a snapshot of a hub's broadcast counters and clients.
+type HubStats struct {
+	SessionID string `json:"sessionId"`
+
+	// Clients is the number of connected clients.
+	Clients int `json:"clients"`
+
+	// BytesBroadcast is the total payload size broadcast by the hub.
+	BytesBroadcast uint64 `json:"bytesBroadcast"`
+
+	// Messages counts broadcast messages by type.
+	Messages map[MessageType]uint64 `json:"messages"`
+
+	// Unicast counts messages sent to a single client by type, such as
+	// history, acks and errors; see Hub.SendTo.
+	Unicast map[MessageType]uint64 `json:"unicast"`
+
+	// Dropped is the number of frames discarded for slow clients,
+	// including clients that have since disconnected.
+	Dropped uint64 `json:"dropped"`
+
+	// WriteTimeouts is the number of clients unregistered because a write
+	// to their connection missed the write deadline.
+	WriteTimeouts uint64 `json:"writeTimeouts"`
+
+	// ParseDropped is the number of output chunks that were not parsed for
+	// smart events because the session's parse queue was full.
+	ParseDropped uint64 `json:"parseDropped"`
+
+	// Connections lists the connected clients, oldest first.
+	Connections []ClientInfo `json:"connections"`
+}
+
+// hubCounters holds a hub's broadcast counters. They are updated without
+// taking the hub lock.
+type hubCounters struct {
+	bytes         atomic.Uint64
+	dropped       atomic.Uint64
+	writeTimeouts atomic.Uint64
+	parseDropped  atomic.Uint64
+	messages      sync.Map // MessageType -> *atomic.Uint64
+	unicast       sync.Map // MessageType -> *atomic.Uint64
+}
+
+// countMessage records a broadcast message.
+func (s *hubCounters) countMessage(msg *Message) {
+	s.bytes.Add(uint64(len(msg.Data)))
+	countType(&s.messages, msg.Type)
+}
+
+// countUnicast records a message sent to a single client.
+func (s *hubCounters) countUnicast(msg *Message) {
+	countType(&s.unicast, msg.Type)
+}
+
+// countType increments the counter of t in counters.
+func countType(counters *sync.Map, t MessageType) {
+	counter, ok := counters.Load(t)
+	if !ok {
+		counter, _ = counters.LoadOrStore(t, new(atomic.Uint64))
+	}
+	counter.(*atomic.Uint64).Add(1)
+}
+
+// typeCounts returns a snapshot of counters by message type.
+func typeCounts(counters *sync.Map) map[MessageType]uint64 {
+	counts := make(map[MessageType]uint64)
+	counters.Range(func(key, value any) bool {
+		counts[key.(MessageType)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
+
+// Info returns the client's connection statistics.
+func (c *Client) Info() ClientInfo {
+	c.mu.Lock()
+	dropped := c.dropped
+	c.mu.Unlock()
+
+	return ClientInfo{
+		ID:           c.id,
+		SessionID:    c.sessionID,
+		RemoteAddr:   c.remoteAddr,
+		ReadOnly:     c.readOnly,
+		ConnectedAt:  c.connectedAt,
+		MessagesSent: c.messagesSent.Load(),
+		BytesSent:    c.bytesSent.Load(),
+		Dropped:      dropped,
+	}
+}
+
+// Snapshot returns information about the connected clients, oldest
+// connection first. The hub lock is only held while copying the client list.
+func (h *Hub) Snapshot() []ClientInfo {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	controller := h.controller
+	h.mu.RUnlock()
+
+	infos := make([]ClientInfo, 0, len(clients))
+	for _, client := range clients {
+		info := client.Info()
+		info.Controller = client == controller
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	return infos
+}
+
+// Stats returns the hub's broadcast counters and connected clients.
+func (h *Hub) Stats() HubStats {
+	connections := h.Snapshot()
+	return HubStats{
+		SessionID:      h.sessionID,
+		Clients:        len(connections),
+		BytesBroadcast: h.stats.bytes.Load(),
+		Messages:       typeCounts(&h.stats.messages),
+		Unicast:        typeCounts(&h.stats.unicast),
+		Dropped:        h.stats.dropped.Load(),
+		WriteTimeouts:  h.stats.writeTimeouts.Load(),
+		ParseDropped:   h.stats.parseDropped.Load(),
+		Connections:    connections,
+	}
+}
+
+// StatsAll returns the stats of every hub, keyed by session ID.
+func (m *HubManager) StatsAll() map[string]HubStats {
+	m.mu.RLock()
+	hubs := make([]*Hub, 0, len(m.hubs))
+	for _, hub := range m.hubs {
+		hubs = append(hubs, hub)
+	}
+	m.mu.RUnlock()
+
+	stats := make(map[string]HubStats, len(hubs))
+	for _, hub := range hubs {
+		stats[hub.SessionID()] = hub.Stats()
+	}
+	return stats
+}
+
+// Counts returns the number of connected clients of every hub, keyed by
+// session ID. Only read locks are taken, so it is cheap to poll.
+func (m *HubManager) Counts() map[string]int {
+	m.mu.RLock()
+	hubs := make([]*Hub, 0, len(m.hubs))
+	for _, hub := range m.hubs {
+		hubs = append(hubs, hub)
+	}
+	m.mu.RUnlock()
+
+	counts := make(map[string]int, len(hubs))
+	for _, hub := range hubs {
+		counts[hub.SessionID()] = hub.ClientCount()
+	}
+	return counts
+}
+
+// ServiceStats is a snapshot of the server's PTY processes and clients.
+type ServiceStats struct {
+	// Sessions is the number of active PTY processes.
+	Sessions int `json:"sessions"`
+
+	// Clients is the total number of connected WebSocket clients.
+	Clients int `json:"clients"`
+
+	// SessionClients is the number of clients of each session with a hub.
+	// UserSessionStats only lists the user's own sessions.
+	SessionClients map[string]int `json:"sessionClients"`
+
+	// BufferedBytes is the output held in the ring buffers of all active
+	// processes, and BufferCapacity their total size.
+	BufferedBytes  int64 `json:"bufferedBytes"`
+	BufferCapacity int64 `json:"bufferCapacity"`
+
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+}
+
+// SessionStats returns a snapshot of the active PTY processes, connected
+// clients and ring buffer usage. Only read locks are taken, so it is cheap
+// to poll.
+func (s *Service) SessionStats() ServiceStats {
+	stats := ServiceStats{
+		SessionClients: s.hubManager.Counts(),
+		StartedAt:      s.startedAt,
+		UptimeSeconds:  int64(time.Since(s.startedAt).Seconds()),
+	}
+	for _, n := range stats.SessionClients {
+		stats.Clients += n
+	}
+
+	processes := s.ptyManager.List()
+	stats.Sessions = len(processes)
+	for _, p := range processes {
+		if p.RingBuffer == nil {
+			continue
+		}
+		stats.BufferedBytes += int64(p.RingBuffer.Len())
+		stats.BufferCapacity += int64(p.RingBufferSize())
+	}
+	return stats
+}
+
+// UserSessionStats is SessionStats with SessionClients limited to the
+// active sessions owned by userID, so other users' session IDs are not
+// exposed. The server-wide totals are kept.
+func (s *Service) UserSessionStats(userID string) ServiceStats {
+	stats := s.SessionStats()
+	for sessionID := range stats.SessionClients {
+		p, ok := s.ptyManager.Get(sessionID)
+		if !ok || p.Session == nil || p.Session.UserID != userID {
+			delete(stats.SessionClients, sessionID)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// StatusSnapshot is the payload of the status message a client receives when
+// it attaches, right before the history. The message's state, code, rows and
+// cols fields hold the session's status, exit code and terminal size.
+type StatusSnapshot struct {
+	Name string `json:"name,omitempty"`
+	PID  int    `json:"pid,omitempty"`
+}
+
+// statusSnapshot returns the status message describing ptyProcess.
+func statusSnapshot(ptyProcess *pty.PTYProcess) *Message {
+	msg := &Message{
+		Type:  MessageTypeStatus,
+		State: string(model.SessionStatusRunning),
+	}
+
+	if exitCode, exited, err := ptyProcess.ExitStatus(); exited {
+		// Reported like the status broadcast when the process exits
+		if err != nil {
+			msg.State = string(model.SessionStatusFailed)
+		} else {
+			msg.State = string(model.SessionStatusExited)
+			msg.Code = &exitCode
+		}
+	} else if ptyProcess.IsClosed() {
+		msg.State = string(model.SessionStatusExited)
+	}
+
+	msg.Rows, msg.Cols = ptyProcess.Size()
+
+	var snapshot StatusSnapshot
+	if ptyProcess.Session != nil {
+		snapshot.Name = ptyProcess.Session.Name
+	}
+	if msg.State == string(model.SessionStatusRunning) && ptyProcess.Process != nil {
+		snapshot.PID = ptyProcess.PID()
+	}
+	msg.Payload, _ = json.Marshal(snapshot)
+	return msg
+}
+
+// StatusSnapshot returns the status message a client attaching to the
+// session would receive, or false if the session has no process.
+func (s *Service) StatusSnapshot(sessionID string) (*Message, bool) {
+	ptyProcess, ok := s.ptyManager.Get(sessionID)
+	if !ok {
+		return nil, false
+	}
+	return statusSnapshot(ptyProcess), true
+}
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// TestStatusSnapshot tests the status message of running and exited sessions
+func TestStatusSnapshot(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	tests := []struct {
+		name     string
+		command  string
+		exited   bool
+		state    model.SessionStatus
+		exitCode int
+	}{
+		{"running", "cat", false, model.SessionStatusRunning, 0},
+		{"exited", "sh -c 'exit 3'", true, model.SessionStatusExited, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+				Session:     &model.Session{ID: "test-status-" + tt.name, UserID: "test-user", Name: tt.name, Command: tt.command},
+				InitialRows: 30,
+				InitialCols: 90,
+			})
+			if err != nil {
+				t.Fatalf("failed to spawn PTY: %v", err)
+			}
+			if tt.exited {
+				deadline := time.Now().Add(2 * time.Second)
+				for {
+					if _, exited, _ := ptyProcess.ExitStatus(); exited {
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatal("process did not exit")
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+
+			msg := statusSnapshot(ptyProcess)
+			if msg.Type != MessageTypeStatus || msg.State != string(tt.state) {
+				t.Errorf("Expected %s status, got %+v", tt.state, msg)
+			}
+			if msg.Rows != 30 || msg.Cols != 90 {
+				t.Errorf("Expected size 30x90, got %dx%d", msg.Rows, msg.Cols)
+			}
+
+			var snapshot StatusSnapshot
+			if err := json.Unmarshal(msg.Payload, &snapshot); err != nil {
+				t.Fatalf("invalid status payload: %v", err)
+			}
+			if snapshot.Name != tt.name {
+				t.Errorf("Expected name %q, got %q", tt.name, snapshot.Name)
+			}
+
+			if tt.exited {
+				if msg.Code == nil || *msg.Code != tt.exitCode {
+					t.Errorf("Expected exit code %d, got %v", tt.exitCode, msg.Code)
+				}
+				if snapshot.PID != 0 {
+					t.Errorf("Expected no pid once exited, got %d", snapshot.PID)
+				}
+			} else {
+				if msg.Code != nil {
+					t.Errorf("Expected no exit code while running, got %d", *msg.Code)
+				}
+				if snapshot.PID != ptyProcess.PID() {
+					t.Errorf("Expected pid %d, got %d", ptyProcess.PID(), snapshot.PID)
+				}
+			}
+		})
+	}
+}
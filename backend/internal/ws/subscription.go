@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"net/http"
+	"strings"
+)
+
+// parsedMessageTypes are the message types produced by the session driver.
+// Clients can opt out of them with ?subscribe=; every other message type is
+// always delivered.
+var parsedMessageTypes = []MessageType{MessageTypeSmartEvent, MessageTypeConversation}
+
+// isParsedMessage reports whether a message type is produced by the session driver.
+func isParsedMessage(t MessageType) bool {
+	for _, parsed := range parsedMessageTypes {
+		if t == parsed {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSubscriptions reads the ?subscribe= attach parameter, a comma
+// separated list of the driver-produced message types the client wants, such
+// as "smart_event,conversation". An empty value subscribes to none of them.
+// It returns nil, subscribing to all of them, when the parameter is absent.
+func parseSubscriptions(r *http.Request) []MessageType {
+	values, ok := r.URL.Query()["subscribe"]
+	if !ok {
+		return nil
+	}
+	types := []MessageType{}
+	for _, value := range values {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, MessageType(t))
+			}
+		}
+	}
+	return types
+}
+
+// SetSubscriptions limits the driver-produced messages (smart events and
+// conversation messages) the client receives to types. A nil slice
+// subscribes to all of them. It should be called before the client is
+// registered with a hub.
+func (c *Client) SetSubscriptions(types []MessageType) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if types == nil {
+		c.subscriptions = nil
+		return
+	}
+	c.subscriptions = make(map[MessageType]bool, len(types))
+	for _, t := range types {
+		c.subscriptions[t] = true
+	}
+}
+
+// Subscribed reports whether the client receives messages of type t.
+func (c *Client) Subscribed(t MessageType) bool {
+	// Resolutions go to the clients that receive the events
+	if t == MessageTypeSmartEventResolved {
+		t = MessageTypeSmartEvent
+	}
+	if !isParsedMessage(t) {
+		return true
+	}
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	return c.subscriptions == nil || c.subscriptions[t]
+}
+
+// wantsParsedOutput reports whether the client receives any message
+// produced by the session driver.
+func (c *Client) wantsParsedOutput() bool {
+	for _, t := range parsedMessageTypes {
+		if c.Subscribed(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// WantsParsedOutput reports whether any connected client receives messages
+// produced by the session driver. When none does, output is still parsed
+// but the results are not broadcast.
+func (h *Hub) WantsParsedOutput() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.parsedClients > 0
+}
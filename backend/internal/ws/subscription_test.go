@@ -0,0 +1,239 @@
+package ws
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// countingDriver records the chunks parsed by the driver it wraps and the
+// number of times it was reset.
+type countingDriver struct {
+	driver.AgentDriver
+	parsed []string
+	resets int
+}
+
+func (d *countingDriver) Parse(ctx context.Context, chunk []byte) (*driver.ParseResult, error) {
+	d.parsed = append(d.parsed, string(chunk))
+	return d.AgentDriver.Parse(ctx, chunk)
+}
+
+func (d *countingDriver) Reset() {
+	d.resets++
+	d.AgentDriver.Reset()
+}
+
+// TestParseSubscriptions tests reading the ?subscribe= attach parameter
+func TestParseSubscriptions(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []MessageType // nil subscribes to everything
+	}{
+		{"", nil},
+		{"?subscribe=", []MessageType{}},
+		{"?subscribe=conversation", []MessageType{MessageTypeConversation}},
+		{"?subscribe=smart_event,%20conversation", []MessageType{MessageTypeSmartEvent, MessageTypeConversation}},
+		{"?subscribe=smart_event&subscribe=conversation", []MessageType{MessageTypeSmartEvent, MessageTypeConversation}},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/attach"+tt.query, nil)
+		got := parseSubscriptions(r)
+		if (got == nil) != (tt.expected == nil) || len(got) != len(tt.expected) {
+			t.Errorf("parseSubscriptions(%q): expected %v, got %v", tt.query, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("parseSubscriptions(%q): expected %v, got %v", tt.query, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+// TestBroadcastOutputParsesWithoutSubscribers tests that output is parsed
+// while no client receives parsed messages, so its events are tracked, but
+// that the results are only broadcast to subscribers
+func TestBroadcastOutputParsesWithoutSubscribers(t *testing.T) {
+	sessionID := "test-subscribe-session"
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+	counting := &countingDriver{AgentDriver: driver.NewClaudeDriver()}
+	handler.SetSessionDriver(sessionID, counting)
+
+	hub := hubManager.GetOrCreate(sessionID)
+	terminal := NewClient(hub, nil, sessionID, false)
+	terminal.SetSubscriptions([]MessageType{})
+	hub.Register(terminal)
+	if hub.WantsParsedOutput() {
+		t.Fatal("Expected no client to want parsed output")
+	}
+
+	// Output reaches the terminal as stdout only, but is still parsed
+	if err := handler.BroadcastOutput(sessionID, []byte("Continue? (y/n)")); err != nil {
+		t.Fatalf("BroadcastOutput failed: %v", err)
+	}
+	handler.waitParsed(sessionID)
+	if msg := receiveMessage(t, terminal, 100*time.Millisecond); msg == nil || msg.Type != MessageTypeStdout {
+		t.Fatalf("Expected stdout, got %+v", msg)
+	}
+	if msg := receiveMessage(t, terminal, 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no smart event for the unsubscribed client, got %+v", msg)
+	}
+	if len(counting.parsed) != 1 {
+		t.Errorf("Expected output to be parsed, got %q", counting.parsed)
+	}
+	if pending := handler.PendingEvents(sessionID); len(pending) != 1 {
+		t.Errorf("Expected the prompt to be pending, got %+v", pending)
+	}
+
+	chat := NewClient(hub, nil, sessionID, false)
+	chat.SetSubscriptions([]MessageType{MessageTypeSmartEvent})
+	hub.Register(chat)
+	if !hub.WantsParsedOutput() {
+		t.Fatal("Expected a client to want parsed output")
+	}
+
+	// The driver kept its state, and only the subscriber gets events
+	if err := handler.BroadcastOutput(sessionID, []byte("\nDelete the file? (y/n)")); err != nil {
+		t.Fatalf("BroadcastOutput failed: %v", err)
+	}
+	handler.waitParsed(sessionID)
+	if counting.resets != 0 || len(counting.parsed) != 2 {
+		t.Errorf("Expected no reset and 2 parses, got %d and %q", counting.resets, counting.parsed)
+	}
+	if msg := receiveMessage(t, chat, 100*time.Millisecond); msg == nil || msg.Type != MessageTypeStdout {
+		t.Fatalf("Expected stdout, got %+v", msg)
+	}
+	if msg := receiveMessage(t, chat, 100*time.Millisecond); msg == nil || msg.Type != MessageTypeSmartEventResolved {
+		t.Fatalf("Expected the first prompt to expire, got %+v", msg)
+	}
+	if msg := receiveMessage(t, chat, 100*time.Millisecond); msg == nil || msg.Type != MessageTypeSmartEvent {
+		t.Fatalf("Expected smart event, got %+v", msg)
+	}
+	if msg := receiveMessage(t, terminal, 100*time.Millisecond); msg == nil || msg.Type != MessageTypeStdout {
+		t.Fatalf("Expected stdout, got %+v", msg)
+	}
+	if msg := receiveMessage(t, terminal, 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no smart event for the unsubscribed client, got %+v", msg)
+	}
+
+	hub.Unregister(chat)
+	if hub.WantsParsedOutput() {
+		t.Error("Expected no client to want parsed output after unregistering")
+	}
+}
+
+// TestBroadcastOutputParsesWithoutHub tests that output of a session whose
+// hub has been removed is still parsed
+func TestBroadcastOutputParsesWithoutHub(t *testing.T) {
+	sessionID := "test-no-hub-session"
+	handler := NewHandler(NewHubManager(), nil, driver.NewGenericDriver())
+	counting := &countingDriver{AgentDriver: driver.NewClaudeDriver()}
+	handler.SetSessionDriver(sessionID, counting)
+
+	if err := handler.BroadcastOutput(sessionID, []byte("Continue? (y/n)")); err != nil {
+		t.Fatalf("BroadcastOutput failed: %v", err)
+	}
+	handler.waitParsed(sessionID)
+	if len(counting.parsed) != 1 {
+		t.Errorf("Expected output to be parsed, got %q", counting.parsed)
+	}
+	if pending := handler.PendingEvents(sessionID); len(pending) != 1 {
+		t.Errorf("Expected the prompt to be pending, got %+v", pending)
+	}
+}
+
+// TestReplayToDriver tests that resuming parsing replays the output that
+// preceded the latest chunk
+func TestReplayToDriver(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-replay-driver-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "sleep 10"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	handler := NewHandler(NewHubManager(), ptyManager, nil)
+
+	tests := []struct {
+		name     string
+		before   string
+		expected string
+	}{
+		{"short history", "earlier output\n", "earlier output\n"},
+		{"long history", strings.Repeat("a", 10000) + strings.Repeat("b", parseReplayBytes), strings.Repeat("b", parseReplayBytes)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ptyProcess.RingBuffer.Clear()
+			chunk := "latest chunk"
+			ptyProcess.RingBuffer.Write([]byte(tt.before + chunk))
+
+			counting := &countingDriver{AgentDriver: driver.NewClaudeDriver()}
+			start := ptyProcess.RingBuffer.Cursor() - len(chunk)
+			handler.replayToDriver(context.Background(), sessionID, counting, int64(start))
+			if counting.resets != 1 {
+				t.Errorf("Expected the driver to be reset once, got %d", counting.resets)
+			}
+			if len(counting.parsed) != 1 || counting.parsed[0] != tt.expected {
+				t.Errorf("Expected %d replayed bytes, got %d chunk(s)", len(tt.expected), len(counting.parsed))
+			}
+		})
+	}
+}
+
+// benchmarkParsedBroadcast broadcasts Claude output to a client that either
+// subscribes to parsed messages or not.
+func benchmarkParsedBroadcast(b *testing.B, subscriptions []MessageType) {
+	sessionID := "bench-parse-session"
+	hubManager := NewHubManager()
+	b.Cleanup(hubManager.Close)
+	handler := NewHandler(hubManager, nil, driver.NewClaudeDriver())
+
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	client.SetSubscriptions(subscriptions)
+	client.policy, client.blockTimeout = BackpressureBlock, time.Minute
+	hub.Register(client)
+
+	done := make(chan struct{})
+	go func() {
+		for range client.SendChan() {
+		}
+		close(done)
+	}()
+
+	chunk := []byte("⏺ Reading src/main.go\n  ⎿  Read 120 lines\n\x1b[32m+ added line\x1b[0m\nThinking… (esc to interrupt)\n")
+	b.SetBytes(int64(len(chunk)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.BroadcastOutput(sessionID, chunk)
+	}
+	handler.waitParsed(sessionID)
+	b.StopTimer()
+
+	client.Close()
+	<-done
+}
+
+func BenchmarkBroadcastOutput_Parsed(b *testing.B) {
+	benchmarkParsedBroadcast(b, nil)
+}
+
+func BenchmarkBroadcastOutput_Unsubscribed(b *testing.B) {
+	benchmarkParsedBroadcast(b, []MessageType{})
+}
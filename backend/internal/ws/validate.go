@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Limits on client messages, checked by validateMessage.
+const (
+	// MaxStdinBytes is the most data a stdin message may carry.
+	MaxStdinBytes = 4 * 1024
+
+	// MaxCommandBytes is the most data a command message may carry.
+	MaxCommandBytes = 16 * 1024
+
+	// MaxTerminalSize is the most rows or columns a resize may request.
+	MaxTerminalSize = 1000
+)
+
+// clientMessageTypes are the message types clients may send.
+var clientMessageTypes = map[MessageType]bool{
+	MessageTypeStdin:          true,
+	MessageTypeCommand:        true,
+	MessageTypeResize:         true,
+	MessageTypePing:           true,
+	MessageTypeEventResponse:  true,
+	MessageTypeInputAction:    true,
+	MessageTypeDismiss:        true,
+	MessageTypeMarker:         true,
+	MessageTypeScrollback:     true,
+	MessageTypeFocus:          true,
+	MessageTypeBlur:           true,
+	MessageTypeControlRequest: true,
+	MessageTypeControlRelease: true,
+}
+
+// ValidationError describes the field of a client message that failed
+// validation.
+type ValidationError struct {
+	Field  string // JSON name of the offending field
+	Reason string
+}
+
+// Error returns the field and the reason it is invalid.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// validateMessage checks a decoded client message before it is handled:
+// its type must be one clients may send, stdin and command data must be
+// within MaxStdinBytes and MaxCommandBytes, and a resize must have rows and
+// columns between 1 and MaxTerminalSize. It returns nil for a valid message.
+func validateMessage(msg *Message) *ValidationError {
+	if !clientMessageTypes[msg.Type] {
+		if msg.Type == "" {
+			return &ValidationError{Field: "type", Reason: "missing message type"}
+		}
+		return &ValidationError{Field: "type", Reason: fmt.Sprintf("unknown message type %q", msg.Type)}
+	}
+
+	switch msg.Type {
+	case MessageTypeStdin:
+		if len(msg.Data) > MaxStdinBytes {
+			return &ValidationError{Field: "data", Reason: fmt.Sprintf("stdin exceeds %d bytes", MaxStdinBytes)}
+		}
+	case MessageTypeCommand:
+		if len(msg.Data) > MaxCommandBytes {
+			return &ValidationError{Field: "data", Reason: fmt.Sprintf("command exceeds %d bytes", MaxCommandBytes)}
+		}
+	case MessageTypeResize:
+		if msg.Rows < 1 || msg.Rows > MaxTerminalSize {
+			return &ValidationError{Field: "rows", Reason: fmt.Sprintf("rows must be between 1 and %d", MaxTerminalSize)}
+		}
+		if msg.Cols < 1 || msg.Cols > MaxTerminalSize {
+			return &ValidationError{Field: "cols", Reason: fmt.Sprintf("cols must be between 1 and %d", MaxTerminalSize)}
+		}
+	}
+	return nil
+}
+
+// rejectInvalid tells a client that its message failed validation. The
+// error's payload names the offending field, and the message's ID, if it
+// has one, is echoed.
+func rejectInvalid(client *Client, msg *Message, err *ValidationError) {
+	fields := map[string]string{"code": ErrorCodeInvalidMessage, "field": err.Field}
+	if msg.Type != "" {
+		fields["type"] = string(msg.Type)
+	}
+	payload, _ := json.Marshal(fields)
+	client.sendReply(&Message{
+		Type:      MessageTypeError,
+		Error:     "Invalid message: " + err.Error(),
+		ErrorCode: ErrorCodeInvalidMessage,
+		Payload:   payload,
+		ID:        msg.ID,
+	})
+}
@@ -0,0 +1,200 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/driver"
+	"github.com/remote-agent-terminal/backend/internal/model"
+	"github.com/remote-agent-terminal/backend/internal/pty"
+)
+
+// TestValidateMessage tests the checks applied to each client message
+func TestValidateMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   Message
+		field string // Expected offending field, "" if valid
+	}{
+		{"stdin", Message{Type: MessageTypeStdin, Data: "ls\r"}, ""},
+		{"stdin at limit", Message{Type: MessageTypeStdin, Data: strings.Repeat("x", MaxStdinBytes)}, ""},
+		{"stdin over limit", Message{Type: MessageTypeStdin, Data: strings.Repeat("x", MaxStdinBytes+1)}, "data"},
+		{"command at limit", Message{Type: MessageTypeCommand, Data: strings.Repeat("x", MaxCommandBytes)}, ""},
+		{"command over limit", Message{Type: MessageTypeCommand, Data: strings.Repeat("x", MaxCommandBytes+1)}, "data"},
+		{"resize", Message{Type: MessageTypeResize, Rows: 24, Cols: 80}, ""},
+		{"resize at limit", Message{Type: MessageTypeResize, Rows: MaxTerminalSize, Cols: MaxTerminalSize}, ""},
+		{"zero rows", Message{Type: MessageTypeResize, Rows: 0, Cols: 80}, "rows"},
+		{"too many rows", Message{Type: MessageTypeResize, Rows: MaxTerminalSize + 1, Cols: 80}, "rows"},
+		{"zero cols", Message{Type: MessageTypeResize, Rows: 24}, "cols"},
+		{"too many cols", Message{Type: MessageTypeResize, Rows: 24, Cols: 5000}, "cols"},
+		{"ping", Message{Type: MessageTypePing}, ""},
+		{"control request", Message{Type: MessageTypeControlRequest}, ""},
+		{"scrollback", Message{Type: MessageTypeScrollback, Lines: 100}, ""},
+		{"focus", Message{Type: MessageTypeFocus}, ""},
+		{"missing type", Message{Data: "ls"}, "type"},
+		{"unknown type", Message{Type: "launch_missiles"}, "type"},
+		{"server-only type", Message{Type: MessageTypeStdout, Data: "spoofed"}, "type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMessage(&tt.msg)
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("Expected valid message, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Field != tt.field {
+				t.Errorf("Expected invalid %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+// dialValidationSession attaches to a session running cat and reads the
+// messages sent on attach.
+func dialValidationSession(t *testing.T, handler *Handler, sessionID string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	readStatusSnapshot(t, conn)
+
+	var end, size Message
+	if err := conn.ReadJSON(&end); err != nil || end.Type != MessageTypeHistoryEnd {
+		t.Fatalf("expected history_end, got %+v (err: %v)", end, err)
+	}
+	if err := conn.ReadJSON(&size); err != nil || size.Type != MessageTypeResize {
+		t.Fatalf("expected initial resize, got %+v (err: %v)", size, err)
+	}
+	return conn
+}
+
+// TestInvalidMessagesRejected tests that each kind of invalid message is
+// answered with an error naming the offending field, without reaching the
+// PTY or closing the connection
+func TestInvalidMessagesRejected(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-validation"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	conn := dialValidationSession(t, handler, sessionID)
+	rows, cols := ptyProcess.Size()
+
+	tests := []struct {
+		name  string
+		msg   Message
+		field string
+	}{
+		{"unknown type", Message{Type: "subscribe_all", ID: "m1"}, "type"},
+		{"missing type", Message{Data: "echo hi"}, "type"},
+		{"oversized stdin", Message{Type: MessageTypeStdin, Data: strings.Repeat("a", MaxStdinBytes+1), ID: "m2"}, "data"},
+		{"oversized command", Message{Type: MessageTypeCommand, Data: strings.Repeat("b", MaxCommandBytes+1)}, "data"},
+		{"zero rows", Message{Type: MessageTypeResize, Rows: 0, Cols: 80}, "rows"},
+		{"too many cols", Message{Type: MessageTypeResize, Rows: 24, Cols: MaxTerminalSize + 1}, "cols"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if err := conn.WriteJSON(tt.msg); err != nil {
+				t.Fatalf("failed to write message: %v", err)
+			}
+			var reply Message
+			if err := conn.ReadJSON(&reply); err != nil || reply.Type != MessageTypeError || reply.ErrorCode != ErrorCodeInvalidMessage {
+				t.Fatalf("expected %s error, got %+v (err: %v)", ErrorCodeInvalidMessage, reply, err)
+			}
+			var payload map[string]string
+			if err := json.Unmarshal(reply.Payload, &payload); err != nil {
+				t.Fatalf("failed to decode error payload: %v", err)
+			}
+			if payload["field"] != tt.field || payload["type"] != string(tt.msg.Type) {
+				t.Errorf("Expected field %q of type %q in payload, got %v", tt.field, tt.msg.Type, payload)
+			}
+			if reply.ID != tt.msg.ID {
+				t.Errorf("Expected the message ID %q to be echoed, got %q", tt.msg.ID, reply.ID)
+			}
+		})
+	}
+
+	if r, c := ptyProcess.Size(); r != rows || c != cols {
+		t.Errorf("Expected invalid resizes to be ignored, got %dx%d", r, c)
+	}
+	if history := ptyProcess.GetHistory(); len(history) != 0 {
+		t.Errorf("Expected no input to reach the PTY, got %q", history)
+	}
+
+	// The connection stays usable
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.WriteJSON(Message{Type: MessageTypePing}); err != nil {
+		t.Fatalf("failed to write ping: %v", err)
+	}
+	var pong Message
+	if err := conn.ReadJSON(&pong); err != nil || pong.Type != MessageTypePong {
+		t.Errorf("expected pong, got %+v (err: %v)", pong, err)
+	}
+}
+
+// TestMaxMessageSize tests that a message over the configured read limit
+// closes the connection
+func TestMaxMessageSize(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-max-message-size"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.MaxMessageSize = 256
+	conn := dialValidationSession(t, handler, sessionID)
+
+	// Within the limit
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.WriteJSON(Message{Type: MessageTypePing}); err != nil {
+		t.Fatalf("failed to write ping: %v", err)
+	}
+	var pong Message
+	if err := conn.ReadJSON(&pong); err != nil || pong.Type != MessageTypePong {
+		t.Fatalf("expected pong, got %+v (err: %v)", pong, err)
+	}
+
+	if err := conn.WriteJSON(Message{Type: MessageTypeStdin, Data: strings.Repeat("x", 512)}); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+	var msg Message
+	err := conn.ReadJSON(&msg)
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected the connection to close with %d, got %+v (err: %v)", websocket.CloseMessageTooBig, msg, err)
+	}
+}
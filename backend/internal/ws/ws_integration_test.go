@@ -1,15 +1,23 @@
 package ws
 
 import (
+	"compress/flate"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/remote-agent-terminal/backend/internal/auth"
 	"github.com/remote-agent-terminal/backend/internal/driver"
 	"github.com/remote-agent-terminal/backend/internal/model"
 	"github.com/remote-agent-terminal/backend/internal/pty"
@@ -21,8 +29,8 @@ func TestHubClientManagement(t *testing.T) {
 	defer hub.Close()
 
 	// Create mock clients
-	client1 := NewClient(hub, nil, "test-session-1")
-	client2 := NewClient(hub, nil, "test-session-1")
+	client1 := NewClient(hub, nil, "test-session-1", false)
+	client2 := NewClient(hub, nil, "test-session-1", false)
 
 	hub.Register(client1)
 	hub.Register(client2)
@@ -53,6 +61,339 @@ func TestHubClientManagement(t *testing.T) {
 	}
 }
 
+// TestHubSnapshot tests per-client statistics reported by Hub.Snapshot
+func TestHubSnapshot(t *testing.T) {
+	hub := NewHub("snapshot-session")
+	defer hub.Close()
+
+	if infos := hub.Snapshot(); len(infos) != 0 {
+		t.Fatalf("expected empty snapshot, got %d clients", len(infos))
+	}
+
+	first := NewClient(hub, nil, "snapshot-session", false)
+	hub.Register(first)
+	time.Sleep(time.Millisecond)
+	second := NewClient(hub, nil, "snapshot-session", true)
+	hub.Register(second)
+
+	hub.Broadcast([]byte("hello"))
+	first.Send([]byte("abc"))
+
+	infos := hub.Snapshot()
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 clients, got %d", len(infos))
+	}
+
+	expected := []struct {
+		connectedAt time.Time
+		messages    uint64
+		bytes       uint64
+	}{
+		{first.connectedAt, 2, 8},
+		{second.connectedAt, 1, 5},
+	}
+	for i, e := range expected {
+		info := infos[i]
+		if info.SessionID != "snapshot-session" {
+			t.Errorf("client %d: expected session snapshot-session, got %s", i, info.SessionID)
+		}
+		if !info.ConnectedAt.Equal(e.connectedAt) {
+			t.Errorf("client %d: expected connected at %v, got %v", i, e.connectedAt, info.ConnectedAt)
+		}
+		if info.MessagesSent != e.messages || info.BytesSent != e.bytes {
+			t.Errorf("client %d: expected %d messages/%d bytes, got %d/%d", i, e.messages, e.bytes, info.MessagesSent, info.BytesSent)
+		}
+	}
+
+	// Sends to a closed client are not counted
+	hub.Unregister(first)
+	first.Send([]byte("after close"))
+	if info := first.Info(); info.MessagesSent != 2 {
+		t.Errorf("expected closed client to stop counting, got %d messages", info.MessagesSent)
+	}
+}
+
+// TestHubStats tests broadcast counters reported by Hub.Stats and HubManager.StatsAll
+func TestHubStats(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+
+	hub := hubManager.GetOrCreate("stats-session")
+	hubManager.GetOrCreate("empty-session")
+
+	viewer := NewClient(hub, nil, "stats-session", true)
+	hub.Register(viewer)
+	hub.Broadcast([]byte("raw"))
+
+	slow := NewClient(hub, nil, "stats-session", false)
+	slow.policy = BackpressureDropOldest
+	slow.send = make(chan Frame, 1)
+	hub.Register(slow)
+
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "one"})
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "two"})
+	hub.BroadcastMessage(&Message{Type: MessageTypeStatus, State: "running"})
+
+	stats := hub.Stats()
+	if stats.SessionID != "stats-session" || stats.Clients != 2 {
+		t.Errorf("Expected 2 clients on stats-session, got %d on %s", stats.Clients, stats.SessionID)
+	}
+	if stats.BytesBroadcast != 9 {
+		t.Errorf("Expected 9 bytes broadcast, got %d", stats.BytesBroadcast)
+	}
+	if stats.Messages[MessageTypeStdout] != 2 || stats.Messages[MessageTypeStatus] != 1 {
+		t.Errorf("Expected 2 stdout and 1 status messages, got %v", stats.Messages)
+	}
+	// The slow client's one-slot queue drops both stdout frames to make
+	// room for the status message
+	if stats.Dropped != 2 {
+		t.Errorf("Expected 2 dropped frames, got %d", stats.Dropped)
+	}
+	if len(stats.Connections) != 2 || !stats.Connections[0].ReadOnly || stats.Connections[1].Dropped != 2 {
+		t.Errorf("Unexpected connections: %+v", stats.Connections)
+	}
+
+	// Drops of disconnected clients still count
+	hub.Unregister(slow)
+	if dropped := hub.Stats().Dropped; dropped != 2 {
+		t.Errorf("Expected dropped count to survive disconnect, got %d", dropped)
+	}
+
+	all := hubManager.StatsAll()
+	if len(all) != 2 {
+		t.Fatalf("Expected stats for 2 hubs, got %d", len(all))
+	}
+	if all["stats-session"].Clients != 1 || all["empty-session"].Clients != 0 {
+		t.Errorf("Unexpected client counts: %d and %d", all["stats-session"].Clients, all["empty-session"].Clients)
+	}
+}
+
+// TestHubSendTo tests that unicast messages reach only their client, in
+// its protocol, and are counted separately from broadcasts
+func TestHubSendTo(t *testing.T) {
+	hub := NewHub("unicast-session")
+	defer hub.Close()
+
+	target := NewClient(hub, nil, "unicast-session", false)
+	target.SetBinary(true)
+	other := NewClient(hub, nil, "unicast-session", false)
+	hub.Register(target)
+	hub.Register(other)
+
+	if err := hub.SendTo(target, &Message{Type: MessageTypeHistory, Data: "\x1b[1mhistory"}); err != nil {
+		t.Fatalf("SendTo failed: %v", err)
+	}
+	if err := hub.SendTo(target, &Message{Type: MessageTypePong}); err != nil {
+		t.Fatalf("SendTo failed: %v", err)
+	}
+
+	frame := <-target.SendChan()
+	msgType, data, err := DecodeBinaryFrame(frame.Data)
+	if err != nil || msgType != MessageTypeHistory || string(data) != "\x1b[1mhistory" {
+		t.Errorf("Expected binary history frame, got %v %q (%v)", msgType, data, err)
+	}
+	frame = <-target.SendChan()
+	var pong Message
+	if err := json.Unmarshal(frame.Data, &pong); err != nil || pong.Type != MessageTypePong || pong.Seq != 0 {
+		t.Errorf("Expected unnumbered pong, got %s", frame.Data)
+	}
+	if n := len(other.SendChan()); n != 0 {
+		t.Errorf("Expected no messages for the other client, got %d", n)
+	}
+
+	stats := hub.Stats()
+	if stats.Unicast[MessageTypeHistory] != 1 || stats.Unicast[MessageTypePong] != 1 {
+		t.Errorf("Expected 1 history and 1 pong unicast, got %v", stats.Unicast)
+	}
+	if len(stats.Messages) != 0 || hub.LastSeq() != 0 {
+		t.Errorf("Expected no broadcasts, got %v and seq %d", stats.Messages, hub.LastSeq())
+	}
+
+	// Replies to a restoring client are not held back like broadcasts
+	other.BeginRestore()
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "live"})
+	hub.SendTo(other, &Message{Type: MessageTypeHistoryEnd})
+	if msg := receiveMessage(t, other, 50*time.Millisecond); msg == nil || msg.Type != MessageTypeHistoryEnd {
+		t.Fatalf("Expected history_end before held back output, got %+v", msg)
+	}
+	other.EndRestore()
+	if msg := receiveMessage(t, other, 50*time.Millisecond); msg == nil || msg.Type != MessageTypeStdout {
+		t.Errorf("Expected held back stdout, got %+v", msg)
+	}
+
+	hub.Unregister(other)
+	if err := hub.SendTo(other, &Message{Type: MessageTypePong}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Expected ErrClientClosed, got %v", err)
+	}
+	hub.Close()
+	if err := hub.SendTo(target, &Message{Type: MessageTypePong}); !errors.Is(err, ErrHubClosed) {
+		t.Errorf("Expected ErrHubClosed, got %v", err)
+	}
+}
+
+// countingRecorder counts broadcast messages by type.
+type countingRecorder struct {
+	mu       sync.Mutex
+	messages map[string]int
+}
+
+func (r *countingRecorder) MessageBroadcast(msgType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages[msgType]++
+}
+
+func (r *countingRecorder) PTYWrite(int)         {}
+func (r *countingRecorder) SessionSpawned()      {}
+func (r *countingRecorder) SessionExited(string) {}
+
+// TestHubManagerMetrics tests that hubs record broadcasts, including hubs
+// created before the recorder was set
+func TestHubManagerMetrics(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+
+	before := hubManager.GetOrCreate("metrics-before")
+	recorder := &countingRecorder{messages: make(map[string]int)}
+	hubManager.SetMetrics(recorder)
+	after := hubManager.GetOrCreate("metrics-after")
+
+	before.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "one"})
+	after.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "two"})
+	after.BroadcastMessage(&Message{Type: MessageTypeStatus, State: "running"})
+
+	recorder.mu.Lock()
+	if recorder.messages["stdout"] != 2 || recorder.messages["status"] != 1 {
+		t.Errorf("Expected 2 stdout and 1 status messages, got %v", recorder.messages)
+	}
+	recorder.mu.Unlock()
+
+	// A nil recorder disables instrumentation
+	hubManager.SetMetrics(nil)
+	after.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "three"})
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.messages["stdout"] != 2 {
+		t.Errorf("Expected no more messages counted, got %v", recorder.messages)
+	}
+}
+
+// TestServiceSessionStats tests the server-wide counts of Service.SessionStats
+// and the per-user counts of UserSessionStats
+func TestServiceSessionStats(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+	wsService := NewService(ptyManager, driver.NewGenericDriver())
+	defer wsService.Close()
+
+	for i, id := range []string{"stats-a", "stats-b"} {
+		userID := "test-user"
+		if id == "stats-b" {
+			userID = "other-user"
+		}
+		p, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+			Session:        &model.Session{ID: id, UserID: userID, Command: "cat"},
+			RingBufferSize: 1024 * (i + 1),
+		})
+		if err != nil {
+			t.Fatalf("failed to spawn PTY: %v", err)
+		}
+		p.RingBuffer.Write([]byte("0123456789"))
+	}
+
+	hub := wsService.HubManager().GetOrCreate("stats-a")
+	hub.Register(NewClient(hub, nil, "stats-a", false))
+	hub.Register(NewClient(hub, nil, "stats-a", true))
+	wsService.HubManager().GetOrCreate("stats-b")
+
+	counts := wsService.HubManager().Counts()
+	if len(counts) != 2 || counts["stats-a"] != 2 || counts["stats-b"] != 0 {
+		t.Errorf("Expected 2 and 0 clients, got %v", counts)
+	}
+
+	stats := wsService.SessionStats()
+	if stats.Sessions != 2 || stats.Clients != 2 {
+		t.Errorf("Expected 2 sessions and 2 clients, got %d and %d", stats.Sessions, stats.Clients)
+	}
+	// The buffers may also hold output echoed by the processes
+	if stats.BufferedBytes < 20 || stats.BufferCapacity != 3*1024 {
+		t.Errorf("Expected at least 20 of 3072 bytes buffered, got %d of %d", stats.BufferedBytes, stats.BufferCapacity)
+	}
+	if stats.StartedAt.IsZero() || stats.UptimeSeconds < 0 {
+		t.Errorf("Expected a start time and uptime, got %v and %d", stats.StartedAt, stats.UptimeSeconds)
+	}
+
+	// A user only sees the client counts of their own sessions
+	userStats := wsService.UserSessionStats("other-user")
+	if len(userStats.SessionClients) != 1 || userStats.SessionClients["stats-b"] != 0 {
+		t.Errorf("Expected only stats-b's clients, got %v", userStats.SessionClients)
+	}
+	if userStats.Sessions != 2 || userStats.Clients != 2 {
+		t.Errorf("Expected the server-wide totals, got %d sessions and %d clients", userStats.Sessions, userStats.Clients)
+	}
+}
+
+// TestHubMaxClients tests the client limit boundary and that slots free up after Unregister
+func TestHubMaxClients(t *testing.T) {
+	hub := NewHub("limited-session")
+	defer hub.Close()
+	hub.SetMaxClients(2)
+
+	newClient := func() *Client {
+		return NewClient(hub, nil, "limited-session", false)
+	}
+
+	// The owner does not count towards the limit
+	owner := newClient()
+	if err := hub.Register(owner); err != nil {
+		t.Fatalf("expected owner to register, got %v", err)
+	}
+	second, third := newClient(), newClient()
+	for _, c := range []*Client{second, third} {
+		if err := hub.Register(c); err != nil {
+			t.Fatalf("expected client within limit to register, got %v", err)
+		}
+	}
+
+	// One past the limit is rejected without affecting existing clients
+	if err := hub.CheckCapacity(); !errors.Is(err, ErrHubFull) {
+		t.Errorf("expected CheckCapacity to report ErrHubFull, got %v", err)
+	}
+	if err := hub.Register(newClient()); !errors.Is(err, ErrHubFull) {
+		t.Errorf("expected ErrHubFull, got %v", err)
+	}
+	if hub.ClientCount() != 3 {
+		t.Errorf("expected 3 clients, got %d", hub.ClientCount())
+	}
+	if second.IsClosed() || third.IsClosed() {
+		t.Error("expected existing clients to stay connected")
+	}
+
+	// Unregistering frees a slot
+	hub.Unregister(third)
+	if err := hub.Register(newClient()); err != nil {
+		t.Errorf("expected freed slot to be reusable, got %v", err)
+	}
+
+	// When the owner leaves, the next client takes its place
+	hub.Unregister(owner)
+	if err := hub.Register(newClient()); err != nil {
+		t.Errorf("expected new owner to register, got %v", err)
+	}
+	if err := hub.Register(newClient()); !errors.Is(err, ErrHubFull) {
+		t.Errorf("expected ErrHubFull after owner replaced, got %v", err)
+	}
+
+	// A hub without a limit accepts any number of clients
+	unlimited := NewHub("unlimited-session")
+	defer unlimited.Close()
+	for i := 0; i < 10; i++ {
+		if err := unlimited.Register(NewClient(unlimited, nil, "unlimited-session", false)); err != nil {
+			t.Fatalf("expected no limit, got %v", err)
+		}
+	}
+}
+
 // TestMessageSerialization tests WebSocket message JSON handling
 func TestMessageSerialization(t *testing.T) {
 	// Test stdin message
@@ -346,7 +687,7 @@ func TestSessionKeepalive(t *testing.T) {
 	})
 
 	// Register and unregister a client
-	client := NewClient(hub, nil, "keepalive-session")
+	client := NewClient(hub, nil, "keepalive-session", false)
 	hub.Register(client)
 
 	if hub.ClientCount() != 1 {
@@ -374,7 +715,7 @@ func TestMultipleClientsBroadcast(t *testing.T) {
 	clients := make([]*Client, numClients)
 
 	for i := 0; i < numClients; i++ {
-		clients[i] = NewClient(hub, nil, "multi-client-session")
+		clients[i] = NewClient(hub, nil, "multi-client-session", false)
 		hub.Register(clients[i])
 	}
 
@@ -438,12 +779,10 @@ func TestServiceIntegration(t *testing.T) {
 	}
 
 	// Track status changes
-	var statusChanged bool
-	var finalStatus model.SessionStatus
+	statusCh := make(chan model.SessionStatus, 1)
 	wsService.SetOnStatusChange(func(sid string, status model.SessionStatus, exitCode *int) {
 		if sid == sessionID {
-			statusChanged = true
-			finalStatus = status
+			statusCh <- status
 		}
 	})
 
@@ -459,24 +798,2737 @@ func TestServiceIntegration(t *testing.T) {
 	}
 
 	// Wait for process to complete
-	time.Sleep(2 * time.Second)
-
-	if !statusChanged {
+	select {
+	case finalStatus := <-statusCh:
+		if finalStatus != model.SessionStatusExited {
+			t.Errorf("expected status 'exited', got '%s'", finalStatus)
+		}
+	case <-time.After(2 * time.Second):
 		t.Error("status change callback was not called")
 	}
+}
+
+// TestServiceWatchdogAlert tests that clients are alerted when a process stops producing output
+func TestServiceWatchdogAlert(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	wsService := NewService(ptyManager, driver.NewGenericDriver())
+	defer wsService.Close()
+
+	sessionID := "test-watchdog-session"
+	session := &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"}
+	ptyProcess, err := wsService.AttachSession(context.Background(), session, pty.SpawnOptions{
+		Session:         session,
+		WatchdogTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to attach session: %v", err)
+	}
+	defer ptyProcess.Close()
+
+	hub := wsService.HubManager().Get(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
 
-	if finalStatus != model.SessionStatusExited {
-		t.Errorf("expected status 'exited', got '%s'", finalStatus)
+	msg := receiveMessage(t, client, 2*time.Second)
+	if msg == nil || msg.Type != MessageTypeAlert || msg.State != AlertWatchdog {
+		t.Fatalf("Expected %s alert, got %+v", AlertWatchdog, msg)
+	}
+	if !strings.Contains(msg.Data, "100ms") {
+		t.Errorf("Expected alert to mention the timeout, got %q", msg.Data)
 	}
 }
 
-// Helper function
-func receiveWithTimeoutTest(t *testing.T, client *Client, timeout time.Duration) []byte {
-	t.Helper()
-	select {
-	case data := <-client.SendChan():
-		return data
-	case <-time.After(timeout):
-		return nil
+// TestServiceExpiredStatus tests that clients are told when a session
+// exceeds its maximum duration
+func TestServiceExpiredStatus(t *testing.T) {
+	wsService := NewService(pty.NewManager(t.TempDir()), driver.NewGenericDriver())
+	defer wsService.Close()
+
+	sessionID := "test-expired-session"
+	hub := wsService.HubManager().GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	wsService.HandleExpired(sessionID, time.Hour)
+
+	msg := receiveMessage(t, client, time.Second)
+	if msg == nil || msg.Type != MessageTypeStatus || msg.State != StateTTLExpired {
+		t.Fatalf("Expected %s status, got %+v", StateTTLExpired, msg)
+	}
+}
+
+// TestServiceAttachProcess tests that output is parsed by the session driver
+// from the start and broadcast once, even when the process is attached again
+func TestServiceAttachProcess(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	wsService := NewService(ptyManager, driver.NewGenericDriver())
+	defer wsService.Close()
+
+	sessionID := "test-attach-process"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+	wsService.AttachProcess(sessionID, ptyProcess, driver.NewClaudeDriver())
+	wsService.AttachProcess(sessionID, ptyProcess, nil)
+
+	hub := wsService.HubManager().Get(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	// Without a trailing newline cat does not repeat the line, so the
+	// prompt is echoed exactly once
+	if err := ptyProcess.Write([]byte("Continue? (y/n)")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	var stdout string
+	events := 0
+	for {
+		msg := receiveMessage(t, client, 200*time.Millisecond)
+		if msg == nil {
+			break
+		}
+		switch msg.Type {
+		case MessageTypeStdout:
+			stdout += msg.Data
+		case MessageTypeSmartEvent:
+			events++
+		}
+	}
+	if n := strings.Count(stdout, "Continue? (y/n)"); n != 1 {
+		t.Errorf("Expected the output once, got %d times: %q", n, stdout)
+	}
+	if events == 0 {
+		t.Error("Expected the Claude driver to report a smart event")
+	}
+
+	// Detaching stops the broadcast
+	wsService.DetachSession(sessionID)
+	ptyProcess.Write([]byte("after detach"))
+	if msg := receiveMessage(t, client, 100*time.Millisecond); msg != nil && msg.Type == MessageTypeStdout {
+		t.Errorf("Expected no output after detach, got %+v", msg)
+	}
+}
+
+// TestServiceAttachProcessRestart tests that attaching a new process for a
+// session marks the restart boundary for its clients
+func TestServiceAttachProcessRestart(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	wsService := NewService(ptyManager, driver.NewGenericDriver())
+	defer wsService.Close()
+
+	sessionID := "test-attach-restart"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hub := wsService.HubManager().GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	// The first attach is not a restart
+	wsService.AttachProcess(sessionID, ptyProcess, nil)
+	if msg := receiveMessage(t, client, 100*time.Millisecond); msg != nil {
+		t.Fatalf("Expected no message on first attach, got %+v", msg)
+	}
+
+	wsService.AttachProcess(sessionID, ptyProcess, nil)
+	msg := receiveMessage(t, client, time.Second)
+	if msg == nil || msg.Type != MessageTypeStatus || msg.State != StateRestarted {
+		t.Fatalf("Expected %s status, got %+v", StateRestarted, msg)
+	}
+}
+
+// TestHandleConnectionTicketAuth tests that attach tickets are validated before upgrade
+func TestHandleConnectionTicketAuth(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ws_ticket_test_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ptyManager := pty.NewManager(tempDir)
+	defer ptyManager.Close()
+
+	sessionID := "test-ticket-session"
+	session := &model.Session{
+		ID:      sessionID,
+		UserID:  "test-user",
+		Command: "cat",
+		Status:  model.SessionStatusRunning,
+	}
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{Session: session}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	tickets := auth.NewTicketStore(auth.DefaultTicketTTL)
+	defer tickets.Close()
+
+	handler := NewHandler(NewHubManager(), ptyManager, driver.NewGenericDriver())
+	handler.SetTicketStore(tickets)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dial := func(ticket string) (*websocket.Conn, *http.Response, error) {
+		return websocket.DefaultDialer.Dial(wsURL+"?ticket="+ticket, nil)
+	}
+
+	otherSession, _ := tickets.Issue("other-session", "test-user")
+	otherUser, _ := tickets.Issue(sessionID, "other-user")
+
+	rejected := []struct {
+		name   string
+		ticket string
+	}{
+		{"missing ticket", ""},
+		{"unknown ticket", "bogus"},
+		{"wrong session", otherSession.Token},
+		{"wrong user", otherUser.Token},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp, err := dial(tt.ticket)
+			if err == nil {
+				conn.Close()
+				t.Fatal("expected upgrade to be rejected")
+			}
+			if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("expected 401 before upgrade, got %v", resp)
+			}
+		})
+	}
+
+	valid, _ := tickets.Issue(sessionID, "test-user")
+	conn, _, err := dial(valid.Token)
+	if err != nil {
+		t.Fatalf("expected valid ticket to be accepted: %v", err)
+	}
+	conn.Close()
+
+	// Tickets are single-use
+	if conn, resp, err := dial(valid.Token); err == nil {
+		conn.Close()
+		t.Error("expected reused ticket to be rejected")
+	} else if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for reused ticket, got %v", resp)
+	}
+}
+
+// TestHandleConnectionOwnership tests that only the session's owner can attach
+func TestHandleConnectionOwnership(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-ownership-session"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, r.URL.Query().Get("user"))
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for _, user := range []string{"other-user", ""} {
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL+"?user="+user, nil)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("expected attach as %q to be rejected", user)
+		}
+		if resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected 403 for user %q, got %v", user, resp)
+		}
+	}
+	if hub := hubManager.Get(sessionID); hub != nil && hub.ClientCount() != 0 {
+		t.Errorf("expected no registered clients, got %d", hub.ClientCount())
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?user=test-user", nil)
+	if err != nil {
+		t.Fatalf("expected the owner to attach: %v", err)
+	}
+	conn.Close()
+}
+
+// TestStdoutSequenceNumbers tests that stdout messages carry gap-free, increasing sequences
+func TestStdoutSequenceNumbers(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+
+	sessionID := "seq-session"
+	hub := hubManager.GetOrCreate(sessionID)
+
+	numClients := 3
+	clients := make([]*Client, numClients)
+	for i := range clients {
+		clients[i] = NewClient(hub, nil, sessionID, false)
+		hub.Register(clients[i])
+	}
+
+	numChunks := 100
+	for i := 0; i < numChunks; i++ {
+		handler.BroadcastOutput(sessionID, []byte("chunk"))
+	}
+
+	for i, client := range clients {
+		var last uint64
+		for j := 0; j < numChunks; j++ {
+			received := receiveWithTimeoutTest(t, client, 100*time.Millisecond)
+			if received == nil {
+				t.Fatalf("client %d missing message %d", i, j)
+			}
+			var parsed Message
+			if err := json.Unmarshal(received, &parsed); err != nil {
+				t.Fatalf("client %d received invalid JSON: %v", i, err)
+			}
+			if parsed.Seq != last+1 {
+				t.Fatalf("client %d expected seq %d, got %d", i, last+1, parsed.Seq)
+			}
+			last = parsed.Seq
+		}
+	}
+
+	if hub.LastSeq() != uint64(numChunks) {
+		t.Errorf("expected hub last seq %d, got %d", numChunks, hub.LastSeq())
+	}
+}
+
+// TestBroadcastSequenceOrdering tests that concurrent broadcasts of any message
+// type reach every client in sequence order
+func TestBroadcastSequenceOrdering(t *testing.T) {
+	hub := NewHub("ordering-session")
+	defer hub.Close()
+
+	numClients := 3
+	clients := make([]*Client, numClients)
+	for i := range clients {
+		clients[i] = NewClient(hub, nil, "ordering-session", false)
+		hub.Register(clients[i])
+	}
+
+	numGoroutines := 4
+	perGoroutine := 50
+	var wg sync.WaitGroup
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				msg := &Message{Type: MessageTypeStdout, Data: "out"}
+				if i%2 == 1 {
+					msg = &Message{Type: MessageTypeStatus, State: "running"}
+				}
+				hub.BroadcastMessage(msg)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := numGoroutines * perGoroutine
+	for i, client := range clients {
+		for expected := uint64(1); expected <= uint64(total); expected++ {
+			received := receiveWithTimeoutTest(t, client, 100*time.Millisecond)
+			if received == nil {
+				t.Fatalf("client %d missing message with seq %d", i, expected)
+			}
+			var parsed Message
+			if err := json.Unmarshal(received, &parsed); err != nil {
+				t.Fatalf("client %d received invalid JSON: %v", i, err)
+			}
+			if parsed.Seq != expected {
+				t.Fatalf("client %d expected seq %d, got %d", i, expected, parsed.Seq)
+			}
+		}
+	}
+}
+
+// TestBroadcastAfterHubClose tests that broadcasting on a closed hub reports ErrHubClosed
+func TestBroadcastAfterHubClose(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+
+	sessionID := "closed-session"
+	hub := hubManager.GetOrCreate(sessionID)
+	if err := hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "before"}); err != nil {
+		t.Fatalf("unexpected error before close: %v", err)
+	}
+
+	hub.Close()
+	if !hub.IsClosed() {
+		t.Error("expected hub to report closed")
+	}
+
+	if err := hub.Broadcast([]byte("after")); !errors.Is(err, ErrHubClosed) {
+		t.Errorf("Broadcast: expected ErrHubClosed, got %v", err)
+	}
+	if err := hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "after"}); !errors.Is(err, ErrHubClosed) {
+		t.Errorf("BroadcastMessage: expected ErrHubClosed, got %v", err)
+	}
+	if hub.LastSeq() != 1 {
+		t.Errorf("expected failed broadcasts not to consume sequence numbers, got last seq %d", hub.LastSeq())
+	}
+
+	// The handler surfaces the error from the output path
+	if err := handler.BroadcastOutput(sessionID, []byte("after")); !errors.Is(err, ErrHubClosed) {
+		t.Errorf("BroadcastOutput: expected ErrHubClosed, got %v", err)
+	}
+	if err := handler.BroadcastStatus(sessionID, "exited", nil); !errors.Is(err, ErrHubClosed) {
+		t.Errorf("BroadcastStatus: expected ErrHubClosed, got %v", err)
+	}
+
+	// A removed hub is not an error: there is nobody to notify
+	hubManager.Remove(sessionID)
+	if err := handler.BroadcastOutput(sessionID, []byte("after")); err != nil {
+		t.Errorf("expected no error without a hub, got %v", err)
+	}
+}
+
+// TestHubManagerCleanupIdle tests removal of hubs that have had no clients past the idle timeout
+func TestHubManagerCleanupIdle(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+
+	// Disabled by default
+	hubManager.GetOrCreate("never-attached")
+	time.Sleep(20 * time.Millisecond)
+	if removed := hubManager.CleanupIdle(); removed != 0 {
+		t.Errorf("expected no cleanup without an idle timeout, removed %d", removed)
+	}
+
+	hubManager.SetIdleTimeout(50 * time.Millisecond)
+
+	active := hubManager.GetOrCreate("active")
+	client := NewClient(active, nil, "active", false)
+	active.Register(client)
+
+	departed := hubManager.GetOrCreate("departed")
+	viewer := NewClient(departed, nil, "departed", false)
+	departed.Register(viewer)
+
+	time.Sleep(30 * time.Millisecond)
+	departed.Unregister(viewer)
+
+	// Only the hub that was never attached has been idle long enough
+	time.Sleep(30 * time.Millisecond)
+	if removed := hubManager.CleanupIdle(); removed != 1 {
+		t.Errorf("expected 1 hub removed, got %d", removed)
+	}
+	if hubManager.Get("never-attached") != nil {
+		t.Error("expected never-attached hub to be removed")
+	}
+	if hubManager.Get("departed") == nil {
+		t.Error("expected departed hub to be kept until its idle timeout elapses")
+	}
+
+	// Fetching a hub resets its idle clock
+	time.Sleep(30 * time.Millisecond)
+	hubManager.GetOrCreate("departed")
+	time.Sleep(30 * time.Millisecond)
+	if removed := hubManager.CleanupIdle(); removed != 0 {
+		t.Errorf("expected recently fetched hub to be kept, removed %d", removed)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if removed := hubManager.CleanupIdle(); removed != 1 {
+		t.Errorf("expected departed hub to be removed, got %d", removed)
+	}
+	if !departed.IsClosed() {
+		t.Error("expected removed hub to be closed")
+	}
+	if hubManager.Get("active") == nil {
+		t.Error("expected hub with a client to be kept")
+	}
+}
+
+// hubCount returns the number of hubs held by the manager
+func hubCount(m *HubManager) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.hubs)
+}
+
+// readStatusSnapshot reads the status message that starts every attach
+func readStatusSnapshot(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != MessageTypeStatus {
+		t.Fatalf("expected status snapshot first, got %+v (err: %v)", msg, err)
+	}
+	return msg
+}
+
+// TestHubManagerCleanupExited tests removal of hubs of exited sessions
+// after their grace period
+func TestHubManagerCleanupExited(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	hubManager.SetExitedGracePeriod(50 * time.Millisecond)
+
+	running := hubManager.GetOrCreate("running")
+	exited := hubManager.GetOrCreate("exited")
+	watched := hubManager.GetOrCreate("watched")
+	viewer := NewClient(watched, nil, "watched", false)
+	watched.Register(viewer)
+
+	exited.MarkExited()
+	watched.MarkExited()
+	if hubCount(hubManager) != 3 {
+		t.Fatalf("Expected 3 hubs, got %d", hubCount(hubManager))
+	}
+
+	// Clients can still see the exit status during the grace period
+	if removed := hubManager.CleanupExited(); removed != 0 {
+		t.Errorf("Expected no cleanup within the grace period, removed %d", removed)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if removed := hubManager.CleanupExited(); removed != 1 {
+		t.Errorf("Expected 1 hub removed, got %d", removed)
+	}
+	if hubCount(hubManager) != 2 {
+		t.Errorf("Expected 2 hubs after cleanup, got %d", hubCount(hubManager))
+	}
+	if hubManager.Get("exited") != nil || !exited.IsClosed() {
+		t.Error("Expected exited hub to be removed and closed")
+	}
+	if hubManager.Get("running") != running {
+		t.Error("Expected hub of a running session to be kept")
+	}
+
+	// The grace period restarts when the last client leaves
+	watched.Unregister(viewer)
+	if removed := hubManager.CleanupExited(); removed != 0 {
+		t.Errorf("Expected hub whose client just left to be kept, removed %d", removed)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if removed := hubManager.CleanupExited(); removed != 1 {
+		t.Errorf("Expected watched hub to be removed, got %d", removed)
+	}
+
+	// A late client gets a fresh hub
+	late := hubManager.GetOrCreate("exited")
+	if late == exited || late.IsClosed() || !late.ExitedAt().IsZero() {
+		t.Error("Expected GetOrCreate to create a new open hub after cleanup")
+	}
+	if err := late.Register(NewClient(late, nil, "exited", false)); err != nil {
+		t.Errorf("Expected late client to register, got %v", err)
+	}
+
+	// Disabled with a zero grace period
+	hubManager.SetExitedGracePeriod(0)
+	running.MarkExited()
+	time.Sleep(10 * time.Millisecond)
+	if removed := hubManager.CleanupExited(); removed != 0 {
+		t.Errorf("Expected no cleanup when disabled, removed %d", removed)
+	}
+}
+
+// TestServiceMarksExitedHub tests that a session's hub is marked exited
+// when its attached process exits, and running again on restart
+func TestServiceMarksExitedHub(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	wsService := NewService(ptyManager, driver.NewGenericDriver())
+	defer wsService.Close()
+	wsService.HubManager().SetExitedGracePeriod(50 * time.Millisecond)
+
+	sessionID := "test-exited-hub"
+	spawn := func() *pty.PTYProcess {
+		p, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+			Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		})
+		if err != nil {
+			t.Fatalf("failed to spawn PTY: %v", err)
+		}
+		return p
+	}
+
+	first := spawn()
+	wsService.AttachProcess(sessionID, first, nil)
+	hub := wsService.HubManager().Get(sessionID)
+
+	// A restarted process keeps the hub running even if the old one closes late
+	second := spawn()
+	wsService.AttachProcess(sessionID, second, nil)
+	first.Close()
+	time.Sleep(50 * time.Millisecond)
+	if !hub.ExitedAt().IsZero() {
+		t.Error("Expected hub to stay running after the replaced process closed")
+	}
+
+	second.Close()
+	deadline := time.Now().Add(time.Second)
+	for hub.ExitedAt().IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected hub to be marked exited")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if removed := wsService.HubManager().CleanupExited(); removed != 1 {
+		t.Errorf("Expected exited hub to be removed, got %d", removed)
+	}
+	if wsService.HubManager().Get(sessionID) != nil {
+		t.Error("Expected hub to be gone after the grace period")
+	}
+}
+
+// TestHubManagerShutdown tests that shutdown tells clients the server is going away
+func TestHubManagerShutdown(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionIDs := []string{"test-shutdown-session-1", "test-shutdown-session-2"}
+	for _, sessionID := range sessionIDs {
+		if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+			Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		}); err != nil {
+			t.Fatalf("failed to spawn PTY: %v", err)
+		}
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, r.URL.Query().Get("session"), "test-user")
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// One client per session, so hubs are drained concurrently
+	conns := make([]*websocket.Conn, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?session="+sessionID, nil)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+
+	// Each client reads until the connection closes, which also answers
+	// the server's close frame
+	type result struct {
+		sawShutdown bool
+		closeErr    *websocket.CloseError
+	}
+	results := make(chan result, len(conns))
+	for _, conn := range conns {
+		go func(conn *websocket.Conn) {
+			var r result
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					errors.As(err, &r.closeErr)
+					results <- r
+					return
+				}
+				var msg Message
+				if json.Unmarshal(data, &msg) == nil && msg.Type == MessageTypeStatus && msg.State == StateServerShutdown {
+					r.sawShutdown = true
+				}
+			}
+		}(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hubManager.Shutdown(ctx, "server restarting"); err != nil {
+		t.Errorf("expected clients to close in time, got %v", err)
+	}
+
+	for range conns {
+		r := <-results
+		if !r.sawShutdown {
+			t.Error("expected server_shutdown status before close")
+		}
+		if r.closeErr == nil {
+			t.Fatal("expected a close frame")
+		}
+		if r.closeErr.Code != websocket.CloseGoingAway || r.closeErr.Text != "server restarting" {
+			t.Errorf("expected close 1001 \"server restarting\", got %d %q", r.closeErr.Code, r.closeErr.Text)
+		}
+	}
+	for _, sessionID := range sessionIDs {
+		if hubManager.Get(sessionID) != nil {
+			t.Errorf("expected hub for %s to be removed after shutdown", sessionID)
+		}
+	}
+}
+
+// TestHubDrainTimeout tests that clients which never answer the close frame are cut off at the deadline
+func TestHubDrainTimeout(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-drain-timeout-session"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	// The client never reads, so it never answers the close frame
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	var hub *Hub
+	for hub == nil || hub.ClientCount() == 0 {
+		time.Sleep(10 * time.Millisecond)
+		hub = hubManager.Get(sessionID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := hub.Drain(ctx, "server restarting"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > closeAckWait {
+		t.Errorf("expected drain to stop at the deadline, took %v", elapsed)
+	}
+	if !hub.IsClosed() {
+		t.Error("expected hub to be closed after drain")
+	}
+}
+
+// TestHandleConnectionTooManyClients tests that attaching to a full hub is rejected with 429
+func TestHandleConnectionTooManyClients(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-max-clients-session"
+	if _, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	}); err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	hubManager.SetMaxClients(1)
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// Owner plus one client fill the hub
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("failed to dial client %d: %v", i, err)
+		}
+		defer conn.Close()
+		for hubManager.Get(sessionID).ClientCount() < i+1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("expected dial to fail when the hub is full")
+	}
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 response, got %+v", resp)
+	}
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error.Code != ErrorCodeTooManyClients {
+		t.Errorf("expected %s error body, got %+v (%v)", ErrorCodeTooManyClients, body, err)
+	}
+	resp.Body.Close()
+}
+
+// TestBinaryProtocolRoundTrip tests byte-exact delivery of terminal output over binary frames
+func TestBinaryProtocolRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ws_binary_test_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ptyManager := pty.NewManager(tempDir)
+	defer ptyManager.Close()
+
+	sessionID := "test-binary-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	// ANSI sequences plus bytes that are not valid UTF-8
+	history := []byte("\x1b[1;32mhistory\x1b[0m \xff\xfe\xc3\x28")
+	stdout := []byte("\x1b[31mred\x1b[0m\r\n\x80\xbf\xf0\x28\x8c\x28")
+	ptyProcess.RingBuffer.Write(history)
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?proto=binary", nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	readBinary := func(expectedType MessageType, expected []byte) {
+		t.Helper()
+		frameType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if frameType != websocket.BinaryMessage {
+			t.Fatalf("expected binary frame, got type %d", frameType)
+		}
+		msgType, payload, err := DecodeBinaryFrame(data)
+		if err != nil {
+			t.Fatalf("failed to decode frame: %v", err)
+		}
+		if msgType != expectedType {
+			t.Errorf("expected %s frame, got %s", expectedType, msgType)
+		}
+		if string(payload) != string(expected) {
+			t.Errorf("expected payload %q, got %q", expected, payload)
+		}
+	}
+
+	readStatusSnapshot(t, conn)
+	readBinary(MessageTypeHistory, history)
+
+	// The end of the history and the size follow as JSON text frames
+	frameType, data, err := conn.ReadMessage()
+	var end Message
+	if err != nil || frameType != websocket.TextMessage || json.Unmarshal(data, &end) != nil || end.Type != MessageTypeHistoryEnd {
+		t.Fatalf("expected JSON history_end text frame, got type %d: %s (err: %v)", frameType, data, err)
+	}
+	frameType, data, err = conn.ReadMessage()
+	var size Message
+	if err != nil || frameType != websocket.TextMessage || json.Unmarshal(data, &size) != nil || size.Type != MessageTypeResize {
+		t.Fatalf("expected JSON resize text frame, got type %d: %s (err: %v)", frameType, data, err)
+	}
+
+	// Wait for registration before broadcasting
+	hub := hubManager.Get(sessionID)
+	for i := 0; i < 100 && hub.ClientCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	handler.BroadcastOutput(sessionID, stdout)
+	readBinary(MessageTypeStdout, stdout)
+
+	// Control messages remain JSON text frames
+	handler.BroadcastStatus(sessionID, "exited", nil)
+	frameType, data, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read status frame: %v", err)
+	}
+	var status Message
+	if frameType != websocket.TextMessage || json.Unmarshal(data, &status) != nil || status.Type != MessageTypeStatus {
+		t.Errorf("expected JSON status text frame, got type %d: %s", frameType, data)
+	}
+}
+
+// TestReconnectWithCursor tests that a client reconnecting with its last
+// cursor only receives the output it missed
+func TestReconnectWithCursor(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ws_cursor_test_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ptyManager := pty.NewManager(tempDir)
+	defer ptyManager.Close()
+
+	sessionID := "test-cursor-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:        &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		RingBufferSize: 8,
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	attach := func(query string) Message {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, nil)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		readStatusSnapshot(t, conn)
+
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		return msg
+	}
+
+	ptyProcess.RingBuffer.Write([]byte("first"))
+
+	msg := attach("")
+	if msg.Type != MessageTypeHistory || msg.Data != "first" || msg.Cursor != 5 {
+		t.Fatalf("expected full history 'first' at cursor 5, got %s %q at %d", msg.Type, msg.Data, msg.Cursor)
+	}
+
+	ptyProcess.RingBuffer.Write([]byte("second"))
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedType MessageType
+		expectedData string
+	}{
+		{"cursor within buffer", "?cursor=5", MessageTypeStdout, "second"},
+		{"cursor overwritten", "?cursor=1", MessageTypeHistory, "stsecond"},
+		{"cursor ahead of buffer", "?cursor=99", MessageTypeHistory, "stsecond"},
+		{"malformed cursor", "?cursor=abc", MessageTypeHistory, "stsecond"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := attach(tt.query)
+			if msg.Type != tt.expectedType || msg.Data != tt.expectedData {
+				t.Errorf("expected %s %q, got %s %q", tt.expectedType, tt.expectedData, msg.Type, msg.Data)
+			}
+			if msg.Cursor != 11 {
+				t.Errorf("expected cursor 11, got %d", msg.Cursor)
+			}
+		})
+	}
+}
+
+// TestReconnectWithCursorAfterRestart tests that a cursor issued for the
+// output of a process since restarted gets the new output in full, while
+// cursors within the new output resume it
+func TestReconnectWithCursorAfterRestart(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-cursor-restart"
+	session := &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"}
+	previous, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{Session: session, RingBufferSize: 64})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+	previous.RingBuffer.Write([]byte("before"))
+	previous.Close()
+
+	// The exited process is removed from the manager before its restart
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := ptyManager.Get(sessionID); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the process to be removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:        session,
+		RingBufferSize: 64,
+		InitialCursor:  previous.RingBuffer.Cursor(),
+	})
+	if err != nil {
+		t.Fatalf("failed to respawn PTY: %v", err)
+	}
+	ptyProcess.RingBuffer.Write([]byte("after the restart"))
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedType MessageType
+		expectedData string
+		expectedMode string
+	}{
+		{"cursor at the restart", "?cursor=6", MessageTypeHistory, "after the restart", RestoreFull},
+		{"cursor before the restart", "?cursor=3", MessageTypeHistory, "after the restart", RestoreFull},
+		{"cursor after the restart", "?cursor=12", MessageTypeStdout, "the restart", RestoreIncremental},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+tt.query, nil)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			readStatusSnapshot(t, conn)
+
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("failed to read message: %v", err)
+			}
+			if msg.Type != tt.expectedType || msg.Data != tt.expectedData || msg.Cursor != 23 {
+				t.Errorf("expected %s %q at cursor 23, got %s %q at %d", tt.expectedType, tt.expectedData, msg.Type, msg.Data, msg.Cursor)
+			}
+
+			var end Message
+			if err := conn.ReadJSON(&end); err != nil || end.Type != MessageTypeHistoryEnd {
+				t.Fatalf("expected history_end, got %+v (err: %v)", end, err)
+			}
+			var payload HistoryEnd
+			if err := json.Unmarshal(end.Payload, &payload); err != nil || payload.Mode != tt.expectedMode {
+				t.Errorf("expected %s restore, got %+v (err: %v)", tt.expectedMode, payload, err)
+			}
+		})
+	}
+}
+
+// TestReconnectWithSinceSeq tests resuming from the last received stdout
+// sequence number, with a fallback to the full history when it is unknown
+// or its output has been evicted
+func TestReconnectWithSinceSeq(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-since-seq-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:        &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		RingBufferSize: 16,
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	hubManager.GetOrCreate(sessionID)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	// output writes to the ring buffer and broadcasts, like WatchOutput
+	output := func(data string) {
+		t.Helper()
+		ptyProcess.RingBuffer.Write([]byte(data))
+		if err := handler.BroadcastOutput(sessionID, []byte(data)); err != nil {
+			t.Fatalf("failed to broadcast: %v", err)
+		}
+	}
+
+	// attach returns the restored output and the history_end message
+	attach := func(query string) ([]Message, Message, HistoryEnd) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, nil)
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		readStatusSnapshot(t, conn)
+
+		var restored []Message
+		for {
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("failed to read message: %v", err)
+			}
+			if msg.Type == MessageTypeHistoryEnd {
+				var end HistoryEnd
+				if err := json.Unmarshal(msg.Payload, &end); err != nil {
+					t.Fatalf("invalid history_end payload: %v", err)
+				}
+				return restored, msg, end
+			}
+			restored = append(restored, msg)
+		}
+	}
+
+	output("first")  // seq 1, cursor 5
+	output("second") // seq 2, cursor 11
+
+	t.Run("incremental", func(t *testing.T) {
+		restored, msg, end := attach("?since_seq=1")
+		if len(restored) != 1 || restored[0].Type != MessageTypeStdout || restored[0].Data != "second" {
+			t.Fatalf("Expected only the missed stdout 'second', got %+v", restored)
+		}
+		if end.Mode != RestoreIncremental || end.Bytes != 6 {
+			t.Errorf("Expected incremental restore of 6 bytes, got %+v", end)
+		}
+		if msg.Seq != 2 || msg.Cursor != 11 {
+			t.Errorf("Expected history_end at seq 2 cursor 11, got seq %d cursor %d", msg.Seq, msg.Cursor)
+		}
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		restored, _, end := attach("?since_seq=2")
+		if len(restored) != 0 {
+			t.Errorf("Expected nothing to restore, got %+v", restored)
+		}
+		if end.Mode != RestoreIncremental || end.Bytes != 0 {
+			t.Errorf("Expected empty incremental restore, got %+v", end)
+		}
+	})
+
+	// Evict everything written up to seq 2
+	output("0123456789abcdef") // seq 3, cursor 27
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"evicted", "?since_seq=1"},
+		{"ahead of hub", "?since_seq=99"},
+		{"malformed", "?since_seq=abc"},
+		{"none", ""},
+	}
+	for _, tt := range tests {
+		t.Run("full "+tt.name, func(t *testing.T) {
+			restored, _, end := attach(tt.query)
+			if len(restored) != 1 || restored[0].Type != MessageTypeHistory || restored[0].Data != "0123456789abcdef" {
+				t.Fatalf("Expected the full history, got %+v", restored)
+			}
+			if end.Mode != RestoreFull || end.Bytes != 16 {
+				t.Errorf("Expected full restore of 16 bytes, got %+v", end)
+			}
+		})
+	}
+}
+
+// TestHubCursorForSeq tests mapping sequence numbers to ring buffer cursors
+func TestHubCursorForSeq(t *testing.T) {
+	hub := NewHub("test-cursor-for-seq")
+
+	hub.BroadcastMessage(&Message{Type: MessageTypeStatus, State: "running"})      // seq 1
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "ab", Cursor: 2}) // seq 2
+	hub.BroadcastMessage(&Message{Type: MessageTypeSmartEvent})                    // seq 3
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "cd", Cursor: 4}) // seq 4
+
+	tests := []struct {
+		seq            uint64
+		expectedCursor int64
+		expectedOK     bool
+	}{
+		{1, 0, false}, // Before the first remembered output
+		{2, 2, true},
+		{3, 2, true}, // Non-output messages do not move the cursor
+		{4, 4, true},
+		{5, 0, false}, // Ahead of the hub
+	}
+	for _, tt := range tests {
+		cursor, ok := hub.CursorForSeq(tt.seq)
+		if cursor != tt.expectedCursor || ok != tt.expectedOK {
+			t.Errorf("CursorForSeq(%d): expected (%d, %v), got (%d, %v)", tt.seq, tt.expectedCursor, tt.expectedOK, cursor, ok)
+		}
+	}
+
+	// Only the latest outputIndexSize messages are remembered
+	for i := 0; i < outputIndexSize; i++ {
+		hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Cursor: int64(10 + i)})
+	}
+	if _, ok := hub.CursorForSeq(4); ok {
+		t.Error("Expected the oldest output to be forgotten")
+	}
+	if cursor, ok := hub.CursorForSeq(hub.LastSeq()); !ok || cursor != int64(9+outputIndexSize) {
+		t.Errorf("Expected the latest cursor %d, got %d (ok=%v)", 9+outputIndexSize, cursor, ok)
+	}
+
+	hub.ResetOutputIndex()
+	if _, ok := hub.CursorForSeq(hub.LastSeq()); ok {
+		t.Error("Expected no cursors after ResetOutputIndex")
+	}
+}
+
+// TestChunkedHistory tests that history is sent in bounded chunks followed
+// by a history_end message
+func TestChunkedHistory(t *testing.T) {
+	full := strings.Repeat("build output 0\n", pty.DefaultRingBufferSize/16)
+
+	tests := []struct {
+		name           string
+		history        string
+		expectedChunks int
+	}{
+		{"empty buffer", "", 0},
+		{"smaller than one chunk", "hello\r\n", 1},
+		{"full buffer", full, 4},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ptyManager := pty.NewManager(t.TempDir())
+			defer ptyManager.Close()
+
+			sessionID := fmt.Sprintf("test-chunked-history-%d", i)
+			ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+				Session: &model.Session{ID: sessionID, UserID: "test-user", Name: "Chunked history", Command: "cat"},
+			})
+			if err != nil {
+				t.Fatalf("failed to spawn PTY: %v", err)
+			}
+			ptyProcess.RingBuffer.Write([]byte(tt.history))
+
+			hubManager := NewHubManager()
+			defer hubManager.Close()
+			handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+			hubManager.GetOrCreate(sessionID).NextSeq()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handler.HandleConnection(w, r, sessionID, "test-user")
+			}))
+			defer server.Close()
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+			// The status snapshot precedes the history
+			status := readStatusSnapshot(t, conn)
+			var snapshot StatusSnapshot
+			if err := json.Unmarshal(status.Payload, &snapshot); err != nil {
+				t.Fatalf("invalid status payload: %v", err)
+			}
+			if status.State != string(model.SessionStatusRunning) || status.Code != nil {
+				t.Errorf("Expected running status without exit code, got %q %v", status.State, status.Code)
+			}
+			if snapshot.PID != ptyProcess.PID() || snapshot.Name != "Chunked history" {
+				t.Errorf("Expected pid %d and name %q, got %+v", ptyProcess.PID(), "Chunked history", snapshot)
+			}
+			if rows, cols := ptyProcess.Size(); status.Rows != rows || status.Cols != cols {
+				t.Errorf("Expected size %dx%d, got %dx%d", rows, cols, status.Rows, status.Cols)
+			}
+
+			var restored strings.Builder
+			chunks := 0
+			for {
+				var msg Message
+				if err := conn.ReadJSON(&msg); err != nil {
+					t.Fatalf("failed to read message: %v", err)
+				}
+				if msg.Type == MessageTypeHistoryEnd {
+					var end HistoryEnd
+					if err := json.Unmarshal(msg.Payload, &end); err != nil {
+						t.Fatalf("invalid history_end payload: %v", err)
+					}
+					if end.Bytes != len(tt.history) {
+						t.Errorf("Expected history_end with %d bytes, got %d", len(tt.history), end.Bytes)
+					}
+					if msg.Seq != 1 {
+						t.Errorf("Expected history_end seq 1, got %d", msg.Seq)
+					}
+					if msg.Cursor != int64(len(tt.history)) {
+						t.Errorf("Expected history_end cursor %d, got %d", len(tt.history), msg.Cursor)
+					}
+					break
+				}
+				if msg.Type != MessageTypeHistory {
+					t.Fatalf("Expected history message, got %s", msg.Type)
+				}
+				if len(msg.Data) > HistoryChunkSize {
+					t.Errorf("Expected chunk of at most %d bytes, got %d", HistoryChunkSize, len(msg.Data))
+				}
+				restored.WriteString(msg.Data)
+				if msg.Cursor != int64(restored.Len()) {
+					t.Errorf("Expected chunk cursor %d, got %d", restored.Len(), msg.Cursor)
+				}
+				chunks++
+			}
+
+			if chunks != tt.expectedChunks {
+				t.Errorf("Expected %d history chunks, got %d", tt.expectedChunks, chunks)
+			}
+			if restored.String() != tt.history {
+				t.Errorf("History not restored intact: expected %d bytes, got %d", len(tt.history), restored.Len())
+			}
+		})
+	}
+}
+
+// TestSplitHistory tests that history chunks end on UTF-8 character boundaries
+func TestSplitHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		size     int
+		expected []string
+	}{
+		{"empty", "", 4, nil},
+		{"exact size", "abcd", 4, []string{"abcd"}},
+		{"ascii", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"multibyte boundary", "ab日本", 4, []string{"ab", "日", "本"}},
+		{"invalid utf-8", "\x80\x80\x80\x80\x80\x80", 4, []string{"\x80\x80\x80\x80", "\x80\x80"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks []string
+			for _, chunk := range splitHistory([]byte(tt.data), tt.size) {
+				chunks = append(chunks, string(chunk))
+			}
+			if !reflect.DeepEqual(chunks, tt.expected) {
+				t.Errorf("Expected chunks %q, got %q", tt.expected, chunks)
+			}
+		})
+	}
+}
+
+// TestClientRestoreHoldsBroadcasts tests that broadcasts during a restore are
+// queued after the messages sent directly, in order
+func TestClientRestoreHoldsBroadcasts(t *testing.T) {
+	hub := NewHub("test-restore-session")
+	client := NewClient(hub, nil, "test-restore-session", false)
+	client.BeginRestore()
+	hub.Register(client)
+
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "live-1"})
+	client.SendMessage(&Message{Type: MessageTypeHistory, Data: "history"})
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "live-2"})
+	client.SendMessage(&Message{Type: MessageTypeHistoryEnd})
+
+	if queued := len(client.SendChan()); queued != 2 {
+		t.Fatalf("Expected only the 2 restore messages queued, got %d", queued)
+	}
+
+	client.EndRestore()
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "live-3"})
+
+	expected := []string{"history", "", "live-1", "live-2", "live-3"}
+	for _, data := range expected {
+		msg := receiveMessage(t, client, time.Second)
+		if msg == nil {
+			t.Fatalf("Expected %q, got nothing", data)
+		}
+		if msg.Data != data {
+			t.Errorf("Expected %q, got %s %q", data, msg.Type, msg.Data)
+		}
+	}
+}
+
+// TestCompressOutput tests permessage-deflate negotiation for output frames
+func TestCompressOutput(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ws_compress_test_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ptyManager := pty.NewManager(tempDir)
+	defer ptyManager.Close()
+
+	sessionID := "test-compress-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	history := strings.Repeat("\x1b[32mbuild ok\x1b[0m\r\n", 200)
+	ptyProcess.RingBuffer.Write([]byte(history))
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.CompressOutput = true
+	handler.CompressThreshold = DefaultCompressThreshold
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		name       string
+		compress   bool
+		negotiated bool
+	}{
+		{"client offers deflate", true, true},
+		{"client without deflate", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := websocket.Dialer{EnableCompression: tt.compress}
+			conn, resp, err := dialer.Dial(url, nil)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+
+			extensions := resp.Header.Get("Sec-Websocket-Extensions")
+			if negotiated := strings.Contains(extensions, "permessage-deflate"); negotiated != tt.negotiated {
+				t.Errorf("expected negotiated=%v, got extensions %q", tt.negotiated, extensions)
+			}
+
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			readStatusSnapshot(t, conn)
+			var msg Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("failed to read history: %v", err)
+			}
+			if msg.Type != MessageTypeHistory || msg.Data != history {
+				t.Errorf("history not restored intact: type=%s len=%d", msg.Type, len(msg.Data))
+			}
+		})
+	}
+}
+
+// TestCompressionLevel tests compressing history at a handler's
+// CompressionLevel
+func TestCompressionLevel(t *testing.T) {
+	if level := (&Handler{}).compressionLevel(); level != flate.BestSpeed {
+		t.Errorf("Expected flate.BestSpeed by default, got %d", level)
+	}
+
+	tempDir, err := os.MkdirTemp("", "ws_upgrader_compress_test_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ptyManager := pty.NewManager(tempDir)
+	defer ptyManager.Close()
+
+	sessionID := "test-upgrader-compress-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	history := strings.Repeat("\x1b[1;34m⏺ Read(src/main.go)\x1b[0m\r\n", 100)
+	ptyProcess.RingBuffer.Write([]byte(history))
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	handler.CompressOutput = true
+	handler.CompressionLevel = flate.BestCompression
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Errorf("expected permessage-deflate to be negotiated, got %q", ext)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	readStatusSnapshot(t, conn)
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+	if msg.Type != MessageTypeHistory || msg.Data != history {
+		t.Errorf("history not restored intact: type=%s len=%d", msg.Type, len(msg.Data))
+	}
+}
+
+// TestWantsBinary tests binary protocol negotiation from the attach query
+func TestWantsBinary(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{"", false},
+		{"?proto=binary", true},
+		{"?proto=json", false},
+		{"?binary=1", true},
+		{"?binary=true", true},
+		{"?binary=0", false},
+		{"?binary=yes", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/sessions/s1/attach"+tt.query, nil)
+			if got := wantsBinary(r); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestReadOnlyClient tests that stdin from a read-only client never reaches the PTY
+func TestReadOnlyClient(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ws_readonly_test_*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ptyManager := pty.NewManager(tempDir)
+	defer ptyManager.Close()
+
+	sessionID := "test-readonly-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts := ConnectOptions{UserID: "test-user", ReadOnly: IsReadOnlyMode(r.URL.Query().Get("mode"))}
+		handler.HandleConnectionWithOptions(w, r, sessionID, opts)
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for _, mode := range []string{ModeReadOnly, ModeViewer, ModeObserver} {
+		observer, _, err := websocket.DefaultDialer.Dial(url+"?mode="+mode, nil)
+		if err != nil {
+			t.Fatalf("failed to dial %s: %v", mode, err)
+		}
+		defer observer.Close()
+		observer.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		// The connect sequence is the status snapshot, the end of the
+		// (empty) history and the current terminal size
+		readStatusSnapshot(t, observer)
+		var end, size Message
+		if err := observer.ReadJSON(&end); err != nil || end.Type != MessageTypeHistoryEnd {
+			t.Fatalf("%s: expected history_end, got %+v (err: %v)", mode, end, err)
+		}
+		if err := observer.ReadJSON(&size); err != nil || size.Type != MessageTypeResize {
+			t.Fatalf("%s: expected initial resize, got %+v (err: %v)", mode, size, err)
+		}
+
+		// Input is rejected with a structured error
+		for _, msg := range []Message{
+			{Type: MessageTypeStdin, Data: "observer-input\n"},
+			{Type: MessageTypeCommand, Data: "observer-command\r"},
+			{Type: MessageTypeResize, Rows: 10, Cols: 10},
+			{Type: MessageTypeEventResponse, Payload: json.RawMessage(`{"kind":"question","response":"y"}`)},
+			{Type: MessageTypeInputAction, Payload: json.RawMessage(`{"type":"key","content":"ctrl+c"}`)},
+			{Type: MessageTypeDismiss},
+		} {
+			if err := observer.WriteJSON(msg); err != nil {
+				t.Fatalf("failed to write message: %v", err)
+			}
+			var reply Message
+			if err := observer.ReadJSON(&reply); err != nil {
+				t.Fatalf("failed to read reply: %v", err)
+			}
+			var payload map[string]string
+			json.Unmarshal(reply.Payload, &payload)
+			if reply.Type != MessageTypeError || payload["code"] != ErrorCodeReadOnly || payload["type"] != string(msg.Type) {
+				t.Errorf("%s: expected READ_ONLY error for %s, got %+v", mode, msg.Type, reply)
+			}
+		}
+
+		// Pings are still answered
+		if err := observer.WriteJSON(Message{Type: MessageTypePing}); err != nil {
+			t.Fatalf("failed to write ping: %v", err)
+		}
+		var pong Message
+		if err := observer.ReadJSON(&pong); err != nil || pong.Type != MessageTypePong {
+			t.Fatalf("%s: expected pong, got %+v (err: %v)", mode, pong, err)
+		}
+	}
+
+	// A writable client's input still reaches the PTY
+	writer, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial writer: %v", err)
+	}
+	defer writer.Close()
+	if err := writer.WriteJSON(Message{Type: MessageTypeStdin, Data: "writer-input\n"}); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+
+	hub := hubManager.Get(sessionID)
+	for i := 0; i < 100 && hub.ClientCount() < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.ViewerCount() != 3 || hub.WriterCount() != 1 {
+		t.Errorf("expected 3 viewers and 1 writer, got %d and %d", hub.ViewerCount(), hub.WriterCount())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && !strings.Contains(string(ptyProcess.GetHistory()), "writer-input") {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	history := string(ptyProcess.GetHistory())
+	if !strings.Contains(history, "writer-input") {
+		t.Errorf("expected writer input to reach the PTY, got %q", history)
+	}
+	if strings.Contains(history, "observer") {
+		t.Errorf("read-only client input reached the PTY: %q", history)
+	}
+}
+
+// TestBackpressureDropOldest tests that a slow client keeps the newest output
+// and never loses control messages
+func TestBackpressureDropOldest(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	hubManager.SetBackpressure(BackpressureDropOldest, 0)
+
+	hub := hubManager.GetOrCreate("drop-session")
+	client := NewClient(hub, nil, "drop-session", false)
+	hub.Register(client)
+
+	numFrames := 2000
+	last := fmt.Sprintf("frame-%d", numFrames-1)
+
+	// Drain slowly while the hub floods the client
+	received := make(chan Message, numFrames)
+	go func() {
+		for frame := range client.SendChan() {
+			var msg Message
+			json.Unmarshal(frame.Data, &msg)
+			received <- msg
+			if msg.Data == last {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	for i := 0; i < numFrames; i++ {
+		hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: fmt.Sprintf("frame-%d", i)})
+		if i%100 == 0 {
+			hub.BroadcastMessage(&Message{Type: MessageTypeStatus, State: "running"})
+		}
+	}
+
+	var got Message
+	statuses := 0
+	timeout := time.After(5 * time.Second)
+	for got.Data != last {
+		select {
+		case got = <-received:
+			if got.Type == MessageTypeStatus {
+				statuses++
+			}
+		case <-timeout:
+			t.Fatalf("newest frame never arrived, last received %q", got.Data)
+		}
+	}
+
+	if client.IsClosed() {
+		t.Error("expected client to stay connected under drop-oldest")
+	}
+	if statuses != numFrames/100 {
+		t.Errorf("expected %d status messages, got %d", numFrames/100, statuses)
+	}
+	stats := client.Stats()
+	if stats.Dropped == 0 {
+		t.Error("expected dropped frames to be counted")
+	}
+	if stats.DroppedBytes == 0 || client.DroppedBytes() != stats.DroppedBytes {
+		t.Errorf("expected dropped bytes to be counted, got %d", stats.DroppedBytes)
+	}
+	if n := client.takeUnreportedDrops(); n == 0 {
+		t.Error("expected unreported drops")
+	}
+	if n := client.takeUnreportedDrops(); n != 0 {
+		t.Errorf("expected drops to be reported once, got %d", n)
+	}
+}
+
+// TestDropOldestControlOverflow tests that a queue full of control messages
+// disconnects instead of dropping one
+func TestDropOldestControlOverflow(t *testing.T) {
+	hub := NewHub("control-session")
+	defer hub.Close()
+	hub.SetBackpressure(BackpressureDropOldest, 0)
+
+	client := NewClient(hub, nil, "control-session", false)
+	hub.Register(client)
+
+	for i := 0; i < cap(client.send); i++ {
+		hub.BroadcastMessage(&Message{Type: MessageTypeStatus, State: "running"})
+	}
+
+	// New output is dropped rather than displacing a control message
+	hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "output"})
+	if client.IsClosed() || client.Stats().Dropped != 1 {
+		t.Fatalf("expected stdout to be dropped, closed=%v stats=%+v", client.IsClosed(), client.Stats())
+	}
+
+	hub.BroadcastMessage(&Message{Type: MessageTypeError, Data: "boom"})
+	if !client.IsClosed() {
+		t.Error("expected client to be disconnected when a control message cannot be queued")
+	}
+}
+
+// TestBackpressureDisconnect tests the disconnect and block policies on a stalled client
+func TestBackpressureDisconnect(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy BackpressurePolicy
+	}{
+		{"disconnect", BackpressureDisconnect},
+		{"block then disconnect", BackpressureBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub("stalled-session")
+			defer hub.Close()
+			hub.SetBackpressure(tt.policy, 10*time.Millisecond)
+
+			client := NewClient(hub, nil, "stalled-session", false)
+			hub.Register(client)
+
+			for i := 0; i < cap(client.send)+1; i++ {
+				hub.Broadcast([]byte("data"))
+			}
+
+			if !client.IsClosed() {
+				t.Error("expected stalled client to be disconnected")
+			}
+		})
+	}
+}
+
+// TestClientSendAfterClose tests that sending to a closed client is a no-op
+func TestClientSendAfterClose(t *testing.T) {
+	client := NewClient(nil, nil, "closed-client", false)
+	if !client.Send([]byte("before")) {
+		t.Error("Expected send to an open client to succeed")
+	}
+
+	client.Close()
+	client.Close()
+	client.CloseWithCode(websocket.CloseGoingAway, "again")
+
+	if client.Send([]byte("after")) {
+		t.Error("Expected send to a closed client to report false")
+	}
+	if client.SendFrame(Frame{Kind: FrameBinary, Data: []byte("after")}) {
+		t.Error("Expected SendFrame to a closed client to report false")
+	}
+
+	// The queued frame is still delivered before the channel closes
+	if frame, ok := <-client.SendChan(); !ok || string(frame.Data) != "before" {
+		t.Errorf("Expected queued frame 'before', got %q (ok=%v)", frame.Data, ok)
+	}
+	if _, ok := <-client.SendChan(); ok {
+		t.Error("Expected send channel to be closed")
+	}
+}
+
+// TestCloseWakesBlockedSender tests that closing a client does not wait out
+// the block timeout of a sender stuck on its full queue
+func TestCloseWakesBlockedSender(t *testing.T) {
+	hub := NewHub("blocked-session")
+	defer hub.Close()
+	hub.SetBackpressure(BackpressureBlock, time.Minute)
+
+	client := NewClient(hub, nil, "blocked-session", false)
+	hub.Register(client)
+	for i := 0; i < cap(client.send); i++ {
+		client.Send([]byte("fill"))
+	}
+
+	sent := make(chan bool)
+	go func() {
+		sent <- client.Send([]byte("blocked"))
+	}()
+
+	// Let the sender block on the full queue
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		hub.Unregister(client)
+		close(closed)
+	}()
+
+	select {
+	case ok := <-sent:
+		if ok {
+			t.Error("Expected blocked send to report false after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Blocked sender was not woken by close")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Unregister did not return")
+	}
+}
+
+// TestBlockedBroadcastReleasesHub tests that a broadcast waiting for a
+// slow client under BackpressureBlock does not hold the hub, so clients can
+// still register and unregister
+func TestBlockedBroadcastReleasesHub(t *testing.T) {
+	hub := NewHub("blocked-broadcast")
+	defer hub.Close()
+	hub.SetBackpressure(BackpressureBlock, time.Minute)
+
+	slow := NewClient(hub, nil, "blocked-broadcast", false)
+	hub.Register(slow)
+	for i := 0; i < cap(slow.send); i++ {
+		slow.Send([]byte("fill"))
+	}
+
+	broadcast := make(chan error)
+	go func() {
+		broadcast <- hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "blocked"})
+	}()
+
+	// Let the broadcast block on the full queue
+	time.Sleep(20 * time.Millisecond)
+
+	registered := make(chan error)
+	go func() {
+		registered <- hub.Register(NewClient(hub, nil, "blocked-broadcast", false))
+	}()
+	select {
+	case err := <-registered:
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Register waited for the blocked broadcast")
+	}
+	if n := hub.ClientCount(); n != 2 {
+		t.Errorf("Expected 2 clients, got %d", n)
+	}
+
+	// Unregistering the slow client wakes the broadcast
+	hub.Unregister(slow)
+	select {
+	case err := <-broadcast:
+		if err != nil {
+			t.Errorf("Expected the broadcast to succeed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Blocked broadcast was not woken by unregister")
+	}
+}
+
+// TestHubConcurrentRegisterUnregister stresses registering, unregistering,
+// closing and broadcasting clients concurrently; run with -race
+func TestHubConcurrentRegisterUnregister(t *testing.T) {
+	const iterations = 2000
+
+	hub := NewHub("stress-session")
+	defer hub.Close()
+
+	var clients sync.WaitGroup
+	for i := 0; i < iterations; i++ {
+		client := NewClient(hub, nil, "stress-session", false)
+		if err := hub.Register(client); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+
+		// Drain the queue like a write pump until the channel closes
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			for range client.SendChan() {
+			}
+		}()
+
+		// Broadcast and close from several goroutines at once
+		clients.Add(4)
+		go func() {
+			defer clients.Done()
+			hub.Broadcast([]byte("data"))
+			hub.BroadcastMessage(&Message{Type: MessageTypeStdout, Data: "msg"})
+		}()
+		go func() {
+			defer clients.Done()
+			hub.Unregister(client)
+		}()
+		go func() {
+			defer clients.Done()
+			client.Close()
+		}()
+		go func() {
+			defer clients.Done()
+			client.Send([]byte("late"))
+		}()
+	}
+
+	clients.Wait()
+
+	if count := hub.ClientCount(); count != 0 {
+		t.Errorf("Expected 0 clients after stress, got %d", count)
+	}
+}
+
+// TestParseBackpressurePolicy tests round-tripping policy names
+func TestParseBackpressurePolicy(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{BackpressureDisconnect, BackpressureBlock, BackpressureDropOldest} {
+		parsed, err := ParseBackpressurePolicy(policy.String())
+		if err != nil || parsed != policy {
+			t.Errorf("expected %s, got %s (err: %v)", policy, parsed, err)
+		}
+	}
+	if _, err := ParseBackpressurePolicy("bogus"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+// Helper function
+func receiveWithTimeoutTest(t *testing.T, client *Client, timeout time.Duration) []byte {
+	t.Helper()
+	select {
+	case frame := <-client.SendChan():
+		return frame.Data
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// noEventsDriver parses like ClaudeDriver but reports no smart event support.
+type noEventsDriver struct {
+	*driver.ClaudeDriver
+}
+
+func (d noEventsDriver) Capabilities() driver.DriverCapabilities {
+	return driver.DriverCapabilities{}
+}
+
+// TestBroadcastOutputSkipsUnsupportedSmartEvents tests that smart events are
+// only broadcast for drivers that report support for them
+func TestBroadcastOutputSkipsUnsupportedSmartEvents(t *testing.T) {
+	tests := []struct {
+		name         string
+		driver       driver.AgentDriver
+		expectEvents bool
+	}{
+		{"claude driver", driver.NewClaudeDriver(), true},
+		{"no smart events", noEventsDriver{driver.NewClaudeDriver()}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hubManager := NewHubManager()
+			defer hubManager.Close()
+			handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+
+			sessionID := "capabilities-session"
+			handler.SetSessionDriver(sessionID, tt.driver)
+			hub := hubManager.GetOrCreate(sessionID)
+			client := NewClient(hub, nil, sessionID, false)
+			hub.Register(client)
+
+			if err := handler.BroadcastOutput(sessionID, []byte("Continue? (y/n)")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			events := 0
+			for {
+				received := receiveWithTimeoutTest(t, client, 50*time.Millisecond)
+				if received == nil {
+					break
+				}
+				var parsed Message
+				if err := json.Unmarshal(received, &parsed); err != nil {
+					t.Fatalf("received invalid JSON: %v", err)
+				}
+				if parsed.Type == MessageTypeSmartEvent {
+					events++
+				}
+			}
+			if (events > 0) != tt.expectEvents {
+				t.Errorf("expected smart events: %v, got %d", tt.expectEvents, events)
+			}
+		})
+	}
+}
+
+// fakePTYWriter captures the bytes written to a PTY.
+type fakePTYWriter struct {
+	written []byte
+}
+
+func (w *fakePTYWriter) Write(data []byte) error {
+	w.written = append(w.written, data...)
+	return nil
+}
+
+// TestHandleEventResponse tests answering smart events with event_response messages
+func TestHandleEventResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		expected  string
+		expectErr bool
+	}{
+		{"confirm once", `{"kind":"claude_confirm","response":"yes"}`, "1", false},
+		{"confirm all", `{"kind":"claude_confirm","response":"all"}`, "2", false},
+		{"confirm cancel", `{"kind":"claude_confirm","response":"esc"}`, driver.KeyEscape, false},
+		{"question", `{"kind":"question","response":"yes","options":["yes","no"]}`, "yes" + driver.KeyEnter, false},
+		{"unknown kind", `{"kind":"launch_missiles","response":"yes"}`, "", true},
+		{"missing response", `{"kind":"question"}`, "", true},
+		{"invalid payload", `"yes"`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, client := newCoalescingHandler(t, "event-response", 0, 0)
+			handler.SetSessionDriver("event-response", driver.NewClaudeDriver())
+			w := &fakePTYWriter{}
+
+			msg := &Message{Type: MessageTypeEventResponse, Payload: json.RawMessage(tt.payload)}
+			handler.handleEventResponse(client, msg, w)
+
+			if string(w.written) != tt.expected {
+				t.Errorf("Expected %q written to the PTY, got %q", tt.expected, w.written)
+			}
+			reply := receiveMessage(t, client, 20*time.Millisecond)
+			if !tt.expectErr {
+				if reply != nil {
+					t.Errorf("Expected no reply, got %+v", reply)
+				}
+				return
+			}
+			var payload map[string]string
+			if reply != nil {
+				json.Unmarshal(reply.Payload, &payload)
+			}
+			if reply == nil || reply.Type != MessageTypeError || payload["code"] != ErrorCodeInvalidEventResponse {
+				t.Errorf("Expected %s error, got %+v", ErrorCodeInvalidEventResponse, reply)
+			}
+		})
+	}
+}
+
+// TestEventResponseClaudeConfirmFlow tests that a broadcast claude_confirm
+// event can be answered end to end
+func TestEventResponseClaudeConfirmFlow(t *testing.T) {
+	sessionID := "confirm-flow"
+	handler, client := newCoalescingHandler(t, sessionID, 0, 0)
+	handler.SetSessionDriver(sessionID, driver.NewClaudeDriver())
+
+	handler.BroadcastOutput(sessionID, []byte("Do you want to create hello.txt?\n❯ 1. Yes\n  2. Yes, allow all edits\n"))
+
+	var event driver.SmartEvent
+	for event.Kind == "" {
+		msg := receiveMessage(t, client, 100*time.Millisecond)
+		if msg == nil {
+			t.Fatal("Expected a claude_confirm smart event")
+		}
+		if msg.Type == MessageTypeSmartEvent {
+			json.Unmarshal(msg.Payload, &event)
+		}
+	}
+	if event.Kind != "claude_confirm" {
+		t.Fatalf("Expected claude_confirm event, got %+v", event)
+	}
+
+	// The client answers with the event's kind
+	payload, _ := json.Marshal(EventResponse{Kind: event.Kind, Response: "all"})
+	w := &fakePTYWriter{}
+	handler.handleEventResponse(client, &Message{Type: MessageTypeEventResponse, Payload: payload}, w)
+
+	if string(w.written) != "2" {
+		t.Errorf("Expected \"2\" written to the PTY, got %q", w.written)
+	}
+}
+
+// TestEventResponseUnsupportedDriver tests that event responses are refused
+// for drivers that cannot map them to input, and nothing is written
+func TestEventResponseUnsupportedDriver(t *testing.T) {
+	handler, client := newCoalescingHandler(t, "unsupported-response", 0, 0)
+	handler.SetSessionDriver("unsupported-response", noEventsDriver{driver.NewClaudeDriver()})
+	w := &fakePTYWriter{}
+
+	msg := &Message{Type: MessageTypeEventResponse, Payload: json.RawMessage(`{"kind":"question","response":"yes"}`)}
+	handler.handleEventResponse(client, msg, w)
+
+	if len(w.written) != 0 {
+		t.Errorf("Expected nothing written to the PTY, got %q", w.written)
+	}
+	expectError(t, client, ErrorCodeInvalidEventResponse, MessageTypeEventResponse)
+}
+
+// TestHandleInputAction tests that input_action messages are formatted by the session driver
+func TestHandleInputAction(t *testing.T) {
+	keys := []struct {
+		name     string
+		expected string
+	}{
+		{"enter", "\r"},
+		{"return", "\r"},
+		{"escape", "\x1b"},
+		{"esc", "\x1b"},
+		{"ctrl+c", "\x03"},
+		{"ctrlc", "\x03"},
+		{"ctrl+d", "\x04"},
+		{"ctrld", "\x04"},
+		{"backspace", "\x7f"},
+		{"bs", "\x7f"},
+		{"tab", "\t"},
+		{"up", "\x1b[A"},
+		{"arrowup", "\x1b[A"},
+		{"down", "\x1b[B"},
+		{"arrowdown", "\x1b[B"},
+		{"left", "\x1b[D"},
+		{"arrowleft", "\x1b[D"},
+		{"right", "\x1b[C"},
+		{"arrowright", "\x1b[C"},
+		{"ESCAPE", "\x1b"},
+		{"f13", "f13"},
+		{"ctrl+z", "ctrl+z"},
+	}
+
+	for _, d := range []driver.AgentDriver{driver.NewClaudeDriver(), driver.NewGenericDriver()} {
+		for _, key := range keys {
+			t.Run(d.Name()+"/"+key.name, func(t *testing.T) {
+				handler, client := newCoalescingHandler(t, "input-action", 0, 0)
+				handler.SetSessionDriver("input-action", d)
+				w := &fakePTYWriter{}
+
+				payload, _ := json.Marshal(driver.InputAction{Type: "key", Content: key.name})
+				handler.handleInputAction(client, &Message{Type: MessageTypeInputAction, Payload: payload}, w)
+
+				if string(w.written) != key.expected {
+					t.Errorf("Expected %q written to the PTY, got %q", key.expected, w.written)
+				}
+				if reply := receiveMessage(t, client, 10*time.Millisecond); reply != nil {
+					t.Errorf("Expected no reply, got %+v", reply)
+				}
+			})
+		}
+	}
+}
+
+// TestHandleInputActionTypes tests action types other than keys and invalid actions
+func TestHandleInputActionTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		expected  string
+		expectErr bool
+	}{
+		{"text", `{"type":"text","content":"hello"}`, "hello", false},
+		{"command", `{"type":"command","content":"/help"}`, "/help\r", false},
+		{"confirm", `{"type":"confirm","content":"all"}`, "2", false},
+		{"cancel", `{"type":"cancel"}`, "\x1b", false},
+		{"interrupt", `{"type":"interrupt"}`, "\x03", false},
+		{"empty text", `{"type":"text","content":""}`, "", false},
+		{"unknown type", `{"type":"macro","content":"rm -rf /"}`, "", true},
+		{"missing type", `{"content":"esc"}`, "", true},
+		{"invalid payload", `["key","esc"]`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, client := newCoalescingHandler(t, "input-action-types", 0, 0)
+			handler.SetSessionDriver("input-action-types", driver.NewClaudeDriver())
+			w := &fakePTYWriter{}
+
+			msg := &Message{Type: MessageTypeInputAction, Payload: json.RawMessage(tt.payload)}
+			handler.handleInputAction(client, msg, w)
+
+			if string(w.written) != tt.expected {
+				t.Errorf("Expected %q written to the PTY, got %q", tt.expected, w.written)
+			}
+			reply := receiveMessage(t, client, 20*time.Millisecond)
+			if !tt.expectErr {
+				if reply != nil {
+					t.Errorf("Expected no reply, got %+v", reply)
+				}
+				return
+			}
+			var payload map[string]string
+			if reply != nil {
+				json.Unmarshal(reply.Payload, &payload)
+			}
+			if reply == nil || reply.Type != MessageTypeError || payload["code"] != ErrorCodeInvalidInputAction {
+				t.Errorf("Expected %s error, got %+v", ErrorCodeInvalidInputAction, reply)
+			}
+		})
+	}
+}
+
+// writeRecording writes an asciinema recording with the given event lines.
+func writeRecording(t *testing.T, events ...string) string {
+	t.Helper()
+	lines := append([]string{`{"version":2,"width":80,"height":24,"timestamp":1700000000}`}, events...)
+	logPath := filepath.Join(t.TempDir(), "replay.cast")
+	if err := os.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write recording: %v", err)
+	}
+	return logPath
+}
+
+// TestHandleReplay tests replaying a recording with its timing, speed and resizes
+func TestHandleReplay(t *testing.T) {
+	logPath := writeRecording(t,
+		`[0.1,"o","$ "]`,
+		`[0.2,"i","ls\r"]`,
+		`[0.3,"o","ls\r\nfile.txt\r\n"]`,
+		`[0.3,"r","120x40"]`,
+		`[0.4,"m","listed"]`,
+		`[0.5,"o","$ "]`,
+	)
+
+	tests := []struct {
+		name    string
+		speed   float64
+		minTime time.Duration
+	}{
+		{"recorded speed", 1, 500 * time.Millisecond},
+		{"double speed", 2, 250 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hubManager := NewHubManager()
+			defer hubManager.Close()
+			handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handler.HandleReplay(w, r, "replay-session", logPath, ReplayOptions{Speed: tt.speed})
+			}))
+			defer server.Close()
+
+			start := time.Now()
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			expected := []Message{
+				{Type: MessageTypeResize, Cols: 80, Rows: 24},
+				{Type: MessageTypeStdout, Data: "$ "},
+				{Type: MessageTypeStdout, Data: "ls\r\nfile.txt\r\n"},
+				{Type: MessageTypeResize, Cols: 120, Rows: 40},
+				{Type: MessageTypeMarker, Data: "listed"},
+				{Type: MessageTypeStdout, Data: "$ "},
+				{Type: MessageTypeStatus, State: StateReplayComplete},
+			}
+			for i, e := range expected {
+				var msg Message
+				if err := conn.ReadJSON(&msg); err != nil {
+					t.Fatalf("message %d: failed to read: %v", i, err)
+				}
+				if msg.Type != e.Type || msg.Data != e.Data || msg.Rows != e.Rows || msg.Cols != e.Cols || msg.State != e.State {
+					t.Errorf("message %d: expected %+v, got %+v", i, e, msg)
+				}
+			}
+			elapsed := time.Since(start)
+			if elapsed < tt.minTime || elapsed > tt.minTime+time.Second {
+				t.Errorf("expected replay to take about %v, took %v", tt.minTime, elapsed)
+			}
+
+			_, _, err = conn.ReadMessage()
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Errorf("expected normal close, got %v", err)
+			}
+		})
+	}
+}
+
+// TestHandleReplayClientDisconnect tests that a replay stops when the client goes away
+func TestHandleReplayClientDisconnect(t *testing.T) {
+	logPath := writeRecording(t,
+		`[0.0,"o","first"]`,
+		`[60.0,"o","a minute later"]`,
+	)
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+	returned := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleReplay(w, r, "replay-session", logPath, ReplayOptions{})
+		close(returned)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range []MessageType{MessageTypeResize, MessageTypeStdout} {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != want {
+			t.Fatalf("expected %s, got %+v (err: %v)", want, msg, err)
+		}
+	}
+	conn.Close()
+
+	select {
+	case <-returned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("replay did not stop after the client disconnected")
+	}
+}
+
+// TestHandleReplayMissingRecording tests that a missing recording is a plain 404
+func TestHandleReplayMissingRecording(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleReplay(w, r, "replay-session", filepath.Join(t.TempDir(), "missing.cast"), ReplayOptions{})
+	}))
+	defer server.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err == nil {
+		t.Fatal("expected dial to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %+v", resp)
+	}
+}
+
+// TestHandleDismiss tests that a dismiss message sends Enter to the process
+// and tells every client
+func TestHandleDismiss(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-dismiss-session"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:     &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		InputDelays: pty.InputDelays{Dismiss: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	hub := hubManager.GetOrCreate(sessionID)
+	sender := NewClient(hub, nil, sessionID, false)
+	other := NewClient(hub, nil, sessionID, false)
+	hub.Register(sender)
+	hub.Register(other)
+
+	// cat only echoes the line back once it receives Enter
+	if err := ptyProcess.Write([]byte("dismiss-me")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	handler.handleDismiss(sender, ptyProcess)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for strings.Count(string(ptyProcess.GetHistory()), "dismiss-me") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected cat to echo the line after Enter, got %q", ptyProcess.GetHistory())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i, client := range []*Client{sender, other} {
+		msg := receiveMessage(t, client, 100*time.Millisecond)
+		if msg == nil || msg.Type != MessageTypeDismissed {
+			t.Errorf("client %d: expected dismissed message, got %+v", i, msg)
+		}
+	}
+
+	// Once the process has exited, dismissing is refused
+	ptyProcess.Close()
+	handler.handleDismiss(sender, ptyProcess)
+
+	reply := receiveMessage(t, sender, 100*time.Millisecond)
+	var payload map[string]string
+	if reply != nil {
+		json.Unmarshal(reply.Payload, &payload)
+	}
+	if reply == nil || reply.Type != MessageTypeError || payload["code"] != ErrorCodeProcessExited {
+		t.Errorf("expected %s error, got %+v", ErrorCodeProcessExited, reply)
+	}
+	if msg := receiveMessage(t, other, 50*time.Millisecond); msg != nil {
+		t.Errorf("expected no broadcast after a failed dismiss, got %+v", msg)
+	}
+}
+
+// failingDismisser fails to dismiss output with err.
+type failingDismisser struct {
+	err error
+}
+
+func (d failingDismisser) DismissOutput() error {
+	return d.err
+}
+
+// TestHandleDismissQueued tests that a dismiss message is handled off the
+// read pump, and that failures are reported with the write error's code
+func TestHandleDismissQueued(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-dismiss-queued"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session:     &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+		InputDelays: pty.InputDelays{Dismiss: 300 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	start := time.Now()
+	handler.handleMessage(client, &Message{Type: MessageTypeDismiss}, ptyProcess)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected dismiss not to block the read pump, took %v", elapsed)
+	}
+	if msg := receiveMessage(t, client, 2*time.Second); msg == nil || msg.Type != MessageTypeDismissed {
+		t.Fatalf("Expected dismissed message, got %+v", msg)
+	}
+
+	handler.handleDismiss(client, failingDismisser{err: errors.New("write failed")})
+	expectError(t, client, ErrorCodePTYWriteFailed, MessageTypeDismiss)
+}
+
+// fakeMarkerAdder records the markers added to a recording.
+type fakeMarkerAdder struct {
+	labels []string
+	err    error
+}
+
+func (m *fakeMarkerAdder) AddMarker(label string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.labels = append(m.labels, label)
+	return nil
+}
+
+// TestHandleMarker tests adding markers to the recording from clients
+func TestHandleMarker(t *testing.T) {
+	tests := []struct {
+		name     string
+		label    string
+		err      error
+		expected []string
+		code     string
+	}{
+		{"marker added", "deploy", nil, []string{"deploy"}, ""},
+		{"label required", "", nil, nil, ErrorCodeInvalidMessage},
+		{"not recorded", "deploy", pty.ErrNotRecorded, nil, ErrorCodeMarkerFailed},
+		{"process exited", "deploy", pty.ErrProcessClosed, nil, ErrorCodeProcessExited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hubManager := NewHubManager()
+			defer hubManager.Close()
+			handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+			hub := hubManager.GetOrCreate("test-marker")
+			client := NewClient(hub, nil, "test-marker", false)
+			hub.Register(client)
+
+			m := &fakeMarkerAdder{err: tt.err}
+			handler.handleMarker(client, &Message{Type: MessageTypeMarker, Data: tt.label}, m)
+
+			if strings.Join(m.labels, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected markers %v, got %v", tt.expected, m.labels)
+			}
+			if tt.code == "" {
+				if msg := receiveMessage(t, client, 20*time.Millisecond); msg != nil {
+					t.Errorf("Expected no reply, got %+v", msg)
+				}
+				return
+			}
+			expectError(t, client, tt.code, MessageTypeMarker)
+		})
+	}
+
+	// Read-only clients cannot add markers
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	hub := hubManager.GetOrCreate("test-marker-readonly")
+	hub.SetOnMessage(func(client *Client, msg *Message) {
+		t.Errorf("Expected the marker not to reach the handler, got %+v", msg)
+	})
+	observer := NewClient(hub, nil, "test-marker-readonly", true)
+	hub.Register(observer)
+	hub.HandleMessage(observer, &Message{Type: MessageTypeMarker, Data: "deploy"})
+	expectError(t, observer, ErrorCodeReadOnly, MessageTypeMarker)
+}
+
+// TestHandleFocus tests that focus and blur messages write the focus
+// tracking reports to the PTY
+func TestHandleFocus(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+	hub := hubManager.GetOrCreate("test-focus")
+	client := NewClient(hub, nil, "test-focus", false)
+	hub.Register(client)
+
+	w := &recordingPTY{}
+	handler.handleFocus(client, &Message{Type: MessageTypeFocus}, w)
+	handler.handleFocus(client, &Message{Type: MessageTypeBlur}, w)
+	handler.handleFocus(client, &Message{Type: MessageTypeFocus}, w)
+	if got := w.written(); got != "\x1b[I\x1b[O\x1b[I" {
+		t.Errorf("Expected focus in, out and in reports, got %q", got)
+	}
+	if msg := receiveMessage(t, client, 20*time.Millisecond); msg != nil {
+		t.Errorf("Expected no reply, got %+v", msg)
+	}
+
+	handler.handleFocus(client, &Message{Type: MessageTypeBlur}, &failingPTY{err: pty.ErrProcessClosed})
+	expectError(t, client, ErrorCodeProcessExited, MessageTypeBlur)
+
+	// Read-only clients cannot write focus reports
+	hub.SetOnMessage(func(client *Client, msg *Message) {
+		t.Errorf("Expected the focus change not to reach the handler, got %+v", msg)
+	})
+	observer := NewClient(hub, nil, "test-focus", true)
+	hub.Register(observer)
+	hub.HandleMessage(observer, &Message{Type: MessageTypeFocus})
+	expectError(t, observer, ErrorCodeReadOnly, MessageTypeFocus)
+}
+
+// fakePTYResizer records the last size a PTY was resized to.
+type fakePTYResizer struct {
+	rows, cols uint16
+}
+
+func (r *fakePTYResizer) Resize(rows, cols uint16) error {
+	r.rows, r.cols = rows, cols
+	return nil
+}
+
+// TestHandleResizeBroadcast tests that a resize is rebroadcast to every client but the sender
+func TestHandleResizeBroadcast(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+
+	sessionID := "test-resize-broadcast"
+	hub := hubManager.GetOrCreate(sessionID)
+	clients := []*Client{
+		NewClient(hub, nil, sessionID, false),
+		NewClient(hub, nil, sessionID, false),
+		NewClient(hub, nil, sessionID, false),
+	}
+	for _, client := range clients {
+		hub.Register(client)
+	}
+
+	resizer := &fakePTYResizer{}
+	handler.handleResize(clients[0], &Message{Type: MessageTypeResize, Rows: 40, Cols: 120}, resizer)
+
+	if resizer.rows != 40 || resizer.cols != 120 {
+		t.Errorf("Expected PTY resized to 40x120, got %dx%d", resizer.rows, resizer.cols)
+	}
+	if msg := receiveMessage(t, clients[0], 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no rebroadcast to the sender, got %+v", msg)
+	}
+	for i, client := range clients[1:] {
+		msg := receiveMessage(t, client, 100*time.Millisecond)
+		if msg == nil || msg.Type != MessageTypeResize || msg.Rows != 40 || msg.Cols != 120 {
+			t.Errorf("client %d: expected 40x120 resize, got %+v", i+1, msg)
+		}
+	}
+
+	// Invalid sizes are ignored and not rebroadcast
+	handler.handleResize(clients[0], &Message{Type: MessageTypeResize, Rows: 0, Cols: 80}, resizer)
+	if msg := receiveMessage(t, clients[1], 50*time.Millisecond); msg != nil {
+		t.Errorf("Expected no rebroadcast of an invalid size, got %+v", msg)
+	}
+}
+
+// TestConnectSendsCurrentSize tests that a newly attached client receives the PTY size after history
+func TestConnectSendsCurrentSize(t *testing.T) {
+	ptyManager := pty.NewManager(t.TempDir())
+	defer ptyManager.Close()
+
+	sessionID := "test-connect-size"
+	ptyProcess, err := ptyManager.Spawn(context.Background(), pty.SpawnOptions{
+		Session: &model.Session{ID: sessionID, UserID: "test-user", Command: "cat"},
+	})
+	if err != nil {
+		t.Fatalf("failed to spawn PTY: %v", err)
+	}
+	if err := ptyProcess.Resize(33, 101); err != nil {
+		t.Fatalf("failed to resize PTY: %v", err)
+	}
+	ptyProcess.RingBuffer.Write([]byte("earlier output"))
+
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, ptyManager, driver.NewGenericDriver())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.HandleConnection(w, r, sessionID, "test-user")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// The status snapshot already carries the size
+	if status := readStatusSnapshot(t, conn); status.Rows != 33 || status.Cols != 101 {
+		t.Errorf("expected 33x101 in the status snapshot, got %dx%d", status.Rows, status.Cols)
+	}
+
+	var history, end, size Message
+	if err := conn.ReadJSON(&history); err != nil || history.Type != MessageTypeHistory {
+		t.Fatalf("expected history after the status snapshot, got %+v (err: %v)", history, err)
+	}
+	if err := conn.ReadJSON(&end); err != nil || end.Type != MessageTypeHistoryEnd {
+		t.Fatalf("expected history_end after history, got %+v (err: %v)", end, err)
+	}
+	if err := conn.ReadJSON(&size); err != nil {
+		t.Fatalf("failed to read size: %v", err)
+	}
+	if size.Type != MessageTypeResize || size.Rows != 33 || size.Cols != 101 {
+		t.Errorf("Expected 33x101 resize after history, got %+v", size)
+	}
+}
+
+// TestBroadcastOutputSmartEventData tests that SmartEvent data round-trips
+// through smart_event messages and is omitted for events without it
+func TestBroadcastOutputSmartEventData(t *testing.T) {
+	hubManager := NewHubManager()
+	defer hubManager.Close()
+	handler := NewHandler(hubManager, nil, driver.NewGenericDriver())
+
+	sessionID := "event-data-session"
+	handler.SetSessionDriver(sessionID, driver.NewClaudeDriver())
+	hub := hubManager.GetOrCreate(sessionID)
+	client := NewClient(hub, nil, sessionID, false)
+	hub.Register(client)
+
+	if err := handler.BroadcastOutput(sessionID, []byte("Total cost: $0.50\r\nContinue? (y/n)")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payloads := map[string]json.RawMessage{}
+	for {
+		msg := receiveMessage(t, client, 50*time.Millisecond)
+		if msg == nil {
+			break
+		}
+		if msg.Type != MessageTypeSmartEvent {
+			continue
+		}
+		var event driver.SmartEvent
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatalf("invalid smart event payload: %v", err)
+		}
+		payloads[event.Kind] = msg.Payload
+	}
+
+	raw, ok := payloads["usage"]
+	if !ok {
+		t.Fatal("Expected a usage smart event")
+	}
+	var usage driver.SmartEvent
+	json.Unmarshal(raw, &usage)
+	if usage.Data["cost_usd"] != "0.50" {
+		t.Errorf("Expected cost_usd 0.50 in usage data, got %v", usage.Data)
+	}
+
+	raw, ok = payloads["question"]
+	if !ok {
+		t.Fatal("Expected a question smart event")
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal(raw, &fields)
+	if _, ok := fields["data"]; ok {
+		t.Errorf("Expected no data field on events without data, got %s", raw)
 	}
 }
@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 	"testing"
@@ -103,7 +104,7 @@ func TestWebSocketBidirectionalCommunicationProperty(t *testing.T) {
 					defer wg.Done()
 					select {
 					case msg := <-mc.client.SendChan():
-						received[idx] = string(msg)
+						received[idx] = string(msg.Data)
 					case <-time.After(100 * time.Millisecond):
 						received[idx] = ""
 					}
@@ -194,7 +195,7 @@ func TestANSISequencePassthroughProperty(t *testing.T) {
 			data := prefix + ansi + suffix
 			drv := driver.NewGenericDriver()
 
-			result, err := drv.Parse([]byte(data))
+			result, err := drv.Parse(context.Background(), []byte(data))
 			if err != nil {
 				return false
 			}
@@ -212,7 +213,7 @@ func TestANSISequencePassthroughProperty(t *testing.T) {
 		func(data []byte) bool {
 			drv := driver.NewGenericDriver()
 
-			result, err := drv.Parse(data)
+			result, err := drv.Parse(context.Background(), data)
 			if err != nil {
 				return false
 			}
@@ -367,7 +368,7 @@ func newMockClient(hub *Hub, sessionID string) *mockClient {
 		hub:       hub,
 		conn:      nil, // No real connection for testing
 		sessionID: sessionID,
-		send:      make(chan []byte, 256),
+		send:      make(chan Frame, 256),
 	}
 	return &mockClient{client: client}
 }
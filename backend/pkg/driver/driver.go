@@ -6,11 +6,22 @@ import (
 
 // Re-export types from internal/driver for external use
 type (
-	AgentDriver = driver.AgentDriver
-	SmartEvent  = driver.SmartEvent
-	ParseResult = driver.ParseResult
-	Message     = driver.Message
-	InputAction = driver.InputAction
+	AgentDriver        = driver.AgentDriver
+	DriverCapabilities = driver.DriverCapabilities
+	SmartEvent         = driver.SmartEvent
+	ParseResult        = driver.ParseResult
+	Message            = driver.Message
+	InputAction        = driver.InputAction
+	ClaudeConfig       = driver.ClaudeConfig
+	BashDriver         = driver.BashDriver
+	Registry           = driver.Registry
+	Matcher            = driver.Matcher
+	Factory            = driver.Factory
+	Pipeline           = driver.Pipeline
+	AutoRespondRule    = driver.AutoRespondRule
+	PatternDriver      = driver.PatternDriver
+	PatternConfig      = driver.PatternConfig
+	PatternRule        = driver.PatternRule
 )
 
 // Re-export key constants
@@ -39,6 +50,15 @@ func NewClaudeDriver() *ClaudeDriver {
 	}
 }
 
+// NewClaudeDriverWithConfig creates a new Claude driver with custom action recognition.
+func NewClaudeDriverWithConfig(cfg ClaudeConfig) (*ClaudeDriver, error) {
+	d, err := driver.NewClaudeDriverWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ClaudeDriver{ClaudeDriver: d}, nil
+}
+
 // Flush returns any pending buffered output as messages.
 // Call this when the session ends to get remaining content.
 func (d *ClaudeDriver) Flush() []Message {
@@ -70,7 +90,72 @@ func (d *ClaudeDriver) SelectMenuItem(index int) []byte {
 	return d.ClaudeDriver.SelectMenuItem(index)
 }
 
+// NewSafeAutoResponder returns conservative rules for ClaudeDriver.AutoRespondRules.
+func NewSafeAutoResponder() []AutoRespondRule {
+	return driver.NewSafeAutoResponder()
+}
+
+// NewGeminiDriver creates a new gemini CLI driver instance.
+func NewGeminiDriver() AgentDriver {
+	return driver.NewGeminiDriver()
+}
+
+// NewBashDriver creates a new shell driver instance.
+func NewBashDriver() *BashDriver {
+	return driver.NewBashDriver()
+}
+
 // NewGenericDriver creates a new generic driver instance.
 func NewGenericDriver() AgentDriver {
 	return driver.NewGenericDriver()
 }
+
+// NewPatternDriver creates a driver configured by regexp rules.
+func NewPatternDriver(cfg PatternConfig) (*PatternDriver, error) {
+	return driver.NewPatternDriver(cfg)
+}
+
+// LoadPatternConfig reads a PatternConfig from a .json, .yaml or .yml file.
+func LoadPatternConfig(path string) (PatternConfig, error) {
+	return driver.LoadPatternConfig(path)
+}
+
+// RegisterPattern registers a PatternDriver for cfg in the default registry.
+func RegisterPattern(cfg PatternConfig) error {
+	return driver.RegisterPattern(cfg)
+}
+
+// NewPipeline creates a driver that passes output through drivers in order.
+func NewPipeline(drivers ...AgentDriver) AgentDriver {
+	return driver.NewPipeline(drivers...)
+}
+
+// NewRegistry creates an empty driver registry.
+func NewRegistry() *Registry {
+	return driver.NewRegistry()
+}
+
+// DefaultRegistry returns the process-wide driver registry.
+func DefaultRegistry() *Registry {
+	return driver.DefaultRegistry()
+}
+
+// Register adds a driver factory to the default registry.
+func Register(name string, matcher Matcher, factory Factory) {
+	driver.Register(name, matcher, factory)
+}
+
+// ResolveDriver returns a driver for the command using the default registry.
+func ResolveDriver(command string) AgentDriver {
+	return driver.ResolveDriver(command)
+}
+
+// CommandContains returns a Matcher that accepts commands containing substr.
+func CommandContains(substr string) Matcher {
+	return driver.CommandContains(substr)
+}
+
+// CommandName returns a Matcher that accepts commands whose program is one of names.
+func CommandName(names ...string) Matcher {
+	return driver.CommandName(names...)
+}
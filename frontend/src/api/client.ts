@@ -7,16 +7,20 @@
  * Requirements: 1.1, 2.1, 2.2, 2.3, 8.1
  */
 
-import type { Session, CreateSessionRequest, ApiError } from '../types';
+import type { Session, CreateSessionRequest, UpdateSessionRequest, ApiError } from '../types';
 
 // Storage key for auth token
 const AUTH_TOKEN_KEY = 'remote_terminal_auth_token';
 
 /**
- * API response wrapper for session list
+ * API response wrapper for a page of the session list
  */
 export interface SessionListResponse {
   sessions: Session[];
+  total: number;
+  // Pass as ?cursor= to fetch the next page; absent on the last page
+  nextCursor?: string;
+  nextOffset?: number;
 }
 
 /**
@@ -212,16 +216,22 @@ export class ApiClient {
    * Requirement 2.1: Return all sessions with ID, name, status, preview, duration
    */
   async listSessions(): Promise<Session[]> {
-    const response = await this.request<SessionListResponse | Session[]>(
-      'GET',
-      '/api/sessions'
-    );
-    
-    // Handle both { sessions: [...] } and [...] response formats
-    if (Array.isArray(response)) {
-      return response;
-    }
-    return response.sessions || [];
+    const sessions: Session[] = [];
+    let cursor: string | undefined;
+    do {
+      const path = cursor
+        ? `/api/sessions?cursor=${encodeURIComponent(cursor)}`
+        : '/api/sessions';
+      const response = await this.request<SessionListResponse | Session[]>('GET', path);
+
+      // Handle both { sessions: [...] } and [...] response formats
+      if (Array.isArray(response)) {
+        return response;
+      }
+      sessions.push(...(response.sessions || []));
+      cursor = response.nextCursor;
+    } while (cursor);
+    return sessions;
   }
 
   /**
@@ -233,6 +243,13 @@ export class ApiClient {
     return this.request<Session>('GET', `/api/sessions/${id}`);
   }
 
+  /**
+   * Rename a session or replace its tags
+   */
+  async updateSession(id: string, request: UpdateSessionRequest): Promise<Session> {
+    return this.request<Session>('PATCH', `/api/sessions/${id}`, request);
+  }
+
   /**
    * Delete a session
    * 
@@ -328,6 +345,13 @@ export async function getSession(id: string): Promise<Session> {
   return apiClient.getSession(id);
 }
 
+/**
+ * Rename a session or replace its tags
+ */
+export async function updateSession(id: string, request: UpdateSessionRequest): Promise<Session> {
+  return apiClient.updateSession(id, request);
+}
+
 /**
  * Delete a session
  */
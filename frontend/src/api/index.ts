@@ -9,6 +9,7 @@ export {
   createSession,
   listSessions,
   getSession,
+  updateSession,
   deleteSession,
   downloadSessionLogs,
   getWebSocketUrl,
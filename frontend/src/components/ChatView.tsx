@@ -349,10 +349,12 @@ interface SmartEventBannerProps {
 }
 
 function SmartEventBanner({ event, onAction, onDismiss }: SmartEventBannerProps) {
+  const isConfirm = event.kind === 'claude_confirm' || event.kind === 'gemini_confirm';
+
   const handleOptionClick = (option: string) => {
     let input: string;
     
-    if (event.kind === 'claude_confirm') {
+    if (isConfirm) {
       switch (option.toLowerCase()) {
         case '1':
         case 'yes':
@@ -397,11 +399,23 @@ function SmartEventBanner({ event, onAction, onDismiss }: SmartEventBannerProps)
           return option;
       }
     }
+    if (event.kind === 'gemini_confirm') {
+      switch (option.toLowerCase()) {
+        case '1':
+          return 'Allow once';
+        case '2':
+          return 'Allow always';
+        case 'esc':
+          return 'No';
+        default:
+          return option;
+      }
+    }
     return option;
   };
 
   const getOptionStyle = (option: string) => {
-    if (event.kind === 'claude_confirm') {
+    if (isConfirm) {
       switch (option.toLowerCase()) {
         case '1':
           return 'bg-green-600 hover:bg-green-500';
@@ -429,7 +443,7 @@ function SmartEventBanner({ event, onAction, onDismiss }: SmartEventBannerProps)
           <span className="text-yellow-400 text-xl">❓</span>
           <div className="flex-1 min-w-0">
             <div className="text-sm font-medium text-yellow-300 mb-1">
-              {event.kind === 'claude_confirm' ? 'Claude needs confirmation' : 'Question'}
+              {event.kind === 'claude_confirm' ? 'Claude needs confirmation' : event.kind === 'gemini_confirm' ? 'Gemini needs confirmation' : 'Question'}
             </div>
             <div className="text-gray-200 text-sm">
               {event.prompt || 'Waiting for your response...'}
@@ -444,7 +458,7 @@ function SmartEventBanner({ event, onAction, onDismiss }: SmartEventBannerProps)
               onClick={() => handleOptionClick(option)}
               className={`px-4 py-2 rounded-lg text-white font-medium transition-colors ${getOptionStyle(option)}`}
             >
-              {event.kind === 'claude_confirm' && (
+              {isConfirm && (
                 <span className="text-xs opacity-75 mr-1">{option}</span>
               )}
               {getOptionLabel(option)}
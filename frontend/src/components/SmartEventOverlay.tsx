@@ -15,8 +15,8 @@ export function SmartEventOverlay({ event, onAction, onDismiss }: SmartEventOver
     // Send the appropriate input based on the event kind and option
     let input: string;
     
-    if (event.kind === 'claude_confirm') {
-      // Claude Code confirmation menu: 1=Yes, 2=Yes allow all, esc=Cancel
+    if (event.kind === 'claude_confirm' || event.kind === 'gemini_confirm') {
+      // Confirmation menus: 1=Yes (once), 2=Yes allow all (always), esc=Cancel
       switch (option.toLowerCase()) {
         case '1':
         case 'yes':
@@ -62,8 +62,11 @@ export function SmartEventOverlay({ event, onAction, onDismiss }: SmartEventOver
           />
         );
       case 'claude_confirm':
+      case 'gemini_confirm':
         return (
-          <ClaudeConfirmOverlay
+          <ConfirmOverlay
+            title={CONFIRM_MENUS[event.kind].title}
+            labels={CONFIRM_MENUS[event.kind].labels}
             prompt={event.prompt}
             options={event.options}
             onOptionClick={handleOptionClick}
@@ -97,27 +100,29 @@ export function SmartEventOverlay({ event, onAction, onDismiss }: SmartEventOver
   );
 }
 
-interface ClaudeConfirmOverlayProps {
+// Titles and option labels of the agents' confirmation menus
+const CONFIRM_MENUS = {
+  claude_confirm: {
+    title: 'Claude Code',
+    labels: { '1': 'Yes', '2': 'Yes, allow all', esc: 'Cancel' } as Record<string, string>,
+  },
+  gemini_confirm: {
+    title: 'Gemini',
+    labels: { '1': 'Allow once', '2': 'Allow always', esc: 'No' } as Record<string, string>,
+  },
+};
+
+interface ConfirmOverlayProps {
+  title: string;
+  labels: Record<string, string>;
   prompt?: string;
   options?: string[];
   onOptionClick: (option: string) => void;
   onDismiss?: () => void;
 }
 
-function ClaudeConfirmOverlay({ prompt, options = [], onOptionClick, onDismiss }: ClaudeConfirmOverlayProps) {
-  // Claude Code confirmation menu: 1=Yes, 2=Yes allow all, Esc=Cancel
-  const getOptionLabel = (option: string) => {
-    switch (option.toLowerCase()) {
-      case '1':
-        return 'Yes';
-      case '2':
-        return 'Yes, allow all';
-      case 'esc':
-        return 'Cancel';
-      default:
-        return option;
-    }
-  };
+function ConfirmOverlay({ title, labels, prompt, options = [], onOptionClick, onDismiss }: ConfirmOverlayProps) {
+  const getOptionLabel = (option: string) => labels[option.toLowerCase()] ?? option;
 
   const getOptionStyle = (option: string) => {
     switch (option.toLowerCase()) {
@@ -138,7 +143,7 @@ function ClaudeConfirmOverlay({ prompt, options = [], onOptionClick, onDismiss }
         <div className="flex items-center gap-3 flex-1 min-w-0">
           <span className="text-purple-400 text-lg flex-shrink-0">🤖</span>
           <div className="flex-1 min-w-0">
-            <div className="text-xs text-purple-300 font-medium mb-0.5">Claude Code</div>
+            <div className="text-xs text-purple-300 font-medium mb-0.5">{title}</div>
             <div className="text-gray-200 text-sm truncate" title={prompt}>
               {prompt || 'Waiting for confirmation...'}
             </div>
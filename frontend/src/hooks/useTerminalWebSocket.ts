@@ -1,6 +1,32 @@
 import { useState, useEffect, useRef, useCallback } from 'react';
 import { getWebSocketUrl } from '../api/client';
-import type { WSMessage, SmartEvent, ConversationMessage } from '../types';
+import type { WSMessage, WSErrorCode, SmartEvent, ConversationMessage } from '../types';
+
+// Largest stdin message the server accepts, in UTF-8 bytes
+const MAX_STDIN_BYTES = 4096;
+
+// Splits data into chunks of at most MAX_STDIN_BYTES UTF-8 bytes, without
+// splitting a character
+function splitStdin(data: string): string[] {
+  const chunks: string[] = [];
+  let chunk = '';
+  let bytes = 0;
+  for (const ch of data) {
+    const cp = ch.codePointAt(0) ?? 0;
+    const size = cp < 0x80 ? 1 : cp < 0x800 ? 2 : cp < 0x10000 ? 3 : 4;
+    if (bytes + size > MAX_STDIN_BYTES) {
+      chunks.push(chunk);
+      chunk = '';
+      bytes = 0;
+    }
+    chunk += ch;
+    bytes += size;
+  }
+  if (chunk || chunks.length === 0) {
+    chunks.push(chunk);
+  }
+  return chunks;
+}
 
 export interface UseTerminalWebSocketOptions {
   sessionId: string;
@@ -16,9 +42,14 @@ export interface UseTerminalWebSocketReturn {
   error: string | null;
   reconnectAttempts: number;
   send: (msg: WSMessage) => void;
-  sendStdin: (data: string) => void;
-  sendCommand: (data: string) => void;
+  // With an id, the server answers with an ack once the input is written.
+  // Input over 4KB is sent in several messages; the last carries the id.
+  sendStdin: (data: string, id?: string) => void;
+  sendCommand: (data: string, id?: string) => void;
   sendResize: (rows: number, cols: number) => void;
+  // Take or give up the input lock; other clients' input is dropped while it is held
+  requestControl: () => void;
+  releaseControl: () => void;
   disconnect: () => void;
   reconnect: () => void;
 }
@@ -26,12 +57,22 @@ export interface UseTerminalWebSocketReturn {
 export interface TerminalWebSocketCallbacks {
   onStdout?: (data: string) => void;
   onHistory?: (data: string) => void;
+  // mode is 'full' when the terminal should be reset before the history,
+  // or 'incremental' when only missed output was resent
+  onHistoryEnd?: (bytes: number, mode: 'full' | 'incremental') => void;
+  onResize?: (rows: number, cols: number) => void;
   onSmartEvent?: (event: SmartEvent) => void;
   onStatus?: (state: string, code?: number) => void;
+  // controllerId is null when no client holds the input lock
+  onControl?: (controllerId: string | null, isSelf: boolean) => void;
+  onAlert?: (alert: string, message: string) => void;
   onConversation?: (message: ConversationMessage) => void;
   onConnect?: () => void;
   onDisconnect?: () => void;
-  onError?: (error: string) => void;
+  // code is set for errors reported by the server, not connection errors
+  onError?: (error: string, code?: WSErrorCode) => void;
+  // Answers a stdin or command message sent with an id
+  onAck?: (id: string, delivered: boolean, code?: WSErrorCode) => void;
 }
 
 export function useTerminalWebSocket(
@@ -56,6 +97,10 @@ export function useTerminalWebSocket(
   const reconnectTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null);
   const shouldReconnectRef = useRef(true);
   const callbacksRef = useRef(callbacks);
+  // Sequence number of the last message received, to resume from on reconnect
+  const lastSeqRef = useRef(0);
+  // ID of this client, learned when it is granted the input lock
+  const clientIdRef = useRef<string | null>(null);
 
   // Update callbacks ref when callbacks change
   useEffect(() => {
@@ -92,6 +137,9 @@ export function useTerminalWebSocket(
   const handleMessage = useCallback((event: MessageEvent) => {
     try {
       const msg: WSMessage = JSON.parse(event.data);
+      if (msg.seq && msg.seq > lastSeqRef.current) {
+        lastSeqRef.current = msg.seq;
+      }
       
       // Debug: log all messages
       if (msg.type === 'conversation') {
@@ -105,20 +153,66 @@ export function useTerminalWebSocket(
         case 'history':
           callbacksRef.current.onHistory?.(msg.data || '');
           break;
+        case 'history_end':
+          // History arrives in chunks; this marks the restore as complete
+          {
+            const end = msg.payload as { bytes?: number; mode?: string } | undefined;
+            callbacksRef.current.onHistoryEnd?.(
+              end?.bytes ?? 0,
+              end?.mode === 'incremental' ? 'incremental' : 'full'
+            );
+          }
+          break;
+        case 'resize':
+          // Another client resized the terminal, or the initial size on connect
+          if (msg.rows && msg.cols) {
+            callbacksRef.current.onResize?.(msg.rows, msg.cols);
+          }
+          break;
         case 'smart_event':
           if (msg.payload && 'kind' in msg.payload) {
             callbacksRef.current.onSmartEvent?.(msg.payload as SmartEvent);
           }
           break;
         case 'status':
+          if (msg.state === 'control') {
+            const controllerId = msg.data || null;
+            callbacksRef.current.onControl?.(
+              controllerId,
+              controllerId !== null && controllerId === clientIdRef.current
+            );
+            break;
+          }
+          if (msg.state === 'idle_disconnect') {
+            // Closed for inactivity; reconnecting would only idle again
+            shouldReconnectRef.current = false;
+          }
           callbacksRef.current.onStatus?.(msg.state || '', msg.code);
           break;
+        case 'control_grant':
+          clientIdRef.current = msg.data || null;
+          break;
+        case 'control_release':
+          // Lost the input lock; the control status names the new holder
+          break;
+        case 'alert':
+          // e.g. 'watchdog' when the process has stopped producing output
+          callbacksRef.current.onAlert?.(msg.state || '', msg.data || '');
+          break;
         case 'conversation':
           if (msg.payload && 'timestamp' in msg.payload) {
             console.log('Calling onConversation with:', msg.payload);
             callbacksRef.current.onConversation?.(msg.payload as ConversationMessage);
           }
           break;
+        case 'error':
+          callbacksRef.current.onError?.(msg.error || '', msg.errorCode);
+          break;
+        case 'ack':
+          if (msg.id) {
+            callbacksRef.current.onAck?.(msg.id, msg.state === 'delivered', msg.errorCode);
+          }
+          break;
         case 'pong':
           // Heartbeat response, no action needed
           break;
@@ -140,12 +234,18 @@ export function useTerminalWebSocket(
     setError(null);
 
     // Use API client to get WebSocket URL with auth token
-    const wsUrl = baseUrl 
+    let wsUrl = baseUrl 
       ? `${baseUrl}/api/sessions/${sessionId}/attach`
       : getWebSocketUrl(sessionId);
+    // Only fetch the output missed since the last message on reconnect
+    if (lastSeqRef.current > 0) {
+      wsUrl += `${wsUrl.includes('?') ? '&' : '?'}since_seq=${lastSeqRef.current}`;
+    }
     const ws = new WebSocket(wsUrl);
 
     ws.onopen = () => {
+      // Each connection is a new client with a new ID
+      clientIdRef.current = null;
       setConnected(true);
       setConnecting(false);
       setReconnectAttempts(0);
@@ -219,14 +319,19 @@ export function useTerminalWebSocket(
     }
   }, []);
 
-  // Send stdin data (for Terminal view - real-time input)
-  const sendStdin = useCallback((data: string) => {
-    send({ type: 'stdin', data });
+  // Send stdin data (for Terminal view - real-time input). Large pastes are
+  // split, as the server rejects stdin messages over 4KB; it writes them in
+  // order, so the ack of the last chunk covers the whole input.
+  const sendStdin = useCallback((data: string, id?: string) => {
+    const chunks = splitStdin(data);
+    chunks.forEach((chunk, i) => {
+      send({ type: 'stdin', data: chunk, id: i === chunks.length - 1 ? id : undefined });
+    });
   }, [send]);
 
   // Send command (for Chat view - complete commands with input clearing)
-  const sendCommand = useCallback((data: string) => {
-    send({ type: 'command', data });
+  const sendCommand = useCallback((data: string, id?: string) => {
+    send({ type: 'command', data, id });
   }, [send]);
 
   // Send resize event
@@ -234,9 +339,20 @@ export function useTerminalWebSocket(
     send({ type: 'resize', rows, cols });
   }, [send]);
 
+  // Take the input lock
+  const requestControl = useCallback(() => {
+    send({ type: 'control_request' });
+  }, [send]);
+
+  // Give up the input lock
+  const releaseControl = useCallback(() => {
+    send({ type: 'control_release' });
+  }, [send]);
+
   // Connect on mount, disconnect on unmount
   useEffect(() => {
     shouldReconnectRef.current = true;
+    lastSeqRef.current = 0;
     connect();
 
     return () => {
@@ -259,6 +375,8 @@ export function useTerminalWebSocket(
     sendStdin,
     sendCommand,
     sendResize,
+    requestControl,
+    releaseControl,
     disconnect,
     reconnect,
   };
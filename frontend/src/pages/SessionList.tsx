@@ -31,12 +31,14 @@ function StatusBadge({ status }: { status: Session['status'] }) {
     running: 'bg-green-500/20 text-green-400 border-green-500/30',
     exited: 'bg-gray-500/20 text-gray-400 border-gray-500/30',
     failed: 'bg-red-500/20 text-red-400 border-red-500/30',
+    expired: 'bg-yellow-500/20 text-yellow-400 border-yellow-500/30',
   };
 
   const icons = {
     running: '●',
     exited: '○',
     failed: '✕',
+    expired: '⌛',
   };
 
   return (
@@ -5,7 +5,7 @@ import { SmartEventOverlay } from '../components/SmartEventOverlay';
 import { ChatView } from '../components/ChatView';
 import { useTerminalWebSocket } from '../hooks/useTerminalWebSocket';
 import { getSession } from '../api/client';
-import type { SmartEvent, Session, ConversationMessage } from '../types';
+import type { SmartEvent, Session, ConversationMessage, WSErrorCode } from '../types';
 
 export interface TerminalPageProps {
   sessionId?: string;
@@ -173,10 +173,13 @@ export function TerminalPage({ sessionId: propSessionId }: TerminalPageProps) {
     }, 500);
   }, [fetchSessionData]);
 
-  const handleError = useCallback((error: string) => {
-    console.log('WebSocket error:', error);
+  const handleError = useCallback((error: string, code?: WSErrorCode) => {
+    console.log('WebSocket error:', error, code);
     // If we get connection errors, the process might have exited
-    // Fetch session status to check
+    // Fetch session status to check; other server errors leave it unchanged
+    if (code && code !== 'PROCESS_EXITED') {
+      return;
+    }
     setTimeout(() => {
       fetchSessionData();
     }, 500);
@@ -6,19 +6,24 @@ export interface Session {
   command: string;
   workdir?: string;
   env?: Record<string, string>;
-  status: 'running' | 'exited' | 'failed';
+  status: 'running' | 'exited' | 'failed' | 'expired';
   exitCode?: number;
   pid?: number;
   logFilePath: string;
+  tags?: string[];
   createdAt: string;
   updatedAt: string;
 }
 
 // SmartEvent types
 export interface SmartEvent {
-  kind: 'question' | 'idle' | 'progress' | 'claude_confirm';
+  // Unique per event; a prompt detected again keeps its first event's ID
+  id?: string;
+  kind: 'question' | 'idle' | 'busy' | 'progress' | 'claude_confirm' | 'gemini_confirm' | 'usage';
   options?: string[];
   prompt?: string;
+  // For 'usage': cost_usd, input_tokens, output_tokens (session totals)
+  data?: Record<string, string>;
 }
 
 // WebSocket message types
@@ -28,17 +33,48 @@ export type WSMessageType =
   | 'stdout' 
   | 'resize' 
   | 'ping' 
+  | 'event_response'
+  | 'input_action'
+  | 'dismiss'
+  | 'dismissed'
+  | 'alert'
   | 'pong' 
   | 'smart_event' 
+  | 'smart_event_resolved'
   | 'status' 
   | 'history'
-  | 'conversation';
+  | 'history_end'
+  | 'control_request'
+  | 'control_grant'
+  | 'control_release'
+  | 'error'
+  | 'ack'
+  | 'marker'
+  | 'conversation'
+  | 'conversation_history'
+  | 'session_created'
+  | 'session_status'
+  | 'session_deleted';
+
+// Codes of 'error' messages, so errors can be handled without matching text
+export type WSErrorCode =
+  | 'READ_ONLY'
+  | 'INVALID_EVENT_RESPONSE'
+  | 'INVALID_INPUT_ACTION'
+  | 'INVALID_MESSAGE'
+  | 'PROCESS_EXITED'
+  | 'PTY_WRITE_FAILED'
+  | 'RESIZE_FAILED'
+  | 'OUTPUT_DROPPED'
+  | 'MARKER_FAILED';
 
 // Conversation message from driver parsing
 export interface ConversationMessage {
   timestamp: string;
-  type: 'user_input' | 'claude_response' | 'claude_action' | 'action_result' | 'command_output' | 'agent_interrupted' | 'session_resumed';
+  type: 'user_input' | 'claude_response' | 'claude_action' | 'action_result' | 'command_output' | 'agent_interrupted' | 'session_resumed' | 'usage_summary';
   content: string;
+  // Parsed values; usage_summary has cost_usd and, if reported, input_tokens and output_tokens
+  metadata?: Record<string, number>;
 }
 
 export interface WSMessage {
@@ -49,6 +85,11 @@ export interface WSMessage {
   payload?: SmartEvent | ConversationMessage;
   state?: string;
   code?: number;
+  error?: string;
+  errorCode?: WSErrorCode;
+  seq?: number;
+  // Set on stdin and command messages to be acknowledged, and echoed in the ack
+  id?: string;
 }
 
 // Client -> Server messages
@@ -72,6 +113,32 @@ export interface PingMessage {
   type: 'ping';
 }
 
+// Answers a SmartEvent, e.g. { kind: 'claude_confirm', response: 'all' }
+export interface EventResponseMessage {
+  type: 'event_response';
+  payload: {
+    // ID of the answered event; without it every pending event of the kind is answered
+    id?: string;
+    kind: string;
+    response: string;
+    options?: string[];
+  };
+}
+
+// Sends a named input, e.g. { type: 'key', content: 'ctrl+c' }
+export interface InputActionMessage {
+  type: 'input_action';
+  payload: {
+    type: 'text' | 'command' | 'key' | 'confirm' | 'cancel' | 'interrupt';
+    content?: string;
+  };
+}
+
+// Dismisses interactive output by pressing Enter; all clients receive 'dismissed'
+export interface DismissMessage {
+  type: 'dismiss';
+}
+
 // Server -> Client messages
 export interface StdoutMessage {
   type: 'stdout';
@@ -83,10 +150,35 @@ export interface SmartEventMessage {
   payload: SmartEvent;
 }
 
+// Sent when a question or confirm event no longer waits for an answer, so
+// clients can close its dialog
+export interface SmartEventResolvedMessage {
+  type: 'smart_event_resolved';
+  payload: { id: string; reason: 'answered' | 'expired' };
+}
+
+// The first message after attaching is a status snapshot carrying the
+// terminal size and payload.name/pid as well
 export interface StatusMessage {
   type: 'status';
   state: string;
   code?: number;
+  rows?: number;
+  cols?: number;
+  payload?: { name?: string; pid?: number };
+}
+
+// Sent on the session feed (/api/ws/sessions) when one of the user's
+// sessions is created, changes status or is deleted. session is omitted
+// for session_deleted.
+export interface SessionFeedMessage {
+  type: 'session_created' | 'session_status' | 'session_deleted';
+  payload: {
+    sessionId: string;
+    session?: Session;
+    status?: Session['status'];
+    exitCode?: number;
+  };
 }
 
 export interface HistoryMessage {
@@ -94,6 +186,14 @@ export interface HistoryMessage {
   data: string;
 }
 
+// Sent once the history restore is complete; payload.bytes is the total
+// history size and seq the latest output sequence number
+export interface HistoryEndMessage {
+  type: 'history_end';
+  payload: { bytes: number; mode: 'full' | 'incremental' };
+  seq?: number;
+}
+
 export interface PongMessage {
   type: 'pong';
 }
@@ -103,12 +203,27 @@ export interface ConversationWSMessage {
   payload: ConversationMessage;
 }
 
+// Sent after history_end to clients subscribed to conversation messages, if
+// the session has any; replaces the messages shown before a reconnect
+export interface ConversationHistoryMessage {
+  type: 'conversation_history';
+  payload: ConversationMessage[];
+}
+
 // API request/response types
 export interface CreateSessionRequest {
   command: string;
   name: string;
   workdir?: string;
   env?: Record<string, string>;
+  // Lifetime in nanoseconds before the session is terminated; omit for no limit
+  maxDuration?: number;
+}
+
+// Omitted fields are left unchanged; tags replaces all tags
+export interface UpdateSessionRequest {
+  name?: string;
+  tags?: string[];
 }
 
 export interface ApiError {
@@ -10,6 +10,12 @@ export default defineConfig({
         target: 'http://localhost:8080',
         changeOrigin: true,
         ws: true, // 支持 WebSocket 代理
+        // The backend only accepts same-origin WebSocket upgrades by default
+        configure: (proxy) => {
+          proxy.on('proxyReqWs', (proxyReq) => {
+            proxyReq.setHeader('origin', 'http://localhost:8080');
+          });
+        },
       },
     },
   },
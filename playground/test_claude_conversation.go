@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -351,7 +352,7 @@ func main() {
 			outputBuffer.Write(data)
 
 			// Parse with ClaudeDriver
-			result, _ := claudeDriver.Parse(data)
+			result, _ := claudeDriver.Parse(context.Background(), data)
 
 			// Log smart events (deduplicated)
 			if len(result.SmartEvents) > 0 {
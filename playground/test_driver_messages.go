@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -87,7 +88,7 @@ func main() {
 			os.Stdout.Write(data)
 
 			// Parse with ClaudeDriver
-			result, _ := claudeDriver.Parse(data)
+			result, _ := claudeDriver.Parse(context.Background(), data)
 
 			// Log smart events
 			if len(result.SmartEvents) > 0 {